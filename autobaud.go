@@ -0,0 +1,116 @@
+package goserial
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// CommonBauds are the rates DetectBaud tries when given none, fastest
+// first.
+var CommonBauds = []int{115200, 57600, 38400, 19200, 9600, 4800, 2400, 1200}
+
+// DetectBaud opens the port described by c and tries each candidate
+// baud rate in turn, returning the first one for which probe reports
+// success.  The port stays open between attempts and only its baud rate
+// changes, so the modem lines are not disturbed.  Before each probe both
+// buffers are flushed, as far as the driver can, and the read timeout
+// is set to perTry.  The port is closed before DetectBaud returns.
+//
+// A probe typically writes a command the device is known to answer and
+// checks the reply; ExpectBytes makes a probe for devices that talk
+// without being asked, and CleanTraffic one that goes by the line
+// errors the driver counts.  With no candidates DetectBaud tries
+// CommonBauds.
+func DetectBaud(c *Config, candidates []int, probe func(p *Port) bool, perTry time.Duration) (int, error) {
+	if len(candidates) == 0 {
+		candidates = CommonBauds
+	}
+
+	cc := *c
+	cc.Baud = candidates[0]
+	p, err := OpenPort(&cc)
+	if err != nil {
+		return 0, err
+	}
+	defer p.Close()
+
+	if err := p.SetReadTimeout(perTry); err != nil {
+		return 0, err
+	}
+	for _, baud := range candidates {
+		if err := p.SetBaud(baud); err != nil {
+			continue
+		}
+		if err := discardBoth(p); err != nil {
+			return 0, err
+		}
+		if probe(p) {
+			return baud, nil
+		}
+	}
+	return 0, fmt.Errorf("goserial: no baud rate detected, tried %v", candidates)
+}
+
+// discardBoth flushes both of p's buffers, as far as its driver can: a
+// buffer it cannot discard is taken to have nothing stale in it.
+func discardBoth(p *Port) error {
+	for _, in := range []bool{true, false} {
+		if err := p.flush(in, !in); err != nil && err != ErrUnsupported {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpectBytes returns a probe for DetectBaud that sends nothing and
+// succeeds if pattern is received within window.
+func ExpectBytes(pattern []byte, window time.Duration) func(p *Port) bool {
+	return func(p *Port) bool {
+		deadline := time.Now().Add(window)
+		var seen []byte
+		buf := make([]byte, 256)
+		for time.Now().Before(deadline) {
+			n, err := p.Read(buf)
+			seen = append(seen, buf[:n]...)
+			if bytes.Contains(seen, pattern) {
+				return true
+			}
+			// Only a partial match at the end can still complete.
+			if keep := len(pattern) - 1; len(seen) > keep {
+				seen = append(seen[:0], seen[len(seen)-keep:]...)
+			}
+			if err != nil && err != ErrTimeout {
+				return false
+			}
+		}
+		return false
+	}
+}
+
+// CleanTraffic returns a probe for DetectBaud that sends nothing and
+// succeeds if at least minBytes arrive within window without a framing
+// error, parity error or break, which a device talking at another rate
+// soon causes.  It needs a driver that counts line errors, see
+// PortStats; on one that does not, every rate at which the device is
+// heard passes, and ExpectBytes or a probe of one's own is the better
+// choice.
+func CleanTraffic(minBytes int, window time.Duration) func(p *Port) bool {
+	return func(p *Port) bool {
+		before := p.Stats()
+		got := 0
+		buf := make([]byte, 256)
+		for deadline := time.Now().Add(window); got < minBytes && time.Now().Before(deadline); {
+			n, err := p.Read(buf)
+			got += n
+			if err != nil && err != ErrTimeout {
+				return false
+			}
+		}
+		after := p.Stats()
+		return got >= minBytes &&
+			after.FramingErrors == before.FramingErrors &&
+			after.ParityErrors == before.ParityErrors &&
+			after.Breaks == before.Breaks
+	}
+}
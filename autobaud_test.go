@@ -0,0 +1,100 @@
+package goserial
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// talker is a Driver for a device that says hello at 19200 baud, and is
+// not heard at other rates.  It cannot reset its buffers, which
+// DetectBaud has to get by without.
+type talker struct {
+	mu      sync.Mutex
+	baud    int
+	timeout time.Duration
+}
+
+func (t *talker) Read(b []byte) (int, error) {
+	t.mu.Lock()
+	baud, timeout := t.baud, t.timeout
+	t.mu.Unlock()
+	if baud != 19200 {
+		time.Sleep(timeout)
+		return 0, ErrTimeout
+	}
+	return copy(b, "hello"), nil
+}
+
+func (t *talker) Write(b []byte) (int, error) { return len(b), nil }
+func (t *talker) Close() error                { return nil }
+
+func (t *talker) SetReadTimeout(d time.Duration) error {
+	t.mu.Lock()
+	t.timeout = d
+	t.mu.Unlock()
+	return nil
+}
+
+func (t *talker) SetBaud(baud int) error {
+	t.mu.Lock()
+	t.baud = baud
+	t.mu.Unlock()
+	return nil
+}
+
+func TestDetectBaud(t *testing.T) {
+	registerTestDriver("testbaud", func(name string, c *Config) (Driver, error) {
+		return &talker{baud: c.Baud}, nil
+	})
+	c := &Config{Name: "testbaud://x", Baud: 9600}
+	baud, err := DetectBaud(c, nil, ExpectBytes([]byte("hello"), 20*time.Millisecond), 5*time.Millisecond)
+	if baud != 19200 || err != nil {
+		t.Errorf("DetectBaud = %d, %v; want 19200", baud, err)
+	}
+	if _, err := DetectBaud(c, []int{9600, 4800}, ExpectBytes([]byte("hello"), 20*time.Millisecond), 5*time.Millisecond); err == nil {
+		t.Error("DetectBaud found a rate the device does not talk at")
+	}
+}
+
+// noisyPipe is a pipe end that counts each NUL it reads as a framing
+// error, as a UART at the wrong rate would find one.
+type noisyPipe struct {
+	*pipeEnd
+	framing uint32
+}
+
+func (n *noisyPipe) Read(b []byte) (int, error) {
+	k, err := n.pipeEnd.Read(b)
+	for _, c := range b[:k] {
+		if c == 0 {
+			atomic.AddUint32(&n.framing, 1)
+		}
+	}
+	return k, err
+}
+
+func (n *noisyPipe) lineCounts() (lineCounts, error) {
+	return lineCounts{framing: atomic.LoadUint32(&n.framing)}, nil
+}
+
+func TestCleanTraffic(t *testing.T) {
+	p, peer := Pipe()
+	defer peer.Close()
+	p.d = &noisyPipe{pipeEnd: p.d.(*pipeEnd)}
+	p.SetReadTimeout(5 * time.Millisecond)
+	probe := CleanTraffic(4, 50*time.Millisecond)
+
+	peer.Write([]byte("ok\r\n"))
+	if !probe(p) {
+		t.Error("CleanTraffic failed on clean data")
+	}
+	if probe(p) {
+		t.Error("CleanTraffic passed with nothing received")
+	}
+	peer.Write([]byte("\xf0\x00\x80\x00"))
+	if probe(p) {
+		t.Error("CleanTraffic passed despite framing errors")
+	}
+}
@@ -0,0 +1,125 @@
+package goserial
+
+import (
+	"fmt"
+	"io"
+	"testing"
+	"time"
+)
+
+// benchSizes are the transfer sizes every backend is measured at.
+var benchSizes = []int{1, 64, 4096}
+
+// benchBackend runs the transfer benchmarks over the pairs made by open:
+// a Port and the other end of whatever it is connected to.
+func benchBackend(b *testing.B, open func(testing.TB) (*Port, io.ReadWriter)) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("Write/%d", size), func(b *testing.B) {
+			p, peer := open(b)
+			go io.Copy(io.Discard, peer)
+			buf := make([]byte, size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := p.Write(buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("Read/%d", size), func(b *testing.B) {
+			p, peer := open(b)
+			go feed(peer, size, b.N)
+			buf := make([]byte, size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for total := 0; total < b.N*size; {
+				n, err := p.Read(buf)
+				if err != nil {
+					b.Fatal(err)
+				}
+				total += n
+			}
+		})
+		b.Run(fmt.Sprintf("ReadFull/%d", size), func(b *testing.B) {
+			p, peer := open(b)
+			go feed(peer, size, b.N)
+			buf := make([]byte, size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := io.ReadFull(p, buf); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("Copy/%d", size), func(b *testing.B) {
+			p, peer := open(b)
+			go feed(peer, size, b.N)
+			buf := make([]byte, size)
+			b.SetBytes(int64(size))
+			b.ReportAllocs()
+			b.ResetTimer()
+			want := int64(b.N * size)
+			if n, err := io.CopyBuffer(io.Discard, io.LimitReader(p, want), buf); n != want {
+				b.Fatal(n, err)
+			}
+		})
+	}
+}
+
+// feed writes n chunks of size bytes to w, stopping at the first error.
+func feed(w io.Writer, size, n int) {
+	buf := make([]byte, size)
+	for i := 0; i < n; i++ {
+		if _, err := w.Write(buf); err != nil {
+			return
+		}
+	}
+}
+
+// testHotPathAllocs checks that a Write of 64 bytes, and the Reads that
+// take them at the other end, allocate nothing once running.
+func testHotPathAllocs(t *testing.T, p *Port, peer io.ReadWriter) {
+	wbuf, rbuf := make([]byte, 64), make([]byte, 64)
+	for _, tc := range []struct {
+		name string
+		w    io.Writer
+		r    io.Reader
+	}{
+		{"Write", p, peer},
+		{"Read", peer, p},
+	} {
+		allocs := testing.AllocsPerRun(100, func() {
+			if _, err := tc.w.Write(wbuf); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.ReadFull(tc.r, rbuf); err != nil {
+				t.Fatal(err)
+			}
+		})
+		if allocs != 0 {
+			t.Errorf("%s: %v allocations per 64 byte transfer; want 0", tc.name, allocs)
+		}
+	}
+}
+
+func pipePair(tb testing.TB) (*Port, io.ReadWriter) {
+	a, b := Pipe()
+	tb.Cleanup(func() { a.Close(); b.Close() })
+	return a, b
+}
+
+func BenchmarkPipe(b *testing.B) {
+	benchBackend(b, pipePair)
+}
+
+func TestPipeAllocs(t *testing.T) {
+	p, peer := pipePair(t)
+	testHotPathAllocs(t, p, peer)
+
+	p.SetReadTimeout(100 * time.Millisecond)
+	testHotPathAllocs(t, p, peer)
+}
@@ -0,0 +1,231 @@
+package goserial
+
+import (
+	"bufio"
+	"bytes"
+	"sync/atomic"
+	"time"
+)
+
+// read reads from the driver, counting and tracing what it gets.
+func (p *Port) read(b []byte) (int, error) {
+	if atomic.LoadInt32(&p.flushOnRead) != 0 {
+		p.flushWrites()
+	}
+	n, err := p.readDriver(b)
+	p.stats.read(n, err)
+	if t := p.tracer(); t != nil {
+		t.OnRead(b[:n], err)
+	}
+	return n, err
+}
+
+// readAt is read, also returning the time the driver's Read returned.
+func (p *Port) readAt(b []byte) (int, time.Time, error) {
+	if atomic.LoadInt32(&p.flushOnRead) != 0 {
+		p.flushWrites()
+	}
+	n, err := p.readDriver(b)
+	at := time.Now()
+	p.stats.read(n, err)
+	if t := p.tracer(); t != nil {
+		t.OnRead(b[:n], err)
+	}
+	if n == 0 {
+		at = time.Time{}
+	}
+	return n, at, err
+}
+
+// A readStamp records when a chunk of the read buffer arrived: the
+// bytes up to rbuf[end], after those of the stamp before.
+type readStamp struct {
+	end int
+	at  time.Time
+}
+
+// fill makes one driver read into the free end of the read buffer,
+// first moving what is buffered to the front.  rr must be held.  rl is
+// not held across the driver read, so that Buffered and a reset of the
+// input need not wait for it: only fill writes to the buffer.  If the
+// input was reset meanwhile, the bytes are dropped with it when the
+// read returned before the reset, and kept otherwise.
+func (p *Port) fill() error {
+	p.rl.Lock()
+	if p.rpos > 0 {
+		p.rend = copy(p.rbuf, p.rbuf[p.rpos:p.rend])
+		for i := range p.rstamps {
+			p.rstamps[i].end -= p.rpos
+		}
+		p.rpos = 0
+	}
+	reset, free := p.rreset, p.rbuf[p.rend:]
+	p.rl.Unlock()
+
+	n, at, err := p.readAt(free)
+	if n > 0 {
+		p.rl.Lock()
+		switch {
+		case p.rreset.Equal(reset):
+			p.rend += n
+		case at.After(p.rreset):
+			p.rend += copy(p.rbuf[p.rend:], free[:n])
+		default:
+			n = 0
+		}
+		if n > 0 {
+			p.rstamps = append(p.rstamps, readStamp{p.rend, at})
+		}
+		p.rl.Unlock()
+	}
+	return err
+}
+
+// consume marks n buffered bytes as read.  rr and rl must be held.
+func (p *Port) consume(n int) {
+	p.rpos += n
+	i := 0
+	for i < len(p.rstamps) && p.rstamps[i].end <= p.rpos {
+		i++
+	}
+	p.rstamps = p.rstamps[:copy(p.rstamps, p.rstamps[i:])]
+}
+
+// Buffered returns the number of bytes that can be read from the read
+// buffer without reading from the device.
+func (p *Port) Buffered() int {
+	p.rl.Lock()
+	defer p.rl.Unlock()
+	return p.rend - p.rpos
+}
+
+// Peek returns the next n bytes without consuming them, reading from
+// the device until that many are buffered.  Each of those reads waits
+// no longer than the read timeout; if one times out or fails, Peek
+// returns what it has with the error.  n larger than the buffer gets
+// the whole buffer and bufio.ErrBufferFull.  The bytes are only valid
+// until the next read.  A port without a read buffer returns
+// ErrUnsupported.
+func (p *Port) Peek(n int) ([]byte, error) {
+	if p.rbuf == nil {
+		return nil, ErrUnsupported
+	}
+	if n < 0 {
+		return nil, bufio.ErrNegativeCount
+	}
+	p.rr.Lock()
+	defer p.rr.Unlock()
+
+	var err error
+	if n > len(p.rbuf) {
+		n, err = len(p.rbuf), bufio.ErrBufferFull
+	}
+	for p.Buffered() < n {
+		if ferr := p.fill(); ferr != nil {
+			p.rl.Lock()
+			defer p.rl.Unlock()
+			return p.rbuf[p.rpos:p.rend], ferr
+		}
+	}
+	p.rl.Lock()
+	defer p.rl.Unlock()
+	return p.rbuf[p.rpos : p.rpos+n], err
+}
+
+// Discard skips the next n bytes, reading from the device as needed,
+// and returns how many were skipped.  If fewer than n, the error says
+// why, as for Peek.  A port without a read buffer returns
+// ErrUnsupported.
+func (p *Port) Discard(n int) (int, error) {
+	if p.rbuf == nil {
+		return 0, ErrUnsupported
+	}
+	if n < 0 {
+		return 0, bufio.ErrNegativeCount
+	}
+	p.rr.Lock()
+	defer p.rr.Unlock()
+
+	discarded := 0
+	for discarded < n {
+		if p.Buffered() == 0 {
+			if err := p.fill(); p.Buffered() == 0 {
+				return discarded, err
+			}
+		}
+		p.rl.Lock()
+		k := p.rend - p.rpos
+		if k > n-discarded {
+			k = n - discarded
+		}
+		p.consume(k)
+		p.rl.Unlock()
+		discarded += k
+	}
+	return discarded, nil
+}
+
+// ReadByte reads a single byte, from the read buffer if there is one.
+func (p *Port) ReadByte() (byte, error) {
+	var b [1]byte
+	for {
+		n, err := p.Read(b[:])
+		if n == 1 {
+			return b[0], nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// ReadUntil reads until the first delim, returning the bytes up to and
+// including it.  Each read from the device waits no longer than the read
+// timeout; if one times out or fails before delim comes, ReadUntil
+// returns the bytes it has, which are consumed, with the error.  On a
+// port with a read buffer the bytes after delim stay buffered, for the
+// next Read, Peek or ReadUntil; without one the port is read a byte at a
+// time so as not to take them.
+func (p *Port) ReadUntil(delim byte) ([]byte, error) {
+	var line []byte
+	if p.rbuf == nil {
+		for {
+			c, err := p.ReadByte()
+			if err != nil {
+				return line, err
+			}
+			line = append(line, c)
+			if c == delim {
+				return line, nil
+			}
+		}
+	}
+	p.rr.Lock()
+	defer p.rr.Unlock()
+	for {
+		p.rl.Lock()
+		b := p.rbuf[p.rpos:p.rend]
+		if i := bytes.IndexByte(b, delim); i >= 0 {
+			line = append(line, b[:i+1]...)
+			p.consume(i + 1)
+			p.rl.Unlock()
+			return line, nil
+		}
+		line = append(line, b...)
+		p.consume(len(b))
+		p.rl.Unlock()
+		if err := p.fill(); err != nil && p.Buffered() == 0 {
+			return line, err
+		}
+	}
+}
+
+// dropBuffered discards the contents of the read buffer, as flushing
+// the input must.
+func (p *Port) dropBuffered() {
+	p.rl.Lock()
+	p.rpos, p.rend = 0, 0
+	p.rstamps = p.rstamps[:0]
+	p.rreset = time.Now()
+	p.rl.Unlock()
+}
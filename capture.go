@@ -0,0 +1,228 @@
+package goserial
+
+import (
+	"io"
+	"sync"
+)
+
+// A Capture reads a port without pause on a goroutine of its own,
+// straight into a ring buffer, and hands the data out as slices of the
+// ring, for data loggers at high rates whose consumer may stall now and
+// then.  The port's own queue is drained all the while, so it does not
+// overflow while the consumer is busy; a Capture whose ring fills up
+// throws away what it reads until there is room again, and counts the
+// bytes lost.  Only those reads are copied.
+type Capture struct {
+	r       io.Reader
+	scratch []byte // reads land here while the ring is full
+
+	mu      sync.Mutex
+	cond    sync.Cond
+	buf     []byte
+	rpos    int64 // bytes consumed, as a running total
+	wpos    int64 // bytes stored, likewise
+	held    int   // bytes handed out by ReadSlice, freed by the next call
+	dropped int64
+	err     error // why the capture stopped, returned once buf is empty
+}
+
+// defaultCaptureBuffer is the ring size of a Capture made with size 0.
+const defaultCaptureBuffer = 1 << 20
+
+// NewCapture starts reading r into a ring of size bytes, or 1 MiB if
+// size is 0, and returns the Capture handing out what it reads.  From
+// then on only the Capture should read r.  Reads that time out are
+// retried, so the port's read timeout does not stop it.
+func NewCapture(r io.Reader, size int) *Capture {
+	if size <= 0 {
+		size = defaultCaptureBuffer
+	}
+	c := &Capture{r: r, buf: make([]byte, size), scratch: make([]byte, 4096)}
+	c.cond.L = &c.mu
+	go c.run()
+	return c
+}
+
+func (c *Capture) run() {
+	for {
+		c.mu.Lock()
+		free, stopped := c.free(), c.err != nil
+		c.mu.Unlock()
+		if stopped {
+			return
+		}
+		full := len(free) == 0
+		if full {
+			free = c.scratch
+		}
+
+		// The free part of the ring is only touched here, so the read
+		// needs no lock.
+		n, err := c.r.Read(free)
+
+		c.mu.Lock()
+		if full {
+			// Room may have been made during the read.
+			b := c.scratch[:n]
+			for len(b) > 0 {
+				k := copy(c.free(), b)
+				if k == 0 {
+					break
+				}
+				c.wpos += int64(k)
+				b = b[k:]
+			}
+			c.dropped += int64(len(b))
+			n -= len(b)
+		} else {
+			c.wpos += int64(n)
+		}
+		if n > 0 {
+			c.cond.Broadcast()
+		}
+		c.mu.Unlock()
+
+		switch err {
+		case nil, ErrTimeout:
+		case ErrPortClosed:
+			c.stop(io.EOF)
+			return
+		default:
+			c.stop(err)
+			return
+		}
+	}
+}
+
+// free returns the longest run of the ring that can be read into
+// without wrapping.  c.mu must be held.
+func (c *Capture) free() []byte {
+	size := int64(len(c.buf))
+	w := int(c.wpos % size)
+	n := int(size - (c.wpos - c.rpos))
+	if w+n > len(c.buf) {
+		n = len(c.buf) - w
+	}
+	return c.buf[w : w+n]
+}
+
+// unread returns the longest run of data not yet consumed that does not
+// wrap.  c.mu must be held.
+func (c *Capture) unread() []byte {
+	size := int64(len(c.buf))
+	r := int(c.rpos % size)
+	n := int(c.wpos - c.rpos)
+	if r+n > len(c.buf) {
+		n = len(c.buf) - r
+	}
+	return c.buf[r : r+n]
+}
+
+// stop ends the capture with err.
+func (c *Capture) stop(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.cond.Broadcast()
+}
+
+// wait waits until there is data to hand out, releasing what the last
+// ReadSlice returned first.  c.mu must be held.
+func (c *Capture) wait() error {
+	c.rpos += int64(c.held)
+	c.held = 0
+	for c.wpos == c.rpos && c.err == nil {
+		c.cond.Wait()
+	}
+	if c.wpos == c.rpos {
+		return c.err
+	}
+	return nil
+}
+
+// Peek waits for data and returns the bytes received and not yet
+// consumed, without consuming them or copying them out of the ring.
+// Where the data wraps around the end of the ring only the part before
+// the end is returned; Discard it to see the rest.  The slice is valid
+// until the next Discard, Read or ReadSlice.  Once the capture has
+// stopped and everything has been consumed, Peek returns io.EOF, or the
+// port's error if it failed.
+func (c *Capture) Peek() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+	return c.unread(), nil
+}
+
+// Discard consumes n of the bytes Peek returned, making room for more.
+func (c *Capture) Discard(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rpos += int64(c.held)
+	c.held = 0
+	if avail := int(c.wpos - c.rpos); n > avail {
+		n = avail
+	}
+	if n > 0 {
+		c.rpos += int64(n)
+	}
+}
+
+// ReadSlice is Peek, consuming the bytes it returns.  They stay valid,
+// and their room in the ring taken, until the next call on c.
+func (c *Capture) ReadSlice() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.wait(); err != nil {
+		return nil, err
+	}
+	b := c.unread()
+	c.held = len(b)
+	return b, nil
+}
+
+// Read copies out what has been received, as io.Reader, for a consumer
+// that does not need the slices.
+func (c *Capture) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.wait(); err != nil {
+		return 0, err
+	}
+	n := copy(b, c.unread())
+	c.rpos += int64(n)
+	return n, nil
+}
+
+// Buffered returns the number of bytes received and not yet consumed.
+func (c *Capture) Buffered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return int(c.wpos-c.rpos) - c.held
+}
+
+// Dropped returns the number of bytes thrown away because the ring was
+// full.
+func (c *Capture) Dropped() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
+
+// Close stops the capture and closes the port, if it can be closed.
+// Data already captured can still be consumed, and is followed by
+// io.EOF.
+func (c *Capture) Close() error {
+	c.stop(io.EOF)
+	if cl, ok := c.r.(io.Closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
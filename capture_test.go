@@ -0,0 +1,91 @@
+package goserial
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestCapture(t *testing.T) {
+	a, b := Pipe()
+	c := NewCapture(b, 8)
+
+	a.Write([]byte("abcdef"))
+	waitBuffered(t, c, 6)
+	if s, err := c.Peek(); string(s) != "abcdef" || err != nil {
+		t.Fatalf("Peek = %q, %v", s, err)
+	}
+	c.Discard(6)
+
+	// The ring wraps after eight bytes; a slice stops at the end of it.
+	a.Write([]byte("ghij"))
+	waitBuffered(t, c, 4)
+	if s, err := c.ReadSlice(); string(s) != "gh" || err != nil {
+		t.Fatalf("ReadSlice at the wrap = %q, %v; want \"gh\"", s, err)
+	}
+	if s, err := c.ReadSlice(); string(s) != "ij" || err != nil {
+		t.Fatalf("ReadSlice after the wrap = %q, %v; want \"ij\"", s, err)
+	}
+
+	// "ij" is still held, so a stalled consumer has room for six bytes
+	// and loses the rest, and is told so.
+	a.Write([]byte("0123456789"))
+	for deadline := time.Now().Add(time.Second); c.Dropped() < 4 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n := c.Dropped(); n != 4 {
+		t.Errorf("Dropped = %d; want 4", n)
+	}
+	buf := make([]byte, 16)
+	if n, err := io.ReadFull(c, buf[:6]); string(buf[:n]) != "012345" || err != nil {
+		t.Errorf("Read after overflow = %q, %v; want \"012345\"", buf[:n], err)
+	}
+
+	a.Write([]byte("end"))
+	waitBuffered(t, c, 3)
+	a.Close()
+	if got, err := io.ReadAll(c); string(got) != "end" || err != nil {
+		t.Errorf("after the peer closed: %q, %v; want \"end\" and EOF", got, err)
+	}
+	if _, err := c.ReadSlice(); err != io.EOF {
+		t.Errorf("ReadSlice once stopped = %v; want io.EOF", err)
+	}
+	c.Close()
+}
+
+func TestCaptureSlicesStayValid(t *testing.T) {
+	// Paced at 1 Mbaud the data arrives slower than it is consumed, so
+	// none is dropped.
+	a, b := NewPipe(&PipeConfig{Baud: 1000000})
+	c := NewCapture(b, 1024)
+	defer c.Close()
+	defer a.Close()
+
+	data := make([]byte, 16<<10)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	go a.Write(data)
+	var got []byte
+	for len(got)+int(c.Dropped()) < len(data) {
+		s, err := c.ReadSlice()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("data through ReadSlice differs, %d dropped", c.Dropped())
+	}
+}
+
+func waitBuffered(t *testing.T, c *Capture, n int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); c.Buffered() < n; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Buffered = %d; want %d", c.Buffered(), n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,118 @@
+package goserial
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// CloseMode says what closing a port does with output written but not
+// yet sent.
+type CloseMode int
+
+const (
+	// CloseDefault leaves it to the operating system, which may send
+	// it, wait for it or throw it away.
+	CloseDefault CloseMode = iota
+
+	// CloseDrain waits for it to be sent, for up to
+	// Config.DrainTimeout.  If it has not gone by then, the rest is
+	// discarded and Close returns ErrDrainTimeout.
+	CloseDrain
+
+	// CloseDiscard throws it away.
+	CloseDiscard
+)
+
+// ErrDrainTimeout is returned by a Close in CloseDrain mode when the
+// output was still not sent after the drain timeout, as happens when
+// flow control holds the line.  The port is closed all the same.
+var ErrDrainTimeout = errors.New("goserial: output not drained before close; the rest was discarded")
+
+// defaultDrainTimeout bounds CloseDrain when Config.DrainTimeout is zero.
+const defaultDrainTimeout = 5 * time.Second
+
+// drainer is implemented by drivers that can wait for their output to
+// be sent.  Network ports cannot, and close as with CloseDefault.
+type drainer interface {
+	drain() error
+}
+
+// Drain waits until the output written has been sent: tcdrain on POSIX,
+// FlushFileBuffers on Windows, after sending the writes collected by
+// SetWriteCoalescing.  Use it before turning an RS-485 transceiver
+// around.  How close to the wire "sent" is depends on the driver: most
+// on-board UARTs report it once their transmitter is empty, usb-to-serial
+// converters once the adapter has taken the data, which may still be a
+// few bytes short.  It waits as long as flow control holds the line.
+// Network ports return ErrUnsupported.
+func (p *Port) Drain() error {
+	if err := p.FlushWrites(); err != nil {
+		return err
+	}
+	dr, ok := p.d.(drainer)
+	if !ok {
+		return ErrUnsupported
+	}
+	err := dr.drain()
+	p.traceControl("drain", err)
+	return err
+}
+
+// CloseWithMode closes the port, dealing with pending output as mode
+// says rather than as Config.CloseMode does.
+func (p *Port) CloseWithMode(mode CloseMode) error {
+	var err error
+	p.stopIdle()
+	p.resumeAll()
+	// Deal with the writes collected by SetWriteCoalescing first.
+	if mode == CloseDiscard {
+		p.discardWrites()
+	} else {
+		err = p.FlushWrites()
+	}
+	atomic.StoreInt32(&p.coalescing, 0)
+	switch mode {
+	case CloseDrain:
+		if derr := p.drainFor(p.drainTimeout); err == nil {
+			err = derr
+		}
+	case CloseDiscard:
+		if err = p.flush(false, true); err == ErrUnsupported {
+			err = nil
+		}
+	}
+	cerr := p.d.Close()
+	p.traceControl("close", cerr)
+	if err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// drainFor waits up to d, or defaultDrainTimeout if d is zero, for the
+// output to be sent, and discards it if it is not.
+func (p *Port) drainFor(d time.Duration) error {
+	p.flushWrites()
+	dr, ok := p.d.(drainer)
+	if !ok {
+		return nil
+	}
+	if d <= 0 {
+		d = defaultDrainTimeout
+	}
+	done := make(chan error, 1)
+	go func() { done <- dr.drain() }()
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case err := <-done:
+		p.traceControl("drain", err)
+		return err
+	case <-t.C:
+		// Discarding the output also lets the drain return.
+		p.d.flush(false, true)
+		p.traceControl("drain", ErrDrainTimeout)
+		return ErrDrainTimeout
+	}
+}
@@ -0,0 +1,212 @@
+// Goserialterm is a terminal on a serial port, for quick checks of a
+// device where screen or minicom would otherwise do.  The port is given
+// as goserial.ParseDSN takes it:
+//
+//	goserialterm /dev/ttyUSB0:115200
+//	goserialterm -hex -log capture.bin COM3:9600,7E1
+//	goserialterm -trace trace.txt 'serial:///dev/ttyACM0?baud=115200&flow=rtscts'
+//
+// The local terminal is put in raw mode, so every key goes to the
+// device as it is typed.  Ctrl-] starts a command: q quits, b sends a
+// break, d and r toggle DTR and RTS, h toggles hex display, ? lists
+// them, and a second Ctrl-] sends the Ctrl-] itself.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sync/atomic"
+
+	"github.com/tarm/goserial"
+)
+
+var (
+	hexMode = flag.Bool("hex", false, "show received bytes in hex")
+	logFile = flag.String("log", "", "append the bytes received to this file")
+	trace   = flag.String("trace", "", "write a hex trace of all I/O and control operations to this file")
+	escape  = flag.Int("escape", 0x1d, "the command character, Ctrl-] by default")
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: goserialterm [flags] port[:baud[,framing]]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	c, err := goserial.ParseDSN(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+	if *trace != "" {
+		f, err := os.Create(*trace)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		c.Tracer = goserial.NewHexTracer(f)
+	}
+	// Reads wait for data however long it takes; quitting closes the
+	// port, which ends them.
+	c.ReadTimeout = 0
+	port, err := goserial.OpenPort(c)
+	if err != nil {
+		fatal(err)
+	}
+
+	rx := &display{}
+	if *logFile != "" {
+		f, err := os.OpenFile(*logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if err != nil {
+			port.Close()
+			fatal(err)
+		}
+		defer f.Close()
+		rx.log = f
+	}
+	if *hexMode {
+		showHex = 1
+	}
+
+	restore, err := makeRaw(os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "goserialterm: %v; keys are sent a line at a time\r\n", err)
+		restore = func() {}
+	}
+	fmt.Fprintf(os.Stderr, "goserialterm: %s open, Ctrl-] ? for help\r\n", c.Name)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(rx, port)
+		done <- err
+	}()
+	go func() {
+		done <- keyboard(port)
+	}()
+	err = <-done
+	port.Close()
+	restore()
+	if err != nil && err != goserial.ErrPortClosed {
+		fmt.Fprintf(os.Stderr, "\ngoserialterm: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Fprintln(os.Stderr)
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "goserialterm: %v\n", err)
+	os.Exit(1)
+}
+
+// showHex is set while received bytes are shown in hex; the keyboard
+// goroutine toggles it.
+var showHex int32
+
+// display writes what the port receives to the terminal, as it is or
+// in hex, and to the log file if there is one.
+type display struct {
+	log io.Writer
+}
+
+func (d *display) Write(b []byte) (int, error) {
+	if d.log != nil {
+		if _, err := d.log.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	if atomic.LoadInt32(&showHex) == 0 {
+		return os.Stdout.Write(b)
+	}
+	out := make([]byte, 0, 3*len(b))
+	for _, c := range b {
+		out = append(out, fmt.Sprintf("%02x ", c)...)
+		if c == '\n' {
+			out = append(out, '\r', '\n')
+		}
+	}
+	if _, err := os.Stdout.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// keyboard sends the keys typed to the port and runs the commands,
+// until the user quits or stdin ends.
+func keyboard(port *goserial.Port) error {
+	var dtr, rts = true, true
+	buf := make([]byte, 256)
+	command := false
+	for {
+		n, err := os.Stdin.Read(buf)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		out := buf[:0]
+		for _, c := range buf[:n] {
+			switch {
+			case !command && int(c) == *escape:
+				command = true
+				continue
+			case !command:
+				out = append(out, c)
+				continue
+			}
+			command = false
+			switch c {
+			case 'q', 'x':
+				return nil
+			case 'b':
+				notice("break", port.SendBreak(0))
+			case 'd':
+				dtr = !dtr
+				notice(fmt.Sprintf("DTR %v", onOff(dtr)), port.SetDTR(dtr))
+			case 'r':
+				rts = !rts
+				notice(fmt.Sprintf("RTS %v", onOff(rts)), port.SetRTS(rts))
+			case 'h':
+				on := atomic.LoadInt32(&showHex) == 0
+				if on {
+					atomic.StoreInt32(&showHex, 1)
+				} else {
+					atomic.StoreInt32(&showHex, 0)
+				}
+				notice(fmt.Sprintf("hex %v", onOff(on)), nil)
+			case '?':
+				fmt.Fprint(os.Stderr, "\r\n[q quit, b break, d DTR, r RTS, h hex, Ctrl-] send Ctrl-]]\r\n")
+			default:
+				if int(c) == *escape {
+					out = append(out, c)
+				}
+			}
+		}
+		if len(out) > 0 {
+			if _, err := port.Write(out); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// notice reports the outcome of a command.
+func notice(what string, err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\r\n[%s: %v]\r\n", what, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "\r\n[%s]\r\n", what)
+}
+
+func onOff(on bool) string {
+	if on {
+		return "on"
+	}
+	return "off"
+}
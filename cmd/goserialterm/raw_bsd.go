@@ -0,0 +1,10 @@
+// +build darwin freebsd netbsd openbsd dragonfly
+
+package main
+
+import "syscall"
+
+const (
+	tcgets = syscall.TIOCGETA
+	tcsets = syscall.TIOCSETA
+)
@@ -0,0 +1,8 @@
+package main
+
+import "syscall"
+
+const (
+	tcgets = syscall.TCGETS
+	tcsets = syscall.TCSETS
+)
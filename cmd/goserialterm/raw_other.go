@@ -0,0 +1,13 @@
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly,!windows
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// makeRaw is not implemented here, and the terminal stays in line mode.
+func makeRaw(f *os.File) (func(), error) {
+	return nil, errors.New("raw mode is not supported on this system")
+}
@@ -0,0 +1,39 @@
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// makeRaw puts the terminal f into raw mode, as cfmakeraw does, and
+// returns the function that puts it back.
+func makeRaw(f *os.File) (func(), error) {
+	fd := f.Fd()
+	var orig syscall.Termios
+	if err := termios(fd, tcgets, &orig); err != nil {
+		return nil, err
+	}
+	t := orig
+	t.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	t.Oflag &^= syscall.OPOST
+	t.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	t.Cflag &^= syscall.CSIZE | syscall.PARENB
+	t.Cflag |= syscall.CS8
+	t.Cc[syscall.VMIN] = 1
+	t.Cc[syscall.VTIME] = 0
+	if err := termios(fd, tcsets, &t); err != nil {
+		return nil, err
+	}
+	return func() { termios(fd, tcsets, &orig) }, nil
+}
+
+func termios(fd, req uintptr, t *syscall.Termios) error {
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(unsafe.Pointer(t))); errno != 0 {
+		return os.NewSyscallError("ioctl", errno)
+	}
+	return nil
+}
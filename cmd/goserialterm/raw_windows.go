@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+var setConsoleMode = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleMode")
+
+// Console mode flags.
+const (
+	enableProcessedInput         = 0x1
+	enableLineInput              = 0x2
+	enableEchoInput              = 0x4
+	enableVirtualTerminalInput   = 0x200
+	enableVirtualTerminalProcess = 0x4 // on an output handle
+)
+
+// makeRaw turns off line editing, echo and Ctrl-C handling on the
+// console f, and has it pass on keys and show the output as VT
+// sequences, for the device on the other end to drive.  It returns the
+// function that puts both modes back.
+func makeRaw(f *os.File) (func(), error) {
+	in := syscall.Handle(f.Fd())
+	var inMode uint32
+	if err := syscall.GetConsoleMode(in, &inMode); err != nil {
+		return nil, err
+	}
+	raw := inMode&^(enableProcessedInput|enableLineInput|enableEchoInput) | enableVirtualTerminalInput
+	if err := consoleMode(in, raw); err != nil {
+		return nil, err
+	}
+	out := syscall.Handle(os.Stdout.Fd())
+	var outMode uint32
+	haveOut := syscall.GetConsoleMode(out, &outMode) == nil
+	if haveOut {
+		consoleMode(out, outMode|enableVirtualTerminalProcess)
+	}
+	return func() {
+		consoleMode(in, inMode)
+		if haveOut {
+			consoleMode(out, outMode)
+		}
+	}, nil
+}
+
+func consoleMode(h syscall.Handle, mode uint32) error {
+	if r, _, err := setConsoleMode.Call(uintptr(h), uintptr(mode)); r == 0 {
+		return os.NewSyscallError("SetConsoleMode", err)
+	}
+	return nil
+}
@@ -0,0 +1,408 @@
+// Serialtest checks a serial port, or a pair of ports, against real
+// hardware using only the exported goserial API.
+//
+// With one port, fit a loopback plug (TX to RX).  With two, connect them
+// with a null-modem cable; data is written to the first and read from
+// the second.  The modem check needs the handshake lines wired too:
+// DTR to DSR and DCD, RTS to CTS, as in a full loopback plug or
+// null-modem cable.
+//
+//	serialtest -port /dev/ttyUSB0
+//	serialtest -port COM3 -port2 COM4 -skip frames
+//
+// Each check prints PASS, FAIL or SKIP; the exit status is 1 if any
+// check failed.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tarm/goserial"
+)
+
+var (
+	port1 = flag.String("port", "", "port to test (required)")
+	port2 = flag.String("port2", "", "second port, for a null-modem cable")
+	bauds = flag.String("bauds", "9600,19200,38400,57600,115200", "baud rates to test")
+	baud  = flag.Int("baud", 115200, "baud rate for the checks that use only one")
+	size  = flag.Int("size", 64*1024, "bytes to send in the throughput check")
+	skip  = flag.String("skip", "", "comma separated checks to skip: "+strings.Join(checkNames(), ","))
+)
+
+type check struct {
+	name string
+	run  func() error
+}
+
+var checks = []check{
+	{"roundtrip", checkRoundTrip},
+	{"frames", checkFrames},
+	{"timeouts", checkTimeouts},
+	{"throughput", checkThroughput},
+	{"concurrent", checkConcurrent},
+	{"flush", checkFlush},
+	{"modem", checkModemLines},
+}
+
+func checkNames() []string {
+	var names []string
+	for _, c := range checks {
+		names = append(names, c.name)
+	}
+	return names
+}
+
+func main() {
+	flag.Parse()
+	if *port1 == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	skipped := make(map[string]bool)
+	for _, s := range strings.Split(*skip, ",") {
+		skipped[strings.TrimSpace(s)] = true
+	}
+
+	failed := false
+	for _, c := range checks {
+		if skipped[c.name] {
+			fmt.Printf("SKIP %s\n", c.name)
+			continue
+		}
+		if err := c.run(); err != nil {
+			fmt.Printf("FAIL %s: %v\n", c.name, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("PASS %s\n", c.name)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// open opens the port pair with the given settings.  With a single port
+// tx and rx are the same.
+func open(c goserial.Config) (tx, rx *goserial.Port, err error) {
+	c.Name = *port1
+	tx, err = goserial.OpenPort(&c)
+	if err != nil {
+		return nil, nil, err
+	}
+	if *port2 == "" {
+		return tx, tx, nil
+	}
+	c.Name = *port2
+	rx, err = goserial.OpenPort(&c)
+	if err != nil {
+		tx.Close()
+		return nil, nil, err
+	}
+	return tx, rx, nil
+}
+
+func closePorts(tx, rx *goserial.Port) {
+	tx.Close()
+	if rx != tx {
+		rx.Close()
+	}
+}
+
+// transfer writes data to tx and reads it back from rx, failing if it
+// does not all come back intact within timeout.
+func transfer(tx, rx *goserial.Port, data []byte, timeout time.Duration) error {
+	if err := rx.SetReadTimeout(100 * time.Millisecond); err != nil {
+		return err
+	}
+	werr := make(chan error, 1)
+	go func() {
+		_, err := tx.Write(data)
+		werr <- err
+	}()
+
+	got := make([]byte, 0, len(data))
+	buf := make([]byte, 4096)
+	deadline := time.Now().Add(timeout)
+	for len(got) < len(data) && time.Now().Before(deadline) {
+		n, err := rx.Read(buf)
+		got = append(got, buf[:n]...)
+		if err != nil && err != goserial.ErrTimeout {
+			return err
+		}
+	}
+	if err := <-werr; err != nil {
+		return err
+	}
+	if len(got) > len(data) {
+		got = got[:len(data)]
+	}
+	if !bytes.Equal(got, data[:len(got)]) {
+		for i := range got {
+			if got[i] != data[i] {
+				return fmt.Errorf("byte %d: got %#02x, want %#02x", i, got[i], data[i])
+			}
+		}
+	}
+	if len(got) < len(data) {
+		return fmt.Errorf("got %d of %d bytes", len(got), len(data))
+	}
+	return nil
+}
+
+// allBytes returns every byte value, n times over.
+func allBytes(n int) []byte {
+	b := make([]byte, 256*n)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return b
+}
+
+// transferTime returns a generous timeout for sending n bytes at baud.
+func transferTime(n, baud int) time.Duration {
+	return time.Second + time.Duration(n)*12*time.Second/time.Duration(baud)
+}
+
+func checkRoundTrip() error {
+	for _, f := range strings.Split(*bauds, ",") {
+		b, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil {
+			return err
+		}
+		tx, rx, err := open(goserial.Config{Baud: b})
+		if err != nil {
+			return fmt.Errorf("%d baud: %v", b, err)
+		}
+		data := allBytes(2)
+		err = transfer(tx, rx, data, transferTime(len(data), b))
+		closePorts(tx, rx)
+		if err != nil {
+			return fmt.Errorf("%d baud: %v", b, err)
+		}
+		fmt.Printf("     roundtrip %d baud ok\n", b)
+	}
+	return nil
+}
+
+func checkFrames() error {
+	for _, size := range []goserial.ByteSize{goserial.Byte7, goserial.Byte8} {
+		for _, parity := range []goserial.ParityMode{goserial.ParityNone, goserial.ParityEven, goserial.ParityOdd} {
+			for _, stop := range []goserial.StopBits{goserial.StopBits1, goserial.StopBits2} {
+				c := goserial.Config{Baud: *baud, Size: size, Parity: parity, StopBits: stop}
+				frame := fmt.Sprintf("%v%s%v", size, strings.ToUpper(parity.String()[:1]), stop)
+
+				c.Name = *port1
+				if err := goserial.Probe(&c); err != nil {
+					fmt.Printf("     frame %s not supported: %v\n", frame, err)
+					continue
+				}
+				tx, rx, err := open(c)
+				if err != nil {
+					return fmt.Errorf("%s: %v", frame, err)
+				}
+				// With 7 data bits only the low 7 bits survive.
+				data := allBytes(1)
+				if size == goserial.Byte7 {
+					data = data[:128]
+				}
+				err = transfer(tx, rx, data, transferTime(len(data), *baud))
+				closePorts(tx, rx)
+				if err != nil {
+					return fmt.Errorf("%s: %v", frame, err)
+				}
+				fmt.Printf("     frame %s ok\n", frame)
+			}
+		}
+	}
+	return nil
+}
+
+func checkTimeouts() error {
+	tx, rx, err := open(goserial.Config{Baud: *baud})
+	if err != nil {
+		return err
+	}
+	defer closePorts(tx, rx)
+
+	buf := make([]byte, 16)
+	for _, want := range []time.Duration{100 * time.Millisecond, 500 * time.Millisecond, time.Second} {
+		if err := rx.SetReadTimeout(want); err != nil {
+			return err
+		}
+		start := time.Now()
+		n, err := rx.Read(buf)
+		got := time.Since(start)
+		if err != goserial.ErrTimeout {
+			return fmt.Errorf("Read on an idle port = %d, %v; want ErrTimeout", n, err)
+		}
+		if got < want || got > want+want/2+50*time.Millisecond {
+			return fmt.Errorf("timeout of %v took %v", want, got)
+		}
+		fmt.Printf("     timeout %v took %v\n", want, got.Round(time.Millisecond))
+	}
+	return nil
+}
+
+func checkThroughput() error {
+	tx, rx, err := open(goserial.Config{Baud: *baud})
+	if err != nil {
+		return err
+	}
+	defer closePorts(tx, rx)
+
+	data := bytes.Repeat(allBytes(1), (*size+255)/256)[:*size]
+	start := time.Now()
+	if err := transfer(tx, rx, data, transferTime(len(data), *baud)); err != nil {
+		return err
+	}
+	elapsed := time.Since(start)
+	rate := float64(len(data)) / elapsed.Seconds()
+	// 8N1 spends 10 bits on the wire per byte.
+	fmt.Printf("     %d bytes in %v: %.0f B/s, %.0f%% of the line rate\n",
+		len(data), elapsed.Round(time.Millisecond), rate, 100*rate*10/float64(*baud))
+	return nil
+}
+
+// checkConcurrent writes while a Read with no timeout is blocked on the
+// idle port, as a command/response loop does, and then checks that
+// Close ends such a Read.
+func checkConcurrent() error {
+	tx, rx, err := open(goserial.Config{Baud: *baud})
+	if err != nil {
+		return err
+	}
+	closed := false
+	defer func() {
+		if !closed {
+			closePorts(tx, rx)
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		data := allBytes(1)
+		got := make(chan error, 1)
+		go func() {
+			buf := make([]byte, len(data))
+			_, err := io.ReadFull(rx, buf)
+			if err == nil && !bytes.Equal(buf, data) {
+				err = errors.New("data corrupted")
+			}
+			got <- err
+		}()
+		time.Sleep(50 * time.Millisecond) // let the Read block
+		limit := transferTime(len(data), *baud)
+		start := time.Now()
+		if _, err := tx.Write(data); err != nil {
+			return err
+		}
+		if d := time.Since(start); d > limit {
+			return fmt.Errorf("Write took %v with a Read pending", d)
+		}
+		select {
+		case err := <-got:
+			if err != nil {
+				return err
+			}
+		case <-time.After(limit):
+			return errors.New("reader did not get the data")
+		}
+	}
+
+	blocked := make(chan error, 1)
+	go func() {
+		_, err := rx.Read(make([]byte, 1))
+		blocked <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	closePorts(tx, rx)
+	closed = true
+	select {
+	case err := <-blocked:
+		if err != goserial.ErrPortClosed {
+			return fmt.Errorf("blocked Read ended with %v, want ErrPortClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		return errors.New("Close did not end a blocked Read")
+	}
+	return nil
+}
+
+// checkFlush lets data arrive unread, discards it with ResetInputBuffer
+// and then Flush, and checks that none of it is read afterwards.
+func checkFlush() error {
+	tx, rx, err := open(goserial.Config{Baud: *baud})
+	if err != nil {
+		return err
+	}
+	defer closePorts(tx, rx)
+
+	for _, reset := range []struct {
+		name string
+		f    func() error
+	}{
+		{"ResetInputBuffer", rx.ResetInputBuffer},
+		{"Flush", rx.Flush},
+	} {
+		data := allBytes(1)
+		if _, err := tx.Write(data); err != nil {
+			return err
+		}
+		time.Sleep(transferTime(len(data), *baud)) // let it all arrive
+		if err := reset.f(); err != nil {
+			return fmt.Errorf("%s: %v", reset.name, err)
+		}
+		if err := rx.SetReadTimeout(100 * time.Millisecond); err != nil {
+			return err
+		}
+		buf := make([]byte, len(data))
+		if n, err := rx.Read(buf); err != goserial.ErrTimeout {
+			return fmt.Errorf("after %s, Read = %d bytes, %v; want ErrTimeout", reset.name, n, err)
+		}
+		// The port still works, with nothing stale ahead of new data.
+		if err := transfer(tx, rx, []byte("fresh"), transferTime(5, *baud)); err != nil {
+			return fmt.Errorf("after %s: %v", reset.name, err)
+		}
+		fmt.Printf("     %s ok\n", reset.name)
+	}
+	return nil
+}
+
+// checkModemLines toggles DTR and RTS on the first port and checks that
+// DSR and DCD, and CTS, follow on the port at the other end.
+func checkModemLines() error {
+	tx, rx, err := open(goserial.Config{Baud: *baud})
+	if err != nil {
+		return err
+	}
+	defer closePorts(tx, rx)
+
+	for _, on := range []bool{true, false, true} {
+		if err := tx.SetDTR(on); err != nil {
+			return err
+		}
+		if err := tx.SetRTS(!on); err != nil {
+			return err
+		}
+		time.Sleep(20 * time.Millisecond) // let the lines settle
+		s, err := rx.ModemStatus()
+		if err != nil {
+			return err
+		}
+		if s.DSR != on || s.DCD != on {
+			return fmt.Errorf("DTR %v: DSR %v, DCD %v", on, s.DSR, s.DCD)
+		}
+		if s.CTS != !on {
+			return fmt.Errorf("RTS %v: CTS %v", !on, s.CTS)
+		}
+		fmt.Printf("     DTR %v, RTS %v ok\n", on, !on)
+	}
+	return nil
+}
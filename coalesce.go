@@ -0,0 +1,166 @@
+package goserial
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SetWriteCoalescing makes Write collect small writes and hand them to
+// the device together, which on a USB adapter saves a bus transaction
+// per write.  The data collected is sent once maxBytes of it are
+// waiting, or maxDelay after the first of it was written, whichever is
+// sooner; a Write of maxBytes or more goes out at once.  Either
+// argument at zero turns coalescing off, the default, sending whatever
+// is waiting.
+//
+// While coalescing a Write returns before its data reaches the device,
+// so an error sending it is returned by the next Write or FlushWrites
+// instead.  Writes keep their order.  SetBaud, Close and the drains
+// send the data collected first, and so do reads if SetFlushOnRead is
+// on.  Discarding the output, as CloseDiscard does, drops it too.  Stats
+// and tracers see the writes made to the device.
+func (p *Port) SetWriteCoalescing(maxDelay time.Duration, maxBytes int) error {
+	p.wl.Lock()
+	defer p.wl.Unlock()
+	err := p.flushWritesLocked()
+	if maxDelay <= 0 || maxBytes <= 0 {
+		atomic.StoreInt32(&p.coalescing, 0)
+		p.wbuf = nil
+	} else {
+		if cap(p.wbuf) != maxBytes {
+			p.wbuf = make([]byte, 0, maxBytes)
+		}
+		p.wdelay = maxDelay
+		if p.wtimer == nil {
+			p.wtimer = time.AfterFunc(time.Hour, p.flushLater)
+			p.wtimer.Stop()
+		}
+		atomic.StoreInt32(&p.coalescing, 1)
+	}
+	p.traceControl("write coalescing", err, maxDelay, maxBytes)
+	return err
+}
+
+// SetFlushOnRead sets whether each read from the device first sends the
+// writes collected by SetWriteCoalescing, as a half-duplex protocol
+// that writes a request and then reads the reply needs.
+func (p *Port) SetFlushOnRead(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&p.flushOnRead, v)
+}
+
+// FlushWrites sends the writes collected by SetWriteCoalescing, and
+// returns the error of an earlier send in the background if there was
+// one.  Without coalescing it does nothing.
+func (p *Port) FlushWrites() error {
+	if atomic.LoadInt32(&p.coalescing) == 0 {
+		return nil
+	}
+	p.wl.Lock()
+	defer p.wl.Unlock()
+	return p.flushWritesLocked()
+}
+
+// flushWrites is FlushWrites for the methods that send the collected
+// writes on the way to doing something else: an error is kept for the
+// next Write or FlushWrites.
+func (p *Port) flushWrites() {
+	if atomic.LoadInt32(&p.coalescing) == 0 {
+		return
+	}
+	p.wl.Lock()
+	p.werr = p.flushWritesLocked()
+	p.wl.Unlock()
+}
+
+// coalesce is Write while coalescing.  On an error the count is of the
+// bytes of b that reached the device; the rest are dropped.
+func (p *Port) coalesce(b []byte) (int, error) {
+	p.wl.Lock()
+	defer p.wl.Unlock()
+	if atomic.LoadInt32(&p.coalescing) == 0 {
+		return p.write(b)
+	}
+	if err := p.werr; err != nil {
+		p.werr = nil
+		return 0, err
+	}
+	max := cap(p.wbuf)
+	if len(b) >= max {
+		if err := p.flushWritesLocked(); err != nil {
+			return 0, err
+		}
+		return p.write(b)
+	}
+	done := 0
+	for len(b) > 0 {
+		if len(p.wbuf) == 0 {
+			p.wtimer.Reset(p.wdelay)
+		}
+		n := copy(p.wbuf[len(p.wbuf):max], b)
+		p.wbuf = p.wbuf[:len(p.wbuf)+n]
+		b = b[n:]
+		done += n
+		if len(p.wbuf) < max {
+			break
+		}
+		waiting := len(p.wbuf)
+		m, err := p.sendCollected()
+		if err != nil {
+			if done -= waiting - m; done < 0 {
+				done = 0
+			}
+			return done, err
+		}
+	}
+	return done, nil
+}
+
+// flushWritesLocked sends the collected writes, returning first any
+// error kept from the background.  wl must be held.
+func (p *Port) flushWritesLocked() error {
+	err := p.werr
+	p.werr = nil
+	if _, serr := p.sendCollected(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// sendCollected writes out wbuf, which is then empty whether or not
+// that worked, and returns how much of it was written.  wl must be
+// held.
+func (p *Port) sendCollected() (int, error) {
+	if len(p.wbuf) == 0 {
+		return 0, nil
+	}
+	p.wtimer.Stop()
+	n, err := p.write(p.wbuf)
+	p.wbuf = p.wbuf[:0]
+	return n, err
+}
+
+// flushLater is run by wtimer, maxDelay after the first collected write.
+func (p *Port) flushLater() {
+	p.wl.Lock()
+	defer p.wl.Unlock()
+	if _, err := p.sendCollected(); err != nil && p.werr == nil {
+		p.werr = err
+	}
+}
+
+// discardWrites drops the collected writes, for a flush of the output.
+func (p *Port) discardWrites() {
+	if atomic.LoadInt32(&p.coalescing) == 0 {
+		return
+	}
+	p.wl.Lock()
+	if len(p.wbuf) > 0 {
+		p.wtimer.Stop()
+		p.wbuf = p.wbuf[:0]
+	}
+	p.wl.Unlock()
+}
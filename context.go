@@ -0,0 +1,66 @@
+package goserial
+
+import (
+	"context"
+	"time"
+)
+
+// ReadContext is Read, returning ctx's error if ctx ends the wait.  It
+// works through the read deadline, which it sets to ctx's deadline and
+// clears again on return, replacing any set with SetReadDeadline.  So
+// cancelling ctx interrupts a Read already waiting only where a new
+// deadline does, see SetReadDeadline; elsewhere it takes effect when
+// the read timeout next expires.
+func (p *Port) ReadContext(ctx context.Context, b []byte) (int, error) {
+	return p.withContext(ctx, p.SetReadDeadline, func() (int, error) { return p.Read(b) })
+}
+
+// WriteContext is Write, returning ctx's error if ctx ends the call, as
+// ReadContext does with the write deadline.  On ports that cannot take
+// a write deadline, see SetWriteDeadline, ctx is only checked before
+// the Write starts.
+func (p *Port) WriteContext(ctx context.Context, b []byte) (int, error) {
+	return p.withContext(ctx, p.SetWriteDeadline, func() (int, error) { return p.Write(b) })
+}
+
+// withContext runs op with the deadline that set sets following ctx:
+// its deadline to begin with, and now once it is done.
+func (p *Port) withContext(ctx context.Context, set func(time.Time) error, op func() (int, error)) (int, error) {
+	if ctx.Done() == nil {
+		return op()
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := set(deadline); err != nil {
+		if err != ErrUnsupported {
+			return 0, err
+		}
+		return op()
+	}
+	stop, stopped := make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			set(time.Now())
+		case <-stop:
+		}
+	}()
+	n, err := op()
+	close(stop)
+	<-stopped
+	set(time.Time{})
+
+	if _, ok := err.(*WriteTimeoutError); ok || err == ErrTimeout {
+		switch {
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		case !deadline.IsZero() && !time.Now().Before(deadline):
+			// The port's deadline fired just before ctx's.
+			err = context.DeadlineExceeded
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,107 @@
+package goserial
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestOpenPortContext(t *testing.T) {
+	// Nothing answers the telnet negotiation, as in TestOpenTimeout.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	defer l.Close()
+	c := &Config{Name: "rfc2217://" + l.Addr().String(), Baud: 9600}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := OpenPortContext(ctx, c); err != context.Canceled {
+		t.Errorf("OpenPortContext with a cancelled context = %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := OpenPortContext(ctx, c); err != context.DeadlineExceeded {
+		t.Errorf("OpenPortContext = %v, want context.DeadlineExceeded", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("OpenPortContext took %v", d)
+	}
+}
+
+func TestReadWriteContext(t *testing.T) {
+	a, b := NewPipe(&PipeConfig{BufferSize: 8})
+	defer a.Close()
+	defer b.Close()
+	buf := make([]byte, 8)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := b.ReadContext(ctx, buf); err != context.Canceled {
+		t.Errorf("ReadContext cancelled while waiting = %v", err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := b.ReadContext(ctx, buf); err != context.DeadlineExceeded {
+		t.Errorf("ReadContext past the deadline = %v", err)
+	}
+
+	a.Write([]byte("hi"))
+	if n, err := b.ReadContext(context.Background(), buf); err != nil || string(buf[:n]) != "hi" {
+		t.Errorf("ReadContext = %q, %v", buf[:n], err)
+	}
+
+	// The deadline is gone again afterwards.
+	b.SetReadTimeout(20 * time.Millisecond)
+	a.Write([]byte("x"))
+	if n, err := b.Read(buf); err != nil || string(buf[:n]) != "x" {
+		t.Errorf("Read after ReadContext = %q, %v", buf[:n], err)
+	}
+
+	// A's peer does not read, so its pipe fills.
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if n, err := a.WriteContext(ctx, make([]byte, 16)); n != 8 || err != context.Canceled {
+		t.Errorf("WriteContext into a full pipe = %d, %v; want 8, context.Canceled", n, err)
+	}
+}
+
+func TestOpenWait(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	tries := 0
+	registerTestDriver("testwait", func(name string, c *Config) (Driver, error) {
+		if tries++; tries < 3 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+		}
+		return a, nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	p, err := OpenWait(ctx, &Config{Name: "testwait://x", Baud: 9600})
+	if err != nil || tries != 3 {
+		t.Fatalf("OpenWait = %v after %d tries; want success after 3", err, tries)
+	}
+	p.Close()
+
+	// Past the context, the wait ends with its error.
+	tries = -100
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err := OpenWait(ctx, &Config{Name: "testwait://x", Baud: 9600}); err != context.DeadlineExceeded {
+		t.Errorf("OpenWait past the deadline = %v; want context.DeadlineExceeded", err)
+	}
+
+	// Other errors are not waited out.
+	_, err = OpenWait(context.Background(), &Config{Name: "testwait://x", Baud: 9600, Size: 9})
+	if !errors.Is(err, ErrConfigByteSize) {
+		t.Errorf("OpenWait with a bad Config = %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package goserial
+
+import (
+	"io"
+	"time"
+)
+
+// A TimeoutReader is a reader whose reads give up with ErrTimeout once
+// its read timeout passes, such as a Port or a serialtest.MockPort.
+type TimeoutReader interface {
+	io.Reader
+	SetReadTimeout(d time.Duration) error
+	ReadTimeout() time.Duration
+}
+
+// CopyUntilIdle copies from src to dst until src has sent nothing for
+// idle, returning the number of bytes copied and a nil error.  If max is
+// not zero and that long passes first, it returns ErrTimeout.  A read or
+// write error ends the copy early and is returned as it is.
+//
+// The gap is timed with the port's read timeout, which is put back
+// afterwards, so it has the resolution of the read timeout: a tenth of
+// a second on a POSIX port opened with PosixTimeouts.  One
+// buffer is used for the whole copy.
+func CopyUntilIdle(dst io.Writer, src TimeoutReader, idle, max time.Duration) (int64, error) {
+	old := src.ReadTimeout()
+	defer src.SetReadTimeout(old)
+
+	var deadline time.Time
+	if max > 0 {
+		deadline = time.Now().Add(max)
+	}
+	buf := make([]byte, 4096)
+	var written int64
+	set := time.Duration(-1)
+	for {
+		wait := idle
+		if !deadline.IsZero() {
+			left := time.Until(deadline)
+			if left <= 0 {
+				return written, ErrTimeout
+			}
+			if left < wait {
+				wait = left
+			}
+		}
+		if wait != set {
+			if err := src.SetReadTimeout(wait); err != nil {
+				return written, err
+			}
+			set = wait
+		}
+
+		n, err := src.Read(buf)
+		if n > 0 {
+			m, werr := dst.Write(buf[:n])
+			written += int64(m)
+			if werr == nil && m < n {
+				werr = io.ErrShortWrite
+			}
+			if werr != nil {
+				return written, werr
+			}
+		}
+		switch {
+		case err == ErrTimeout && n == 0 && wait == idle:
+			return written, nil
+		case err == ErrTimeout:
+			// Cut short by max; the loop returns once it has passed.
+		case err != nil:
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package goserial
+
+import "time"
+
+// deadliner is implemented by drivers that support read and write
+// deadlines, including changing them while a Read or Write waits.
+type deadliner interface {
+	setReadDeadline(t time.Time) error
+	setWriteDeadline(t time.Time) error
+}
+
+// SetDeadline sets both the read and the write deadline.
+func (p *Port) SetDeadline(t time.Time) error {
+	if err := p.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return p.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the time after which Read fails with ErrTimeout,
+// as net.Conn does: the deadline is absolute, holds for every call until
+// changed, and a deadline already past fails the next Read at once.
+// The zero Time clears it.  The read timeout still applies, and
+// whichever is sooner ends the call.
+//
+// Local ports, Pipe and tcp:// ports change the deadline under a Read
+// already waiting.  On Windows, RFC 2217 ports and ports opened with
+// PosixTimeouts it is turned into a read timeout as each Read starts,
+// so a new deadline only applies from the next call; with PosixTimeouts
+// that replaces VMIN and VTIME, as SetReadTimeout does.
+func (p *Port) SetReadDeadline(t time.Time) error {
+	err := ErrUnsupported
+	if dl, ok := p.d.(deadliner); ok {
+		err = dl.setReadDeadline(t)
+	}
+	if err == ErrUnsupported {
+		err = p.setReadDeadline(t)
+	}
+	p.traceControl("read deadline", err, t)
+	return err
+}
+
+// SetWriteDeadline is like SetReadDeadline, for Write.  A Write that
+// runs into it may have sent part of the data, as its count says.
+// Emulating it needs a write timeout, so RFC 2217 ports only take the
+// zero Time.
+func (p *Port) SetWriteDeadline(t time.Time) error {
+	err := ErrUnsupported
+	if dl, ok := p.d.(deadliner); ok {
+		err = dl.setWriteDeadline(t)
+	}
+	if err == ErrUnsupported {
+		err = p.setWriteDeadline(t)
+	}
+	p.traceControl("write deadline", err, t)
+	return err
+}
+
+// setReadDeadline keeps the deadline for drivers without their own.
+// Clearing it puts back the read timeout a Read may have replaced.
+func (p *Port) setReadDeadline(t time.Time) error {
+	p.tl.Lock()
+	defer p.tl.Unlock()
+	was := p.rdeadline
+	p.rdeadline = t
+	if t.IsZero() && !was.IsZero() {
+		return p.d.setReadTimeout(p.readTimeout)
+	}
+	return nil
+}
+
+func (p *Port) setWriteDeadline(t time.Time) error {
+	s, ok := p.d.(writeTimeoutSetter)
+	if !ok {
+		if t.IsZero() {
+			return nil
+		}
+		return ErrUnsupported
+	}
+	p.tl.Lock()
+	defer p.tl.Unlock()
+	was := p.wdeadline
+	p.wdeadline = t
+	if t.IsZero() && !was.IsZero() {
+		return s.setWriteTimeout(p.writeTimeout)
+	}
+	return nil
+}
+
+// readDriver is the driver's Read, bounded by a deadline kept by
+// setReadDeadline.
+func (p *Port) readDriver(b []byte) (int, error) {
+	p.tl.Lock()
+	d, ok := untilDeadline(p.rdeadline, p.readTimeout)
+	if ok && d > 0 {
+		if err := p.d.setReadTimeout(d); err != nil {
+			p.tl.Unlock()
+			return 0, err
+		}
+	}
+	p.tl.Unlock()
+	if ok && d <= 0 {
+		return 0, ErrTimeout
+	}
+	return p.d.Read(b)
+}
+
+// writeDriver is readDriver for Write.
+func (p *Port) writeDriver(b []byte) (int, error) {
+	p.tl.Lock()
+	d, ok := untilDeadline(p.wdeadline, p.writeTimeout)
+	if ok && d > 0 {
+		if err := p.d.(writeTimeoutSetter).setWriteTimeout(d); err != nil {
+			p.tl.Unlock()
+			return 0, err
+		}
+	}
+	p.tl.Unlock()
+	if ok && d <= 0 {
+		return 0, ErrTimeout
+	}
+	return p.d.Write(b)
+}
+
+// untilDeadline returns the timeout that ends a call at deadline t, or
+// sooner if timeout is shorter, and whether t is set at all.  A timeout
+// of zero or less means none.
+func untilDeadline(t time.Time, timeout time.Duration) (time.Duration, bool) {
+	if t.IsZero() {
+		return 0, false
+	}
+	d := time.Until(t)
+	if d <= 0 {
+		return 0, true
+	}
+	if timeout > 0 && timeout < d {
+		d = timeout
+	}
+	return d, true
+}
@@ -0,0 +1,237 @@
+package goserial
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Driver is a backend OpenPort can open ports through besides the
+// built-in ones, such as a raw USB device, a BLE UART bridge or a
+// simulator; see RegisterDriver.  The Port it is wrapped in adds the
+// rest of the package on top: read buffering, Config.MinimumReadSize
+// and InterCharacterTimeout, deadlines, statistics and tracing.
+//
+// Read must return ErrTimeout when the read timeout runs out with
+// nothing read, and ErrPortClosed once the driver has been closed.
+//
+// A Driver may have any of these methods as well, with the meaning
+// they have on Port; a Port whose Driver lacks one returns
+// ErrUnsupported from it:
+//
+//	SetBaud(baud int) error
+//	SetFraming(size ByteSize, parity ParityMode, stop StopBits) error
+//	SetFlowControl(f FlowControl) error
+//	SetDTR(on bool) error
+//	SetRTS(on bool) error
+//	ModemStatus() (ModemStatus, error)
+//	ResetInputBuffer() error
+//	ResetOutputBuffer() error
+//	Drain() error
+//	SetWriteTimeout(d time.Duration) error
+//	SetReadDeadline(t time.Time) error
+//	SetWriteDeadline(t time.Time) error
+//	Config() (Config, error)
+//
+// A *Port has them all, so a Driver can also wrap another Port.
+type Driver interface {
+	io.ReadWriteCloser
+
+	// SetReadTimeout sets how long Read waits for data, as on Port.
+	// OpenPort calls it with Config.ReadTimeout once the Driver is
+	// open.
+	SetReadTimeout(d time.Duration) error
+}
+
+// An OpenFunc opens the port a Driver is registered for.  name is the
+// part of Config.Name after "scheme://"; c holds the rest of the
+// settings, already checked.
+type OpenFunc func(name string, c *Config) (Driver, error)
+
+var (
+	driversMu sync.RWMutex
+	drivers   = make(map[string]OpenFunc)
+)
+
+// RegisterDriver has OpenPort open the names "scheme://..." with open.
+// It is meant to be called from an init function, as database/sql's
+// Register is, and panics if scheme is already registered, is one of
+// the built-in "rfc2217" and "tcp", or open is nil.
+func RegisterDriver(scheme string, open OpenFunc) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if open == nil {
+		panic("goserial: RegisterDriver open func is nil")
+	}
+	if scheme == "rfc2217" || scheme == "tcp" {
+		panic(fmt.Sprintf("goserial: RegisterDriver of built-in scheme %q", scheme))
+	}
+	if _, dup := drivers[scheme]; dup {
+		panic(fmt.Sprintf("goserial: RegisterDriver called twice for scheme %q", scheme))
+	}
+	drivers[scheme] = open
+}
+
+// registeredDriver returns the OpenFunc for the scheme of name, if it
+// has one, and the rest of name.
+func registeredDriver(name string) (OpenFunc, string, bool) {
+	i := strings.Index(name, "://")
+	if i < 0 {
+		return nil, "", false
+	}
+	driversMu.RLock()
+	open, ok := drivers[name[:i]]
+	driversMu.RUnlock()
+	return open, name[i+len("://"):], ok
+}
+
+// openDriverFunc opens a port through a registered Driver.
+func openDriverFunc(open OpenFunc, name string, c *Config) (driver, error) {
+	d, err := open(name, c)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.SetReadTimeout(time.Duration(c.ReadTimeout) * time.Millisecond); err != nil {
+		d.Close()
+		return nil, err
+	}
+	if _, ok := d.(interface{ Drain() error }); ok {
+		return customDrainer{customDriver{d}}, nil
+	}
+	return customDriver{d}, nil
+}
+
+// customDriver adapts a Driver to the package's own driver interface,
+// and the optional ones, through the methods the Driver has.
+type customDriver struct {
+	Driver
+}
+
+func (d customDriver) setBaud(baud int) error {
+	if s, ok := d.Driver.(interface{ SetBaud(int) error }); ok {
+		return s.SetBaud(baud)
+	}
+	return ErrUnsupported
+}
+
+func (d customDriver) setReadTimeout(t time.Duration) error {
+	return d.SetReadTimeout(t)
+}
+
+func (d customDriver) setFraming(size ByteSize, parity ParityMode, stop StopBits) error {
+	if s, ok := d.Driver.(interface {
+		SetFraming(ByteSize, ParityMode, StopBits) error
+	}); ok {
+		return s.SetFraming(size, parity, stop)
+	}
+	return ErrUnsupported
+}
+
+func (d customDriver) setFlowControl(f FlowControl) error {
+	if s, ok := d.Driver.(interface{ SetFlowControl(FlowControl) error }); ok {
+		return s.SetFlowControl(f)
+	}
+	return ErrUnsupported
+}
+
+func (d customDriver) setDTR(on bool) error {
+	if s, ok := d.Driver.(interface{ SetDTR(bool) error }); ok {
+		return s.SetDTR(on)
+	}
+	return ErrUnsupported
+}
+
+func (d customDriver) setRTS(on bool) error {
+	if s, ok := d.Driver.(interface{ SetRTS(bool) error }); ok {
+		return s.SetRTS(on)
+	}
+	return ErrUnsupported
+}
+
+// outputLines is not known: a Driver has no way to report it.
+func (d customDriver) outputLines() (dtr, rts bool, err error) {
+	return false, false, ErrUnsupported
+}
+
+func (d customDriver) modemStatus() (ModemStatus, error) {
+	if s, ok := d.Driver.(interface{ ModemStatus() (ModemStatus, error) }); ok {
+		return s.ModemStatus()
+	}
+	return ModemStatus{}, ErrUnsupported
+}
+
+func (d customDriver) flush(in, out bool) error {
+	if in {
+		r, ok := d.Driver.(interface{ ResetInputBuffer() error })
+		if !ok {
+			return ErrUnsupported
+		}
+		if err := r.ResetInputBuffer(); err != nil {
+			return err
+		}
+	}
+	if out {
+		r, ok := d.Driver.(interface{ ResetOutputBuffer() error })
+		if !ok {
+			return ErrUnsupported
+		}
+		return r.ResetOutputBuffer()
+	}
+	return nil
+}
+
+func (d customDriver) setWriteTimeout(t time.Duration) error {
+	if s, ok := d.Driver.(interface{ SetWriteTimeout(time.Duration) error }); ok {
+		return s.SetWriteTimeout(t)
+	}
+	return ErrUnsupported
+}
+
+// setReadDeadline and setWriteDeadline return ErrUnsupported for a
+// Driver without them, and the Port keeps the deadline itself.
+func (d customDriver) setReadDeadline(t time.Time) error {
+	if s, ok := d.Driver.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return s.SetReadDeadline(t)
+	}
+	return ErrUnsupported
+}
+
+func (d customDriver) setWriteDeadline(t time.Time) error {
+	if s, ok := d.Driver.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return s.SetWriteDeadline(t)
+	}
+	return ErrUnsupported
+}
+
+// getConfig copies the line settings from the Driver's Config, if it
+// has one, and otherwise leaves c zeroed, as for a tcp:// port.
+func (d customDriver) getConfig(c *Config) error {
+	s, ok := d.Driver.(interface{ Config() (Config, error) })
+	if !ok {
+		return nil
+	}
+	dc, err := s.Config()
+	if err != nil {
+		return err
+	}
+	c.Baud, c.Size, c.Parity, c.StopBits = dc.Baud, dc.Size, dc.Parity, dc.StopBits
+	c.RTSFlowControl, c.XONFlowControl = dc.RTSFlowControl, dc.XONFlowControl
+	return nil
+}
+
+func (d customDriver) restore() error {
+	return nil
+}
+
+// customDrainer is a customDriver whose Driver can drain its output.
+// Without it, CloseDrain closes as CloseDefault does, as for network
+// ports.
+type customDrainer struct {
+	customDriver
+}
+
+func (d customDrainer) drain() error {
+	return d.Driver.(interface{ Drain() error }).Drain()
+}
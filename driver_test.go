@@ -0,0 +1,86 @@
+package goserial
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// The OpenFuncs of the schemes the tests register.  Each scheme is
+// registered once, to call whichever func its test set last, so that
+// the tests can run more than once in a process, as with -count.
+var (
+	testDriversMu sync.Mutex
+	testDrivers   = make(map[string]OpenFunc)
+)
+
+// registerTestDriver has OpenPort open scheme:// names with open.
+func registerTestDriver(scheme string, open OpenFunc) {
+	testDriversMu.Lock()
+	defer testDriversMu.Unlock()
+	if _, ok := testDrivers[scheme]; !ok {
+		RegisterDriver(scheme, func(name string, c *Config) (Driver, error) {
+			testDriversMu.Lock()
+			open := testDrivers[scheme]
+			testDriversMu.Unlock()
+			return open(name, c)
+		})
+	}
+	testDrivers[scheme] = open
+}
+
+func TestRegisterDriver(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	var opened string
+	registerTestDriver("testpipe", func(name string, c *Config) (Driver, error) {
+		opened = name
+		return a, nil
+	})
+
+	p, err := OpenPort(&Config{Name: "testpipe://dev0", Baud: 9600, ReadTimeout: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if opened != "dev0" {
+		t.Errorf("opened %q; want dev0", opened)
+	}
+	if got := a.ReadTimeout(); got != 50*time.Millisecond {
+		t.Errorf("read timeout %v; want 50ms", got)
+	}
+
+	if _, err := p.Write([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 8)
+	n, err := b.Read(buf)
+	if err != nil || string(buf[:n]) != "hi" {
+		t.Fatalf("Read = %q, %v; want hi", buf[:n], err)
+	}
+	if _, err := p.Read(buf); err != ErrTimeout {
+		t.Errorf("Read with nothing sent = %v; want ErrTimeout", err)
+	}
+
+	// The optional methods go through to the Pipe end.
+	if err := p.SetBaud(19200); err != nil {
+		t.Fatal(err)
+	}
+	c, err := p.Config()
+	if err != nil || c.Baud != 19200 {
+		t.Errorf("Config = %v, %v; want baud 19200", c.Baud, err)
+	}
+	if err := p.SetDTR(true); err != nil {
+		t.Fatal(err)
+	}
+	if ms, err := b.ModemStatus(); err != nil || !ms.DSR {
+		t.Errorf("peer ModemStatus = %+v, %v; want DSR", ms, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering testpipe twice did not panic")
+		}
+	}()
+	RegisterDriver("testpipe", func(string, *Config) (Driver, error) { return nil, nil })
+}
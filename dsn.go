@@ -0,0 +1,192 @@
+package goserial
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Dial opens the port that dsn describes; see ParseDSN.
+func Dial(dsn string) (*Port, error) {
+	c, err := ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return OpenPort(c)
+}
+
+// shortDSN is the settings suffix of the short form, such as ":9600" or
+// ":115200,8N1".
+var shortDSN = regexp.MustCompile(`^(.+):([0-9]+)(?:,([0-9A-Za-z.]+))?$`)
+
+// ParseDSN turns a port specification, as taken from a command-line
+// flag or a configuration file, into a Config.  It understands a URL,
+// whose query sets the line:
+//
+//	serial:///dev/ttyUSB0?baud=115200&parity=N
+//	serial://COM5?baud=9600&framing=7E1&flow=rtscts&timeout=100ms
+//	rfc2217://host:2217?baud=19200
+//
+// and a short form, with the baud rate and optionally the framing after
+// the last colon:
+//
+//	COM5:115200,8N1
+//	/dev/ttyS0:9600
+//
+// A name alone, such as "COM5" or "tcp://host:4001", opens at 9600 8N1.
+//
+// The query keys are baud; framing, as in the short form, or size (5
+// to 8), parity (N, E, O, M and S, or none, even, odd, mark and space)
+// and stop (1, 1.5 or 2); flow (none, rtscts or xonxoff); timeout,
+// write_timeout and open_timeout, as Go durations; and exclusive, a
+// boolean.  An unknown key or a value out of range gives a ConfigError.
+func ParseDSN(dsn string) (*Config, error) {
+	c := &Config{Baud: DefaultBaud}
+	i := strings.Index(dsn, "://")
+	if i < 0 && strings.HasPrefix(dsn, "serial:") {
+		i = len("serial")
+	}
+	if i < 0 {
+		if m := shortDSN.FindStringSubmatch(dsn); m != nil {
+			c.Name = m[1]
+			if err := c.setDSN("baud", m[2]); err != nil {
+				return nil, err
+			}
+			if m[3] != "" {
+				if err := c.setDSN("framing", m[3]); err != nil {
+					return nil, err
+				}
+			}
+			return c, nil
+		}
+		c.Name = dsn
+		return c, nil
+	}
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, &ConfigError{Field: "DSN", Value: dsn, Err: err}
+	}
+	switch u.Scheme {
+	case "serial":
+		c.Name = u.Host + u.Path
+		if u.Opaque != "" {
+			c.Name = u.Opaque
+		}
+	case "rfc2217", "tcp":
+		c.Name = u.Scheme + "://" + u.Host
+	default:
+		return nil, &ConfigError{Field: "DSN", Value: dsn, Err: fmt.Errorf("unknown scheme %q", u.Scheme)}
+	}
+	if c.Name == "" {
+		return nil, &ConfigError{Field: "DSN", Value: dsn, Err: errors.New("no port name")}
+	}
+	q, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, &ConfigError{Field: "DSN", Value: dsn, Err: err}
+	}
+	// framing first, so that size, parity and stop can amend it.
+	keys := []string{"framing"}
+	for k := range q {
+		if k != "framing" {
+			keys = append(keys, k)
+		}
+	}
+	for _, k := range keys {
+		for _, v := range q[k] {
+			if err := c.setDSN(k, v); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// setDSN sets the setting named key, as ParseDSN takes it, to v.
+func (c *Config) setDSN(key, v string) error {
+	bad := func(err error) error {
+		return &ConfigError{Field: "DSN " + key, Value: v, Err: err}
+	}
+	switch key {
+	case "baud":
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return bad(errors.New("not a baud rate"))
+		}
+		c.Baud = n
+	case "framing":
+		if len(v) < 3 {
+			return bad(errors.New("not like 8N1"))
+		}
+		for _, kv := range [][2]string{{"size", v[:1]}, {"parity", v[1:2]}, {"stop", v[2:]}} {
+			if err := c.setDSN(kv[0], kv[1]); err != nil {
+				return bad(errors.New("not like 8N1"))
+			}
+		}
+	case "size":
+		sizes := map[string]ByteSize{"5": Byte5, "6": Byte6, "7": Byte7, "8": Byte8}
+		s, ok := sizes[v]
+		if !ok {
+			return bad(ErrConfigByteSize)
+		}
+		c.Size = s
+	case "parity":
+		parities := map[string]ParityMode{"n": ParityNone, "e": ParityEven, "o": ParityOdd, "m": ParityMark, "s": ParitySpace}
+		p, ok := parities[strings.ToLower(v)]
+		if !ok {
+			for _, m := range parities {
+				if strings.EqualFold(m.String(), v) {
+					p, ok = m, true
+				}
+			}
+		}
+		if !ok {
+			return bad(ErrConfigParity)
+		}
+		c.Parity = p
+	case "stop":
+		stops := map[string]StopBits{"1": StopBits1, "1.5": StopBits1Half, "2": StopBits2}
+		s, ok := stops[v]
+		if !ok {
+			return bad(ErrConfigStopBits)
+		}
+		c.StopBits = s
+	case "flow":
+		switch strings.ToLower(v) {
+		case "none":
+			c.RTSFlowControl, c.XONFlowControl = false, false
+		case "rtscts":
+			c.RTSFlowControl, c.XONFlowControl = true, false
+		case "xonxoff":
+			c.RTSFlowControl, c.XONFlowControl = false, true
+		default:
+			return bad(errors.New("not none, rtscts or xonxoff"))
+		}
+	case "timeout", "write_timeout", "open_timeout":
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return bad(errors.New("not a duration"))
+		}
+		switch key {
+		case "timeout":
+			WithReadTimeout(d)(c)
+		case "write_timeout":
+			c.WriteTimeout = d
+		case "open_timeout":
+			c.OpenTimeout = d
+		}
+	case "exclusive":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return bad(err)
+		}
+		c.Exclusive = b
+	default:
+		return bad(errors.New("unknown setting"))
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package goserial
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseDSN(t *testing.T) {
+	for _, tc := range []struct {
+		dsn  string
+		want Config
+	}{
+		{"COM5", Config{Name: "COM5", Baud: 9600}},
+		{"COM5:115200,8N1", Config{Name: "COM5", Baud: 115200}},
+		{"/dev/ttyS0:1200,7e2", Config{Name: "/dev/ttyS0", Baud: 1200, Size: Byte7, Parity: ParityEven, StopBits: StopBits2}},
+		{"/dev/serial/by-path/pci-0000:00:14.0-usb-0:2:1.0-port0",
+			Config{Name: "/dev/serial/by-path/pci-0000:00:14.0-usb-0:2:1.0-port0", Baud: 9600}},
+		{"serial:///dev/ttyUSB0?baud=115200&parity=N", Config{Name: "/dev/ttyUSB0", Baud: 115200}},
+		{"serial://COM5?framing=5N1.5&parity=mark&flow=rtscts&timeout=100ms&exclusive=true",
+			Config{Name: "COM5", Baud: 9600, Size: Byte5, Parity: ParityMark, StopBits: StopBits1Half,
+				RTSFlowControl: true, ReadTimeout: 100, Exclusive: true}},
+		{"rfc2217://host:2217?baud=19200&open_timeout=2s",
+			Config{Name: "rfc2217://host:2217", Baud: 19200, OpenTimeout: 2 * time.Second}},
+		{"tcp://host:4001", Config{Name: "tcp://host:4001", Baud: 9600}},
+	} {
+		c, err := ParseDSN(tc.dsn)
+		if err != nil {
+			t.Errorf("ParseDSN(%q): %v", tc.dsn, err)
+			continue
+		}
+		if !reflect.DeepEqual(*c, tc.want) {
+			t.Errorf("ParseDSN(%q) = %+v\nwant %+v", tc.dsn, *c, tc.want)
+		}
+	}
+}
+
+func TestParseDSNErrors(t *testing.T) {
+	for _, dsn := range []string{
+		"COM5:115200,9N1",
+		"COM5:115200,8X1",
+		"serial://COM5?baud=fast",
+		"serial://COM5?speed=9600",
+		"serial://COM5?flow=dtr",
+		"serial://COM5?timeout=-1s",
+		"serial://?baud=9600",
+		"http://host/",
+	} {
+		if c, err := ParseDSN(dsn); err == nil {
+			t.Errorf("ParseDSN(%q) = %+v, want an error", dsn, *c)
+		} else if _, ok := err.(*ConfigError); !ok {
+			t.Errorf("ParseDSN(%q) = %v, want a ConfigError", dsn, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package goserial
+
+import (
+	"time"
+)
+
+// ESPTiming holds the delays used by EnterESPBootloader and HardReset.
+// Zero fields take the defaults used by esptool.
+type ESPTiming struct {
+	Reset time.Duration // how long EN is held low; default 100 ms
+	Boot  time.Duration // how long IO0 stays low after EN is released; default 50 ms
+}
+
+func (t *ESPTiming) reset() time.Duration {
+	if t == nil || t.Reset == 0 {
+		return 100 * time.Millisecond
+	}
+	return t.Reset
+}
+
+func (t *ESPTiming) boot() time.Duration {
+	if t == nil || t.Boot == 0 {
+		return 50 * time.Millisecond
+	}
+	return t.Boot
+}
+
+// EnterESPBootloader resets an ESP8266 or ESP32 into its serial
+// bootloader using the usual auto-program circuit, where RTS drives EN
+// and DTR drives GPIO0 through a pair of transistors: EN is pulled low,
+// GPIO0 is pulled low while EN is released, and then GPIO0 is released.
+// Input received during the sequence is discarded, and both lines are
+// left deasserted.  t may be nil to use the default timing.
+func (p *Port) EnterESPBootloader(t *ESPTiming) error {
+	p.cl.Lock()
+	defer p.cl.Unlock()
+
+	if err := p.setDTR(false); err != nil { // GPIO0 high
+		return err
+	}
+	if err := p.setRTS(true); err != nil { // EN low: chip held in reset
+		return err
+	}
+	time.Sleep(t.reset())
+	if err := p.setDTR(true); err != nil { // GPIO0 low
+		return err
+	}
+	if err := p.setRTS(false); err != nil { // EN high: chip boots
+		return err
+	}
+	time.Sleep(t.boot())
+	if err := p.setDTR(false); err != nil { // GPIO0 released
+		return err
+	}
+	return p.flush(true, false)
+}
+
+// HardReset restarts an ESP8266 or ESP32 into its normal firmware by
+// holding EN low for the reset delay.  Input received during the reset
+// is discarded and both lines are left deasserted.  t may be nil to use
+// the default timing.
+func (p *Port) HardReset(t *ESPTiming) error {
+	p.cl.Lock()
+	defer p.cl.Unlock()
+
+	if err := p.setDTR(false); err != nil {
+		return err
+	}
+	if err := p.setRTS(true); err != nil {
+		return err
+	}
+	time.Sleep(t.reset())
+	if err := p.setRTS(false); err != nil {
+		return err
+	}
+	return p.flush(true, false)
+}
@@ -0,0 +1,66 @@
+package goserial
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FlowControl selects how the port paces the data it sends and
+// receives.
+type FlowControl byte
+
+const (
+	FlowNone    FlowControl = iota
+	FlowRTSCTS              // hardware, with the RTS and CTS lines
+	FlowXONXOFF             // software, with Config.XONChar and XOFFChar
+)
+
+func (f FlowControl) String() string {
+	switch f {
+	case FlowNone:
+		return "none"
+	case FlowRTSCTS:
+		return "RTS/CTS"
+	case FlowXONXOFF:
+		return "XON/XOFF"
+	}
+	return fmt.Sprintf("FlowControl(%d)", byte(f))
+}
+
+// ErrRTSFlowControl is returned by SetRTS and the helpers that pulse RTS
+// while RTS/CTS flow control owns the line.
+var ErrRTSFlowControl = errors.New("goserial: RTS is driven by RTS/CTS flow control")
+
+// flowController is implemented by drivers that can change the flow
+// control of an open port.
+type flowController interface {
+	setFlowControl(f FlowControl) error
+}
+
+// SetFlowControl switches the port's flow control without reopening
+// it, for devices that only honor RTS/CTS or XON/XOFF once they have
+// been told to.  It may be called any number of times.  Output already
+// queued is neither discarded nor altered; it is sent under the new
+// mode.  While FlowRTSCTS is on, the driver owns RTS and SetRTS returns
+// ErrRTSFlowControl; switching away from it hands RTS back, on Windows
+// in the state last set with SetRTS.  Ports that cannot do it return
+// ErrUnsupported.
+func (p *Port) SetFlowControl(f FlowControl) error {
+	switch f {
+	case FlowNone, FlowRTSCTS, FlowXONXOFF:
+	default:
+		return &ConfigError{Field: "FlowControl", Value: f, Err: errors.New("unknown mode")}
+	}
+	fc, ok := p.d.(flowController)
+	if !ok {
+		return ErrUnsupported
+	}
+	p.cl.Lock()
+	defer p.cl.Unlock()
+	err := fc.setFlowControl(f)
+	p.traceControl("flow control", err, f)
+	if err == nil {
+		p.flow = f
+	}
+	return err
+}
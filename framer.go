@@ -0,0 +1,257 @@
+package goserial
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// ErrFrameTooLong is returned by Framer.ReadFrame for a frame longer
+// than FramerConfig.MaxSize, which is dropped.
+var ErrFrameTooLong = errors.New("goserial: frame too long")
+
+// FramerConfig says how a Framer splits the stream into frames.
+// Exactly one of Delimiter, Length, LengthSize and Gap must be set.
+type FramerConfig struct {
+	// Delimiter ends each frame, as "\r\n" does a line.  The frames
+	// returned leave it out.
+	Delimiter []byte
+
+	// Length is the size of every frame.
+	Length int
+
+	// LengthSize, 1, 2 or 4, is the size of a length field found at
+	// LengthOffset in each frame, big-endian unless LittleEndian is
+	// set.  It counts the bytes after it, plus LengthAdjust, which is
+	// for protocols whose length also covers the header or leaves out
+	// a trailing checksum.  The frames returned include the header.  A
+	// length that makes a frame shorter than its header is taken as no
+	// bytes after the field.
+	LengthSize   int
+	LengthOffset int
+	LittleEndian bool
+	LengthAdjust int
+
+	// Gap ends a frame when the line has been idle that long, as a
+	// Modbus RTU frame ends after 3.5 character times.  It is timed
+	// with the read timeout, so the reader must be a TimeoutReader; see
+	// CopyUntilIdle for the resolution that gives.
+	Gap time.Duration
+
+	// MaxSize bounds the frames of every mode but Length; zero means
+	// 64 KiB.
+	MaxSize int
+}
+
+// A Framer splits the byte stream a reader delivers into frames, taking
+// care of frames that arrive over several reads and reads that hold
+// several frames.
+type Framer struct {
+	r     io.Reader
+	c     FramerConfig
+	max   int
+	buf   []byte // read and not yet returned as part of a frame
+	chunk []byte // for reads
+	err   error  // from a read that also returned data
+	skip  bool   // dropping an overlong frame up to its delimiter
+}
+
+// NewFramer returns a Framer reading from r, usually a Port.  A c that
+// does not choose exactly one mode, or has values out of range, gives a
+// ConfigError.
+func NewFramer(r io.Reader, c FramerConfig) (*Framer, error) {
+	modes := 0
+	for _, set := range []bool{len(c.Delimiter) > 0, c.Length != 0, c.LengthSize != 0, c.Gap != 0} {
+		if set {
+			modes++
+		}
+	}
+	switch {
+	case modes != 1:
+		return nil, &ConfigError{Field: "FramerConfig", Value: c, Err: errors.New("needs exactly one of Delimiter, Length, LengthSize and Gap")}
+	case c.Length < 0:
+		return nil, &ConfigError{Field: "Length", Value: c.Length, Err: errors.New("negative")}
+	case c.LengthSize != 0 && c.LengthSize != 1 && c.LengthSize != 2 && c.LengthSize != 4:
+		return nil, &ConfigError{Field: "LengthSize", Value: c.LengthSize, Err: errors.New("not 1, 2 or 4")}
+	case c.LengthOffset < 0:
+		return nil, &ConfigError{Field: "LengthOffset", Value: c.LengthOffset, Err: errors.New("negative")}
+	case c.Gap < 0:
+		return nil, &ConfigError{Field: "Gap", Value: c.Gap, Err: errors.New("negative")}
+	case c.MaxSize < 0:
+		return nil, &ConfigError{Field: "MaxSize", Value: c.MaxSize, Err: errors.New("negative")}
+	}
+	if _, ok := r.(TimeoutReader); c.Gap > 0 && !ok {
+		return nil, &ConfigError{Field: "Gap", Value: c.Gap, Err: errors.New("needs a TimeoutReader")}
+	}
+	f := &Framer{r: r, c: c, max: c.MaxSize, chunk: make([]byte, 4096)}
+	if f.max == 0 {
+		f.max = 64 << 10
+	}
+	return f, nil
+}
+
+// ReadFrame returns the next frame, in a slice of its own.  An error
+// from the reader, such as ErrTimeout, is returned as it is, and the
+// part of a frame read so far is kept for the next call; io.EOF in the
+// middle of a frame gives io.ErrUnexpectedEOF.  A frame longer than
+// MaxSize is dropped with ErrFrameTooLong, and ReadFrame then carries
+// on from the next delimiter or gap; with LengthSize, from the next
+// byte read, as the stream cannot be resynchronized.
+func (f *Framer) ReadFrame() ([]byte, error) {
+	if f.c.Gap > 0 {
+		return f.readGap()
+	}
+	for {
+		if frame, err := f.next(); frame != nil || err != nil {
+			return frame, err
+		}
+		if err := f.more(); err != nil {
+			if err == io.EOF && len(f.buf) > 0 && !f.skip {
+				f.buf = nil
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+}
+
+// more reads into buf.  An error that came with data is kept until
+// that data has been looked at.
+func (f *Framer) more() error {
+	if err := f.err; err != nil {
+		f.err = nil
+		return err
+	}
+	n, err := f.r.Read(f.chunk)
+	f.buf = append(f.buf, f.chunk[:n]...)
+	if n > 0 {
+		f.err = err
+		return nil
+	}
+	return err
+}
+
+// take returns the first n bytes of buf as a frame and drops them and
+// the skip bytes after them.
+func (f *Framer) take(n, skip int) []byte {
+	frame := make([]byte, n) // not nil even when empty
+	copy(frame, f.buf)
+	f.buf = f.buf[n+skip:]
+	return frame
+}
+
+// next returns the frame at the start of buf, or nil if it has not all
+// arrived yet.
+func (f *Framer) next() ([]byte, error) {
+	switch {
+	case len(f.c.Delimiter) > 0:
+		return f.nextDelimited()
+	case f.c.Length > 0:
+		if len(f.buf) < f.c.Length {
+			return nil, nil
+		}
+		return f.take(f.c.Length, 0), nil
+	}
+
+	hdr := f.c.LengthOffset + f.c.LengthSize
+	if len(f.buf) < hdr {
+		return nil, nil
+	}
+	field := f.buf[f.c.LengthOffset:hdr]
+	var order binary.ByteOrder = binary.BigEndian
+	if f.c.LittleEndian {
+		order = binary.LittleEndian
+	}
+	var n int64
+	switch f.c.LengthSize {
+	case 1:
+		n = int64(field[0])
+	case 2:
+		n = int64(order.Uint16(field))
+	case 4:
+		n = int64(order.Uint32(field))
+	}
+	size := int64(hdr) + n + int64(f.c.LengthAdjust)
+	if size < int64(hdr) {
+		size = int64(hdr)
+	}
+	if size > int64(f.max) {
+		f.buf = f.buf[:0]
+		return nil, ErrFrameTooLong
+	}
+	if len(f.buf) < int(size) {
+		return nil, nil
+	}
+	return f.take(int(size), 0), nil
+}
+
+func (f *Framer) nextDelimited() ([]byte, error) {
+	d := f.c.Delimiter
+	i := bytes.Index(f.buf, d)
+	if f.skip {
+		if i < 0 {
+			// Keep what may be the start of the delimiter.
+			if keep := len(d) - 1; len(f.buf) > keep {
+				f.buf = f.buf[len(f.buf)-keep:]
+			}
+			return nil, nil
+		}
+		f.buf = f.buf[i+len(d):]
+		f.skip = false
+		i = bytes.Index(f.buf, d)
+	}
+	switch {
+	case i > f.max:
+		f.buf = f.buf[i+len(d):]
+		return nil, ErrFrameTooLong
+	case i < 0 && len(f.buf) > f.max+len(d)-1:
+		f.skip = true
+		return nil, ErrFrameTooLong
+	case i < 0:
+		return nil, nil
+	}
+	return f.take(i, len(d)), nil
+}
+
+// readGap reads a frame in Gap mode: the first byte within the reader's
+// own read timeout, the rest with the read timeout set to Gap, which is
+// put back afterwards.
+func (f *Framer) readGap() ([]byte, error) {
+	for len(f.buf) == 0 {
+		if err := f.more(); err != nil {
+			return nil, err
+		}
+	}
+	tr := f.r.(TimeoutReader)
+	old := tr.ReadTimeout()
+	if err := tr.SetReadTimeout(f.c.Gap); err != nil {
+		return nil, err
+	}
+	defer tr.SetReadTimeout(old)
+
+	tooLong := false
+	for {
+		err := f.more()
+		if len(f.buf) > f.max {
+			tooLong = true
+			f.buf = f.buf[:0]
+		}
+		if err == ErrTimeout {
+			break
+		}
+		if err != nil {
+			// Hand back what arrived before it first.
+			f.err = err
+			break
+		}
+	}
+	if tooLong {
+		f.buf = nil
+		return nil, ErrFrameTooLong
+	}
+	frame := f.buf
+	f.buf = nil
+	return frame, nil
+}
@@ -0,0 +1,159 @@
+package goserial
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// readFrames reads frames from f until an error, returning them as
+// strings along with the error.
+func readFrames(f *Framer) ([]string, error) {
+	var frames []string
+	for {
+		frame, err := f.ReadFrame()
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, string(frame))
+	}
+}
+
+func TestFramer(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		c     FramerConfig
+		in    string
+		want  []string
+		final error
+	}{
+		{"delimiter", FramerConfig{Delimiter: []byte("\r\n")}, "one\r\ntwo\r\n\r\nthree\r\n",
+			[]string{"one", "two", "", "three"}, io.EOF},
+		{"delimiter cut off", FramerConfig{Delimiter: []byte("\n")}, "one\ntw",
+			[]string{"one"}, io.ErrUnexpectedEOF},
+		{"length", FramerConfig{Length: 3}, "abcdefghi", []string{"abc", "def", "ghi"}, io.EOF},
+		{"prefix", FramerConfig{LengthSize: 1}, "\x02ab\x00\x03cde", []string{"\x02ab", "\x00", "\x03cde"}, io.EOF},
+		{"prefix offset", FramerConfig{LengthSize: 2, LengthOffset: 1, LittleEndian: true, LengthAdjust: 1},
+			"A\x02\x00xyzB\x00\x00k", []string{"A\x02\x00xyz", "B\x00\x00k"}, io.EOF},
+		{"prefix short", FramerConfig{LengthSize: 1, LengthAdjust: -4}, "\x01\x01", []string{"\x01", "\x01"}, io.EOF},
+	} {
+		for _, split := range []bool{false, true} {
+			var r io.Reader = bytes.NewReader([]byte(tc.in))
+			if split {
+				r = iotest.OneByteReader(r)
+			}
+			f, err := NewFramer(r, tc.c)
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+			got, err := readFrames(f)
+			if err != tc.final || len(got) != len(tc.want) {
+				t.Errorf("%s (split %v): frames %q, %v; want %q, %v", tc.name, split, got, err, tc.want, tc.final)
+				continue
+			}
+			for i := range got {
+				if got[i] != tc.want[i] {
+					t.Errorf("%s (split %v): frame %d = %q, want %q", tc.name, split, i, got[i], tc.want[i])
+				}
+			}
+		}
+	}
+}
+
+func TestFramerTooLong(t *testing.T) {
+	in := "ok\n" + "0123456789" + "\n" + "abcdefghijklmnopqrstuvwxyz" + "\nafter\n"
+	f, err := NewFramer(iotest.HalfReader(bytes.NewReader([]byte(in))), FramerConfig{Delimiter: []byte("\n"), MaxSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for {
+		frame, err := f.ReadFrame()
+		if err == ErrFrameTooLong {
+			got = append(got, "too long")
+			continue
+		}
+		if err != nil {
+			break
+		}
+		got = append(got, string(frame))
+	}
+	want := []string{"ok", "too long", "too long", "after"}
+	if len(got) != len(want) {
+		t.Fatalf("frames %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Errorf("frame %d = %q, want %q", i, got[i], want[i])
+		}
+	}
+
+	f, _ = NewFramer(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff}), FramerConfig{LengthSize: 4, MaxSize: 100})
+	if _, err := f.ReadFrame(); err != ErrFrameTooLong {
+		t.Errorf("huge length: %v, want ErrFrameTooLong", err)
+	}
+}
+
+func TestFramerTimeout(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	a.SetReadTimeout(20 * time.Millisecond)
+	f, _ := NewFramer(a, FramerConfig{Delimiter: []byte(";")})
+
+	b.Write([]byte("par"))
+	if _, err := f.ReadFrame(); err != ErrTimeout {
+		t.Fatalf("partial frame: %v, want ErrTimeout", err)
+	}
+	b.Write([]byte("tial;"))
+	if frame, err := f.ReadFrame(); err != nil || string(frame) != "partial" {
+		t.Errorf("ReadFrame = %q, %v; want \"partial\"", frame, err)
+	}
+}
+
+func TestFramerGap(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	a.SetReadTimeout(time.Second)
+	f, err := NewFramer(a, FramerConfig{Gap: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		b.Write([]byte("ab"))
+		time.Sleep(10 * time.Millisecond)
+		b.Write([]byte("cd"))
+		time.Sleep(200 * time.Millisecond)
+		b.Write([]byte("ef"))
+	}()
+	for _, want := range []string{"abcd", "ef"} {
+		if frame, err := f.ReadFrame(); err != nil || string(frame) != want {
+			t.Errorf("ReadFrame = %q, %v; want %q", frame, err, want)
+		}
+	}
+	if d := a.ReadTimeout(); d != time.Second {
+		t.Errorf("ReadTimeout after ReadFrame = %v, want 1s", d)
+	}
+}
+
+func TestNewFramerErrors(t *testing.T) {
+	r := bytes.NewReader(nil)
+	for _, c := range []FramerConfig{
+		{},
+		{Length: 4, Delimiter: []byte("\n")},
+		{LengthSize: 3},
+		{Length: -1},
+		{Delimiter: []byte("\n"), MaxSize: -1},
+		{Gap: time.Millisecond}, // r is not a TimeoutReader
+	} {
+		if _, err := NewFramer(r, c); err == nil {
+			t.Errorf("NewFramer accepted %+v", c)
+		} else if _, ok := err.(*ConfigError); !ok {
+			t.Errorf("NewFramer(%+v) = %v, want a ConfigError", c, err)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+// +build linux darwin freebsd netbsd openbsd dragonfly solaris
+
+package goserial
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// FromFd makes a Port of fd, an open tty descriptor such as systemd
+// socket activation, a sandbox broker or a pty library hands over, and
+// sets it up as OpenPort would a port it opened, from c; c.Name, if
+// set, names the port, and c.OpenTimeout is ignored.  The descriptor is
+// put into non-blocking mode, for the runtime poller, and the Port
+// takes it over: it is closed with the Port, or at once if FromFd
+// fails.  On Windows FromHandle is the equivalent.
+func FromFd(fd uintptr, c *Config) (*Port, error) {
+	cc := *c
+	if cc.Name == "" {
+		cc.Name = fmt.Sprintf("fd %d", fd)
+	}
+	if err := cc.check(); err != nil {
+		syscall.Close(int(fd))
+		return nil, err
+	}
+	// Before os.NewFile, which only puts a non-blocking descriptor on
+	// the poller.
+	if err := syscall.SetNonblock(int(fd), true); err != nil {
+		syscall.Close(int(fd))
+		return nil, os.NewSyscallError("fcntl", err)
+	}
+	d, err := openFile(os.NewFile(fd, cc.Name), &cc)
+	if err != nil {
+		return nil, err
+	}
+	return wrapDriver(d, &cc)
+}
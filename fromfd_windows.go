@@ -0,0 +1,30 @@
+package goserial
+
+import "syscall"
+
+// FromHandle makes a Port of h, an open comm device handle such as a
+// broker process hands over, and sets it up as OpenPort would a port it
+// opened, from c; c.Name, if set, names the port, and c.OpenTimeout is
+// ignored.  h must have been opened with FILE_FLAG_OVERLAPPED, as the
+// Port's reads and writes are.  The Port takes it over: it is closed
+// with the Port, or at once if FromHandle fails.  On POSIX FromFd is
+// the equivalent.
+func FromHandle(h syscall.Handle, c *Config) (*Port, error) {
+	err := c.check()
+	if err == nil {
+		err = checkWindows(c)
+	}
+	if err != nil {
+		syscall.CloseHandle(h)
+		return nil, err
+	}
+	cc := *c
+	if cc.Name == "" {
+		cc.Name = "handle"
+	}
+	d, err := openHandle(h, cc.Name, &cc)
+	if err != nil {
+		return nil, err
+	}
+	return wrapDriver(d, &cc)
+}
@@ -0,0 +1,61 @@
+// +build linux
+
+package goserial
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// latencyTimerPath returns the sysfs file holding the latency timer of
+// the FTDI adapter behind the port, or ErrUnsupported if the port is
+// not on one.  The device name is resolved first, so that the links
+// under /dev/serial work too.
+func (p *serialPort) latencyTimerPath() (string, error) {
+	dev, err := filepath.EvalSymlinks(p.f.Name())
+	if err != nil {
+		return "", err
+	}
+	sys := "/sys/class/tty/" + filepath.Base(dev) + "/device"
+	drv, err := filepath.EvalSymlinks(sys + "/driver")
+	if err != nil || filepath.Base(drv) != "ftdi_sio" {
+		return "", ErrUnsupported
+	}
+	return sys + "/latency_timer", nil
+}
+
+func (p *serialPort) latencyTimer() (int, error) {
+	path, err := p.latencyTimerPath()
+	if err != nil {
+		return 0, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// setLatencyTimer writes the latency timer.  The first time it is
+// changed, Close is arranged to write back the value found.
+func (p *serialPort) setLatencyTimer(ms int) error {
+	path, err := p.latencyTimerPath()
+	if err != nil {
+		return err
+	}
+	if !p.latencySaved {
+		orig, err := p.latencyTimer()
+		if err != nil {
+			return err
+		}
+		if orig != ms {
+			p.latencySaved = true
+			p.undo = append(p.undo, func() {
+				ioutil.WriteFile(path, []byte(strconv.Itoa(orig)), 0)
+			})
+		}
+	}
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(ms)), 0)
+}
@@ -0,0 +1,137 @@
+// +build windows
+
+package goserial
+
+import (
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// The FTDI driver keeps the settings of each adapter it has seen under
+// a key named after its USB IDs and serial number.
+const ftdiBusKey = `SYSTEM\CurrentControlSet\Enum\FTDIBUS`
+
+const (
+	errorInvalidData = syscall.Errno(13)  // ERROR_INVALID_DATA
+	errorNoMoreItems = syscall.Errno(259) // ERROR_NO_MORE_ITEMS
+)
+
+// ftdiParamsKey returns the "Device Parameters" key of the FTDI adapter
+// whose PortName is the port's COM name, or ErrUnsupported if no FTDI
+// adapter has that name.
+func (p *serialPort) ftdiParamsKey() (string, error) {
+	com := strings.TrimPrefix(p.f.Name(), `\\.\`)
+
+	var bus syscall.Handle
+	err := syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE,
+		syscall.StringToUTF16Ptr(ftdiBusKey), 0, syscall.KEY_READ, &bus)
+	if err == syscall.ERROR_FILE_NOT_FOUND {
+		return "", ErrUnsupported
+	}
+	if err != nil {
+		return "", err
+	}
+	defer syscall.RegCloseKey(bus)
+
+	name := make([]uint16, 256)
+	for i := uint32(0); ; i++ {
+		n := uint32(len(name))
+		err := syscall.RegEnumKeyEx(bus, i, &name[0], &n, nil, nil, nil, nil)
+		if err == errorNoMoreItems {
+			return "", ErrUnsupported
+		}
+		if err != nil {
+			return "", err
+		}
+		key := ftdiBusKey + `\` + syscall.UTF16ToString(name[:n]) + `\0000\Device Parameters`
+		if s, err := regString(key, "PortName"); err == nil && strings.EqualFold(s, com) {
+			return key, nil
+		}
+	}
+}
+
+func (p *serialPort) latencyTimer() (int, error) {
+	key, err := p.ftdiParamsKey()
+	if err != nil {
+		return 0, err
+	}
+	v, err := regDWORD(key, "LatencyTimer")
+	return int(v), err
+}
+
+// setLatencyTimer writes the LatencyTimer value.  Unlike on Linux the
+// setting outlives the port, and the original is not put back on Close.
+func (p *serialPort) setLatencyTimer(ms int) error {
+	if err := loadProcs(nRegSetValueEx); err != nil {
+		return err
+	}
+	key, err := p.ftdiParamsKey()
+	if err != nil {
+		return err
+	}
+	cur, err := regDWORD(key, "LatencyTimer")
+	if err != nil {
+		return err
+	}
+
+	var h syscall.Handle
+	err = syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE,
+		syscall.StringToUTF16Ptr(key), 0, syscall.KEY_SET_VALUE, &h)
+	if err == nil {
+		defer syscall.RegCloseKey(h)
+		v := uint32(ms)
+		r, _, _ := syscall.Syscall6(nRegSetValueEx.Addr(), 6,
+			uintptr(h),
+			uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr("LatencyTimer"))),
+			0,
+			syscall.REG_DWORD,
+			uintptr(unsafe.Pointer(&v)),
+			unsafe.Sizeof(v))
+		if r != 0 {
+			err = syscall.Errno(r)
+		}
+	}
+	if err == syscall.ERROR_ACCESS_DENIED {
+		return &ElevationError{Key: key, Value: "LatencyTimer", Current: cur, Err: err}
+	}
+	return err
+}
+
+// regString and regDWORD read a value of a key under HKEY_LOCAL_MACHINE.
+func regString(key, value string) (string, error) {
+	buf := make([]uint16, 64)
+	typ, n, err := regQuery(key, value, unsafe.Pointer(&buf[0]), uint32(len(buf)*2))
+	if err != nil {
+		return "", err
+	}
+	if typ != syscall.REG_SZ {
+		return "", errorInvalidData
+	}
+	return syscall.UTF16ToString(buf[:n/2]), nil
+}
+
+func regDWORD(key, value string) (uint32, error) {
+	var v uint32
+	typ, _, err := regQuery(key, value, unsafe.Pointer(&v), uint32(unsafe.Sizeof(v)))
+	if err != nil {
+		return 0, err
+	}
+	if typ != syscall.REG_DWORD {
+		return 0, errorInvalidData
+	}
+	return v, nil
+}
+
+func regQuery(key, value string, buf unsafe.Pointer, size uint32) (typ, n uint32, err error) {
+	var h syscall.Handle
+	err = syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE,
+		syscall.StringToUTF16Ptr(key), 0, syscall.KEY_READ, &h)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer syscall.RegCloseKey(h)
+	n = size
+	err = syscall.RegQueryValueEx(h, syscall.StringToUTF16Ptr(value), nil, &typ, (*byte)(buf), &n)
+	return typ, n, err
+}
@@ -0,0 +1,54 @@
+package goserial
+
+// readGather is Read for a port opened with InterCharacterTimeout or
+// MinimumReadSize: it reads as usual for the first byte, then with the
+// read timeout set to the gap allowed between bytes until it has what
+// Config asks for.  Once it has data, an error or the end of the gap
+// ends the call without an error; the error comes back next time.
+func (p *Port) readGather(b []byte) (int, error) {
+	n, err := p.readOnce(b)
+	if err != nil || n == 0 {
+		return n, err
+	}
+	want := len(b)
+	if p.minRead > 0 && p.minRead < want {
+		want = p.minRead
+	}
+	if n >= want {
+		return n, nil
+	}
+
+	p.tl.Lock()
+	old := p.readTimeout
+	gap := p.interChar
+	if gap == 0 {
+		gap = old
+	}
+	if gap != old {
+		if err := p.d.setReadTimeout(gap); err != nil {
+			p.tl.Unlock()
+			return n, nil
+		}
+		p.readTimeout = gap
+	}
+	p.tl.Unlock()
+
+	for n < want {
+		k, err := p.readOnce(b[n:])
+		n += k
+		if err != nil {
+			break
+		}
+	}
+
+	if gap != old {
+		// Put back the read timeout, unless it was changed meanwhile.
+		p.tl.Lock()
+		if p.readTimeout == gap {
+			p.d.setReadTimeout(old)
+			p.readTimeout = old
+		}
+		p.tl.Unlock()
+	}
+	return n, nil
+}
@@ -0,0 +1,59 @@
+package goserial
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterCharacterTimeout(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	a.SetReadTimeout(time.Second)
+	a.interChar = 50 * time.Millisecond
+
+	go func() {
+		b.Write([]byte("ab"))
+		time.Sleep(10 * time.Millisecond)
+		b.Write([]byte("cd"))
+		time.Sleep(200 * time.Millisecond)
+		b.Write([]byte("ef"))
+	}()
+	buf := make([]byte, 16)
+	if n, err := a.Read(buf); err != nil || string(buf[:n]) != "abcd" {
+		t.Errorf("first frame = %q, %v; want \"abcd\"", buf[:n], err)
+	}
+	if d := a.ReadTimeout(); d != time.Second {
+		t.Errorf("ReadTimeout after Read = %v, want 1s", d)
+	}
+	if n, err := a.Read(buf); err != nil || string(buf[:n]) != "ef" {
+		t.Errorf("second frame = %q, %v; want \"ef\"", buf[:n], err)
+	}
+}
+
+func TestMinimumReadSize(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	a.SetReadTimeout(200 * time.Millisecond)
+	a.minRead = 3
+
+	go func() {
+		b.Write([]byte("a"))
+		time.Sleep(20 * time.Millisecond)
+		b.Write([]byte("bc"))
+	}()
+	buf := make([]byte, 16)
+	if n, err := a.Read(buf); err != nil || string(buf[:n]) != "abc" {
+		t.Errorf("Read = %q, %v; want \"abc\"", buf[:n], err)
+	}
+
+	// A gap longer than the read timeout ends the Read early.
+	b.Write([]byte("x"))
+	if n, err := a.Read(buf); err != nil || string(buf[:n]) != "x" {
+		t.Errorf("Read = %q, %v; want \"x\"", buf[:n], err)
+	}
+	if _, err := a.Read(buf); err != ErrTimeout {
+		t.Errorf("Read with nothing sent = %v, want ErrTimeout", err)
+	}
+}
@@ -0,0 +1,238 @@
+package goserial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// A Pin is one of the modem lines as a GPIO treats it: DTR and RTS are
+// outputs, the modem status lines inputs.
+type Pin uint8
+
+const (
+	PinDTR Pin = iota
+	PinRTS
+	PinCTS
+	PinDSR
+	PinRI
+	PinDCD
+)
+
+func (p Pin) String() string {
+	switch p {
+	case PinDTR:
+		return "DTR"
+	case PinRTS:
+		return "RTS"
+	case PinCTS:
+		return "CTS"
+	case PinDSR:
+		return "DSR"
+	case PinRI:
+		return "RI"
+	case PinDCD:
+		return "DCD"
+	}
+	return fmt.Sprintf("Pin(%d)", byte(p))
+}
+
+// Output reports whether p is one of the two outputs.
+func (p Pin) Output() bool {
+	return p == PinDTR || p == PinRTS
+}
+
+// A GPIO drives and reads a port's modem lines as two outputs and four
+// inputs, for the reset and boot mode pins of development boards and
+// the like.  Pins go by their names, "DTR" to "DCD", or by those given
+// with Define.  A pin is on while its line is asserted, or for one
+// defined as inverted while it is not.
+type GPIO struct {
+	p *Port
+
+	mu       sync.Mutex
+	pins     map[string]gpioPin
+	debounce time.Duration
+}
+
+type gpioPin struct {
+	pin    Pin
+	invert bool
+}
+
+// NewGPIO returns a GPIO on the modem lines of p.
+func NewGPIO(p *Port) *GPIO {
+	g := &GPIO{p: p, pins: make(map[string]gpioPin)}
+	for pin := PinDTR; pin <= PinDCD; pin++ {
+		g.pins[pin.String()] = gpioPin{pin: pin}
+	}
+	return g
+}
+
+// Define names pin, for instance "EN" for the RTS line that resets an
+// ESP32.  invert makes the named pin on while the line is deasserted,
+// as behind a transistor that pulls the board's pin low.
+func (g *GPIO) Define(name string, pin Pin, invert bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.pins[name] = gpioPin{pin: pin, invert: invert}
+}
+
+// SetDebounce has Get and WaitFor take an input's state only once it has
+// held for d, reading it every millisecond until it does; zero, the
+// default, takes the first reading.
+func (g *GPIO) SetDebounce(d time.Duration) {
+	g.mu.Lock()
+	g.debounce = d
+	g.mu.Unlock()
+}
+
+func (g *GPIO) pin(name string) (gpioPin, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.pins[name]
+	if !ok {
+		return gpioPin{}, &ConfigError{Field: "GPIO pin", Value: name, Err: errors.New("not defined")}
+	}
+	return p, nil
+}
+
+// Set turns the named output on or off.
+func (g *GPIO) Set(name string, on bool) error {
+	p, err := g.pin(name)
+	if err != nil {
+		return err
+	}
+	g.p.cl.Lock()
+	defer g.p.cl.Unlock()
+	return g.set(name, p, on)
+}
+
+// set is Set for a pin already looked up.  The port's cl is held.
+func (g *GPIO) set(name string, p gpioPin, on bool) error {
+	switch p.pin {
+	case PinDTR:
+		return g.p.setDTR(on != p.invert)
+	case PinRTS:
+		return g.p.setRTS(on != p.invert)
+	}
+	return &ConfigError{Field: "GPIO pin", Value: name, Err: errors.New("not an output")}
+}
+
+// Get reads the named pin: an input as debounced, an output as last
+// set, where the driver can tell.
+func (g *GPIO) Get(name string) (bool, error) {
+	p, err := g.pin(name)
+	if err != nil {
+		return false, err
+	}
+	if p.pin.Output() {
+		dtr, rts, err := g.p.d.outputLines()
+		if err != nil {
+			return false, err
+		}
+		return (p.pin == PinDTR && dtr || p.pin == PinRTS && rts) != p.invert, nil
+	}
+	g.mu.Lock()
+	debounce := g.debounce
+	g.mu.Unlock()
+	on, err := g.read(p)
+	for settled := time.Now().Add(debounce); err == nil && time.Now().Before(settled); {
+		time.Sleep(time.Millisecond)
+		var now bool
+		if now, err = g.read(p); now != on {
+			on, settled = now, time.Now().Add(debounce)
+		}
+	}
+	return on, err
+}
+
+// read takes one reading of the input p.
+func (g *GPIO) read(p gpioPin) (bool, error) {
+	s, err := g.p.ModemStatus()
+	if err != nil {
+		return false, err
+	}
+	var on bool
+	switch p.pin {
+	case PinCTS:
+		on = s.CTS
+	case PinDSR:
+		on = s.DSR
+	case PinRI:
+		on = s.RI
+	case PinDCD:
+		on = s.DCD
+	}
+	return on != p.invert, nil
+}
+
+// WaitFor waits until the named input is on or off as asked, debounced,
+// or until ctx is done.
+func (g *GPIO) WaitFor(ctx context.Context, name string, on bool) error {
+	p, err := g.pin(name)
+	if err != nil {
+		return err
+	}
+	if p.pin.Output() {
+		return &ConfigError{Field: "GPIO pin", Value: name, Err: errors.New("not an input")}
+	}
+	line := map[Pin]ModemLines{PinCTS: ModemCTS, PinDSR: ModemDSR, PinRI: ModemRI, PinDCD: ModemDCD}[p.pin]
+	for {
+		now, err := g.Get(name)
+		if err != nil || now == on {
+			return err
+		}
+		if _, err := g.p.WaitForLineChange(ctx, line); err != nil {
+			return err
+		}
+	}
+}
+
+// A Step of a GPIO sequence turns an output on or off and then holds
+// the lines as they are for Hold.
+type Step struct {
+	Pin  string
+	On   bool
+	Hold time.Duration
+}
+
+// Sequence runs steps in order, with no other change to the modem lines
+// in between, for the likes of a bootloader entry:
+//
+//	g.Define("EN", serial.PinRTS, true)
+//	g.Define("IO0", serial.PinDTR, true)
+//	g.Sequence(
+//		serial.Step{Pin: "IO0", On: true},
+//		serial.Step{Pin: "EN", On: false, Hold: 100 * time.Millisecond},
+//		serial.Step{Pin: "IO0", On: false},
+//		serial.Step{Pin: "EN", On: true, Hold: 50 * time.Millisecond},
+//		serial.Step{Pin: "IO0", On: true},
+//	)
+//
+// The holds are as accurate as the duration of PulseDTR.  Every pin is
+// looked up before the first step, and a failed step ends the sequence.
+func (g *GPIO) Sequence(steps ...Step) error {
+	pins := make([]gpioPin, len(steps))
+	for i, s := range steps {
+		p, err := g.pin(s.Pin)
+		if err != nil {
+			return err
+		}
+		if !p.pin.Output() {
+			return &ConfigError{Field: "GPIO pin", Value: s.Pin, Err: errors.New("not an output")}
+		}
+		pins[i] = p
+	}
+	g.p.cl.Lock()
+	defer g.p.cl.Unlock()
+	for i, s := range steps {
+		if err := g.set(s.Pin, pins[i], s.On); err != nil {
+			return err
+		}
+		time.Sleep(s.Hold)
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package goserial
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestGPIO(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	g, peer := NewGPIO(a), NewGPIO(b)
+	g.Define("EN", PinRTS, true)
+	peer.Define("BUSY", PinCTS, false)
+	peer.SetDebounce(5 * time.Millisecond)
+
+	// EN is off while RTS is asserted, which the peer sees on CTS.
+	if err := g.Set("EN", false); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := g.Get("EN"); on || err != nil {
+		t.Errorf("Get(EN) = %v, %v; want off", on, err)
+	}
+	if on, err := peer.Get("BUSY"); !on || err != nil {
+		t.Errorf("peer Get(BUSY) = %v, %v; want on", on, err)
+	}
+
+	if err := g.Set("CTS", true); err == nil {
+		t.Error("Set of an input succeeded")
+	}
+	if _, err := g.Get("IO0"); err == nil {
+		t.Error("Get of an undefined pin succeeded")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		g.Sequence(Step{Pin: "DTR", On: true, Hold: 5 * time.Millisecond}, Step{Pin: "EN", On: true})
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := peer.WaitFor(ctx, "BUSY", false); err != nil {
+		t.Fatal(err)
+	}
+	if on, err := peer.Get("DSR"); !on || err != nil {
+		t.Errorf("peer Get(DSR) after the sequence = %v, %v; want on", on, err)
+	}
+}
@@ -0,0 +1,81 @@
+package goserial
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrIdle is what a ReconnectingPort with ReconnectPolicy.IdleTimeout
+// reports, to OnStateChange, when it reopens a device gone quiet.
+var ErrIdle = errors.New("goserial: nothing received within the idle timeout")
+
+// idleWatch is the watchdog set by SetIdleTimeout.
+type idleWatch struct {
+	d     time.Duration
+	f     func()
+	since int64 // UnixNano; silence counts from the later of this and the last read
+	timer *time.Timer
+}
+
+// SetIdleTimeout calls onSilence once nothing has been received for d,
+// and again each further d the silence lasts, to tell a link that has
+// died quietly, with the adapter wedged or the device off, from one
+// that is merely slow.  Only bytes returned by Read count, so something
+// has to keep reading the port; the silence before the first is counted
+// from the call.  onSilence runs on a goroutine of its own, and may
+// call the Port, to reset its input or close it, say; a
+// ReconnectingPort reopens the device itself given
+// ReconnectPolicy.IdleTimeout.  A d of zero, or a nil onSilence, stops
+// the watchdog, as does Close.
+func (p *Port) SetIdleTimeout(d time.Duration, onSilence func()) error {
+	if d < 0 {
+		return &ConfigError{Field: "SetIdleTimeout", Value: d, Err: errors.New("negative duration")}
+	}
+	p.il.Lock()
+	defer p.il.Unlock()
+	if p.idle != nil {
+		p.idle.timer.Stop()
+		p.idle = nil
+	}
+	if d > 0 && onSilence != nil {
+		w := &idleWatch{d: d, f: onSilence, since: time.Now().UnixNano()}
+		w.timer = time.AfterFunc(d, func() { p.checkIdle(w) })
+		p.idle = w
+	}
+	p.traceControl("idle timeout", nil, d)
+	return nil
+}
+
+// checkIdle runs when w's timer fires, calling its function if the
+// port has indeed been silent for w.d, and sets the timer again.
+func (p *Port) checkIdle(w *idleWatch) {
+	p.il.Lock()
+	if p.idle != w {
+		p.il.Unlock()
+		return
+	}
+	last := atomic.LoadInt64(&p.stats.lastRead)
+	if last < w.since {
+		last = w.since
+	}
+	if wait := time.Until(time.Unix(0, last).Add(w.d)); wait > 0 {
+		w.timer.Reset(wait)
+		p.il.Unlock()
+		return
+	}
+	w.since = time.Now().UnixNano()
+	w.timer.Reset(w.d)
+	p.il.Unlock()
+	w.f()
+}
+
+// stopIdle stops the watchdog, as the port closes.
+func (p *Port) stopIdle() {
+	p.il.Lock()
+	if p.idle != nil {
+		p.idle.timer.Stop()
+		p.idle = nil
+	}
+	p.il.Unlock()
+}
@@ -0,0 +1,55 @@
+package goserial
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIdleTimeout(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	a.SetReadTimeout(5 * time.Millisecond)
+	silent := make(chan time.Time, 8)
+	start := time.Now()
+	if err := a.SetIdleTimeout(40*time.Millisecond, func() { silent <- time.Now() }); err != nil {
+		t.Fatal(err)
+	}
+
+	// Data keeps the watchdog quiet.
+	buf := make([]byte, 8)
+	for time.Since(start) < 80*time.Millisecond {
+		b.Write([]byte("x"))
+		a.Read(buf)
+		time.Sleep(5 * time.Millisecond)
+	}
+	select {
+	case <-silent:
+		t.Fatal("onSilence called while data was arriving")
+	default:
+	}
+
+	// Silence fires it, and again while the silence lasts.
+	quiet := a.Stats().LastRead
+	for i := 0; i < 2; i++ {
+		select {
+		case at := <-silent:
+			if d := at.Sub(quiet); d < time.Duration(i+1)*40*time.Millisecond {
+				t.Errorf("onSilence %d came after %v of silence", i, d)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("onSilence not called")
+		}
+	}
+
+	a.Close()
+	for len(silent) > 0 {
+		<-silent
+	}
+	time.Sleep(60 * time.Millisecond)
+	if len(silent) != 0 {
+		t.Error("onSilence called after Close")
+	}
+	if err := a.SetIdleTimeout(-time.Second, func() {}); err == nil {
+		t.Error("negative idle timeout accepted")
+	}
+}
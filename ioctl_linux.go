@@ -0,0 +1,10 @@
+// +build linux,386 linux,amd64 linux,arm
+
+package goserial
+
+// The syscall package does not export these on every architecture.
+const (
+	tcflsh = 0x540b
+	tcsbrk = 0x5409
+	tcxonc = 0x540a
+)
@@ -0,0 +1,14 @@
+// +build linux,!386,!amd64,!arm
+
+package goserial
+
+import "syscall"
+
+const (
+	tcflsh = syscall.TCFLSH
+
+	// Not exported anywhere, but TCSBRK, TCXONC and TCFLSH are
+	// consecutive on every architecture.
+	tcsbrk = syscall.TCFLSH - 2
+	tcxonc = syscall.TCFLSH - 1
+)
@@ -0,0 +1,20 @@
+// +build cgo
+
+package goserial
+
+// #include <stdint.h>
+// #include <sys/ioctl.h>
+//
+// static int ioctlp(int fd, int req, uintptr_t arg) {
+// 	return ioctl(fd, req, (void *)arg);
+// }
+import "C"
+
+// ioctl goes through libc: on Solaris and illumos the syscall package
+// cannot make system calls directly.
+func ioctl(fd, req, arg uintptr) error {
+	if r, err := C.ioctlp(C.int(fd), C.int(req), C.uintptr_t(arg)); r == -1 {
+		return err
+	}
+	return nil
+}
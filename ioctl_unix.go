@@ -0,0 +1,20 @@
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package goserial
+
+import "syscall"
+
+func ioctl(fd, req, arg uintptr) error {
+	if _, _, errno := syscall.Syscall6(
+		syscall.SYS_IOCTL,
+		fd,
+		req,
+		arg,
+		0,
+		0,
+		0,
+	); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package goserial
+
+import "fmt"
+
+// ElevationError is returned by SetLatencyTimer on Windows, where the
+// FTDI driver keeps the latency timer in the registry, when the process
+// may not change the value.  Key and Value say where the setting lives,
+// so that it can be changed some other way, and Current is what it is
+// set to now.
+type ElevationError struct {
+	Key     string // under HKEY_LOCAL_MACHINE
+	Value   string // name of the value
+	Current uint32
+	Err     error
+}
+
+func (e *ElevationError) Error() string {
+	return fmt.Sprintf(`goserial: cannot set HKEY_LOCAL_MACHINE\%s\%s (now %d): %v`, e.Key, e.Value, e.Current, e.Err)
+}
+
+func (e *ElevationError) Unwrap() error {
+	return e.Err
+}
+
+// latencyTimer is implemented by drivers that can reach the latency
+// timer of an FTDI adapter.
+type latencyTimer interface {
+	latencyTimer() (int, error)
+	setLatencyTimer(ms int) error
+}
+
+// LatencyTimer returns the latency timer of an FTDI USB adapter, in
+// milliseconds: how long the chip holds on to a short packet of
+// received data before sending it to the host.  Other devices return
+// ErrUnsupported.
+func (p *Port) LatencyTimer() (int, error) {
+	l, ok := p.d.(latencyTimer)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	return l.latencyTimer()
+}
+
+// SetLatencyTimer sets the latency timer of an FTDI USB adapter to ms
+// milliseconds, from 1 to 255.  The default of 16 ms dominates the
+// round trip of short request and response exchanges; 1 or 2 ms cuts
+// it to a few milliseconds.  Other devices return ErrUnsupported.
+//
+// On Linux the setting is made through sysfs and the original value is
+// put back when the port is closed.  On Windows it is written to the
+// registry, which needs administrator rights and lasts until it is
+// changed again; the driver only reads it when the device is started,
+// so the adapter must be plugged in again for it to take effect.
+func (p *Port) SetLatencyTimer(ms int) error {
+	if ms < 1 || ms > 255 {
+		return &ConfigError{Field: "LatencyTimer", Value: ms, Err: fmt.Errorf("must be from 1 to 255 ms")}
+	}
+	l, ok := p.d.(latencyTimer)
+	if !ok {
+		return ErrUnsupported
+	}
+	p.cl.Lock()
+	defer p.cl.Unlock()
+	err := l.setLatencyTimer(ms)
+	p.traceControl("latency timer", err, ms)
+	return err
+}
+
+// setLatencyTimerOnOpen applies Config.LatencyTimer, recording a
+// failure as a setup warning.
+func (p *Port) setLatencyTimerOnOpen(ms int) {
+	if err := p.SetLatencyTimer(ms); err != nil {
+		p.warnings = append(p.warnings, &ConfigError{Field: "LatencyTimer", Value: ms, Err: err})
+	}
+}
@@ -0,0 +1,142 @@
+package goserial
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// LineEnding is what ends a line for a LinePort.
+type LineEnding byte
+
+const (
+	LineAny  LineEnding = iota // LF or CRLF when reading; CRLF is written
+	LineCRLF                   // CR LF, as NMEA and most AT commands use
+	LineLF                     // LF alone
+	LineCR                     // CR alone, as a modem expects commands
+)
+
+func (e LineEnding) String() string {
+	switch e {
+	case LineAny:
+		return "any"
+	case LineCRLF:
+		return "CRLF"
+	case LineLF:
+		return "LF"
+	case LineCR:
+		return "CR"
+	}
+	return fmt.Sprintf("LineEnding(%d)", byte(e))
+}
+
+// LineConfig says how a LinePort reads and writes lines.
+type LineConfig struct {
+	// Ending is the line ending read, and the one WriteLine adds
+	// unless WriteEnding is set.
+	Ending      LineEnding
+	WriteEnding LineEnding
+
+	// SkipEmpty has ReadLine pass over empty lines, such as those
+	// around a modem's responses.
+	SkipEmpty bool
+
+	// SuppressEcho has ReadLine drop the first line after a WriteLine
+	// if it repeats the line written, as a modem with echo on (ATE1)
+	// or a device's console sends back commands.
+	SuppressEcho bool
+
+	// MaxSize bounds a line, as FramerConfig.MaxSize does.
+	MaxSize int
+}
+
+// A LinePort reads and writes lines on a port, for line-based devices
+// such as AT-command modems and NMEA GPS receivers.  It does the work
+// of Config.CRLFTranslate portably and without changing the port, and
+// also handles endings other than CR.
+type LinePort struct {
+	rw      io.ReadWriter
+	c       LineConfig
+	f       *Framer
+	trim    bool   // drop trailing CRs, for LineAny
+	echo    string // the line last written
+	echoing bool   // whether echo may still come back
+}
+
+// NewLinePort returns a LinePort reading and writing rw, usually a Port.
+func NewLinePort(rw io.ReadWriter, c LineConfig) (*LinePort, error) {
+	for _, e := range []LineEnding{c.Ending, c.WriteEnding} {
+		if e > LineCR {
+			return nil, &ConfigError{Field: "Ending", Value: e, Err: errors.New("unknown line ending")}
+		}
+	}
+	f, err := NewFramer(rw, FramerConfig{Delimiter: []byte(c.Ending.readDelimiter()), MaxSize: c.MaxSize})
+	if err != nil {
+		return nil, err
+	}
+	return &LinePort{rw: rw, c: c, f: f, trim: c.Ending == LineAny}, nil
+}
+
+func (e LineEnding) readDelimiter() string {
+	switch e {
+	case LineCRLF:
+		return "\r\n"
+	case LineCR:
+		return "\r"
+	}
+	return "\n"
+}
+
+func (e LineEnding) writeDelimiter() string {
+	switch e {
+	case LineLF:
+		return "\n"
+	case LineCR:
+		return "\r"
+	}
+	return "\r\n"
+}
+
+// ReadLine returns the next line, without its ending.  Errors are those
+// of Framer.ReadFrame: after ErrTimeout the part of the line read so far
+// is kept for the next call.
+func (l *LinePort) ReadLine() (string, error) {
+	for {
+		frame, err := l.f.ReadFrame()
+		if err != nil {
+			return "", err
+		}
+		line := string(frame)
+		if l.trim {
+			line = strings.TrimRight(line, "\r")
+		}
+		if line == "" && l.c.SkipEmpty {
+			continue
+		}
+		if l.echoing {
+			l.echoing = false
+			if line == l.echo {
+				continue
+			}
+		}
+		return line, nil
+	}
+}
+
+// WriteLine writes s and the line ending in one Write.
+func (l *LinePort) WriteLine(s string) error {
+	end := l.c.WriteEnding
+	if end == LineAny {
+		end = l.c.Ending
+	}
+	b := []byte(s + end.writeDelimiter())
+	n, err := l.rw.Write(b)
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	if l.c.SuppressEcho {
+		l.echo, l.echoing = s, true
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package goserial
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLinePort(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	a.SetReadTimeout(100 * time.Millisecond)
+	b.SetReadTimeout(100 * time.Millisecond)
+
+	l, err := NewLinePort(a, LineConfig{WriteEnding: LineCR, SkipEmpty: true, SuppressEcho: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.WriteLine("ATI"); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 16)
+	if n, _ := b.Read(buf); string(buf[:n]) != "ATI\r" {
+		t.Errorf("wrote %q, want \"ATI\\r\"", buf[:n])
+	}
+
+	// The modem echoes the command and answers with CR LF lines.
+	b.Write([]byte("ATI\r\r\nModem 1.0\r\n\r\nOK\r\n"))
+	for _, want := range []string{"Modem 1.0", "OK"} {
+		if line, err := l.ReadLine(); err != nil || line != want {
+			t.Errorf("ReadLine = %q, %v; want %q", line, err, want)
+		}
+	}
+
+	// A line split across reads, and one that is not the echo.
+	l.WriteLine("AT")
+	b.Read(buf)
+	b.Write([]byte("ERR"))
+	if _, err := l.ReadLine(); err != ErrTimeout {
+		t.Errorf("ReadLine of a partial line = %v, want ErrTimeout", err)
+	}
+	b.Write([]byte("OR\n"))
+	if line, err := l.ReadLine(); err != nil || line != "ERROR" {
+		t.Errorf("ReadLine = %q, %v; want \"ERROR\"", line, err)
+	}
+}
+
+func TestLinePortEndings(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	a.SetReadTimeout(100 * time.Millisecond)
+
+	l, err := NewLinePort(a, LineConfig{Ending: LineCRLF})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Write([]byte("$GPGGA,1\r\n\r\nbare\rcr\n$GPRMC\r\n"))
+	for _, want := range []string{"$GPGGA,1", "", "bare\rcr\n$GPRMC"} {
+		if line, err := l.ReadLine(); err != nil || line != want {
+			t.Errorf("ReadLine = %q, %v; want %q", line, err, want)
+		}
+	}
+	l.WriteLine("x")
+	buf := make([]byte, 8)
+	b.SetReadTimeout(100 * time.Millisecond)
+	if n, _ := b.Read(buf); string(buf[:n]) != "x\r\n" {
+		t.Errorf("wrote %q, want \"x\\r\\n\"", buf[:n])
+	}
+
+	if _, err := NewLinePort(a, LineConfig{Ending: LineCR + 1}); err == nil {
+		t.Error("NewLinePort accepted an unknown ending")
+	}
+}
@@ -0,0 +1,227 @@
+package goserial
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// PulseOption changes what PulseDTR and PulseRTS do.
+type PulseOption func(*pulseOptions)
+
+type pulseOptions struct {
+	flushInput bool
+}
+
+// FlushInput makes a pulse discard the unread input once the line is
+// back in its prior state.  Boards reset by a pulse tend to send
+// garbage while they restart.
+func FlushInput() PulseOption {
+	return func(o *pulseOptions) { o.flushInput = true }
+}
+
+// PulseDTR inverts DTR for d and then returns it to its prior state.
+// With DTR deasserted beforehand, as is usual, that asserts the line,
+// sleeps, and deasserts it again.
+//
+// The duration is only as accurate as time.Sleep: expect it to run
+// over by up to a couple of milliseconds on Linux and macOS, and by up
+// to a timer tick (15.6 ms by default) on Windows.  On usb-to-serial
+// converters each line change is also a USB request, adding about a
+// millisecond at either edge.
+//
+// Reads and writes may run concurrently with a pulse; other modem line
+// changes wait for it to finish.
+func (p *Port) PulseDTR(d time.Duration, opts ...PulseOption) error {
+	return p.pulse(p.setDTR, true, d, opts)
+}
+
+// PulseRTS is like PulseDTR, but for RTS.
+func (p *Port) PulseRTS(d time.Duration, opts ...PulseOption) error {
+	return p.pulse(p.setRTS, false, d, opts)
+}
+
+func (p *Port) pulse(set func(bool) error, dtr bool, d time.Duration, opts []PulseOption) error {
+	var o pulseOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	p.cl.Lock()
+	defer p.cl.Unlock()
+
+	curDTR, curRTS, err := p.d.outputLines()
+	if err != nil {
+		return err
+	}
+	prior := curRTS
+	if dtr {
+		prior = curDTR
+	}
+
+	if err := set(!prior); err != nil {
+		return err
+	}
+	time.Sleep(d)
+	if err := set(prior); err != nil {
+		return err
+	}
+
+	if o.flushInput {
+		return p.flush(true, false)
+	}
+	return nil
+}
+
+// defaultBreak is the break SendBreak sends for a duration of zero,
+// about what tcsendbreak(fd, 0) gives.
+const defaultBreak = 250 * time.Millisecond
+
+// breaker is implemented by drivers that can hold the line in the
+// break condition.
+type breaker interface {
+	setBreak(on bool) error
+}
+
+// SendBreak holds the transmit line in the break condition for d, or
+// 250ms if d is zero, and then releases it; with TIOCSBRK and TIOCCBRK
+// on POSIX, SETBREAK and CLRBREAK on Windows and SET-CONTROL over RFC
+// 2217.  The duration is as accurate as it is for PulseDTR.  Writes
+// collected by SetWriteCoalescing are sent first, but output already
+// queued in the driver is not waited for, and may be cut short by the
+// break.  TCP ports and Pipe return ErrUnsupported.
+func (p *Port) SendBreak(d time.Duration) error {
+	b, ok := p.d.(breaker)
+	if !ok {
+		return ErrUnsupported
+	}
+	if d < 0 {
+		return &ConfigError{Field: "SendBreak", Value: d, Err: errors.New("negative duration")}
+	}
+	if d == 0 {
+		d = defaultBreak
+	}
+	p.flushWrites()
+
+	p.cl.Lock()
+	defer p.cl.Unlock()
+	err := b.setBreak(true)
+	if err == nil {
+		time.Sleep(d)
+		err = b.setBreak(false)
+	}
+	p.traceControl("break", err, d)
+	return err
+}
+
+// ModemStatus is the state of the modem status lines, the inputs of a
+// DTE port.
+type ModemStatus struct {
+	CTS bool // clear to send
+	DSR bool // data set ready
+	RI  bool // ring indicator
+	DCD bool // data carrier detect
+}
+
+// modemStatusReader is implemented by drivers that can read the modem
+// status lines.
+type modemStatusReader interface {
+	modemStatus() (ModemStatus, error)
+}
+
+// ModemStatus reads the modem status lines.  RFC 2217 ports report them
+// as the server last notified them, and a Pipe wires each end's CTS to
+// the other end's RTS, and DSR and DCD to its DTR, as a null-modem
+// cable does.  TCP ports return ErrUnsupported.
+func (p *Port) ModemStatus() (ModemStatus, error) {
+	r, ok := p.d.(modemStatusReader)
+	if !ok {
+		return ModemStatus{}, ErrUnsupported
+	}
+	return r.modemStatus()
+}
+
+// ModemLines is a set of modem status lines, for WaitForLineChange.
+type ModemLines uint8
+
+const (
+	ModemCTS ModemLines = 1 << iota
+	ModemDSR
+	ModemRI
+	ModemDCD
+
+	AllModemLines = ModemCTS | ModemDSR | ModemRI | ModemDCD
+)
+
+// lines returns the lines of s that are asserted.
+func (s ModemStatus) lines() ModemLines {
+	var l ModemLines
+	for _, b := range []struct {
+		on   bool
+		line ModemLines
+	}{{s.CTS, ModemCTS}, {s.DSR, ModemDSR}, {s.RI, ModemRI}, {s.DCD, ModemDCD}} {
+		if b.on {
+			l |= b.line
+		}
+	}
+	return l
+}
+
+// modemWaiter is implemented by drivers that can wait for a modem
+// status line to change without polling.
+type modemWaiter interface {
+	waitModemChange(ctx context.Context, lines ModemLines) error
+}
+
+// modemPoll is how often WaitForLineChange reads the lines of a port
+// whose driver cannot wait for them.
+const modemPoll = 10 * time.Millisecond
+
+// WaitForLineChange blocks until one of lines changes state, then
+// returns the modem status lines as they are afterwards.  It returns
+// ctx's error once ctx is done, and ErrPortClosed once the port is
+// closed.  Windows waits with WaitCommEvent, sharing the one wait a
+// port has with WaitReadable, so that each of the two waits for the
+// other to return.  Linux has TIOCMIWAIT, but a thread blocked in it
+// can be woken by neither ctx nor Close, so the counts of line changes
+// it waits on, from TIOCGICOUNT, are read every 10ms instead, which
+// still catches a pulse shorter than that.  Pipe and RFC 2217 ports
+// are woken by the change itself.  Other ports, and Linux drivers
+// without TIOCGICOUNT, read the lines every 10ms, missing any pulse in
+// between.  TCP ports return ErrUnsupported.
+func (p *Port) WaitForLineChange(ctx context.Context, lines ModemLines) (ModemStatus, error) {
+	r, ok := p.d.(modemStatusReader)
+	if !ok {
+		return ModemStatus{}, ErrUnsupported
+	}
+	if lines&AllModemLines == 0 {
+		return ModemStatus{}, &ConfigError{Field: "WaitForLineChange", Value: lines, Err: errors.New("no lines to wait for")}
+	}
+	if w, ok := p.d.(modemWaiter); ok {
+		err := w.waitModemChange(ctx, lines)
+		if err == nil {
+			return r.modemStatus()
+		}
+		if err != ErrUnsupported {
+			return ModemStatus{}, err
+		}
+	}
+
+	prior, err := r.modemStatus()
+	if err != nil {
+		return ModemStatus{}, err
+	}
+	t := time.NewTicker(modemPoll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ModemStatus{}, ctx.Err()
+		case <-t.C:
+		}
+		s, err := r.modemStatus()
+		if err != nil || (s.lines()^prior.lines())&lines != 0 {
+			return s, err
+		}
+	}
+}
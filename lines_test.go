@@ -0,0 +1,78 @@
+package goserial
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fakeDriver records the control calls made on it.
+type fakeDriver struct {
+	dtr, rts bool
+	calls    []string
+}
+
+func (d *fakeDriver) Read(b []byte) (int, error)  { return 0, nil }
+func (d *fakeDriver) Write(b []byte) (int, error) { return len(b), nil }
+func (d *fakeDriver) Close() error                { return nil }
+
+func (d *fakeDriver) setBaud(baud int) error               { return nil }
+func (d *fakeDriver) setReadTimeout(t time.Duration) error { return nil }
+
+func (d *fakeDriver) getConfig(c *Config) error { return nil }
+func (d *fakeDriver) restore() error            { return nil }
+
+func (d *fakeDriver) setDTR(on bool) error {
+	d.dtr = on
+	d.calls = append(d.calls, map[bool]string{true: "DTR+", false: "DTR-"}[on])
+	return nil
+}
+
+func (d *fakeDriver) setRTS(on bool) error {
+	d.rts = on
+	d.calls = append(d.calls, map[bool]string{true: "RTS+", false: "RTS-"}[on])
+	return nil
+}
+
+func (d *fakeDriver) outputLines() (bool, bool, error) {
+	return d.dtr, d.rts, nil
+}
+
+func (d *fakeDriver) flush(in, out bool) error {
+	if in {
+		d.calls = append(d.calls, "flush-in")
+	}
+	return nil
+}
+
+func TestPulse(t *testing.T) {
+	d := new(fakeDriver)
+	p := &Port{d: d}
+
+	if err := p.PulseDTR(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	d.rts = true
+	if err := p.PulseRTS(time.Millisecond, FlushInput()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"DTR+", "DTR-", "RTS-", "RTS+", "flush-in"}
+	if !reflect.DeepEqual(d.calls, want) {
+		t.Errorf("got calls %v, want %v", d.calls, want)
+	}
+}
+
+func TestEnterESPBootloader(t *testing.T) {
+	d := new(fakeDriver)
+	p := &Port{d: d}
+
+	tm := &ESPTiming{Reset: time.Millisecond, Boot: time.Millisecond}
+	if err := p.EnterESPBootloader(tm); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"DTR-", "RTS+", "DTR+", "RTS-", "DTR-", "flush-in"}
+	if !reflect.DeepEqual(d.calls, want) {
+		t.Errorf("got calls %v, want %v", d.calls, want)
+	}
+}
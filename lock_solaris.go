@@ -0,0 +1,5 @@
+package goserial
+
+// flock does nothing: the syscall package has no flock on Solaris and
+// illumos, so Exclusive relies on TIOCEXCL alone there.
+func flock(fd uintptr) error { return nil }
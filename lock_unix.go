@@ -0,0 +1,9 @@
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package goserial
+
+import "syscall"
+
+func flock(fd uintptr) error {
+	return syscall.Flock(int(fd), syscall.LOCK_EX|syscall.LOCK_NB)
+}
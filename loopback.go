@@ -0,0 +1,121 @@
+package goserial
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNoLoopback means nothing came back during a loopback test,
+	// as happens with no jumper or cable fitted.
+	ErrNoLoopback = errors.New("goserial: loopback: nothing received")
+	// ErrLoopbackCorrupt means data came back but differed from what
+	// was sent, which points at a bad cable or mismatched settings.
+	ErrLoopbackCorrupt = errors.New("goserial: loopback: received data differs from sent")
+)
+
+// LoopbackResult describes a loopback test.
+type LoopbackResult struct {
+	Sent     int           // bytes written
+	Received int           // bytes read back
+	Mismatch int           // offset of the first wrong byte, or -1
+	Elapsed  time.Duration // from the first write to the last byte read
+}
+
+// Throughput returns the rate at which data came back, in bytes per
+// second.
+func (r *LoopbackResult) Throughput() float64 {
+	if r.Elapsed <= 0 {
+		return 0
+	}
+	return float64(r.Received) / r.Elapsed.Seconds()
+}
+
+// LoopbackTest checks the port with TX wired to RX.  It flushes both
+// buffers, writes pattern and reads it back, giving up timeout after the
+// first write.  A nil pattern sends all 256 byte values four times over.
+//
+// The result is returned even on failure.  The error is ErrNoLoopback if
+// nothing came back, ErrLoopbackCorrupt if the data differed, ErrTimeout
+// if only the start of the pattern came back, or the error from a write
+// or read.  The port's read timeout is put back afterwards.
+func (p *Port) LoopbackTest(pattern []byte, timeout time.Duration) (*LoopbackResult, error) {
+	if pattern == nil {
+		pattern = make([]byte, 4*256)
+		for i := range pattern {
+			pattern[i] = byte(i)
+		}
+	}
+	r := &LoopbackResult{Mismatch: -1}
+
+	old := p.ReadTimeout()
+	if err := p.SetReadTimeout(100 * time.Millisecond); err != nil {
+		return r, err
+	}
+	defer p.SetReadTimeout(old)
+	if err := p.flush(true, true); err != nil {
+		return r, err
+	}
+
+	// Write from another goroutine so that a pattern larger than the
+	// driver's buffers keeps flowing while it is read back.
+	type result struct {
+		n   int
+		err error
+	}
+	start := time.Now()
+	written := make(chan result, 1)
+	go func() {
+		n, err := p.Write(pattern)
+		written <- result{n, err}
+	}()
+
+	got := make([]byte, len(pattern))
+	deadline := start.Add(timeout)
+	var err error
+	for r.Received < len(got) && time.Now().Before(deadline) {
+		var n int
+		n, err = p.Read(got[r.Received:])
+		r.Received += n
+		if err == ErrTimeout {
+			err = nil
+		}
+		if err != nil {
+			break
+		}
+	}
+	r.Elapsed = time.Since(start)
+	var w result
+	select {
+	case w = <-written:
+	default:
+		select {
+		case w = <-written:
+		case <-time.After(time.Until(deadline)):
+			// The write is stuck, perhaps on flow control; it is
+			// left to finish in the background.
+			return r, ErrTimeout
+		}
+	}
+	r.Sent = w.n
+	if w.err != nil {
+		return r, w.err
+	}
+	if err != nil {
+		return r, err
+	}
+
+	for i := 0; i < r.Received; i++ {
+		if got[i] != pattern[i] {
+			r.Mismatch = i
+			return r, ErrLoopbackCorrupt
+		}
+	}
+	switch {
+	case r.Received == 0:
+		return r, ErrNoLoopback
+	case r.Received < len(pattern):
+		return r, ErrTimeout
+	}
+	return r, nil
+}
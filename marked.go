@@ -0,0 +1,120 @@
+package goserial
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrBreak is returned by MarkedReader.Read for a break received.
+var ErrBreak = errors.New("goserial: break received")
+
+// A MarkedReader reads from a port opened with Config.MarkErrors and
+// undoes the marking, reporting which bytes arrived with an error.
+type MarkedReader struct {
+	r        io.Reader
+	buf      []byte
+	pos, end int // the bytes read from r and not yet returned
+}
+
+// NewMarkedReader returns a MarkedReader reading from r.
+func NewMarkedReader(r io.Reader) *MarkedReader {
+	return &MarkedReader{r: r, buf: make([]byte, 512)}
+}
+
+// ReadMarked returns the next byte received, and whether it arrived
+// with a parity or framing error.  A break reads as a zero byte with
+// an error.  An error from the port, such as ErrTimeout, leaves any
+// mark partly read in place for the next call.
+func (m *MarkedReader) ReadMarked() (b byte, bad bool, err error) {
+	if err := m.fill(1); err != nil {
+		return 0, false, err
+	}
+	if b = m.buf[m.pos]; b != 0xff {
+		m.pos++
+		return b, false, nil
+	}
+	if err := m.fill(2); err != nil {
+		return 0, false, err
+	}
+	if m.buf[m.pos+1] == 0xff {
+		m.pos += 2
+		return 0xff, false, nil
+	}
+	if err := m.fill(3); err != nil {
+		return 0, false, err
+	}
+	b = m.buf[m.pos+2]
+	m.pos += 3
+	return b, true, nil
+}
+
+// Read is io.Reader over the unmarked bytes, stopping at each break:
+// the bytes before it are returned first and then the break, on its
+// own, as ErrBreak, so that a protocol delimiting frames with a break,
+// such as LIN or DMX512, sees where it fell.  The tty marks a zero byte
+// with a framing error as it does a break, so that reads as a break
+// too.  Other bytes with an error are returned as they are.  A break
+// read from a Port also calls its RegisterBreakHandler handler.
+func (m *MarkedReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		k := m.unit()
+		if k == 0 {
+			if n > 0 {
+				break
+			}
+			if err := m.fill(m.end - m.pos + 1); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		if k == 3 && m.buf[m.pos+2] == 0 {
+			if n > 0 {
+				break
+			}
+			m.pos += 3
+			if port, ok := m.r.(*Port); ok {
+				port.breakReceived()
+			}
+			return 0, ErrBreak
+		}
+		p[n], _, _ = m.ReadMarked()
+		n++
+	}
+	return n, nil
+}
+
+// unit returns the length of the byte or mark at the front of the
+// buffer, or 0 if it has not all been read yet.
+func (m *MarkedReader) unit() int {
+	a := m.end - m.pos
+	switch {
+	case a == 0:
+		return 0
+	case m.buf[m.pos] != 0xff:
+		return 1
+	case a < 2:
+		return 0
+	case m.buf[m.pos+1] == 0xff:
+		return 2
+	case a < 3:
+		return 0
+	}
+	return 3
+}
+
+// fill reads from the port until at least n bytes are buffered.
+func (m *MarkedReader) fill(n int) error {
+	if m.pos+n > len(m.buf) {
+		m.end = copy(m.buf, m.buf[m.pos:m.end])
+		m.pos = 0
+	}
+	for m.end-m.pos < n {
+		k, err := m.r.Read(m.buf[m.end:])
+		m.end += k
+		if err != nil && m.end-m.pos < n {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package goserial
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMarkedReader(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	a.SetReadTimeout(10 * time.Millisecond)
+	m := NewMarkedReader(a)
+
+	type marked struct {
+		b   byte
+		bad bool
+	}
+	b.Write([]byte{'a', 0xff, 0xff, 0xff, 0x00, 'x', 0xff, 0x00, 0x00, 'b'})
+	want := []marked{{'a', false}, {0xff, false}, {'x', true}, {0, true}, {'b', false}}
+	for i, w := range want {
+		c, bad, err := m.ReadMarked()
+		if err != nil || c != w.b || bad != w.bad {
+			t.Errorf("byte %d: ReadMarked = %q, %v, %v; want %q, %v", i, c, bad, err, w.b, w.bad)
+		}
+	}
+
+	// A mark cut short by a timeout is finished by the next call.
+	b.Write([]byte{0xff, 0x00})
+	if _, _, err := m.ReadMarked(); err != ErrTimeout {
+		t.Errorf("ReadMarked of a partial mark = %v, want ErrTimeout", err)
+	}
+	b.Write([]byte{'y'})
+	if c, bad, err := m.ReadMarked(); err != nil || c != 'y' || !bad {
+		t.Errorf("ReadMarked = %q, %v, %v; want 'y' marked bad", c, bad, err)
+	}
+}
+
+func TestMarkedReaderBreaks(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	a.SetReadTimeout(10 * time.Millisecond)
+	breaks := 0
+	a.RegisterBreakHandler(func() { breaks++ })
+	m := NewMarkedReader(a)
+
+	// A DMX512-like stream: a frame, a break, then the next frame.
+	b.Write([]byte{1, 0xff, 0xff, 0xff, 0x00, 'x', 0xff, 0x00, 0x00, 2, 3})
+	buf := make([]byte, 16)
+	if n, err := m.Read(buf); err != nil || string(buf[:n]) != "\x01\xffx" {
+		t.Errorf("Read before the break = %q, %v; want %q", buf[:n], err, "\x01\xffx")
+	}
+	if n, err := m.Read(buf); n != 0 || err != ErrBreak {
+		t.Errorf("Read at the break = %d, %v; want ErrBreak", n, err)
+	}
+	if n, err := m.Read(buf); err != nil || string(buf[:n]) != "\x02\x03" {
+		t.Errorf("Read after the break = %q, %v; want %q", buf[:n], err, "\x02\x03")
+	}
+	if breaks != 1 {
+		t.Errorf("break handler called %d times; want 1", breaks)
+	}
+
+	// A partial mark is left for the next Read rather than waited for.
+	b.Write([]byte{4, 0xff})
+	if n, err := m.Read(buf); err != nil || string(buf[:n]) != "\x04" {
+		t.Errorf("Read before a partial mark = %q, %v; want %q", buf[:n], err, "\x04")
+	}
+	b.Write([]byte{0x00, 0x00})
+	if n, err := m.Read(buf); n != 0 || err != ErrBreak {
+		t.Errorf("Read of the completed mark = %d, %v; want ErrBreak", n, err)
+	}
+}
@@ -0,0 +1,213 @@
+package modbusrtu
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// An Option changes how a Client works.
+type Option func(*Client)
+
+// Timeout sets how long to wait for the start of a response.  The
+// default is a second.
+func Timeout(d time.Duration) Option {
+	return func(c *Client) { c.timeout = d }
+}
+
+// TurnaroundDelay sets how long to wait after a broadcast, which has no
+// response, before the next request, for the units to act on it.  The
+// default is 100ms.
+func TurnaroundDelay(d time.Duration) Option {
+	return func(c *Client) { c.turnaround = d }
+}
+
+// A Client sends requests to the units on a line and reads their
+// responses, one transaction at a time.
+type Client struct {
+	p          Port
+	gap        time.Duration
+	timeout    time.Duration
+	turnaround time.Duration
+	idleFrom   time.Time // when the line last went quiet
+	buf        []byte
+}
+
+// NewClient returns a Client for the line p, which runs at baud.
+func NewClient(p Port, baud int, opts ...Option) *Client {
+	c := &Client{
+		p:          p,
+		gap:        SilentInterval(baud),
+		timeout:    time.Second,
+		turnaround: 100 * time.Millisecond,
+		buf:        make([]byte, 256),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Transact sends pdu, a function code and its data, to unit and returns
+// the PDU of the response, from its function code on.  Unit 0 is a
+// broadcast: there is no response, and Transact returns nil once the
+// turnaround delay has passed.  An exception response is returned as
+// an *ExceptionError.
+//
+// Data left over from an earlier transaction is discarded first, and
+// the port's read timeout, if it can say what it was, is put back
+// afterwards.
+func (c *Client) Transact(unit byte, pdu []byte) ([]byte, error) {
+	if len(pdu) == 0 {
+		return nil, ErrShortFrame
+	}
+	if t, ok := c.p.(interface{ ReadTimeout() time.Duration }); ok {
+		defer c.p.SetReadTimeout(t.ReadTimeout())
+	}
+	if r, ok := c.p.(interface{ ResetInputBuffer() error }); ok {
+		r.ResetInputBuffer()
+	}
+	if wait := c.gap - time.Since(c.idleFrom); wait > 0 {
+		time.Sleep(wait)
+	}
+	if _, err := c.p.Write(Frame(unit, pdu)); err != nil {
+		return nil, err
+	}
+	if unit == 0 {
+		time.Sleep(c.turnaround)
+		c.idleFrom = time.Now()
+		return nil, nil
+	}
+
+	frame, err := c.readFrame()
+	c.idleFrom = time.Now()
+	if err != nil {
+		return nil, err
+	}
+	u, resp, err := Parse(frame)
+	switch {
+	case err != nil:
+		return nil, err
+	case u != unit:
+		return nil, ErrUnexpectedResponse
+	case resp[0] == pdu[0]|0x80 && len(resp) == 2:
+		return nil, &ExceptionError{Function: pdu[0], Code: resp[1]}
+	case resp[0] != pdu[0]:
+		return nil, ErrUnexpectedResponse
+	}
+	return resp, nil
+}
+
+// readFrame reads a response: its first byte within the timeout, and
+// the rest either until it is complete, for the functions whose
+// responses say how long they are, or until the silent interval.  Only
+// the second waits out the gap, or can be fooled by a USB adapter that
+// pauses within a frame.
+func (c *Client) readFrame() ([]byte, error) {
+	if err := c.p.SetReadTimeout(c.timeout); err != nil {
+		return nil, err
+	}
+	n, err := c.p.Read(c.buf)
+	if n == 0 {
+		if err == nil || isTimeout(err) {
+			return nil, ErrNoResponse
+		}
+		return nil, err
+	}
+	gap := false
+	for {
+		want, known := responseSize(c.buf[:n])
+		if want > 0 && n >= want {
+			return c.buf[:want], nil
+		}
+		if !known && !gap {
+			if err := c.p.SetReadTimeout(c.gap); err != nil {
+				return nil, err
+			}
+			gap = true
+		}
+		if n == len(c.buf) {
+			return nil, errors.New("modbusrtu: response too long")
+		}
+		k, err := c.p.Read(c.buf[n:])
+		n += k
+		if isTimeout(err) && k == 0 {
+			return c.buf[:n], nil
+		}
+		if err != nil && k == 0 {
+			return nil, err
+		}
+	}
+}
+
+// responseSize returns the length of the response frame that starts
+// with b, or 0 if b is too short to tell; known is false for functions
+// whose responses do not give their length.
+func responseSize(b []byte) (size int, known bool) {
+	if len(b) < 2 {
+		return 0, true
+	}
+	switch fn := b[1]; {
+	case fn&0x80 != 0:
+		return 5, true
+	case fn >= 1 && fn <= 4:
+		if len(b) < 3 {
+			return 0, true
+		}
+		return 3 + int(b[2]) + 2, true
+	case fn == 5 || fn == 6 || fn == 15 || fn == 16:
+		return 8, true
+	}
+	return 0, false
+}
+
+func isTimeout(err error) bool {
+	t, ok := err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
+
+// ReadHoldingRegisters reads count holding registers of unit, starting
+// at addr, with function 3.
+func (c *Client) ReadHoldingRegisters(unit byte, addr, count uint16) ([]uint16, error) {
+	return c.readRegisters(unit, 3, addr, count)
+}
+
+// ReadInputRegisters reads count input registers, with function 4.
+func (c *Client) ReadInputRegisters(unit byte, addr, count uint16) ([]uint16, error) {
+	return c.readRegisters(unit, 4, addr, count)
+}
+
+func (c *Client) readRegisters(unit, fn byte, addr, count uint16) ([]uint16, error) {
+	resp, err := c.Transact(unit, []byte{fn, byte(addr >> 8), byte(addr), byte(count >> 8), byte(count)})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < 2 || int(resp[1]) != 2*int(count) || len(resp) != 2+2*int(count) {
+		return nil, ErrUnexpectedResponse
+	}
+	regs := make([]uint16, count)
+	for i := range regs {
+		regs[i] = binary.BigEndian.Uint16(resp[2+2*i:])
+	}
+	return regs, nil
+}
+
+// WriteSingleRegister sets one holding register, with function 6.
+func (c *Client) WriteSingleRegister(unit byte, addr, value uint16) error {
+	_, err := c.Transact(unit, []byte{6, byte(addr >> 8), byte(addr), byte(value >> 8), byte(value)})
+	return err
+}
+
+// WriteMultipleRegisters sets consecutive holding registers from addr,
+// with function 16.
+func (c *Client) WriteMultipleRegisters(unit byte, addr uint16, values []uint16) error {
+	if len(values) == 0 || len(values) > 123 {
+		return errors.New("modbusrtu: need 1 to 123 registers")
+	}
+	pdu := []byte{16, byte(addr >> 8), byte(addr), 0, byte(len(values)), byte(2 * len(values))}
+	for _, v := range values {
+		pdu = append(pdu, byte(v>>8), byte(v))
+	}
+	_, err := c.Transact(unit, pdu)
+	return err
+}
@@ -0,0 +1,96 @@
+// Package modbusrtu is a Modbus RTU client: it assembles and checks
+// frames, and runs request and response transactions with the silent
+// intervals the protocol needs between frames.
+//
+// A transaction times its reads with the port's read timeout, which
+// it sets for the duration, so any port whose Read returns an error
+// with a Timeout method once that passes will do; *serial.Port,
+// serial.Pipe and the serialtest ports all qualify.  The gaps are only
+// as precise as the port's timeouts: see serial.CopyUntilIdle.
+package modbusrtu
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var (
+	// ErrCRC is returned for a frame whose CRC does not match.
+	ErrCRC = errors.New("modbusrtu: bad CRC")
+	// ErrShortFrame is returned for a frame too short to hold an
+	// address, a function code and a CRC.
+	ErrShortFrame = errors.New("modbusrtu: frame too short")
+	// ErrNoResponse is returned when no response arrives in time.
+	ErrNoResponse = errors.New("modbusrtu: no response")
+	// ErrUnexpectedResponse is returned for a response from another
+	// unit, or to another function, than the request went to.
+	ErrUnexpectedResponse = errors.New("modbusrtu: unexpected response")
+)
+
+// An ExceptionError is a unit's exception response.
+type ExceptionError struct {
+	Function byte // of the request
+	Code     byte // 1 illegal function, 2 illegal data address, ...
+}
+
+func (e *ExceptionError) Error() string {
+	return fmt.Sprintf("modbusrtu: exception %d to function %d", e.Code, e.Function)
+}
+
+// Port is what a Client needs from a serial port.
+type Port interface {
+	io.ReadWriter
+	SetReadTimeout(d time.Duration) error
+}
+
+// CRC16 returns the Modbus CRC of b.  Frames carry it low byte first.
+func CRC16(b []byte) uint16 {
+	v := uint16(0xffff)
+	for _, c := range b {
+		v ^= uint16(c)
+		for i := 0; i < 8; i++ {
+			if v&1 != 0 {
+				v = v>>1 ^ 0xa001
+			} else {
+				v >>= 1
+			}
+		}
+	}
+	return v
+}
+
+// Frame returns the frame that carries pdu, a function code and its
+// data, to or from unit.
+func Frame(unit byte, pdu []byte) []byte {
+	f := make([]byte, 0, len(pdu)+3)
+	f = append(f, unit)
+	f = append(f, pdu...)
+	crc := CRC16(f)
+	return append(f, byte(crc), byte(crc>>8))
+}
+
+// Parse checks the CRC of frame and returns its unit and PDU.  The PDU
+// shares frame's storage.
+func Parse(frame []byte) (unit byte, pdu []byte, err error) {
+	if len(frame) < 4 {
+		return 0, nil, ErrShortFrame
+	}
+	n := len(frame) - 2
+	if CRC16(frame[:n]) != binary.LittleEndian.Uint16(frame[n:]) {
+		return 0, nil, ErrCRC
+	}
+	return frame[0], frame[1:n], nil
+}
+
+// SilentInterval returns the 3.5 character times that separate frames
+// at baud, counting 11 bits to a character.  Above 19200 baud the
+// specification fixes it at 1750µs instead.
+func SilentInterval(baud int) time.Duration {
+	if baud <= 0 || baud > 19200 {
+		return 1750 * time.Microsecond
+	}
+	return time.Duration(35*11) * time.Second / time.Duration(10*baud)
+}
@@ -0,0 +1,112 @@
+package modbusrtu
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	serial "github.com/tarm/goserial"
+)
+
+func TestFrame(t *testing.T) {
+	// The example from the Modbus over serial line specification.
+	f := Frame(1, []byte{3, 0, 0, 0, 10})
+	want := []byte{1, 3, 0, 0, 0, 10, 0xc5, 0xcd}
+	if !bytes.Equal(f, want) {
+		t.Errorf("Frame = % x, want % x", f, want)
+	}
+	unit, pdu, err := Parse(f)
+	if err != nil || unit != 1 || !bytes.Equal(pdu, want[1:6]) {
+		t.Errorf("Parse = %d, % x, %v", unit, pdu, err)
+	}
+	f[3]++
+	if _, _, err := Parse(f); err != ErrCRC {
+		t.Errorf("Parse of a corrupted frame = %v, want ErrCRC", err)
+	}
+	if _, _, err := Parse(f[:3]); err != ErrShortFrame {
+		t.Errorf("Parse of 3 bytes = %v, want ErrShortFrame", err)
+	}
+}
+
+func TestSilentInterval(t *testing.T) {
+	if d := SilentInterval(9600); d < 4*time.Millisecond || d > 4100*time.Microsecond {
+		t.Errorf("SilentInterval(9600) = %v, want about 4.01ms", d)
+	}
+	if d := SilentInterval(115200); d != 1750*time.Microsecond {
+		t.Errorf("SilentInterval(115200) = %v, want 1.75ms", d)
+	}
+}
+
+// unit answers requests read from p with reply, until p is closed.
+func unit(p *serial.Port, reply func(req []byte) []byte) {
+	p.SetReadTimeout(5 * time.Millisecond)
+	var req []byte
+	buf := make([]byte, 256)
+	for {
+		n, err := p.Read(buf)
+		req = append(req, buf[:n]...)
+		if err == serial.ErrTimeout && len(req) > 0 {
+			if resp := reply(req); resp != nil {
+				// Send it in two parts, as a USB adapter might.
+				p.Write(resp[:2])
+				time.Sleep(10 * time.Millisecond)
+				p.Write(resp[2:])
+			}
+			req = nil
+		} else if err != nil && err != serial.ErrTimeout {
+			return
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	a, b := serial.Pipe()
+	defer a.Close()
+	regs := map[uint16]uint16{0: 0x1234, 1: 0xabcd}
+	go unit(b, func(req []byte) []byte {
+		u, pdu, err := Parse(req)
+		if err != nil || u != 7 {
+			return nil
+		}
+		if len(pdu) != 5 {
+			return Frame(7, []byte{pdu[0] | 0x80, 1})
+		}
+		addr := uint16(pdu[1])<<8 | uint16(pdu[2])
+		switch pdu[0] {
+		case 3:
+			resp := []byte{3, 4}
+			for i := uint16(0); i < 2; i++ {
+				resp = append(resp, byte(regs[addr+i]>>8), byte(regs[addr+i]))
+			}
+			return Frame(7, resp)
+		case 6:
+			regs[addr] = uint16(pdu[3])<<8 | uint16(pdu[4])
+			return Frame(7, pdu)
+		}
+		return Frame(7, []byte{pdu[0] | 0x80, 1})
+	})
+	defer b.Close()
+
+	c := NewClient(a, 9600, Timeout(200*time.Millisecond))
+	got, err := c.ReadHoldingRegisters(7, 0, 2)
+	if err != nil || len(got) != 2 || got[0] != 0x1234 || got[1] != 0xabcd {
+		t.Fatalf("ReadHoldingRegisters = %x, %v", got, err)
+	}
+	if err := c.WriteSingleRegister(7, 1, 42); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := c.ReadHoldingRegisters(7, 0, 2); err != nil || got[1] != 42 {
+		t.Errorf("after write: %v, %v", got, err)
+	}
+
+	_, err = c.Transact(7, []byte{0x2b, 0x0e})
+	if e, ok := err.(*ExceptionError); !ok || e.Function != 0x2b || e.Code != 1 {
+		t.Errorf("unknown function: %v, want exception 1", err)
+	}
+	if _, err := c.Transact(9, []byte{3, 0, 0, 0, 1}); err != ErrNoResponse {
+		t.Errorf("absent unit: %v, want ErrNoResponse", err)
+	}
+	if a.ReadTimeout() != 0 {
+		t.Errorf("read timeout left at %v", a.ReadTimeout())
+	}
+}
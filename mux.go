@@ -0,0 +1,362 @@
+package goserial
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// A Mux shares one port between several clients, such as the modules
+// polling different addresses on one RS-485 bus, by way of
+// transactions: a client that holds the Mux's lock has the port to
+// itself, its writes going out and everything read from the port coming
+// back to it alone, until it unlocks.  Data that arrives outside any
+// transaction, such as a device's unsolicited reports, goes to the
+// clients whose filter accepts it.
+type Mux struct {
+	p  io.ReadWriter
+	tl chan struct{} // holds a token while a transaction runs
+	wl sync.Mutex    // serializes Write
+
+	mu      sync.Mutex
+	owner   *MuxClient // the client in a transaction, if any
+	clients map[*MuxClient]struct{}
+	err     error // why the mux stopped, once it has
+}
+
+// NewMux starts reading p and returns the Mux sharing it.  From then on
+// only the Mux should read p.  Reads that time out are retried, so the
+// port's read timeout does not stop the Mux; the clients have read
+// deadlines of their own.
+func NewMux(p io.ReadWriter) *Mux {
+	m := &Mux{p: p, tl: make(chan struct{}, 1), clients: make(map[*MuxClient]struct{})}
+	go m.run()
+	return m
+}
+
+func (m *Mux) run() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := m.p.Read(buf)
+		if n > 0 {
+			m.route(buf[:n])
+		}
+		switch err {
+		case nil, ErrTimeout:
+		case ErrPortClosed:
+			m.stop(io.EOF)
+			return
+		default:
+			m.stop(err)
+			return
+		}
+	}
+}
+
+// route hands b to the client in a transaction, or else to every client
+// whose filter accepts it.
+func (m *Mux) route(b []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.owner != nil {
+		m.owner.put(b)
+		return
+	}
+	for c := range m.clients {
+		if c.filter != nil && c.filter(b) {
+			c.put(b)
+		}
+	}
+}
+
+// stop ends every client with err, and any made later.
+func (m *Mux) stop(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return
+	}
+	m.err = err
+	for c := range m.clients {
+		c.finish(err)
+	}
+	m.clients = nil
+}
+
+// NewClient returns a client of the Mux.  filter, which may be nil,
+// chooses the data read outside transactions that the client receives:
+// it is called with each piece as read from the port, which at a
+// moderate rate is usually a whole frame but need not be, and must not
+// keep it.  A client holds up to 64 KiB for a consumer that falls
+// behind, dropping the oldest bytes beyond that.
+func (m *Mux) NewClient(filter func(b []byte) bool) *MuxClient {
+	c := &MuxClient{m: m, filter: filter, size: defaultTeeBuffer}
+	c.cond.L = &c.mu
+	m.mu.Lock()
+	if m.err != nil {
+		c.err = m.err
+	} else {
+		m.clients[c] = struct{}{}
+	}
+	m.mu.Unlock()
+	return c
+}
+
+// Close ends every client with io.EOF and closes the port, if it can be
+// closed, which stops the Mux reading it.
+func (m *Mux) Close() error {
+	m.stop(io.EOF)
+	if c, ok := m.p.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// A MuxClient is one user's share of a Mux.  Its methods are not meant
+// to be called from several goroutines at once, except Close.
+type MuxClient struct {
+	m      *Mux
+	filter func([]byte) bool
+
+	mu       sync.Mutex
+	cond     sync.Cond
+	buf      []byte
+	size     int
+	dropped  int64
+	deadline time.Time
+	err      error // returned once buf is empty
+
+	// Whether c holds the Mux's token and whether it has been closed,
+	// guarded by the Mux's mu.
+	owns, closed bool
+}
+
+// put adds b to c's buffer, dropping the oldest bytes if it would
+// overflow.  The Mux's mu is held.
+func (c *MuxClient) put(b []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	if excess := len(c.buf) + len(b) - c.size; excess > 0 {
+		if excess > len(c.buf) {
+			b = b[excess-len(c.buf):]
+			c.buf = c.buf[:0]
+		} else {
+			c.buf = c.buf[excess:]
+		}
+		c.dropped += int64(excess)
+	}
+	c.buf = append(c.buf, b...)
+	c.cond.Broadcast()
+}
+
+func (c *MuxClient) finish(err error) {
+	c.mu.Lock()
+	c.err = err
+	c.cond.Broadcast()
+	c.mu.Unlock()
+}
+
+// Lock starts a transaction, waiting for the one running to end.  What
+// c holds from before is discarded, so that Read returns only the bytes
+// that arrive from then on.  On a closed client it does nothing.
+func (c *MuxClient) Lock() {
+	c.m.tl <- struct{}{}
+	c.begin()
+}
+
+// LockContext is Lock, giving up with ctx's error once ctx is done.  A
+// closed client returns ErrPortClosed.
+func (c *MuxClient) LockContext(ctx context.Context) error {
+	select {
+	case c.m.tl <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return c.begin()
+}
+
+// begin makes c the owner of the token just taken, or gives it back if
+// c has been closed.
+func (c *MuxClient) begin() error {
+	c.m.mu.Lock()
+	if c.closed {
+		c.m.mu.Unlock()
+		<-c.m.tl
+		return ErrPortClosed
+	}
+	c.owns = true
+	c.m.owner = c
+	c.m.mu.Unlock()
+	c.mu.Lock()
+	c.buf = c.buf[:0]
+	c.mu.Unlock()
+	return nil
+}
+
+// release gives back the token if c still holds it.  The token goes
+// back once however Unlock and Close race.
+func (c *MuxClient) release() {
+	c.m.mu.Lock()
+	owns := c.owns
+	if owns {
+		c.owns = false
+		if c.m.owner == c {
+			c.m.owner = nil
+		}
+	}
+	c.m.mu.Unlock()
+	if owns {
+		<-c.m.tl
+	}
+}
+
+// Unlock ends c's transaction.  After Close, which ends it, it does
+// nothing.
+func (c *MuxClient) Unlock() {
+	c.m.mu.Lock()
+	owns, closed := c.owns, c.closed
+	c.m.mu.Unlock()
+	if !owns && !closed {
+		panic("goserial: MuxClient.Unlock outside a transaction")
+	}
+	c.release()
+}
+
+// Transact runs one transaction: it locks, writes req, calls read to
+// read the response from c and unlocks again.  ctx bounds the wait for
+// the lock, and its deadline, if it has one, is c's read deadline while
+// read runs.
+func (c *MuxClient) Transact(ctx context.Context, req []byte, read func(r io.Reader) error) error {
+	if err := c.LockContext(ctx); err != nil {
+		return err
+	}
+	defer c.Unlock()
+	if t, ok := ctx.Deadline(); ok {
+		prev := c.readDeadline()
+		c.SetReadDeadline(t)
+		defer c.SetReadDeadline(prev)
+	}
+	if _, err := c.Write(req); err != nil {
+		return err
+	}
+	return read(c)
+}
+
+// Write writes to the port.  Outside a transaction of c's own it waits
+// for the one running to end, so as not to break into it.  A closed
+// client returns ErrPortClosed.
+func (c *MuxClient) Write(b []byte) (int, error) {
+	c.m.mu.Lock()
+	own := c.owns
+	c.m.mu.Unlock()
+	if !own {
+		c.m.tl <- struct{}{}
+		defer func() { <-c.m.tl }()
+	}
+	c.m.wl.Lock()
+	defer c.m.wl.Unlock()
+	// Checked under wl, which Close waits for before the token can
+	// pass to another client.
+	c.m.mu.Lock()
+	closed := c.closed
+	c.m.mu.Unlock()
+	if closed {
+		return 0, ErrPortClosed
+	}
+	return c.m.p.Write(b)
+}
+
+// SetReadDeadline sets the time after which Read fails with ErrTimeout
+// if it has nothing to return; the zero time, the default, has it wait
+// for as long as it takes.
+func (c *MuxClient) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.deadline = t
+	c.cond.Broadcast()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *MuxClient) readDeadline() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline
+}
+
+// Read waits for data for c: inside its transaction whatever the port
+// sends, and outside it what the filter accepts.  Once the Mux or the
+// port has been closed, it returns what is left and then io.EOF; if the
+// port failed, it returns the port's error instead.
+func (c *MuxClient) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var timer *time.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	for len(c.buf) == 0 && c.err == nil {
+		if !c.deadline.IsZero() {
+			d := time.Until(c.deadline)
+			if d <= 0 {
+				return 0, ErrTimeout
+			}
+			if timer != nil {
+				timer.Stop()
+			}
+			timer = time.AfterFunc(d, func() {
+				c.mu.Lock()
+				c.cond.Broadcast()
+				c.mu.Unlock()
+			})
+		}
+		c.cond.Wait()
+	}
+	if len(c.buf) == 0 {
+		return 0, c.err
+	}
+	n := copy(b, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+// Dropped returns the number of bytes dropped because c's buffer was
+// full.
+func (c *MuxClient) Dropped() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dropped
+}
+
+// Close detaches c from the Mux, discarding what it holds.  Later Reads
+// return io.EOF and Writes ErrPortClosed, also within a Transact under
+// way.  A transaction c is in is ended once a Write of its already
+// going out has finished, so that it does not overlap the next client's.
+func (c *MuxClient) Close() error {
+	c.m.mu.Lock()
+	if c.closed {
+		c.m.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	delete(c.m.clients, c)
+	if c.m.owner == c {
+		c.m.owner = nil
+	}
+	c.m.mu.Unlock()
+	c.mu.Lock()
+	c.buf = nil
+	c.err = io.EOF
+	c.cond.Broadcast()
+	c.mu.Unlock()
+
+	c.m.wl.Lock()
+	c.m.wl.Unlock()
+	c.release()
+	return nil
+}
@@ -0,0 +1,127 @@
+package goserial
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestMux(t *testing.T) {
+	dev, p := Pipe()
+	defer dev.Close()
+	m := NewMux(p)
+	defer m.Close()
+	events := m.NewClient(func(b []byte) bool { return b[0] == '!' })
+	poller := m.NewClient(nil)
+
+	// The device answers "?n" with "rn".
+	go func() {
+		buf := make([]byte, 2)
+		for {
+			if _, err := io.ReadFull(dev, buf); err != nil {
+				return
+			}
+			dev.Write([]byte{'r', buf[1]})
+		}
+	}()
+
+	reply := make([]byte, 2)
+	read := func(r io.Reader) error {
+		_, err := io.ReadFull(r, reply)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := poller.Transact(ctx, []byte("?1"), read); err != nil || string(reply) != "r1" {
+		t.Fatalf("Transact = %q, %v; want r1", reply, err)
+	}
+
+	// Data outside a transaction goes by the filters.
+	dev.Write([]byte("!evt"))
+	buf := make([]byte, 16)
+	if n, err := events.Read(buf); string(buf[:n]) != "!evt" || err != nil {
+		t.Errorf("events got %q, %v; want !evt", buf[:n], err)
+	}
+	poller.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if n, err := poller.Read(buf); err != ErrTimeout {
+		t.Errorf("poller got %q, %v outside its transaction; want ErrTimeout", buf[:n], err)
+	}
+	poller.SetReadDeadline(time.Time{})
+
+	// A write from another client waits for the transaction to end.
+	poller.Lock()
+	wrote := make(chan struct{})
+	go func() {
+		events.Write([]byte("?2"))
+		close(wrote)
+	}()
+	select {
+	case <-wrote:
+		t.Error("Write from another client went into a transaction")
+	case <-time.After(20 * time.Millisecond):
+	}
+	poller.Unlock()
+	<-wrote
+
+	m.Close()
+	if _, err := poller.Read(buf); err != io.EOF {
+		t.Errorf("Read after Mux.Close = %v; want io.EOF", err)
+	}
+}
+
+func TestMuxClientCloseDuringTransact(t *testing.T) {
+	dev, p := Pipe()
+	defer dev.Close()
+	m := NewMux(p)
+	defer m.Close()
+	a, b := m.NewClient(nil), m.NewClient(nil)
+
+	// The device answers "?2" with "r2" and leaves "?1" unanswered.
+	got := make(chan string, 2)
+	go func() {
+		buf := make([]byte, 2)
+		for {
+			if _, err := io.ReadFull(dev, buf); err != nil {
+				return
+			}
+			got <- string(buf)
+			if buf[1] == '2' {
+				dev.Write([]byte("r2"))
+			}
+		}
+	}()
+
+	reply := make([]byte, 2)
+	read := func(r io.Reader) error {
+		_, err := io.ReadFull(r, reply)
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	done := make(chan error)
+	go func() { done <- a.Transact(ctx, []byte("?1"), read) }()
+	if s := <-got; s != "?1" {
+		t.Fatalf("device got %q; want ?1", s)
+	}
+	a.Close()
+	if err := <-done; err != io.EOF {
+		t.Errorf("Transact closed under it = %v; want io.EOF", err)
+	}
+
+	// The token went back once: b gets it, and a locks no more.
+	if err := b.Transact(ctx, []byte("?2"), read); err != nil || string(reply) != "r2" {
+		t.Fatalf("Transact after the other client closed = %q, %v; want r2", reply, err)
+	}
+	if s := <-got; s != "?2" {
+		t.Errorf("device got %q; want ?2", s)
+	}
+	if err := a.Transact(ctx, []byte("?3"), read); err != ErrPortClosed {
+		t.Errorf("Transact on a closed client = %v; want ErrPortClosed", err)
+	}
+	if _, err := a.Write([]byte("?3")); err != ErrPortClosed {
+		t.Errorf("Write on a closed client = %v; want ErrPortClosed", err)
+	}
+	a.Unlock()
+	a.Close()
+}
@@ -0,0 +1,87 @@
+package goserial
+
+import (
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// An Addr is the address of a serial port, as a net.Conn from NetConn
+// reports it: the network "serial" and the name the port was opened by.
+type Addr struct {
+	Name string
+}
+
+func (a Addr) Network() string { return "serial" }
+func (a Addr) String() string  { return a.Name }
+
+// The port itself is a net.Conn too, with the deadlines of
+// SetReadDeadline and an Addr at either end, for libraries that take
+// one as it is.  Its errors are the package's own: a deadline gives
+// ErrTimeout, which passes for os.ErrDeadlineExceeded, and a closed
+// port ErrPortClosed.  NetConn gives the errors the net package would.
+var _ net.Conn = (*Port)(nil)
+
+// LocalAddr returns an Addr naming the port.
+func (p *Port) LocalAddr() net.Addr { return Addr{p.name} }
+
+// RemoteAddr returns the same as LocalAddr: the device at the other end
+// has no address of its own.
+func (p *Port) RemoteAddr() net.Addr { return Addr{p.name} }
+
+// NetConn returns the port as a net.Conn, for code written against one.
+// Read, Write and Close go to the port, and both addresses are an Addr
+// naming it.  The deadlines follow the net.Conn rules: they are
+// absolute, hold until changed, and a call that runs into one fails with
+// a net.Error whose Timeout method reports true and that wraps
+// os.ErrDeadlineExceeded.  A closed port gives errors wrapping
+// net.ErrClosed.
+//
+// The conn clears the port's read and write timeouts, which net.Conn
+// has no place for; use the port through it alone from then on.  The
+// deadlines are the port's, see Port.SetReadDeadline for where they can
+// change under a Read or Write already waiting.
+func (p *Port) NetConn() net.Conn {
+	p.SetReadTimeout(0)
+	p.SetWriteTimeout(0)
+	return &portConn{p: p, addr: Addr{p.name}}
+}
+
+type portConn struct {
+	p    *Port
+	addr Addr
+}
+
+func (c *portConn) Read(b []byte) (int, error) {
+	n, err := c.p.Read(b)
+	return n, c.opError("read", err)
+}
+
+func (c *portConn) Write(b []byte) (int, error) {
+	n, err := c.p.Write(b)
+	return n, c.opError("write", err)
+}
+
+// opError wraps err as the net package does, leaving io.EOF alone.
+func (c *portConn) opError(op string, err error) error {
+	switch err {
+	case nil, io.EOF:
+		return err
+	case ErrPortClosed:
+		err = net.ErrClosed
+	}
+	if _, ok := err.(*WriteTimeoutError); ok || err == ErrTimeout {
+		err = os.ErrDeadlineExceeded
+	}
+	return &net.OpError{Op: op, Net: "serial", Addr: c.addr, Err: err}
+}
+
+func (c *portConn) Close() error { return c.p.Close() }
+
+func (c *portConn) LocalAddr() net.Addr  { return c.addr }
+func (c *portConn) RemoteAddr() net.Addr { return c.addr }
+
+func (c *portConn) SetDeadline(t time.Time) error      { return c.p.SetDeadline(t) }
+func (c *portConn) SetReadDeadline(t time.Time) error  { return c.p.SetReadDeadline(t) }
+func (c *portConn) SetWriteDeadline(t time.Time) error { return c.p.SetWriteDeadline(t) }
@@ -0,0 +1,136 @@
+package goserial
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// isTimeout reports whether err is a deadline error as net.Conn
+// defines one.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout() && errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+// testConnDeadlines runs checks in the style of nettest.TestConn over c,
+// whose peer is written to through w.
+func testConnDeadlines(t *testing.T, c net.Conn, w io.Writer) {
+	buf := make([]byte, 16)
+
+	// A deadline in the past fails at once, and keeps failing.
+	c.SetReadDeadline(time.Now().Add(-time.Second))
+	for i := 0; i < 2; i++ {
+		if _, err := c.Read(buf); !isTimeout(err) {
+			t.Fatalf("Read %d past the deadline = %v; want a timeout", i, err)
+		}
+	}
+
+	// A future deadline fails at about that time.
+	start := time.Now()
+	c.SetReadDeadline(start.Add(50 * time.Millisecond))
+	if _, err := c.Read(buf); !isTimeout(err) {
+		t.Fatalf("Read until the deadline = %v; want a timeout", err)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond || d > time.Second {
+		t.Errorf("Read with a 50ms deadline returned after %v", d)
+	}
+
+	// Clearing it lets data through again.
+	c.SetReadDeadline(time.Time{})
+	w.Write([]byte("hi"))
+	if n, err := c.Read(buf); err != nil || string(buf[:n]) != "hi" {
+		t.Fatalf("Read with no deadline = %q, %v", buf[:n], err)
+	}
+
+	// Moving the deadline into the past wakes a waiting Read.
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.Read(buf)
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	c.SetReadDeadline(time.Now())
+	select {
+	case err := <-done:
+		if !isTimeout(err) {
+			t.Errorf("waiting Read after the deadline moved = %v; want a timeout", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("moving the deadline did not wake a waiting Read")
+	}
+	c.SetReadDeadline(time.Time{})
+}
+
+func TestNetConn(t *testing.T) {
+	a, b := NewPipe(&PipeConfig{BufferSize: 8})
+	c := b.NetConn()
+	if addr := c.LocalAddr(); addr.Network() != "serial" || addr.String() != "pipe" {
+		t.Errorf("LocalAddr = %v %q", addr.Network(), addr.String())
+	}
+
+	testConnDeadlines(t, c, a)
+
+	// Write deadlines, against a peer that does not read.
+	c.SetWriteDeadline(time.Now().Add(20 * time.Millisecond))
+	if n, err := c.Write(make([]byte, 16)); n != 8 || !isTimeout(err) {
+		t.Errorf("Write into a full pipe = %d, %v; want 8 and a timeout", n, err)
+	}
+	if _, err := c.Write([]byte("x")); !isTimeout(err) {
+		t.Errorf("Write after the deadline = %v; want a timeout", err)
+	}
+	c.SetDeadline(time.Time{})
+
+	a.Write([]byte("bye"))
+	a.Close()
+	buf := make([]byte, 8)
+	if n, err := c.Read(buf); string(buf[:n]) != "bye" || err != nil {
+		t.Errorf("Read after the peer closed = %q, %v", buf[:n], err)
+	}
+	if _, err := c.Read(buf); err != io.EOF {
+		t.Errorf("Read at EOF = %v; want io.EOF", err)
+	}
+	c.Close()
+	if _, err := c.Read(buf); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Read after Close = %v; want net.ErrClosed", err)
+	}
+}
+
+func TestPortNetConn(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	var c net.Conn = b
+	if addr := c.RemoteAddr(); addr.Network() != "serial" || addr.String() != "pipe" {
+		t.Errorf("RemoteAddr = %v %q", addr.Network(), addr.String())
+	}
+	testConnDeadlines(t, c, a)
+}
+
+// TestNetConnTimeouts checks the deadlines a port keeps itself, for
+// drivers that cannot.
+func TestNetConnTimeouts(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	b.d = struct{ driver }{b.d} // hides deadliner
+	c := b.NetConn()
+
+	c.SetReadDeadline(time.Now().Add(-time.Second))
+	if _, err := c.Read(make([]byte, 1)); !isTimeout(err) {
+		t.Errorf("Read past the deadline = %v; want a timeout", err)
+	}
+	start := time.Now()
+	c.SetReadDeadline(start.Add(50 * time.Millisecond))
+	if _, err := c.Read(make([]byte, 1)); !isTimeout(err) {
+		t.Errorf("Read until the deadline = %v; want a timeout", err)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond || d > time.Second {
+		t.Errorf("Read with a 50ms deadline returned after %v", d)
+	}
+	if err := c.SetWriteDeadline(time.Now()); err != ErrUnsupported {
+		t.Errorf("SetWriteDeadline without a write timeout = %v; want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,54 @@
+package goserial
+
+import (
+	"context"
+	"errors"
+	"os"
+	"time"
+)
+
+// The waits between OpenWait's attempts, which double from the first
+// to the last.
+const (
+	openWaitFirst = 50 * time.Millisecond
+	openWaitMax   = time.Second
+)
+
+// OpenWait is OpenPortContext for a device that may not be there yet,
+// such as a USB adapter whose node udev is still creating at boot: while
+// the open fails because the port does not exist, cannot be opened by
+// this user yet or is busy, it tries again, waiting 50 ms at first and
+// up to a second between attempts, until the port opens or ctx is done,
+// when it returns ctx's error.  Any other error, such as a ConfigError,
+// is returned at once.
+func OpenWait(ctx context.Context, c *Config) (*Port, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+	wait := openWaitFirst
+	for {
+		p, err := OpenPortContext(ctx, c)
+		if err == nil || !openRetryable(err) {
+			return p, err
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		}
+		if wait *= 2; wait > openWaitMax {
+			wait = openWaitMax
+		}
+	}
+}
+
+// openRetryable reports whether an open that failed with err may
+// succeed later without anything but the device changing.  Permission
+// is among them because udev sets a node's group and mode only after
+// creating it.
+func openRetryable(err error) bool {
+	return errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) ||
+		errors.Is(err, ErrPortBusy) || errors.Is(err, ErrPortDisconnected)
+}
@@ -0,0 +1,115 @@
+package goserial
+
+import "time"
+
+// An Option sets part of the Config that Open opens a port with.  Any
+// func(*Config) will do, for the fields without an Option of their own:
+//
+//	serial.Open("/dev/ttyUSB0", serial.WithBaud(115200),
+//		serial.Option(func(c *serial.Config) { c.LowLatency = true }))
+type Option func(*Config)
+
+// DefaultBaud is the rate Open uses without WithBaud.
+const DefaultBaud = 9600
+
+// Open opens the named port as configured by opts, starting from 9600
+// baud, 8 data bits, no parity and one stop bit, with no read timeout.
+// It is OpenPort with the Config built by the options, which are
+// applied in order; a later one overrides an earlier one.
+func Open(name string, opts ...Option) (*Port, error) {
+	return OpenPort(optionConfig(name, opts))
+}
+
+func optionConfig(name string, opts []Option) *Config {
+	c := &Config{Name: name, Baud: DefaultBaud}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// WithBaud sets the baud rate.
+func WithBaud(baud int) Option {
+	return func(c *Config) { c.Baud = baud }
+}
+
+// WithSize sets the number of data bits.
+func WithSize(size ByteSize) Option {
+	return func(c *Config) { c.Size = size }
+}
+
+// WithParity sets the parity.
+func WithParity(parity ParityMode) Option {
+	return func(c *Config) { c.Parity = parity }
+}
+
+// WithStopBits sets the number of stop bits.
+func WithStopBits(stop StopBits) Option {
+	return func(c *Config) { c.StopBits = stop }
+}
+
+// WithReadTimeout sets the read timeout, rounded up to a whole
+// millisecond; zero or less makes Read block.  See Port.SetReadTimeout.
+func WithReadTimeout(d time.Duration) Option {
+	return func(c *Config) {
+		c.ReadTimeout = 0
+		if d > 0 {
+			ms := (d + time.Millisecond - 1) / time.Millisecond
+			if ms > 1<<32-1 {
+				ms = 1<<32 - 1
+			}
+			c.ReadTimeout = uint32(ms)
+		}
+	}
+}
+
+// WithWriteTimeout sets Config.WriteTimeout.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(c *Config) { c.WriteTimeout = d }
+}
+
+// WithOpenTimeout sets Config.OpenTimeout.
+func WithOpenTimeout(d time.Duration) Option {
+	return func(c *Config) { c.OpenTimeout = d }
+}
+
+// WithFlowControl turns on hardware or software flow control, or with
+// FlowNone turns off both.
+func WithFlowControl(f FlowControl) Option {
+	return func(c *Config) {
+		c.RTSFlowControl = f == FlowRTSCTS
+		c.XONFlowControl = f == FlowXONXOFF
+	}
+}
+
+// WithInitialLines sets the state DTR and RTS are put in on open; see
+// Config.InitialDTR.
+func WithInitialLines(dtr, rts LineState) Option {
+	return func(c *Config) { c.InitialDTR, c.InitialRTS = dtr, rts }
+}
+
+// WithReadBufferSize gives the port a read buffer; see
+// Config.ReadBufferSize.
+func WithReadBufferSize(n int) Option {
+	return func(c *Config) { c.ReadBufferSize = n }
+}
+
+// WithTracer has t see everything done through the port, from the
+// setup of the open on; see Config.Tracer.
+func WithTracer(t Tracer) Option {
+	return func(c *Config) { c.Tracer = t }
+}
+
+// WithExclusive keeps other processes off the port; see
+// Config.Exclusive.
+func WithExclusive() Option {
+	return func(c *Config) { c.Exclusive = true }
+}
+
+// WithLowLatency asks for received data to be passed on as soon as
+// possible: Config.LowLatency, and a Config.LatencyTimer of 1 ms for an
+// FTDI adapter.  Where either is not supported the port opens anyway,
+// with the failure in Port.SetupWarnings.
+func WithLowLatency() Option {
+	return func(c *Config) { c.LowLatency, c.LatencyTimer = true, 1 }
+}
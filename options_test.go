@@ -0,0 +1,38 @@
+package goserial
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestOptionConfig(t *testing.T) {
+	c := optionConfig("COM5", []Option{
+		WithBaud(115200),
+		WithParity(ParityEven),
+		WithStopBits(StopBits2),
+		WithReadTimeout(1500 * time.Microsecond),
+		WithFlowControl(FlowXONXOFF),
+		WithFlowControl(FlowRTSCTS),
+		WithLowLatency(),
+	})
+	want := Config{Name: "COM5", Baud: 115200, Parity: ParityEven, StopBits: StopBits2,
+		ReadTimeout: 2, RTSFlowControl: true, LowLatency: true, LatencyTimer: 1}
+	if !reflect.DeepEqual(*c, want) {
+		t.Errorf("optionConfig = %+v\nwant %+v", *c, want)
+	}
+
+	if c := optionConfig("x", nil); c.Baud != DefaultBaud || c.check() != nil {
+		t.Errorf("default config %+v, check %v", *c, c.check())
+	}
+	if c := optionConfig("x", []Option{WithReadTimeout(-time.Second)}); c.ReadTimeout != 0 {
+		t.Errorf("negative read timeout gave %d ms", c.ReadTimeout)
+	}
+}
+
+func TestOpenOptions(t *testing.T) {
+	if _, err := Open("x", WithSize(ByteSize(9))); !errors.Is(err, ErrConfigByteSize) {
+		t.Errorf("Open with a bad size = %v, want ErrConfigByteSize", err)
+	}
+}
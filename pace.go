@@ -0,0 +1,66 @@
+package goserial
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// SetWritePacing makes Write send its data chunk bytes at a time, each
+// piece starting at least interval after the last one did, for devices
+// with a small UART and no flow control that drop characters when a
+// whole frame arrives at once.  SetWritePacing(1, d) puts d between the
+// starts of successive bytes.  Where the driver can drain its output,
+// each piece is also drained before the next is sent, so the pace is
+// kept on the line rather than at the kernel's queue; on a USB adapter
+// draining only waits for the adapter to take the data.  Either
+// argument at zero turns pacing off, the default.
+//
+// The pace holds across Writes as well as within one, and concurrent
+// Writes take turns a piece at a time.  A Write that fails part way
+// returns the count of the bytes sent.  Stats and tracers see each
+// piece as a write of its own.  Coalesced writes are paced as they are
+// sent.
+func (p *Port) SetWritePacing(chunk int, interval time.Duration) error {
+	p.pl.Lock()
+	defer p.pl.Unlock()
+	if chunk <= 0 || interval <= 0 {
+		atomic.StoreInt32(&p.pacing, 0)
+	} else {
+		p.paceChunk, p.paceInterval = chunk, interval
+		atomic.StoreInt32(&p.pacing, 1)
+	}
+	p.traceControl("write pacing", nil, chunk, interval)
+	return nil
+}
+
+// pacedWrite is write while pacing.
+func (p *Port) pacedWrite(b []byte) (int, error) {
+	p.pl.Lock()
+	defer p.pl.Unlock()
+	if atomic.LoadInt32(&p.pacing) == 0 {
+		return p.writeNow(b)
+	}
+	dr, canDrain := p.d.(drainer)
+	done := 0
+	for done < len(b) {
+		if wait := time.Until(p.paceNext); wait > 0 {
+			time.Sleep(wait)
+		}
+		end := done + p.paceChunk
+		if end > len(b) {
+			end = len(b)
+		}
+		p.paceNext = time.Now().Add(p.paceInterval)
+		n, err := p.writeNow(b[done:end])
+		done += n
+		if err != nil {
+			return done, err
+		}
+		if canDrain {
+			if err := dr.drain(); err != nil {
+				return done, err
+			}
+		}
+	}
+	return done, nil
+}
@@ -0,0 +1,488 @@
+package goserial
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// PipeConfig configures the ports returned by NewPipe.
+type PipeConfig struct {
+	// Baud paces writes at the time the data would take on a real
+	// line, counting ten bits per byte.  Zero delivers data at once.
+	Baud int
+
+	// BufferSize is how many bytes each direction holds before
+	// writes block.  Zero means 4096.
+	BufferSize int
+
+	// ReadBufferSize gives both ports a read buffer, as
+	// Config.ReadBufferSize does.
+	ReadBufferSize int
+}
+
+// Pipe returns the two ends of an in-memory null-modem cable: bytes
+// written to one port can be read from the other.  It is meant for
+// testing code that uses a Port without hardware.  Read timeouts work
+// as on a real port.  Once one end is closed, reads on the other return
+// the data already buffered and then io.EOF, and writes to it fail with
+// ErrPortClosed.
+func Pipe() (*Port, *Port) {
+	return NewPipe(nil)
+}
+
+// NewPipe is like Pipe but takes a configuration; c may be nil.
+func NewPipe(c *PipeConfig) (*Port, *Port) {
+	var pc PipeConfig
+	if c != nil {
+		pc = *c
+	}
+	if pc.BufferSize <= 0 {
+		pc.BufferSize = 4096
+	}
+	ab := newPipeBuffer(pc.BufferSize)
+	ba := newPipeBuffer(pc.BufferSize)
+	a := &pipeEnd{in: ba, out: ab, baud: pc.Baud, wake: make(chan struct{})}
+	b := &pipeEnd{in: ab, out: ba, baud: pc.Baud, wake: make(chan struct{})}
+	a.peer, b.peer = b, a
+	pa, pb := &Port{d: a, name: "pipe"}, &Port{d: b, name: "pipe"}
+	if pc.ReadBufferSize > 0 {
+		pa.rbuf = make([]byte, pc.ReadBufferSize)
+		pb.rbuf = make([]byte, pc.ReadBufferSize)
+	}
+	return pa, pb
+}
+
+// pipeBuffer carries the data going one way through a pipe.
+type pipeBuffer struct {
+	mu      sync.Mutex
+	buf     []byte // allocated once; data is a window on it
+	data    []byte
+	wclosed bool          // the writing end has been closed
+	rclosed bool          // the reading end has been closed
+	wake    chan struct{} // closed, and replaced, on a change someone waits for
+	waiting bool          // someone is waiting on wake
+
+	// The deadlines set by the reading and writing ends, which bound
+	// every read and write as well as their own timeouts.
+	rdeadline, wdeadline time.Time
+}
+
+func newPipeBuffer(size int) *pipeBuffer {
+	buf := make([]byte, size)
+	return &pipeBuffer{buf: buf, data: buf[:0], wake: make(chan struct{})}
+}
+
+// changed wakes everyone waiting on b.  Only then is wake replaced, so
+// a transfer nobody waits for does not allocate.  b.mu must be held.
+func (b *pipeBuffer) changed() {
+	if !b.waiting {
+		return
+	}
+	close(b.wake)
+	b.wake = make(chan struct{})
+	b.waiting = false
+}
+
+// earliest returns the earlier of two deadlines, where zero means none.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || !b.IsZero() && b.Before(a) {
+		return b
+	}
+	return a
+}
+
+// expired reports whether deadline is set and has passed.
+func expired(deadline time.Time) bool {
+	return !deadline.IsZero() && !time.Now().Before(deadline)
+}
+
+// read waits for data until the deadline, if it is not zero, or the
+// read deadline, which may change while it waits.
+func (b *pipeBuffer) read(p []byte, deadline time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.data) == 0 {
+		switch {
+		case b.rclosed:
+			return 0, ErrPortClosed
+		case b.wclosed:
+			return 0, io.EOF
+		}
+		d := earliest(deadline, b.rdeadline)
+		if expired(d) {
+			return 0, ErrTimeout
+		}
+		b.wait(d)
+	}
+	n := copy(p, b.data)
+	b.data = b.data[n:]
+	if len(b.data) == 0 {
+		b.data = b.buf[:0]
+	}
+	b.changed()
+	return n, nil
+}
+
+// write appends p, waiting for room as needed until the deadline, if
+// it is not zero, or the write deadline.
+func (b *pipeBuffer) write(p []byte, deadline time.Time) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	written := 0
+	for len(p) > 0 {
+		switch {
+		case b.wclosed, b.rclosed:
+			return written, ErrPortClosed
+		case len(b.data) >= len(b.buf):
+			d := earliest(deadline, b.wdeadline)
+			if expired(d) {
+				return written, ErrTimeout
+			}
+			b.wait(d)
+			continue
+		}
+		if len(b.data) == cap(b.data) {
+			b.data = b.buf[:copy(b.buf, b.data)]
+		}
+		n := cap(b.data) - len(b.data)
+		if n > len(p) {
+			n = len(p)
+		}
+		b.data = append(b.data, p[:n]...)
+		p = p[n:]
+		written += n
+		b.changed()
+	}
+	return written, nil
+}
+
+// put appends p without waiting, growing the buffer if p does not fit.
+func (b *pipeBuffer) put(p []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.wclosed || b.rclosed {
+		return ErrPortClosed
+	}
+	if len(p) == 0 {
+		return nil
+	}
+	if n := len(b.data) + len(p); n > cap(b.data) {
+		if n > len(b.buf) {
+			size := 2 * len(b.buf)
+			for size < n {
+				size *= 2
+			}
+			b.buf = make([]byte, size)
+		}
+		b.data = b.buf[:copy(b.buf, b.data)]
+	}
+	b.data = append(b.data, p...)
+	b.changed()
+	return nil
+}
+
+// wait releases b.mu until b changes or the deadline passes, returning
+// false in the latter case.
+func (b *pipeBuffer) wait(deadline time.Time) bool {
+	wake := b.wake
+	b.waiting = true
+	b.mu.Unlock()
+	defer b.mu.Lock()
+	if deadline.IsZero() {
+		<-wake
+		return true
+	}
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case <-wake:
+		return true
+	case <-t.C:
+		return false
+	}
+}
+
+// waitData waits until there is data to read, or the buffer is closed.
+func (b *pipeBuffer) waitData(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.data) == 0 {
+		switch {
+		case b.rclosed:
+			return ErrPortClosed
+		case b.wclosed:
+			return io.EOF
+		}
+		wake := b.wake
+		b.waiting = true
+		b.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+		}
+		b.mu.Lock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setDeadline sets the read or write deadline, waking a read or write
+// waiting on the old one.
+func (b *pipeBuffer) setDeadline(d *time.Time, t time.Time) {
+	b.mu.Lock()
+	*d = t
+	b.changed()
+	b.mu.Unlock()
+}
+
+// waitEmpty waits until everything written has been read, or the
+// buffer is reset or closed.
+func (b *pipeBuffer) waitEmpty() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for len(b.data) > 0 && !b.rclosed {
+		b.wait(time.Time{})
+	}
+}
+
+func (b *pipeBuffer) closeReader() {
+	b.mu.Lock()
+	b.rclosed = true
+	b.changed()
+	b.mu.Unlock()
+}
+
+func (b *pipeBuffer) closeWriter() {
+	b.mu.Lock()
+	b.wclosed = true
+	b.changed()
+	b.mu.Unlock()
+}
+
+func (b *pipeBuffer) reset() {
+	b.mu.Lock()
+	b.data = b.buf[:0]
+	b.changed()
+	b.mu.Unlock()
+}
+
+// pipeEnd is the driver for one end of a Pipe.
+type pipeEnd struct {
+	in, out *pipeBuffer
+	peer    *pipeEnd // for the modem status lines
+
+	mu       sync.Mutex
+	baud     int
+	size     ByteSize
+	parity   ParityMode
+	stop     StopBits
+	timeout  time.Duration
+	wtimeout time.Duration
+	dtr, rts bool
+	closed   bool
+	wake     chan struct{} // closed, and replaced, when the peer's lines change
+}
+
+func (e *pipeEnd) Read(p []byte) (int, error) {
+	e.mu.Lock()
+	timeout := e.timeout
+	e.mu.Unlock()
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	return e.in.read(p, deadline)
+}
+
+func (e *pipeEnd) Write(p []byte) (int, error) {
+	e.mu.Lock()
+	baud, timeout := e.baud, e.wtimeout
+	e.mu.Unlock()
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	if baud <= 0 {
+		return e.out.write(p, deadline)
+	}
+
+	// Hand the data over in chunks of about 5 ms of line time.
+	chunk := baud / 10 / 200
+	if chunk < 1 {
+		chunk = 1
+	}
+	written := 0
+	for len(p) > 0 {
+		n := chunk
+		if n > len(p) {
+			n = len(p)
+		}
+		time.Sleep(time.Duration(n) * 10 * time.Second / time.Duration(baud))
+		m, err := e.out.write(p[:n], deadline)
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+func (e *pipeEnd) waitReadable(ctx context.Context) error {
+	return e.in.waitData(ctx)
+}
+
+// queued reports the data buffered towards this end, and as pending
+// output what the peer has not read yet.
+func (e *pipeEnd) queued() (in, out int, err error) {
+	e.in.mu.Lock()
+	in = len(e.in.data)
+	e.in.mu.Unlock()
+	e.out.mu.Lock()
+	out = len(e.out.data)
+	e.out.mu.Unlock()
+	return in, out, nil
+}
+
+// drain waits for the peer to read everything written to it.
+func (e *pipeEnd) drain() error {
+	e.out.waitEmpty()
+	return nil
+}
+
+func (e *pipeEnd) Close() error {
+	e.in.closeReader()
+	e.out.closeWriter()
+	e.mu.Lock()
+	e.closed = true
+	e.changed()
+	e.mu.Unlock()
+	return nil
+}
+
+// changed wakes the waitModemChange in progress, if any.  e.mu must be
+// held.
+func (e *pipeEnd) changed() {
+	close(e.wake)
+	e.wake = make(chan struct{})
+}
+
+func (e *pipeEnd) setBaud(baud int) error {
+	e.mu.Lock()
+	e.baud = baud
+	e.mu.Unlock()
+	return nil
+}
+
+// setFraming only records the settings, for getConfig; every byte
+// arrives whole whatever both ends say.
+func (e *pipeEnd) setFraming(size ByteSize, parity ParityMode, stop StopBits) error {
+	e.mu.Lock()
+	e.size, e.parity, e.stop = size, parity, stop
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *pipeEnd) setReadTimeout(d time.Duration) error {
+	e.mu.Lock()
+	e.timeout = d
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *pipeEnd) setReadDeadline(t time.Time) error {
+	e.in.setDeadline(&e.in.rdeadline, t)
+	return nil
+}
+
+func (e *pipeEnd) setWriteDeadline(t time.Time) error {
+	e.out.setDeadline(&e.out.wdeadline, t)
+	return nil
+}
+
+func (e *pipeEnd) setWriteTimeout(d time.Duration) error {
+	e.mu.Lock()
+	e.wtimeout = d
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *pipeEnd) setDTR(on bool) error {
+	e.mu.Lock()
+	e.dtr = on
+	e.mu.Unlock()
+	e.peer.mu.Lock()
+	e.peer.changed()
+	e.peer.mu.Unlock()
+	return nil
+}
+
+func (e *pipeEnd) setRTS(on bool) error {
+	e.mu.Lock()
+	e.rts = on
+	e.mu.Unlock()
+	e.peer.mu.Lock()
+	e.peer.changed()
+	e.peer.mu.Unlock()
+	return nil
+}
+
+func (e *pipeEnd) outputLines() (dtr, rts bool, err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dtr, e.rts, nil
+}
+
+// modemStatus wires the lines as a null-modem cable does.
+func (e *pipeEnd) modemStatus() (ModemStatus, error) {
+	e.peer.mu.Lock()
+	defer e.peer.mu.Unlock()
+	return ModemStatus{CTS: e.peer.rts, DSR: e.peer.dtr, DCD: e.peer.dtr}, nil
+}
+
+// waitModemChange waits for a change on the peer's DTR or RTS that
+// changes one of lines.
+func (e *pipeEnd) waitModemChange(ctx context.Context, lines ModemLines) error {
+	prior, _ := e.modemStatus()
+	for {
+		e.mu.Lock()
+		closed, wake := e.closed, e.wake
+		e.mu.Unlock()
+		if closed {
+			return ErrPortClosed
+		}
+		if s, _ := e.modemStatus(); (s.lines()^prior.lines())&lines != 0 {
+			return nil
+		}
+		select {
+		case <-wake:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (e *pipeEnd) flush(in, out bool) error {
+	if in {
+		e.in.reset()
+	}
+	if out {
+		e.out.reset()
+	}
+	return nil
+}
+
+func (e *pipeEnd) getConfig(c *Config) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	*c = Config{Baud: e.baud, Size: e.size, Parity: e.parity, StopBits: e.stop}
+	return nil
+}
+
+func (e *pipeEnd) restore() error {
+	return nil
+}
@@ -0,0 +1,737 @@
+package goserial
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPipe(t *testing.T) {
+	a, b := NewPipe(&PipeConfig{BufferSize: 4})
+
+	go a.Write([]byte("hello, world"))
+	buf := make([]byte, 64)
+	var got []byte
+	for len(got) < 12 {
+		n, err := b.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > 4 {
+			t.Fatalf("read %d bytes through a 4 byte buffer", n)
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != "hello, world" {
+		t.Fatalf("got %q", got)
+	}
+
+	b.SetReadTimeout(50 * time.Millisecond)
+	if n, err := b.Read(buf); n != 0 || err != ErrTimeout {
+		t.Errorf("Read on empty pipe = %d, %v; want 0, ErrTimeout", n, err)
+	}
+
+	a.Write([]byte("bye"))
+	a.Close()
+	if n, err := b.Read(buf); err != nil || string(buf[:n]) != "bye" {
+		t.Errorf("Read after peer close = %q, %v; want \"bye\"", buf[:n], err)
+	}
+	if _, err := b.Read(buf); err != io.EOF {
+		t.Errorf("Read of drained pipe = %v; want io.EOF", err)
+	}
+	if _, err := b.Write(buf[:1]); err != ErrPortClosed {
+		t.Errorf("Write to closed peer = %v; want ErrPortClosed", err)
+	}
+	if _, err := a.Read(buf); err != ErrPortClosed {
+		t.Errorf("Read on closed port = %v; want ErrPortClosed", err)
+	}
+}
+
+func TestPipePacing(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping timing test in short mode")
+	}
+	a, b := NewPipe(&PipeConfig{Baud: 9600})
+	defer a.Close()
+	defer b.Close()
+
+	// 96 bytes at 9600 baud take 100 ms on the line.
+	go a.Write(make([]byte, 96))
+	start := time.Now()
+	if _, err := io.ReadFull(b, make([]byte, 96)); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 90*time.Millisecond || d > time.Second {
+		t.Errorf("96 bytes at 9600 baud took %v; want about 100ms", d)
+	}
+}
+
+func TestWaitReadable(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.WaitReadable(ctx); err != context.DeadlineExceeded {
+		t.Errorf("WaitReadable with nothing sent: %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		a.Write([]byte("x"))
+	}()
+	if err := b.WaitReadable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := b.InputWaiting(); n != 1 || err != nil {
+		t.Errorf("InputWaiting = %d, %v; want 1", n, err)
+	}
+	if n, err := a.OutputPending(); n != 1 || err != nil {
+		t.Errorf("OutputPending = %d, %v; want 1", n, err)
+	}
+	b.SetReadTimeout(time.Millisecond)
+	if n, err := b.Read(make([]byte, 4)); n != 1 || err != nil {
+		t.Errorf("Read after WaitReadable: %d, %v", n, err)
+	}
+
+	b.Close()
+	if err := b.WaitReadable(context.Background()); err != ErrPortClosed {
+		t.Errorf("WaitReadable after Close: %v, want ErrPortClosed", err)
+	}
+}
+
+func TestReadBuffer(t *testing.T) {
+	a, b := NewPipe(&PipeConfig{ReadBufferSize: 8})
+	defer a.Close()
+	b.SetReadTimeout(20 * time.Millisecond)
+
+	a.Write([]byte("hello, world"))
+	if got, err := b.Peek(5); string(got) != "hello" || err != nil {
+		t.Fatalf("Peek(5) = %q, %v", got, err)
+	}
+	if n := b.Buffered(); n < 5 || n > 8 {
+		t.Errorf("Buffered after Peek(5) = %d", n)
+	}
+	if got, err := b.Peek(9); len(got) != 8 || err != bufio.ErrBufferFull {
+		t.Errorf("Peek(9) = %q, %v; want 8 bytes and ErrBufferFull", got, err)
+	}
+	if c, err := b.ReadByte(); c != 'h' || err != nil {
+		t.Errorf("ReadByte = %q, %v", c, err)
+	}
+	if n, err := b.Discard(6); n != 6 || err != nil {
+		t.Errorf("Discard(6) = %d, %v", n, err)
+	}
+	// Read returns what is buffered without reading more.
+	buf := make([]byte, 3)
+	if n, err := b.Read(buf); string(buf[:n]) != "w" || err != nil {
+		t.Errorf("Read = %q, %v; want \"w\"", buf[:n], err)
+	}
+	if n, err := b.InputWaiting(); n != 4 || err != nil {
+		t.Errorf("InputWaiting = %d, %v; want 4", n, err)
+	}
+	if err := b.WaitReadable(context.Background()); err != nil {
+		t.Errorf("WaitReadable with bytes buffered: %v", err)
+	}
+
+	// Peek gives up at the read timeout with what it has.
+	if got, err := b.Peek(6); string(got) != "orld" || err != ErrTimeout {
+		t.Errorf("Peek(6) short = %q, %v; want \"orld\", ErrTimeout", got, err)
+	}
+	if n, err := b.Discard(6); n != 4 || err != ErrTimeout {
+		t.Errorf("Discard(6) short = %d, %v; want 4, ErrTimeout", n, err)
+	}
+
+	a.Write([]byte("stale"))
+	b.Peek(1)
+	b.flush(true, false)
+	if n := b.Buffered(); n != 0 {
+		t.Errorf("Buffered after Flush = %d", n)
+	}
+
+	u, _ := Pipe()
+	if _, err := u.Peek(1); err != ErrUnsupported {
+		t.Errorf("Peek unbuffered = %v; want ErrUnsupported", err)
+	}
+	if err := (&Config{Name: "x", Baud: 9600, ReadBufferSize: -1}).check(); err == nil {
+		t.Error("check accepted a negative ReadBufferSize")
+	}
+}
+
+func TestCopyUntilIdle(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	b.SetReadTimeout(time.Second)
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			a.Write([]byte("abc"))
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	var got bytes.Buffer
+	n, err := CopyUntilIdle(&got, b, 100*time.Millisecond, 5*time.Second)
+	if n != 9 || err != nil || got.String() != "abcabcabc" {
+		t.Errorf("CopyUntilIdle = %d, %v, %q; want 9, nil", n, err, got.String())
+	}
+	if d := b.ReadTimeout(); d != time.Second {
+		t.Errorf("read timeout afterwards = %v; want it put back", d)
+	}
+
+	// A device that never goes quiet hits max.
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+				a.Write([]byte("x"))
+			}
+		}
+	}()
+	start := time.Now()
+	n, err = CopyUntilIdle(io.Discard, b, 100*time.Millisecond, 200*time.Millisecond)
+	if n == 0 || err != ErrTimeout {
+		t.Errorf("CopyUntilIdle on a busy port = %d, %v; want some bytes and ErrTimeout", n, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("CopyUntilIdle with max 200ms took %v", d)
+	}
+}
+
+func TestCloseMode(t *testing.T) {
+	for _, tc := range []struct {
+		mode CloseMode
+		read bool // whether the peer reads
+		err  error
+		want string
+	}{
+		{CloseDefault, false, nil, "data"},
+		{CloseDiscard, false, nil, ""},
+		{CloseDrain, true, nil, "data"},
+		{CloseDrain, false, ErrDrainTimeout, ""},
+	} {
+		a, b := Pipe()
+		a.drainTimeout = 50 * time.Millisecond
+		a.Write([]byte("data"))
+		got := make(chan string, 1)
+		if tc.read {
+			go func() {
+				time.Sleep(10 * time.Millisecond)
+				buf := make([]byte, 4)
+				n, _ := io.ReadFull(b, buf)
+				got <- string(buf[:n])
+			}()
+		}
+		start := time.Now()
+		if err := a.CloseWithMode(tc.mode); err != tc.err {
+			t.Errorf("mode %d: Close = %v; want %v", tc.mode, err, tc.err)
+		}
+		if d := time.Since(start); d > time.Second {
+			t.Errorf("mode %d: Close took %v", tc.mode, d)
+		}
+		if !tc.read {
+			rest, _ := io.ReadAll(b)
+			got <- string(rest)
+		}
+		if s := <-got; s != tc.want {
+			t.Errorf("mode %d: peer read %q; want %q", tc.mode, s, tc.want)
+		}
+		b.Close()
+	}
+
+	if err := (&Config{Name: "x", Baud: 9600, CloseMode: 7}).check(); err == nil {
+		t.Error("check accepted an unknown CloseMode")
+	}
+}
+
+func TestReadTimestamped(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	before := time.Now()
+	a.Write([]byte("x"))
+	buf := make([]byte, 16)
+	n, at, err := b.ReadTimestamped(buf)
+	if n != 1 || err != nil || at.Before(before) || at.After(time.Now()) {
+		t.Errorf("ReadTimestamped = %d, %v, %v; want 1 byte stamped after %v", n, at, err, before)
+	}
+
+	// A buffered port keeps the time of each driver read.
+	a, b = NewPipe(&PipeConfig{ReadBufferSize: 16})
+	defer a.Close()
+	a.Write([]byte("ab"))
+	b.Peek(2)
+	time.Sleep(20 * time.Millisecond)
+	a.Write([]byte("cd"))
+	b.Peek(4)
+	n, t1, err := b.ReadTimestamped(buf)
+	if string(buf[:n]) != "ab" || err != nil {
+		t.Fatalf("first ReadTimestamped = %q, %v; want \"ab\"", buf[:n], err)
+	}
+	n, t2, err := b.ReadTimestamped(buf)
+	if string(buf[:n]) != "cd" || err != nil {
+		t.Fatalf("second ReadTimestamped = %q, %v; want \"cd\"", buf[:n], err)
+	}
+	if d := t2.Sub(t1); d < 20*time.Millisecond {
+		t.Errorf("chunks stamped %v apart; want at least 20ms", d)
+	}
+
+	b.SetReadTimeout(10 * time.Millisecond)
+	if n, at, err := b.ReadTimestamped(buf); n != 0 || !at.IsZero() || err != ErrTimeout {
+		t.Errorf("ReadTimestamped on an idle port = %d, %v, %v; want 0, zero time, ErrTimeout", n, at, err)
+	}
+}
+
+func TestPipeWriteTimeout(t *testing.T) {
+	a, b := NewPipe(&PipeConfig{BufferSize: 4})
+	defer b.Close()
+	if err := a.SetWriteTimeout(20 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.Write([]byte("overflow")); n != 4 || err != ErrTimeout {
+		t.Errorf("Write past a full pipe = %d, %v; want 4, ErrTimeout", n, err)
+	}
+	if st := a.Stats(); st.Timeouts != 1 {
+		t.Errorf("Timeouts = %d; want 1", st.Timeouts)
+	}
+	for _, c := range []Config{
+		{Name: "x", Baud: 9600, WriteTimeout: -1},
+		{Name: "x", Baud: 9600, WriteTimeout: time.Second, WindowsTimeouts: &WindowsTimeouts{}},
+		{Name: "x", Baud: 9600, WriteTimeout: time.Second, PosixTimeouts: &PosixTimeouts{}},
+		{Name: "x", Baud: 9600, InterCharacterTimeout: -1},
+		{Name: "x", Baud: 9600, MinimumReadSize: 4, PosixTimeouts: &PosixTimeouts{}},
+	} {
+		if err := c.check(); err == nil {
+			t.Errorf("check accepted %+v", c)
+		}
+	}
+}
+
+func TestWriteCoalescing(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	b.SetReadTimeout(10 * time.Millisecond)
+	got := func() string {
+		buf := make([]byte, 64)
+		n, _ := b.Read(buf)
+		return string(buf[:n])
+	}
+	if err := a.SetWriteCoalescing(50*time.Millisecond, 8); err != nil {
+		t.Fatal(err)
+	}
+
+	// Small writes wait for the delay.
+	for _, s := range []string{"a", "b", "c"} {
+		if n, err := a.Write([]byte(s)); n != 1 || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if s := got(); s != "" {
+		t.Errorf("read %q before the delay", s)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if s := got(); s != "abc" {
+		t.Errorf("read %q after the delay; want abc", s)
+	}
+	if st := a.Stats(); st.Writes != 1 {
+		t.Errorf("Writes = %d; want 1", st.Writes)
+	}
+
+	// maxBytes sends at once, and a large write keeps its place.
+	a.Write([]byte("0123"))
+	a.Write([]byte("45678"))
+	if s := got(); s != "01234567" {
+		t.Errorf("read %q after filling maxBytes; want 01234567", s)
+	}
+	a.Write([]byte("0123456789"))
+	if s := got(); s != "80123456789" {
+		t.Errorf("read %q after a large write; want 80123456789", s)
+	}
+
+	a.Write([]byte("x"))
+	if err := a.FlushWrites(); err != nil {
+		t.Fatal(err)
+	}
+	if s := got(); s != "x" {
+		t.Errorf("read %q after FlushWrites; want x", s)
+	}
+
+	a.SetFlushOnRead(true)
+	a.SetReadTimeout(time.Millisecond)
+	a.Write([]byte("q"))
+	a.Read(make([]byte, 1))
+	if s := got(); s != "q" {
+		t.Errorf("read %q after a Read with SetFlushOnRead; want q", s)
+	}
+	a.SetFlushOnRead(false)
+
+	a.Write([]byte("gone"))
+	a.flush(false, true)
+	a.FlushWrites()
+	if s := got(); s != "" {
+		t.Errorf("read %q after discarding the output", s)
+	}
+
+	a.Write([]byte("bye"))
+	a.Close()
+	if s := got(); s != "bye" {
+		t.Errorf("read %q after Close; want bye", s)
+	}
+
+	// An error sending in the background is returned by the next Write.
+	a, b = Pipe()
+	a.SetWriteCoalescing(10*time.Millisecond, 8)
+	a.Write([]byte("lost"))
+	b.Close()
+	time.Sleep(30 * time.Millisecond)
+	if _, err := a.Write([]byte("z")); err != ErrPortClosed {
+		t.Errorf("Write after a failed background send = %v; want ErrPortClosed", err)
+	}
+	if err := a.FlushWrites(); err != nil {
+		t.Errorf("FlushWrites after the error was returned = %v", err)
+	}
+	a.Close()
+}
+
+func TestSettings(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	before, err := a.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := before.Get("read_timeout"); v != "0s" {
+		t.Errorf("read_timeout = %q; want 0s", v)
+	}
+	a.SetReadTimeout(time.Second)
+	a.SetDTR(true)
+	after, _ := a.Settings()
+	want := "dtr: false -> true\nread_timeout: 0s -> 1s\n"
+	if d := DiffSettings(before, after); d != want {
+		t.Errorf("DiffSettings =\n%s; want\n%s", d, want)
+	}
+	if d := DiffSettings(after, append(after, Setting{"extra", "1"})); d != "extra: (none) -> 1\n" {
+		t.Errorf("DiffSettings with an added setting = %q", d)
+	}
+	dump, _ := a.DumpSettings()
+	if dump != after.String() || !strings.Contains(dump, "\nbaud: 0\n") {
+		t.Errorf("DumpSettings =\n%s", dump)
+	}
+}
+
+func TestModemStatus(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	if s, err := a.ModemStatus(); err != nil || s != (ModemStatus{}) {
+		t.Errorf("ModemStatus = %+v, %v; want all lines off", s, err)
+	}
+	b.SetRTS(true)
+	if s, _ := a.ModemStatus(); s != (ModemStatus{CTS: true}) {
+		t.Errorf("ModemStatus after peer RTS = %+v; want CTS only", s)
+	}
+	b.SetDTR(true)
+	if s, _ := a.ModemStatus(); s != (ModemStatus{CTS: true, DSR: true, DCD: true}) {
+		t.Errorf("ModemStatus after peer DTR = %+v; want CTS, DSR and DCD", s)
+	}
+	if s, _ := b.ModemStatus(); s != (ModemStatus{}) {
+		t.Errorf("ModemStatus of the other end = %+v; want all lines off", s)
+	}
+}
+
+func TestWaitForLineChange(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		b.SetRTS(true) // CTS, which is not waited for
+		time.Sleep(10 * time.Millisecond)
+		b.SetDTR(true)
+	}()
+	s, err := a.WaitForLineChange(context.Background(), ModemDSR)
+	if err != nil || s != (ModemStatus{CTS: true, DSR: true, DCD: true}) {
+		t.Errorf("WaitForLineChange(DSR) = %+v, %v; want CTS, DSR and DCD", s, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := a.WaitForLineChange(ctx, AllModemLines); err != context.DeadlineExceeded {
+		t.Errorf("WaitForLineChange with no change = %v; want DeadlineExceeded", err)
+	}
+	if _, err := a.WaitForLineChange(context.Background(), 0); err == nil {
+		t.Error("WaitForLineChange with no lines succeeded")
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		a.Close()
+	}()
+	if _, err := a.WaitForLineChange(context.Background(), AllModemLines); err != ErrPortClosed {
+		t.Errorf("WaitForLineChange across Close = %v; want ErrPortClosed", err)
+	}
+}
+
+func TestPortDeadlines(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	buf := make([]byte, 4)
+
+	// The read timeout ends a call before a later deadline.
+	b.SetReadTimeout(20 * time.Millisecond)
+	b.SetReadDeadline(time.Now().Add(time.Hour))
+	start := time.Now()
+	if _, err := b.Read(buf); err != ErrTimeout || time.Since(start) > time.Second {
+		t.Errorf("Read with a 20ms timeout and a later deadline = %v after %v", err, time.Since(start))
+	}
+
+	// A deadline ends it before a longer timeout, and a past one fails
+	// at once.
+	b.SetReadTimeout(time.Hour)
+	b.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := b.Read(buf); err != ErrTimeout {
+		t.Errorf("Read until the deadline = %v; want ErrTimeout", err)
+	}
+	if _, err := b.Read(buf); err != ErrTimeout {
+		t.Errorf("Read past the deadline = %v; want ErrTimeout", err)
+	}
+
+	// The same, for a driver whose deadlines the port keeps.
+	b.SetDeadline(time.Time{})
+	b.d = struct {
+		driver
+		writeTimeoutSetter
+	}{b.d, b.d.(writeTimeoutSetter)}
+	b.SetDeadline(time.Now().Add(20 * time.Millisecond))
+	start = time.Now()
+	if _, err := b.Read(buf); err != ErrTimeout || time.Since(start) < 10*time.Millisecond {
+		t.Errorf("emulated: Read until the deadline = %v after %v", err, time.Since(start))
+	}
+	if _, err := b.Write(make([]byte, 1<<20)); err != ErrTimeout {
+		t.Errorf("emulated: Write past the deadline = %v; want ErrTimeout", err)
+	}
+	b.SetDeadline(time.Time{})
+	if b.ReadTimeout() != time.Hour {
+		t.Errorf("ReadTimeout after clearing the deadline = %v", b.ReadTimeout())
+	}
+	a.Write([]byte("hi"))
+	if n, err := b.Read(buf); err != nil || string(buf[:n]) != "hi" {
+		t.Errorf("Read with the deadline cleared = %q, %v", buf[:n], err)
+	}
+}
+
+func TestReadBufferBlockedReader(t *testing.T) {
+	a, b := NewPipe(&PipeConfig{ReadBufferSize: 16})
+	defer a.Close()
+	defer b.Close()
+	got := make(chan string, 1)
+	go func() {
+		buf := make([]byte, 8)
+		n, _ := b.Read(buf)
+		got <- string(buf[:n])
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// While a Read waits, the buffer can still be asked about and reset.
+	done := make(chan struct{})
+	go func() {
+		b.Buffered()
+		b.ResetInputBuffer()
+		b.InputWaiting()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Buffered and ResetInputBuffer waited for a blocked Read")
+	}
+	a.Write([]byte("x"))
+	if s := <-got; s != "x" {
+		t.Errorf("blocked Read got %q; want x", s)
+	}
+}
+
+func TestReadUntil(t *testing.T) {
+	for _, size := range []int{0, 16} {
+		a, b := NewPipe(&PipeConfig{ReadBufferSize: size})
+		b.SetReadTimeout(20 * time.Millisecond)
+		a.Write([]byte("one\ntwo\nthr"))
+		if line, err := b.ReadUntil('\n'); string(line) != "one\n" || err != nil {
+			t.Errorf("size %d: ReadUntil = %q, %v; want one", size, line, err)
+		}
+		// The rest stays for the other reads.
+		if c, err := b.ReadByte(); c != 't' || err != nil {
+			t.Errorf("size %d: ReadByte after ReadUntil = %q, %v", size, c, err)
+		}
+		if line, err := b.ReadUntil('\n'); string(line) != "wo\n" || err != nil {
+			t.Errorf("size %d: second ReadUntil = %q, %v", size, line, err)
+		}
+		if line, err := b.ReadUntil('\n'); string(line) != "thr" || err != ErrTimeout {
+			t.Errorf("size %d: short ReadUntil = %q, %v; want thr, ErrTimeout", size, line, err)
+		}
+		a.Close()
+		b.Close()
+	}
+}
+
+func TestResetBuffers(t *testing.T) {
+	a, b := NewPipe(&PipeConfig{ReadBufferSize: 4})
+	defer a.Close()
+	defer b.Close()
+	b.SetReadTimeout(20 * time.Millisecond)
+	buf := make([]byte, 8)
+
+	// Both what the read buffer holds and what the pipe does go.
+	a.Write([]byte("stale data"))
+	b.Peek(1)
+	if err := b.ResetInputBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := b.Read(buf); err != ErrTimeout {
+		t.Errorf("Read after ResetInputBuffer = %q, %v; want ErrTimeout", buf[:n], err)
+	}
+
+	b.Write([]byte("unsent"))
+	if err := b.ResetOutputBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	a.SetReadTimeout(20 * time.Millisecond)
+	if n, err := a.Read(buf); err != ErrTimeout {
+		t.Errorf("peer Read after ResetOutputBuffer = %q, %v; want ErrTimeout", buf[:n], err)
+	}
+
+	a.Write([]byte("in"))
+	b.Write([]byte("out"))
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := b.Read(buf); err != ErrTimeout {
+		t.Errorf("Read after Flush = %q, %v; want ErrTimeout", buf[:n], err)
+	}
+	if n, err := a.Read(buf); err != ErrTimeout {
+		t.Errorf("peer Read after Flush = %q, %v; want ErrTimeout", buf[:n], err)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	a.SetWriteCoalescing(time.Hour, 64)
+	a.Write([]byte("frame"))
+
+	done := make(chan error, 1)
+	go func() { done <- a.Drain() }()
+	select {
+	case err := <-done:
+		t.Fatalf("Drain returned before the peer read: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(b, buf); err != nil || string(buf) != "frame" {
+		t.Fatalf("peer read %q, %v", buf, err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Drain = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Drain did not return once the output was read")
+	}
+}
+
+func TestRS485(t *testing.T) {
+	a, b := NewPipe(&PipeConfig{BufferSize: 4})
+	defer a.Close()
+	defer b.Close()
+	if err := a.setRS485(&RS485{DelayBeforeSend: 10 * time.Millisecond}); err != nil {
+		t.Fatal(err)
+	}
+	if w := a.SetupWarnings(); len(w) != 1 {
+		t.Errorf("SetupWarnings = %v; want the RS485 fallback", w)
+	}
+	cts := func() bool {
+		s, _ := b.ModemStatus()
+		return s.CTS
+	}
+	if cts() {
+		t.Error("RTS raised before sending")
+	}
+
+	// The frame fills the pipe, so the Write waits for the peer.
+	done := make(chan error, 1)
+	go func() {
+		_, err := a.Write([]byte("01030000"))
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if !cts() {
+		t.Error("RTS not raised while sending")
+	}
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(b, buf); err != nil || string(buf) != "01030000" {
+		t.Fatalf("peer read %q, %v", buf, err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if cts() {
+		t.Error("RTS still raised after sending")
+	}
+}
+
+func TestWritePacing(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	if err := a.SetWritePacing(2, 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	got := make(chan []byte, 1)
+	go func() {
+		var all []byte
+		buf := make([]byte, 64)
+		for len(all) < 6 {
+			n, err := b.Read(buf)
+			if err != nil {
+				break
+			}
+			all = append(all, buf[:n]...)
+		}
+		got <- all
+	}()
+	start := time.Now()
+	if n, err := a.Write([]byte("abcdef")); n != 6 || err != nil {
+		t.Fatalf("Write = %d, %v", n, err)
+	}
+	if d := time.Since(start); d < 40*time.Millisecond {
+		t.Errorf("paced Write took %v; want at least 40ms", d)
+	}
+	if s := string(<-got); s != "abcdef" {
+		t.Errorf("read %q; want abcdef", s)
+	}
+	if st := a.Stats(); st.Writes != 3 {
+		t.Errorf("Writes = %d; want 3", st.Writes)
+	}
+
+	// The pace holds from one Write to the next.
+	start = time.Now()
+	go b.Read(make([]byte, 1))
+	a.Write([]byte("g"))
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("next Write took %v; want it held back", d)
+	}
+
+	a.SetWritePacing(0, 0)
+	go b.Read(make([]byte, 64))
+	a.Write([]byte("hijk"))
+	if st := a.Stats(); st.Writes != 5 {
+		t.Errorf("Writes = %d after pacing off; want 5", st.Writes)
+	}
+}
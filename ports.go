@@ -0,0 +1,55 @@
+package goserial
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ListPorts returns the names of the serial ports currently on the
+// system, sorted, in the form Config.Name takes.  On Linux they are the
+// ttys backed by a device in sysfs, leaving out the legacy 8250 ports
+// with no UART behind them; on Windows, the COM ports the serial
+// drivers have registered; on macOS the /dev/cu.* call-out devices, and
+// on the BSDs and Solaris their call-out and USB devices; in the
+// browser, the Web Serial ports the page has been granted.  A port may
+// disappear, or another appear, by the time it is opened.
+func ListPorts() ([]string, error) {
+	return listPorts()
+}
+
+// PortInfo describes a serial port found by EnumeratePorts.
+type PortInfo struct {
+	Name string // as ListPorts returns it
+
+	// IsUSB is set for a port on a USB device, such as an adapter or a
+	// board with a USB CDC interface, which the remaining fields then
+	// describe as far as the device and system report it.
+	IsUSB        bool
+	VID, PID     uint16 // USB vendor and product IDs
+	SerialNumber string
+	Manufacturer string
+	Product      string
+}
+
+func (pi PortInfo) String() string {
+	if !pi.IsUSB {
+		return pi.Name
+	}
+	s := fmt.Sprintf("%s USB %04x:%04x", pi.Name, pi.VID, pi.PID)
+	if pi.SerialNumber != "" {
+		s += " serial " + pi.SerialNumber
+	}
+	if p := pi.Manufacturer + " " + pi.Product; p != " " {
+		s += " (" + strings.TrimSpace(p) + ")"
+	}
+	return s
+}
+
+// EnumeratePorts is ListPorts with a description of each port, so that
+// a particular adapter can be picked out by its USB IDs or serial
+// number.  The USB details come from sysfs on Linux, the IORegistry on
+// macOS, built with cgo, and the device's setup information on Windows.
+// Elsewhere only the names are filled in.
+func EnumeratePorts() ([]PortInfo, error) {
+	return enumeratePorts()
+}
@@ -0,0 +1,114 @@
+// +build darwin,cgo
+
+package goserial
+
+// #cgo LDFLAGS: -framework CoreFoundation -framework IOKit
+// #include <stdlib.h>
+// #include <CoreFoundation/CoreFoundation.h>
+// #include <IOKit/IOKitLib.h>
+//
+// static CFStringRef cfstr(const char *s) {
+//	return CFStringCreateWithCString(kCFAllocatorDefault, s, kCFStringEncodingUTF8);
+// }
+import "C"
+
+import "unsafe"
+
+// enumeratePorts describes the ports listPorts finds, from the
+// IOSerialBSDClient services in the IORegistry and the USB device each
+// hangs off, if any.
+func enumeratePorts() ([]PortInfo, error) {
+	names, err := listPorts()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]PortInfo, len(names))
+	index := make(map[string]*PortInfo, len(names))
+	for i, name := range names {
+		ports[i].Name = name
+		index[name] = &ports[i]
+	}
+
+	class := C.CString("IOSerialBSDClient")
+	defer C.free(unsafe.Pointer(class))
+	var iter C.io_iterator_t
+	// IOServiceGetMatchingServices takes the reference to the matching
+	// dictionary.  Port 0 is the default main port.
+	if C.IOServiceGetMatchingServices(0, C.IOServiceMatching(class), &iter) != C.KERN_SUCCESS {
+		return ports, nil
+	}
+	defer C.IOObjectRelease(iter)
+
+	for {
+		service := C.IOIteratorNext(iter)
+		if service == 0 {
+			break
+		}
+		if pi := index[registryString(service, "IOCalloutDevice", false)]; pi != nil {
+			if vid, ok := registryNumber(service, "idVendor"); ok {
+				pi.IsUSB = true
+				pi.VID = uint16(vid)
+				pid, _ := registryNumber(service, "idProduct")
+				pi.PID = uint16(pid)
+				pi.SerialNumber = registryString(service, "USB Serial Number", true)
+				pi.Manufacturer = registryString(service, "USB Vendor Name", true)
+				pi.Product = registryString(service, "USB Product Name", true)
+			}
+		}
+		C.IOObjectRelease(service)
+	}
+	return ports, nil
+}
+
+// registryProperty returns the named property of entry, or if parents
+// is set the first found on it or the entries above it in the service
+// plane; the caller must release it.
+func registryProperty(entry C.io_registry_entry_t, name string, parents bool) C.CFTypeRef {
+	cname := C.CString(name)
+	defer C.free(unsafe.Pointer(cname))
+	key := C.cfstr(cname)
+	defer C.CFRelease(C.CFTypeRef(key))
+	if !parents {
+		return C.IORegistryEntryCreateCFProperty(entry, key, C.kCFAllocatorDefault, 0)
+	}
+	plane := C.CString("IOService")
+	defer C.free(unsafe.Pointer(plane))
+	return C.IORegistryEntrySearchCFProperty(entry, plane, key, C.kCFAllocatorDefault,
+		C.kIORegistryIterateRecursively|C.kIORegistryIterateParents)
+}
+
+// registryString returns a string property, or "".
+func registryString(entry C.io_registry_entry_t, name string, parents bool) string {
+	ref := registryProperty(entry, name, parents)
+	if ref == 0 {
+		return ""
+	}
+	defer C.CFRelease(ref)
+	if C.CFGetTypeID(ref) != C.CFStringGetTypeID() {
+		return ""
+	}
+	s := C.CFStringRef(ref)
+	size := C.CFStringGetMaximumSizeForEncoding(C.CFStringGetLength(s), C.kCFStringEncodingUTF8) + 1
+	buf := make([]byte, size)
+	if C.CFStringGetCString(s, (*C.char)(unsafe.Pointer(&buf[0])), size, C.kCFStringEncodingUTF8) == 0 {
+		return ""
+	}
+	return C.GoString((*C.char)(unsafe.Pointer(&buf[0])))
+}
+
+// registryNumber returns a number property found on entry or above it.
+func registryNumber(entry C.io_registry_entry_t, name string) (int, bool) {
+	ref := registryProperty(entry, name, true)
+	if ref == 0 {
+		return 0, false
+	}
+	defer C.CFRelease(ref)
+	if C.CFGetTypeID(ref) != C.CFNumberGetTypeID() {
+		return 0, false
+	}
+	var v C.SInt32
+	if C.CFNumberGetValue(C.CFNumberRef(ref), C.kCFNumberSInt32Type, unsafe.Pointer(&v)) == 0 {
+		return 0, false
+	}
+	return int(v), true
+}
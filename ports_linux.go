@@ -0,0 +1,100 @@
+// +build linux
+
+package goserial
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// listPorts returns the device names of the serial ports currently on
+// the system.  Only ttys backed by a device are listed, which excludes
+// virtual consoles and ptys, and of those not the phantoms.
+func listPorts() ([]string, error) {
+	ttys, err := filepath.Glob("/sys/class/tty/*/device")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(ttys))
+	for _, t := range ttys {
+		sys := filepath.Dir(t)
+		name := "/dev/" + filepath.Base(sys)
+		if phantom(sys) {
+			continue
+		}
+		if _, err := os.Stat(name); err == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// phantom reports whether the serial core tty at sys has no UART: the
+// 8250 driver registers ttyS0 to ttyS3, or more, whether or not the
+// hardware is there, and reports the type of those it did not find as
+// PORT_UNKNOWN, which DriverInfo calls "unknown".
+func phantom(sys string) bool {
+	b, err := ioutil.ReadFile(sys + "/type")
+	return err == nil && strings.TrimSpace(string(b)) == "0"
+}
+
+// enumeratePorts describes the ports listPorts finds, reading the USB
+// device behind each from sysfs.
+func enumeratePorts() ([]PortInfo, error) {
+	names, err := listPorts()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]PortInfo, len(names))
+	for i, name := range names {
+		ports[i].Name = name
+		dev, err := filepath.EvalSymlinks("/sys/class/tty/" + filepath.Base(name) + "/device")
+		if err == nil {
+			usbInfo(&ports[i], dev)
+		}
+	}
+	return ports, nil
+}
+
+// usbInfo fills in the USB fields of pi from the first directory at or
+// above dev holding an idVendor attribute: the USB device, of which dev
+// is an interface or a port of the driver bound to one.
+func usbInfo(pi *PortInfo, dev string) {
+	for ; dev != "/" && dev != "."; dev = filepath.Dir(dev) {
+		vid, err := sysfsHex(dev + "/idVendor")
+		if err != nil {
+			continue
+		}
+		pi.IsUSB = true
+		pi.VID = vid
+		pi.PID, _ = sysfsHex(dev + "/idProduct")
+		pi.SerialNumber = sysfsString(dev + "/serial")
+		pi.Manufacturer = sysfsString(dev + "/manufacturer")
+		pi.Product = sysfsString(dev + "/product")
+		return
+	}
+}
+
+// sysfsString returns the contents of a sysfs attribute, or "" if it
+// cannot be read.
+func sysfsString(path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func sysfsHex(path string) (uint16, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(strings.TrimSpace(string(b)), 16, 16)
+	return uint16(v), err
+}
@@ -0,0 +1,16 @@
+// +build !linux,!windows,!darwin,!js !linux,!windows,!cgo,!js
+
+package goserial
+
+// enumeratePorts only has the names to go on.
+func enumeratePorts() ([]PortInfo, error) {
+	names, err := listPorts()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]PortInfo, len(names))
+	for i, name := range names {
+		ports[i].Name = name
+	}
+	return ports, nil
+}
@@ -0,0 +1,38 @@
+// +build !linux,!windows,!js
+
+package goserial
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Device name patterns for serial ports: macOS call-out devices, the
+// BSD USB and onboard ports (FreeBSD's cuau, OpenBSD's cua00, NetBSD's
+// dty00 and DragonFly's cuaa), then the Solaris and illumos call-out
+// devices.
+var portPatterns = []string{
+	"/dev/cu.*",
+	"/dev/cuaU*",
+	"/dev/cuau*",
+	"/dev/cua0*",
+	"/dev/cuaa*",
+	"/dev/dty*",
+	"/dev/ttyU*",
+	"/dev/cua/*",
+}
+
+// listPorts returns the device names of the serial ports currently on
+// the system.
+func listPorts() ([]string, error) {
+	var names []string
+	for _, pat := range portPatterns {
+		m, err := filepath.Glob(pat)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, m...)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,145 @@
+// +build windows
+
+package goserial
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// listPorts returns the names of the COM ports currently on the system,
+// as recorded by the serial drivers under HARDWARE\DEVICEMAP\SERIALCOMM.
+func listPorts() ([]string, error) {
+	if err := loadProcs(nRegEnumValue); err != nil {
+		return nil, err
+	}
+	var h syscall.Handle
+	err := syscall.RegOpenKeyEx(syscall.HKEY_LOCAL_MACHINE,
+		syscall.StringToUTF16Ptr(`HARDWARE\DEVICEMAP\SERIALCOMM`),
+		0, syscall.KEY_READ, &h)
+	if err == syscall.ERROR_FILE_NOT_FOUND {
+		// The key only exists while at least one port does.
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer syscall.RegCloseKey(h)
+
+	var count, maxName, maxData uint32
+	err = syscall.RegQueryInfoKey(h, nil, nil, nil, nil, nil, nil,
+		&count, &maxName, &maxData, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, count)
+	name := make([]uint16, maxName+1)
+	data := make([]uint16, maxData/2+1)
+	for i := uint32(0); i < count; i++ {
+		nameLen := uint32(len(name))
+		dataLen := uint32(len(data) * 2)
+		var typ uint32
+		r, _, _ := syscall.Syscall9(nRegEnumValue.Addr(), 8,
+			uintptr(h),
+			uintptr(i),
+			uintptr(unsafe.Pointer(&name[0])),
+			uintptr(unsafe.Pointer(&nameLen)),
+			0,
+			uintptr(unsafe.Pointer(&typ)),
+			uintptr(unsafe.Pointer(&data[0])),
+			uintptr(unsafe.Pointer(&dataLen)),
+			0)
+		if r != 0 {
+			return nil, syscall.Errno(r)
+		}
+		if typ == syscall.REG_SZ {
+			names = append(names, syscall.UTF16ToString(data[:dataLen/2]))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// enumeratePorts describes the ports listPorts finds, from the setup
+// information of the device behind each: the USB IDs and serial number
+// from the device instance IDs of it and its parents, and the
+// manufacturer and description its driver's INF gave it.
+func enumeratePorts() ([]PortInfo, error) {
+	names, err := listPorts()
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]PortInfo, len(names))
+	index := make(map[string]*PortInfo, len(names))
+	for i, name := range names {
+		ports[i].Name = name
+		index[strings.ToUpper(name)] = &ports[i]
+	}
+	if loadProcs(nCMGetParent, nCMGetDeviceID) != nil {
+		return ports, nil
+	}
+	portDevices(func(set uintptr, data *spDevinfoData, name string) bool {
+		pi := index[strings.ToUpper(name)]
+		if pi == nil {
+			return true
+		}
+		inst := data.devInst
+		for i := 0; i < 3; i++ {
+			if usbInstanceID(pi, deviceID(inst)) {
+				pi.Manufacturer = devProperty(set, data, spdrpMfg)
+				pi.Product = devProperty(set, data, spdrpDeviceDesc)
+				break
+			}
+			r, _, _ := syscall.Syscall(nCMGetParent.Addr(), 3, uintptr(unsafe.Pointer(&inst)), uintptr(inst), 0)
+			if r != 0 {
+				break
+			}
+		}
+		return true
+	})
+	return ports, nil
+}
+
+// deviceID returns the device instance ID of a devnode, or "".
+func deviceID(inst uint32) string {
+	buf := make([]uint16, 256)
+	r, _, _ := syscall.Syscall6(nCMGetDeviceID.Addr(), 4, uintptr(inst),
+		uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0, 0, 0)
+	if r != 0 { // not CR_SUCCESS
+		return ""
+	}
+	return syscall.UTF16ToString(buf)
+}
+
+// usbInstanceID fills in the USB fields of pi from a device instance ID
+// of the form USB\VID_0403&PID_6001\A6008isP, reporting whether it was
+// one.  The last part is the serial number unless Windows made it up,
+// in which case it contains an "&".
+func usbInstanceID(pi *PortInfo, id string) bool {
+	parts := strings.Split(id, `\`)
+	if len(parts) != 3 || !strings.EqualFold(parts[0], "USB") {
+		return false
+	}
+	var vid, pid uint16
+	for _, f := range strings.Split(strings.ToUpper(parts[1]), "&") {
+		v, _ := strconv.ParseUint(f[strings.Index(f, "_")+1:], 16, 16)
+		switch {
+		case strings.HasPrefix(f, "VID_"):
+			vid = uint16(v)
+		case strings.HasPrefix(f, "PID_"):
+			pid = uint16(v)
+		}
+	}
+	if vid == 0 {
+		return false
+	}
+	pi.IsUSB, pi.VID, pi.PID = true, vid, pid
+	if !strings.Contains(parts[2], "&") {
+		pi.SerialNumber = parts[2]
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package goserial
+
+import (
+	"context"
+	"fmt"
+)
+
+// Probe checks whether the port named by c can be configured as c asks
+// without keeping it open.  It opens the device, applies c, reads the
+// settings back, puts back the settings it found and closes the device
+// again.  Some drivers accept settings they cannot do and silently keep
+// others, so each field is checked against what the driver reports; the
+// first that did not stick is returned as a *ConfigError.  Flow control
+// is set and read back too, and RS485 handed to the driver as OpenPort
+// does; a port that can do neither returns a *ConfigError for it, as
+// OpenPort would fail.
+//
+// Probe does not touch DTR or RTS, whatever c.InitialDTR, InitialRTS and
+// KeepDTROnClose say, so attached boards are not reset.  On POSIX the
+// kernel still raises both lines while the device is open, and the
+// restored HUPCL setting decides whether they drop again on close, just
+// as after the previous close.
+func Probe(c *Config) error {
+	if err := c.checkOpen(); err != nil {
+		return err
+	}
+
+	cc := *c
+	cc.InitialDTR = LineUnchanged
+	cc.InitialRTS = LineUnchanged
+	cc.KeepDTROnClose = false
+
+	d, err := openDriver(context.Background(), &cc)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	err = probeSetup(d, c)
+	var got Config
+	if err == nil {
+		err = d.getConfig(&got)
+	}
+	if rerr := d.restore(); err == nil {
+		err = rerr
+	}
+	if err != nil {
+		return err
+	}
+
+	mismatch := func(field string, want, have interface{}) error {
+		return &ConfigError{Field: field, Value: want, Err: fmt.Errorf("driver reports %v", have)}
+	}
+	switch {
+	case got.Baud != c.Baud:
+		return mismatch("Baud", c.Baud, got.Baud)
+	case got.Size != c.Size:
+		return mismatch("Size", c.Size, got.Size)
+	case got.Parity != c.Parity:
+		return mismatch("Parity", c.Parity, got.Parity)
+	case got.StopBits != c.StopBits && !(c.StopBits == StopBits1Half && got.StopBits == StopBits2):
+		// Termios reports 1.5 stop bits as 2, see StopBits1Half.
+		return mismatch("StopBits", c.StopBits, got.StopBits)
+	}
+
+	// Only check the flow control characters where c chose them, as
+	// network ports cannot report them.
+	xon, xoff := c.xonChars()
+	switch {
+	case c.XONChar != 0 && got.XONChar != xon:
+		return mismatch("XONChar", xon, got.XONChar)
+	case c.XOFFChar != 0 && got.XOFFChar != xoff:
+		return mismatch("XOFFChar", xoff, got.XOFFChar)
+	case c.XANY && !got.XANY:
+		return mismatch("XANY", true, false)
+	}
+	if c.MarkErrors && !got.MarkErrors {
+		return mismatch("MarkErrors", true, false)
+	}
+	switch {
+	case c.RTSFlowControl && !got.RTSFlowControl:
+		return mismatch("RTSFlowControl", true, false)
+	case c.XONFlowControl && !got.XONFlowControl:
+		return mismatch("XONFlowControl", true, false)
+	}
+	return nil
+}
+
+// probeSetup applies the flow control and RS485 settings of c to d, as
+// wrapDriver does, without touching RTS.  Where the driver cannot do
+// RS485 itself, it is enough that the port could switch RTS around
+// each Write.
+func probeSetup(d driver, c *Config) error {
+	if f := c.flowControl(); f != FlowNone {
+		field := "RTSFlowControl"
+		if f == FlowXONXOFF {
+			field = "XONFlowControl"
+		}
+		fc, ok := d.(flowController)
+		if !ok {
+			return &ConfigError{Field: field, Value: true, Err: ErrUnsupported}
+		}
+		if err := fc.setFlowControl(f); err != nil {
+			if err == ErrUnsupported {
+				err = &ConfigError{Field: field, Value: true, Err: err}
+			}
+			return err
+		}
+	}
+	if c.RS485 != nil {
+		err := ErrUnsupported
+		if s, ok := d.(rs485Setter); ok {
+			err = s.setRS485(c.RS485)
+		}
+		if err != ErrUnsupported {
+			return err
+		}
+		if _, ok := d.(drainer); !ok {
+			return &ConfigError{Field: "RS485", Value: true, Err: ErrUnsupported}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+// +build linux freebsd darwin
+
+package goserial
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"time"
+)
+
+// OpenPty creates a pseudo-terminal pair and returns a Port on its
+// master side, together with the name of the slave, such as
+// /dev/pts/3, for another program to open as if it were a serial port.
+// It is for integration tests of programs that insist on a device path,
+// and for simulating devices.
+//
+// The slave is set up from c as OpenPort would set up a port, in raw
+// mode at c.Baud unless c says otherwise, and is held open until the
+// Port is closed, so that its settings stay and the master sees no
+// hangup while other programs open and close it.  c.Name is ignored and
+// c.Exclusive, which would lock them out, is refused; c may be nil,
+// for 115200 baud.  SetBaud, SetFraming and SetFlowControl change the
+// slave's settings; a pty has no modem lines, so SetDTR, SetRTS and
+// ModemStatus return ErrUnsupported.  Closing the Port hangs up the
+// slave.
+//
+// OpenPty is available on Linux, macOS and FreeBSD.  Elsewhere it
+// returns ErrUnsupported.
+func OpenPty(c *Config) (*Port, string, error) {
+	cc := Config{Baud: 115200}
+	if c != nil {
+		cc = *c
+	}
+	if cc.Exclusive {
+		return nil, "", &ConfigError{Field: "Exclusive", Value: true, Err: errors.New("would keep other programs off the slave")}
+	}
+	if err := cc.check(); err != nil {
+		return nil, "", err
+	}
+
+	f, err := os.OpenFile("/dev/ptmx", syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	master, err := newSerialPort(f)
+	if err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	var name string
+	if err := master.control(func(fd uintptr) (err error) {
+		name, err = unlockpt(fd)
+		return err
+	}); err != nil {
+		f.Close()
+		return nil, "", &os.PathError{Op: "unlockpt", Path: f.Name(), Err: err}
+	}
+
+	cc.Name = name
+	d, err := openPort(name, &cc)
+	if err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	pd := &ptyPort{master: master, slave: d.(*serialPort)}
+	if err := master.setReadTimeout(time.Duration(cc.ReadTimeout) * time.Millisecond); err != nil {
+		pd.Close()
+		return nil, "", err
+	}
+	p, err := wrapDriver(pd, &cc)
+	if err != nil {
+		return nil, "", err
+	}
+	return p, name, nil
+}
+
+// ptyPort is the driver of a Port from OpenPty.  Data and timeouts go
+// through the master; the line settings are the slave's.
+type ptyPort struct {
+	master *serialPort
+	slave  *serialPort
+}
+
+func (p *ptyPort) Read(b []byte) (int, error)  { return p.master.Read(b) }
+func (p *ptyPort) Write(b []byte) (int, error) { return p.master.Write(b) }
+
+func (p *ptyPort) Close() error {
+	err := p.master.Close()
+	if serr := p.slave.Close(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+func (p *ptyPort) setBaud(baud int) error                  { return p.slave.setBaud(baud) }
+func (p *ptyPort) setReadTimeout(d time.Duration) error    { return p.master.setReadTimeout(d) }
+func (p *ptyPort) setReadDeadline(t time.Time) error       { return p.master.setReadDeadline(t) }
+func (p *ptyPort) setWriteDeadline(t time.Time) error      { return p.master.setWriteDeadline(t) }
+func (p *ptyPort) setWriteTimeout(d time.Duration) error   { return p.master.setWriteTimeout(d) }
+func (p *ptyPort) setFlowControl(f FlowControl) error      { return p.slave.setFlowControl(f) }
+func (p *ptyPort) flush(in, out bool) error                { return p.master.flush(in, out) }
+func (p *ptyPort) queued() (in, out int, err error)        { return p.master.queued() }
+func (p *ptyPort) getConfig(c *Config) error               { return p.slave.getConfig(c) }
+func (p *ptyPort) restore() error                          { return p.slave.restore() }
+func (p *ptyPort) setDTR(on bool) error                    { return ErrUnsupported }
+func (p *ptyPort) setRTS(on bool) error                    { return ErrUnsupported }
+func (p *ptyPort) outputLines() (dtr, rts bool, err error) { return false, false, ErrUnsupported }
+
+func (p *ptyPort) syscallConn() (syscall.RawConn, error) {
+	return p.master.syscallConn()
+}
+
+func (p *ptyPort) setFraming(size ByteSize, parity ParityMode, stop StopBits) error {
+	return p.slave.setFraming(size, parity, stop)
+}
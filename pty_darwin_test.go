@@ -0,0 +1,57 @@
+package goserial
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openPty opens a new pseudo-terminal master and returns it together with
+// the name of its slave device.
+func openPty(t testing.TB) (*os.File, string) {
+	m, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("no pty support:", err)
+	}
+	var name [128]byte
+	for _, c := range []struct{ req, arg uintptr }{
+		{syscall.TIOCPTYGRANT, 0},
+		{syscall.TIOCPTYUNLK, 0},
+		{syscall.TIOCPTYGNAME, uintptr(unsafe.Pointer(&name[0]))},
+	} {
+		if err := ioctl(m.Fd(), c.req, c.arg); err != nil {
+			m.Close()
+			t.Fatal(err)
+		}
+	}
+	if i := bytes.IndexByte(name[:], 0); i >= 0 {
+		return m, string(name[:i])
+	}
+	return m, string(name[:])
+}
+
+func TestCustomBaudOnOpen(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+	p, err := OpenPort(&Config{Name: name, Baud: 250000})
+	if errors.Is(err, syscall.ENOTTY) || errors.Is(err, syscall.EINVAL) {
+		t.Skip("the pty does not take IOSSIOSPEED:", err)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	var st syscall.Termios
+	if err := p.d.(*serialPort).tcgetattr(&st); err != nil {
+		t.Fatal(err)
+	}
+	if st.Ispeed != 250000 || st.Ospeed != 250000 {
+		t.Errorf("speed after opening at 250000 = %d/%d", st.Ispeed, st.Ospeed)
+	}
+	if c, err := p.Config(); err != nil || c.Baud != 250000 {
+		t.Errorf("Config().Baud = %d, %v; want 250000", c.Baud, err)
+	}
+}
@@ -0,0 +1,32 @@
+package goserial
+
+import (
+	"bytes"
+	"os"
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+// openPty opens a new pseudo-terminal master and returns it together with
+// the name of its slave device, which FreeBSD creates unlocked.
+func openPty(t testing.TB) (*os.File, string) {
+	m, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("no pty support:", err)
+	}
+	var name [64]byte
+	arg := struct {
+		len int32
+		buf unsafe.Pointer
+	}{int32(len(name)), unsafe.Pointer(&name[0])}
+	req := 0x80000000 | unsafe.Sizeof(arg)<<16 | 'f'<<8 | 120 // FIODGNAME
+	if err := ioctl(m.Fd(), req, uintptr(unsafe.Pointer(&arg))); err != nil {
+		m.Close()
+		t.Fatal(err)
+	}
+	if i := bytes.IndexByte(name[:], 0); i >= 0 {
+		return m, "/dev/" + string(name[:i])
+	}
+	return m, "/dev/" + string(name[:])
+}
@@ -0,0 +1,9 @@
+// +build !linux,!freebsd,!darwin
+
+package goserial
+
+// OpenPty returns ErrUnsupported: it is only implemented on Linux,
+// macOS and FreeBSD.
+func OpenPty(c *Config) (*Port, string, error) {
+	return nil, "", ErrUnsupported
+}
@@ -0,0 +1,646 @@
+// +build linux darwin freebsd
+
+package goserial
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// openPtyPort opens the slave of a new pty through OpenPort.
+func openPtyPort(t *testing.T, c Config) (*os.File, *Port) {
+	m, name := openPty(t)
+	c.Name = name
+	if c.Baud == 0 {
+		c.Baud = 115200
+	}
+	s, err := OpenPort(&c)
+	if err != nil {
+		m.Close()
+		t.Fatal(err)
+	}
+	return m, s
+}
+
+// readFull reads len(buf) bytes from p, failing the test on any error.
+func readFull(t *testing.T, r io.Reader, buf []byte) {
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRawTransparency(t *testing.T) {
+	m, p := openPtyPort(t, Config{ReadTimeout: 1000})
+	defer m.Close()
+	defer p.Close()
+
+	all := make([]byte, 256)
+	for i := range all {
+		all[i] = byte(i)
+	}
+
+	if _, err := m.Write(all); err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, len(all))
+	readFull(t, p, got)
+	if !bytes.Equal(got, all) {
+		t.Errorf("device to port:\ngot  %x\nwant %x", got, all)
+	}
+
+	if _, err := p.Write(all); err != nil {
+		t.Fatal(err)
+	}
+	readFull(t, m, got)
+	if !bytes.Equal(got, all) {
+		t.Errorf("port to device:\ngot  %x\nwant %x", got, all)
+	}
+}
+
+func TestReadTimeoutDuration(t *testing.T) {
+	m, p := openPtyPort(t, Config{})
+	defer m.Close()
+	defer p.Close()
+
+	// Reads time out on a deadline, not VTIME's tenths of a second,
+	// so the only slack needed is for scheduling.
+	for _, d := range []time.Duration{20 * time.Millisecond, 100 * time.Millisecond, 250 * time.Millisecond} {
+		p.SetReadTimeout(d)
+		start := time.Now()
+		n, err := p.Read(make([]byte, 1))
+		elapsed := time.Since(start)
+		if n != 0 || err != ErrTimeout {
+			t.Fatalf("timeout %v: Read = %d, %v; want ErrTimeout", d, n, err)
+		}
+		if elapsed < d || elapsed > d+50*time.Millisecond {
+			t.Errorf("timeout %v: Read returned after %v", d, elapsed)
+		}
+	}
+
+	// Data that arrives in time is returned at once.
+	p.SetReadTimeout(2 * time.Second)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.Write([]byte("x"))
+	}()
+	start := time.Now()
+	if _, err := p.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Read waited %v for data sent after 50ms", elapsed)
+	}
+}
+
+func TestPosixTimeouts(t *testing.T) {
+	m, p := openPtyPort(t, Config{PosixTimeouts: &PosixTimeouts{VMIN: 4, VTIME: 1}})
+	defer m.Close()
+	defer p.Close()
+
+	// A short frame is returned once the line has been idle for VTIME.
+	m.Write([]byte("ab"))
+	buf := make([]byte, 8)
+	start := time.Now()
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "ab" {
+		t.Fatalf("Read = %q, %v; want \"ab\"", buf[:n], err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("short frame took %v", elapsed)
+	}
+
+	// A whole frame is returned as soon as VMIN bytes are there.
+	m.Write([]byte("wxyz"))
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "wxyz" {
+		t.Fatalf("Read = %q, %v; want \"wxyz\"", buf[:n], err)
+	}
+
+	// With VMIN and VTIME 0 a Read polls.
+	m2, p2 := openPtyPort(t, Config{PosixTimeouts: &PosixTimeouts{}})
+	defer m2.Close()
+	defer p2.Close()
+	if n, err := p2.Read(buf); n != 0 || err != ErrTimeout {
+		t.Errorf("Read on idle port = %d, %v; want 0, ErrTimeout", n, err)
+	}
+}
+
+func TestNoReadTimeoutBlocks(t *testing.T) {
+	m, p := openPtyPort(t, Config{})
+	defer m.Close()
+	defer p.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Read(make([]byte, 1))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		t.Fatalf("Read without a timeout returned early: %v", err)
+	case <-time.After(300 * time.Millisecond):
+	}
+	m.Write([]byte("x"))
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Read did not return once data arrived")
+	}
+}
+
+func TestCloseUnblocksRead(t *testing.T) {
+	m, p := openPtyPort(t, Config{})
+	defer m.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	p.Close()
+	select {
+	case err := <-done:
+		if err != ErrPortClosed {
+			t.Errorf("Read on a closed port = %v, want ErrPortClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not unblock Read")
+	}
+}
+
+func TestCloseUnblocksWrite(t *testing.T) {
+	m, p := openPtyPort(t, Config{})
+	defer m.Close()
+
+	// Nothing reads the master, so the write fills the pty and waits.
+	done := make(chan error, 1)
+	go func() {
+		_, err := p.Write(make([]byte, 1<<20))
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	p.Close()
+	select {
+	case err := <-done:
+		if err != ErrPortClosed {
+			t.Errorf("Write on a closed port = %v, want ErrPortClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not unblock Write")
+	}
+}
+
+func TestPtyWaitReadable(t *testing.T) {
+	m, p := openPtyPort(t, Config{ReadTimeout: 10})
+	defer m.Close()
+	defer p.Close()
+
+	// A Read that timed out leaves its deadline behind; the wait must
+	// not trip over it.
+	if _, err := p.Read(make([]byte, 1)); err != ErrTimeout {
+		t.Fatalf("Read with nothing sent = %v, want ErrTimeout", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := p.WaitReadable(ctx); err != context.DeadlineExceeded {
+		t.Errorf("WaitReadable with nothing sent = %v, want DeadlineExceeded", err)
+	}
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		m.Write([]byte("x"))
+	}()
+	if err := p.WaitReadable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if n, err := p.Read(buf); n != 1 || err != nil {
+		t.Errorf("Read after WaitReadable = %d, %v", n, err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- p.WaitReadable(context.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	p.Close()
+	select {
+	case err := <-done:
+		if err != ErrPortClosed {
+			t.Errorf("WaitReadable across Close = %v, want ErrPortClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close did not end WaitReadable")
+	}
+}
+
+func TestFlushInput(t *testing.T) {
+	m, p := openPtyPort(t, Config{ReadTimeout: 200})
+	defer m.Close()
+	defer p.Close()
+
+	m.Write([]byte("stale"))
+	time.Sleep(50 * time.Millisecond)
+	if err := p.d.flush(true, false); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := p.Read(make([]byte, 8)); err != ErrTimeout {
+		t.Fatalf("Read after flush = %d, %v; want ErrTimeout", n, err)
+	}
+
+	m.Write([]byte("fresh"))
+	buf := make([]byte, 5)
+	readFull(t, p, buf)
+	if string(buf) != "fresh" {
+		t.Errorf("Read after flush = %q, want \"fresh\"", buf)
+	}
+}
+
+func TestPurgeOnOpen(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	// Hold the slave open so that the stale bytes stay queued on it.
+	f, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	m.Write([]byte("stale"))
+	time.Sleep(50 * time.Millisecond)
+
+	s, err := OpenPort(&Config{Name: name, Baud: 9600, ReadTimeout: 200, PurgeOnOpen: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if n, err := s.Read(make([]byte, 8)); err != ErrTimeout {
+		t.Fatalf("Read after PurgeOnOpen = %d, %v; want ErrTimeout", n, err)
+	}
+}
+
+func TestFlushOutput(t *testing.T) {
+	m, p := openPtyPort(t, Config{})
+	defer m.Close()
+	defer p.Close()
+
+	// Output reaches a pty master at once, so there is nothing to
+	// discard; flushing output must still succeed and leave the port
+	// usable.
+	if err := p.d.flush(false, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Write([]byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	readFull(t, m, buf)
+	if string(buf) != "ok" {
+		t.Errorf("read %q after output flush, want \"ok\"", buf)
+	}
+}
+
+// ptyPair opens the slave of a new pty, returning it with the master.
+func ptyPair(tb testing.TB) (*Port, io.ReadWriter) {
+	m, name := openPty(tb)
+	s, err := OpenPort(&Config{Name: name, Baud: 115200})
+	if err != nil {
+		m.Close()
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { s.Close(); m.Close() })
+	return s, m
+}
+
+// BenchmarkPty measures transfers through a pty, for the polled read
+// and write paths.
+func BenchmarkPty(b *testing.B) {
+	benchBackend(b, ptyPair)
+}
+
+func TestPtyAllocs(t *testing.T) {
+	p, peer := ptyPair(t)
+	testHotPathAllocs(t, p, peer)
+
+	// A read timeout sets a deadline on every Read.
+	p.SetReadTimeout(time.Second)
+	testHotPathAllocs(t, p, peer)
+}
+
+func TestPtyCloseMode(t *testing.T) {
+	for _, mode := range []CloseMode{CloseDrain, CloseDiscard} {
+		m, s := openPtyPort(t, Config{CloseMode: mode, DrainTimeout: time.Second})
+		if _, err := s.Write([]byte("bye")); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Close(); err != nil {
+			t.Errorf("mode %d: Close = %v", mode, err)
+		}
+		if mode == CloseDrain {
+			readFull(t, m, make([]byte, 3))
+		}
+		m.Close()
+	}
+}
+
+func TestWriteTimeout(t *testing.T) {
+	// Nobody reads the master, so the pty's buffers fill and the
+	// write blocks.
+	m, s := openPtyPort(t, Config{WriteTimeout: 50 * time.Millisecond})
+	defer m.Close()
+	defer s.Close()
+	big := make([]byte, 1<<20)
+	start := time.Now()
+	n, err := s.Write(big)
+	if err != ErrTimeout || n == 0 || n == len(big) {
+		t.Fatalf("Write into a full pty = %d, %v; want a short count and ErrTimeout", n, err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Write with a 50ms timeout took %v", d)
+	}
+
+	// With flow control on, the error says what the line looked like.
+	if err := s.SetFlowControl(FlowRTSCTS); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Write(big)
+	var we *WriteTimeoutError
+	if !errors.As(err, &we) || !errors.Is(err, ErrTimeout) {
+		t.Fatalf("Write with flow control = %v; want a WriteTimeoutError", err)
+	}
+	if we.Flow != FlowRTSCTS || we.Timeout != 50*time.Millisecond {
+		t.Errorf("WriteTimeoutError = %+v", we)
+	}
+}
+
+func TestPtyNetConn(t *testing.T) {
+	m, s := openPtyPort(t, Config{ReadTimeout: 1000})
+	defer m.Close()
+	c := s.NetConn()
+	if dl, ok := s.d.(deadliner); !ok || dl.setReadDeadline(time.Time{}) != nil {
+		t.Error("pty deadlines not kept by the driver")
+	}
+	testConnDeadlines(t, c, m)
+	c.Close()
+}
+
+func TestPtySendBreak(t *testing.T) {
+	m, s := openPtyPort(t, Config{})
+	defer m.Close()
+	defer s.Close()
+	start := time.Now()
+	if err := s.SendBreak(30 * time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d < 30*time.Millisecond {
+		t.Errorf("SendBreak(30ms) returned after %v", d)
+	}
+	if err := s.SendBreak(-time.Second); err == nil {
+		t.Error("SendBreak accepted a negative duration")
+	}
+}
+
+func TestPtySuspend(t *testing.T) {
+	m, s := openPtyPort(t, Config{WriteTimeout: 50 * time.Millisecond})
+	defer m.Close()
+	if err := s.SuspendOutput(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SuspendOutput(); err != nil || !s.OutputSuspended() {
+		t.Fatalf("second SuspendOutput = %v, suspended %v", err, s.OutputSuspended())
+	}
+	if n, err := s.Write([]byte("held")); n != 0 || err != ErrTimeout {
+		t.Fatalf("Write while suspended = %d, %v; want 0, ErrTimeout", n, err)
+	}
+	if err := s.ResumeOutput(); err != nil || s.OutputSuspended() {
+		t.Fatalf("ResumeOutput = %v, suspended %v", err, s.OutputSuspended())
+	}
+	if _, err := s.Write([]byte("sent")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	readFull(t, m, buf)
+	if string(buf) != "sent" {
+		t.Errorf("read %q after ResumeOutput; want sent", buf)
+	}
+
+	// Suspending input sends XOFF, and Close sends the XON.
+	if err := s.SuspendInput(); err != nil || !s.InputSuspended() {
+		t.Fatalf("SuspendInput = %v, suspended %v", err, s.InputSuspended())
+	}
+	readFull(t, m, buf[:1])
+	if buf[0] != xoffDefault {
+		t.Errorf("SuspendInput sent %#x; want XOFF", buf[0])
+	}
+	s.SuspendOutput()
+	s.Close()
+	readFull(t, m, buf[:1])
+	if buf[0] != xonDefault {
+		t.Errorf("Close of a suspended port sent %#x; want XON", buf[0])
+	}
+}
+
+func TestPtySettings(t *testing.T) {
+	m, s := openPtyPort(t, Config{Baud: 9600})
+	defer m.Close()
+	defer s.Close()
+	before, err := s.Settings()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"baud": "9600", "flow_control": "none"} {
+		if v, _ := before.Get(name); v != want {
+			t.Errorf("%s = %q; want %q", name, v, want)
+		}
+	}
+	if v, _ := before.Get("termios.iflag"); !strings.Contains(v, "-ixon") {
+		t.Errorf("termios.iflag = %q; want -ixon", v)
+	}
+	s.SetFlowControl(FlowXONXOFF)
+	after, _ := s.Settings()
+	d := DiffSettings(before, after)
+	if !strings.Contains(d, "flow_control: none -> XON/XOFF\n") || !strings.Contains(d, "termios.iflag: ") {
+		t.Errorf("DiffSettings after SetFlowControl =\n%s", d)
+	}
+}
+
+func TestPortConfig(t *testing.T) {
+	// No framing: Linux ptys force it to 8N1, which Config would
+	// rightly report.
+	m, p := openPtyPort(t, Config{Baud: 57600, XONFlowControl: true, CRLFTranslate: true,
+		ReadTimeout: 250, ReadBufferSize: 64})
+	defer m.Close()
+	defer p.Close()
+	p.SetReadTimeout(1500 * time.Microsecond)
+
+	c, err := p.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{Name: p.name, Baud: 57600, XONFlowControl: true, CRLFTranslate: true,
+		ReadTimeout: 2, ReadBufferSize: 64}
+	c.XONChar, c.XOFFChar = 0, 0
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Config = %+v\nwant %+v", c, want)
+	}
+}
+
+func TestExclusive(t *testing.T) {
+	m, p := openPtyPort(t, Config{Exclusive: true})
+	defer m.Close()
+	c := &Config{Name: p.name, Baud: 115200, Exclusive: true}
+	if q, err := OpenPort(c); err != ErrPortBusy {
+		if err == nil {
+			q.Close()
+		}
+		t.Errorf("second Exclusive OpenPort = %v, want ErrPortBusy", err)
+	}
+	p.Close()
+	q, err := OpenPort(c)
+	if err != nil {
+		t.Fatalf("OpenPort after Close: %v", err)
+	}
+	q.Close()
+}
+
+func TestMarkErrors(t *testing.T) {
+	m, p := openPtyPort(t, Config{MarkErrors: true, ReadTimeout: 1000})
+	defer m.Close()
+	defer p.Close()
+
+	var got Config
+	if err := p.d.getConfig(&got); err != nil || !got.MarkErrors {
+		t.Fatalf("getConfig = %v, MarkErrors %v", err, got.MarkErrors)
+	}
+	// A pty cannot produce parity errors, but it does double 0xff.
+	m.Write([]byte{'a', 0xff})
+	buf := make([]byte, 3)
+	readFull(t, p, buf)
+	if !bytes.Equal(buf, []byte{'a', 0xff, 0xff}) {
+		t.Errorf("read %x, want 61ffff", buf)
+	}
+}
+
+func TestInterCharacterTimeoutPty(t *testing.T) {
+	m, p := openPtyPort(t, Config{ReadTimeout: 1000, InterCharacterTimeout: 50 * time.Millisecond})
+	defer m.Close()
+	defer p.Close()
+
+	go func() {
+		m.Write([]byte("ab"))
+		time.Sleep(10 * time.Millisecond)
+		m.Write([]byte("cd"))
+	}()
+	buf := make([]byte, 16)
+	if n, err := p.Read(buf); err != nil || string(buf[:n]) != "abcd" {
+		t.Errorf("Read = %q, %v; want \"abcd\"", buf[:n], err)
+	}
+}
+
+func TestOpenPty(t *testing.T) {
+	p, name, err := OpenPty(&Config{Baud: 9600, ReadTimeout: 1000})
+	if err != nil {
+		t.Skip("no pty support:", err)
+	}
+	defer p.Close()
+
+	// Another program opens the slave, goes away, and comes back.
+	for i := 0; i < 2; i++ {
+		s, err := OpenPort(&Config{Name: name, Baud: 9600, ReadTimeout: 1000})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Write([]byte("ping\n"))
+		buf := make([]byte, 5)
+		readFull(t, p, buf)
+		if string(buf) != "ping\n" {
+			t.Errorf("master read %q", buf)
+		}
+		p.Write([]byte{0xff, '\r'})
+		buf = buf[:2]
+		readFull(t, s, buf)
+		if buf[0] != 0xff || buf[1] != '\r' {
+			t.Errorf("slave read %q, want raw bytes", buf)
+		}
+		s.Close()
+	}
+
+	if err := p.SetDTR(true); err != ErrUnsupported {
+		t.Errorf("SetDTR = %v, want ErrUnsupported", err)
+	}
+	if err := p.SetBaud(19200); err != nil {
+		t.Errorf("SetBaud: %v", err)
+	}
+	p.SetReadTimeout(20 * time.Millisecond)
+	if _, err := p.Read(make([]byte, 1)); err != ErrTimeout {
+		t.Errorf("idle Read = %v, want ErrTimeout", err)
+	}
+	if _, _, err := OpenPty(&Config{Exclusive: true}); err == nil {
+		t.Error("OpenPty accepted Exclusive")
+	}
+}
+
+func TestSyscallConn(t *testing.T) {
+	m, p := openPtyPort(t, Config{})
+	defer m.Close()
+	defer p.Close()
+	var _ syscall.Conn = p
+
+	rc, err := p.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flags uintptr
+	var errno syscall.Errno
+	if err := rc.Control(func(fd uintptr) {
+		flags, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFL, 0)
+	}); err != nil || errno != 0 {
+		t.Fatal(err, errno)
+	}
+	if flags&syscall.O_NONBLOCK == 0 {
+		t.Errorf("descriptor flags %#x, want O_NONBLOCK", flags)
+	}
+
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	if _, err := a.SyscallConn(); err != ErrUnsupported {
+		t.Errorf("Pipe SyscallConn = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestFromFd(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+	fd, err := syscall.Open(name, syscall.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := FromFd(uintptr(fd), &Config{Baud: 19200, ReadTimeout: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if c, err := p.Config(); err != nil || c.Baud != 19200 || c.Name != fmt.Sprintf("fd %d", fd) {
+		t.Errorf("Config = %+v, %v", c, err)
+	}
+	if _, err := p.Read(make([]byte, 1)); err != ErrTimeout {
+		t.Errorf("idle Read = %v, want ErrTimeout", err)
+	}
+	m.Write([]byte{0xff, '\r'})
+	buf := make([]byte, 2)
+	readFull(t, p, buf)
+	if buf[0] != 0xff || buf[1] != '\r' {
+		t.Errorf("read %q, want the raw bytes", buf)
+	}
+}
@@ -0,0 +1,22 @@
+// +build !windows,!linux,!freebsd,!openbsd,!netbsd,!darwin,!solaris,cgo
+
+package goserial
+
+// #include <sys/ioctl.h>
+import "C"
+
+import "unsafe"
+
+// Solaris has no TIOCOUTQ, so this is kept out of serial_posix.go.
+
+func (p *serialPort) queued() (in, out int, err error) {
+	var n C.int
+	if err := p.ioctl(C.FIONREAD, uintptr(unsafe.Pointer(&n))); err != nil {
+		return 0, 0, err
+	}
+	in = int(n)
+	if err := p.ioctl(C.TIOCOUTQ, uintptr(unsafe.Pointer(&n))); err != nil {
+		return 0, 0, err
+	}
+	return in, int(n), nil
+}
@@ -0,0 +1,28 @@
+package goserial
+
+import "syscall"
+
+// syscallConner is implemented by drivers with a descriptor or handle
+// of their own.
+type syscallConner interface {
+	syscallConn() (syscall.RawConn, error)
+}
+
+// SyscallConn returns a raw connection to the port's file descriptor,
+// or on Windows its handle, for the ioctls and calls the package has no
+// method for, such as a vendor bitbang mode.  It makes a Port a
+// syscall.Conn.
+//
+// The Port keeps the descriptor: use it only inside the functions
+// passed to the RawConn's methods, and do not close it.  On POSIX it
+// must also stay non-blocking, for the runtime poller.  The Port does
+// not know about changes made through it, and calls such as SetBaud
+// may undo them.  A port from OpenPty gives its master side.  Network
+// ports and Pipe return ErrUnsupported.
+func (p *Port) SyscallConn() (syscall.RawConn, error) {
+	s, ok := p.d.(syscallConner)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	return s.syscallConn()
+}
@@ -0,0 +1,54 @@
+package goserial
+
+// framingSetter is implemented by drivers that can change the character
+// format of an open port.
+type framingSetter interface {
+	setFraming(size ByteSize, parity ParityMode, stop StopBits) error
+}
+
+// SetFraming changes the byte size, parity and stop bits of the open
+// port.  As with SetBaud, the port is not reopened: the modem lines keep
+// their states and data already received stays to be read.  Ports that
+// cannot do it return ErrUnsupported.
+func (p *Port) SetFraming(size ByteSize, parity ParityMode, stop StopBits) error {
+	c := Config{Size: size, Parity: parity, StopBits: stop}
+	if err := c.check(); err != nil {
+		return err
+	}
+	f, ok := p.d.(framingSetter)
+	if !ok {
+		return ErrUnsupported
+	}
+	p.flushWrites()
+	err := f.setFraming(size, parity, stop)
+	p.traceControl("framing", err, size, parity, stop)
+	return err
+}
+
+// Reconfigure applies the baud rate, byte size, parity, stop bits and
+// flow control of c to the open port, for devices that are talked to
+// at one speed and then switched to another, such as auto-baud boot
+// loaders.  The other fields of c only matter to OpenPort and are
+// ignored, though c must still pass its checks.
+//
+// The settings are changed one after the other, as SetBaud, SetFraming
+// and SetFlowControl would, and Reconfigure stops at the first that
+// fails, leaving the earlier ones in place.  Output written before the
+// call goes out under the old settings only if it has left the driver;
+// call Drain first to be sure of it.
+func (p *Port) Reconfigure(c *Config) error {
+	if err := c.check(); err != nil {
+		return err
+	}
+	if err := p.SetBaud(c.Baud); err != nil {
+		return err
+	}
+	if err := p.SetFraming(c.Size, c.Parity, c.StopBits); err != nil {
+		return err
+	}
+	f := c.flowControl()
+	if err := p.SetFlowControl(f); err != nil && !(err == ErrUnsupported && f == FlowNone) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,333 @@
+package goserial
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PortState is the state of a ReconnectingPort.
+type PortState byte
+
+const (
+	PortConnected    PortState = iota // the device is open
+	PortDisconnected                  // it went away, and is being reopened
+	PortClosed                        // Close was called, or reopening gave up
+)
+
+func (s PortState) String() string {
+	switch s {
+	case PortConnected:
+		return "connected"
+	case PortDisconnected:
+		return "disconnected"
+	case PortClosed:
+		return "closed"
+	}
+	return fmt.Sprintf("PortState(%d)", byte(s))
+}
+
+// ReconnectPolicy says how a ReconnectingPort reopens its device.
+type ReconnectPolicy struct {
+	// Delay is how long to wait before each attempt to reopen the
+	// device; zero means a second.  If MaxDelay is longer, the wait
+	// doubles after each failed attempt until it reaches MaxDelay.
+	Delay    time.Duration
+	MaxDelay time.Duration
+
+	// MaxAttempts, if not zero, is how many attempts are made after
+	// each loss before giving up.  The port is then closed, and Read
+	// and Write return the error of the last attempt.
+	MaxAttempts int
+
+	// IdleTimeout, if not zero, counts the device as gone once nothing
+	// has been received from it for that long, as with
+	// Port.SetIdleTimeout, and reopens it, reporting ErrIdle.  It is
+	// for devices that send all the time, telemetry and the like.
+	IdleTimeout time.Duration
+
+	// OnStateChange, if not nil, is called with each new state and the
+	// error that caused it, on the goroutine that noticed: a Read or
+	// Write for a loss, the reopening goroutine otherwise.  It should
+	// not block.
+	OnStateChange func(s PortState, err error)
+}
+
+// A ReconnectingPort is a port that reopens its device when it goes
+// away, as a USB adapter does when it is unplugged, and carries on.
+// Read and Write wait while it is being reopened, for no longer than
+// Config.ReadTimeout and Config.WriteTimeout respectively if those are
+// set, and a Write cut short by the loss sends the rest of its data
+// once the device is back.  Data the device sent, or was still to send,
+// when it went away is lost, and the settings come from the Config
+// again each time: anything changed on the Port since is lost too.
+//
+// Any error from Read or Write other than a timeout counts as the
+// device having gone away, which is how unplugging shows on POSIX:
+// as io.EOF or EIO rather than ErrPortDisconnected.
+type ReconnectingPort struct {
+	c      Config
+	policy ReconnectPolicy
+	open   func(c *Config) (*Port, error) // OpenPort, but for tests
+
+	mu     sync.Mutex
+	port   *Port // nil while disconnected
+	gen    int   // counts the opens, so that a loss is handled once
+	closed bool
+	failed error         // why reopening gave up
+	past   PortStats     // the counters of the ports opened before this one
+	up     chan struct{} // closed once the port is open again, or closed
+	done   chan struct{} // closed by Close
+}
+
+// NewReconnectingPort opens the port c names, as OpenPort does, and
+// keeps it open according to policy.  Only a Config that fails its
+// checks is an error: if the device cannot be opened straight away it
+// is reopened as though it had gone away.
+func NewReconnectingPort(c *Config, policy ReconnectPolicy) (*ReconnectingPort, error) {
+	return newReconnectingPort(c, policy, OpenPort)
+}
+
+func newReconnectingPort(c *Config, policy ReconnectPolicy, open func(*Config) (*Port, error)) (*ReconnectingPort, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+	if policy.Delay <= 0 {
+		policy.Delay = time.Second
+	}
+	r := &ReconnectingPort{
+		c:      *c,
+		policy: policy,
+		open:   open,
+		up:     make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	p, err := open(&r.c)
+	if err != nil {
+		r.notify(PortDisconnected, err)
+		go r.reconnect()
+		return r, nil
+	}
+	r.port = p
+	close(r.up)
+	r.watchIdle(p, 0)
+	r.notify(PortConnected, nil)
+	return r, nil
+}
+
+func (r *ReconnectingPort) notify(s PortState, err error) {
+	if r.policy.OnStateChange != nil {
+		r.policy.OnStateChange(s, err)
+	}
+}
+
+// State returns the port's state.
+func (r *ReconnectingPort) State() PortState {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	switch {
+	case r.closed || r.failed != nil:
+		return PortClosed
+	case r.port == nil:
+		return PortDisconnected
+	}
+	return PortConnected
+}
+
+// Port returns the port as it is open now, or nil while it is not; see
+// ReconnectingPort for what happens to changes made on it.
+func (r *ReconnectingPort) Port() *Port {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.port
+}
+
+// Stats returns the transfer counters summed over every port opened so
+// far, the one open now included, and in Reopens how many times the
+// device has been opened again.
+func (r *ReconnectingPort) Stats() PortStats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	s := r.past
+	if r.port != nil {
+		s.add(r.port.Stats())
+	}
+	s.Reopens = uint64(r.gen)
+	return s
+}
+
+// current returns the open port, waiting for it for up to timeout, or
+// forever if timeout is zero.
+func (r *ReconnectingPort) current(timeout time.Duration) (*Port, int, error) {
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	for {
+		r.mu.Lock()
+		p, gen, up := r.port, r.gen, r.up
+		switch {
+		case r.closed:
+			r.mu.Unlock()
+			return nil, 0, ErrPortClosed
+		case r.failed != nil:
+			err := r.failed
+			r.mu.Unlock()
+			return nil, 0, err
+		}
+		r.mu.Unlock()
+		if p != nil {
+			return p, gen, nil
+		}
+		select {
+		case <-up:
+		case <-expired:
+			return nil, 0, ErrTimeout
+		}
+	}
+}
+
+// watchIdle has the port opened as gen count as lost once it has been
+// silent for the policy's IdleTimeout.
+func (r *ReconnectingPort) watchIdle(p *Port, gen int) {
+	if r.policy.IdleTimeout > 0 {
+		p.SetIdleTimeout(r.policy.IdleTimeout, func() { r.lost(gen, ErrIdle) })
+	}
+}
+
+// lost closes the port opened as gen and starts reopening it, unless
+// that already happened.
+func (r *ReconnectingPort) lost(gen int, err error) {
+	r.mu.Lock()
+	if r.closed || r.port == nil || r.gen != gen {
+		r.mu.Unlock()
+		return
+	}
+	p := r.port
+	r.port = nil
+	r.up = make(chan struct{})
+	r.past.add(p.Stats())
+	r.mu.Unlock()
+	p.CloseWithMode(CloseDiscard)
+	r.notify(PortDisconnected, err)
+	go r.reconnect()
+}
+
+// reconnect reopens the port until it opens, the policy gives up or
+// Close is called.
+func (r *ReconnectingPort) reconnect() {
+	delay := r.policy.Delay
+	for attempt := 1; ; attempt++ {
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-r.done:
+			t.Stop()
+			return
+		}
+		p, err := r.open(&r.c)
+		r.mu.Lock()
+		switch {
+		case r.closed:
+			r.mu.Unlock()
+			if err == nil {
+				p.Close()
+			}
+			return
+		case err == nil:
+			r.port = p
+			r.gen++
+			r.watchIdle(p, r.gen)
+			close(r.up)
+			r.mu.Unlock()
+			r.notify(PortConnected, nil)
+			return
+		case r.policy.MaxAttempts > 0 && attempt >= r.policy.MaxAttempts:
+			r.failed = err
+			close(r.up)
+			r.mu.Unlock()
+			r.notify(PortClosed, err)
+			return
+		}
+		r.mu.Unlock()
+		if delay *= 2; delay > r.policy.MaxDelay {
+			delay = r.policy.MaxDelay
+		}
+		if delay < r.policy.Delay {
+			delay = r.policy.Delay
+		}
+	}
+}
+
+// isPortTimeout reports whether err is a timeout, which does not mean the
+// device went away.
+func isPortTimeout(err error) bool {
+	_, ok := err.(*WriteTimeoutError)
+	return ok || err == ErrTimeout
+}
+
+// Read reads from the port, waiting for it to be reopened if it is not
+// open.
+func (r *ReconnectingPort) Read(b []byte) (int, error) {
+	for {
+		p, gen, err := r.current(time.Duration(r.c.ReadTimeout) * time.Millisecond)
+		if err != nil {
+			return 0, err
+		}
+		n, err := p.Read(b)
+		if err == nil || isPortTimeout(err) {
+			return n, err
+		}
+		r.lost(gen, err)
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Write writes to the port, waiting for it to be reopened if it is not
+// open and finishing after a reopen if the device went away meanwhile.
+func (r *ReconnectingPort) Write(b []byte) (int, error) {
+	written := 0
+	for {
+		p, gen, err := r.current(r.c.WriteTimeout)
+		if err != nil {
+			return written, err
+		}
+		n, err := p.Write(b[written:])
+		written += n
+		if err == nil || isPortTimeout(err) {
+			return written, err
+		}
+		r.lost(gen, err)
+	}
+}
+
+// Close closes the port and stops reopening it.  A Read or Write
+// waiting for the port returns ErrPortClosed.
+func (r *ReconnectingPort) Close() error {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return ErrPortClosed
+	}
+	r.closed = true
+	close(r.done)
+	if r.failed == nil && r.port == nil {
+		close(r.up)
+	}
+	p := r.port
+	r.port = nil
+	if p != nil {
+		r.past.add(p.Stats())
+	}
+	r.mu.Unlock()
+	var err error
+	if p != nil {
+		err = p.Close()
+	}
+	r.notify(PortClosed, nil)
+	return err
+}
@@ -0,0 +1,164 @@
+package goserial
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// pipeOpener hands out one end of a new Pipe per open, keeping the
+// other ends for the test, and fails while fail is set.
+type pipeOpener struct {
+	mu    sync.Mutex
+	fail  error
+	peers chan *Port
+}
+
+func (o *pipeOpener) open(c *Config) (*Port, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.fail != nil {
+		return nil, o.fail
+	}
+	a, b := Pipe()
+	a.SetReadTimeout(time.Duration(c.ReadTimeout) * time.Millisecond)
+	o.peers <- b
+	return a, nil
+}
+
+func (o *pipeOpener) peer(t *testing.T) *Port {
+	select {
+	case b := <-o.peers:
+		return b
+	case <-time.After(2 * time.Second):
+		t.Fatal("the port was not reopened")
+	}
+	return nil
+}
+
+func TestReconnectingPort(t *testing.T) {
+	o := &pipeOpener{peers: make(chan *Port, 4)}
+	states := make(chan PortState, 8)
+	policy := ReconnectPolicy{
+		Delay:         10 * time.Millisecond,
+		OnStateChange: func(s PortState, err error) { states <- s },
+	}
+	r, err := newReconnectingPort(&Config{Name: "pipe", Baud: 9600}, policy, o.open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := o.peer(t)
+	b.Write([]byte("one"))
+	buf := make([]byte, 8)
+	if n, err := r.Read(buf); err != nil || string(buf[:n]) != "one" {
+		t.Fatalf("Read = %q, %v", buf[:n], err)
+	}
+
+	// Unplug: the Read that notices waits for the reopened port.
+	b.Close()
+	got := make(chan string, 1)
+	go func() {
+		n, err := r.Read(buf)
+		if err != nil {
+			got <- err.Error()
+			return
+		}
+		got <- string(buf[:n])
+	}()
+	b = o.peer(t)
+	b.Write([]byte("two"))
+	if s := <-got; s != "two" {
+		t.Errorf("Read across the reconnect = %q, want \"two\"", s)
+	}
+	if _, err := r.Write([]byte("up")); err != nil {
+		t.Fatal(err)
+	}
+	b.SetReadTimeout(time.Second)
+	if n, err := b.Read(buf); err != nil || string(buf[:n]) != "up" {
+		t.Errorf("peer read %q, %v", buf[:n], err)
+	}
+
+	if s := r.Stats(); s.BytesRead != 6 || s.BytesWritten != 2 || s.Reopens != 1 {
+		t.Errorf("Stats = %d read, %d written, %d reopens; want 6, 2, 1", s.BytesRead, s.BytesWritten, s.Reopens)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Read(buf); err != ErrPortClosed {
+		t.Errorf("Read after Close = %v, want ErrPortClosed", err)
+	}
+	want := []PortState{PortConnected, PortDisconnected, PortConnected, PortClosed}
+	for _, w := range want {
+		if s := <-states; s != w {
+			t.Errorf("state %v, want %v", s, w)
+		}
+	}
+}
+
+func TestReconnectingPortGivesUp(t *testing.T) {
+	errGone := errors.New("no such device")
+	o := &pipeOpener{fail: errGone, peers: make(chan *Port, 1)}
+	policy := ReconnectPolicy{Delay: time.Millisecond, MaxDelay: 4 * time.Millisecond, MaxAttempts: 3}
+	r, err := newReconnectingPort(&Config{Name: "pipe", Baud: 9600}, policy, o.open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err := r.Read(make([]byte, 1)); err != errGone {
+		t.Errorf("Read = %v, want %v", err, errGone)
+	}
+	if s := r.State(); s != PortClosed {
+		t.Errorf("State = %v, want closed", s)
+	}
+}
+
+func TestReconnectingPortTimeout(t *testing.T) {
+	o := &pipeOpener{fail: io.EOF, peers: make(chan *Port, 1)}
+	c := &Config{Name: "pipe", Baud: 9600, ReadTimeout: 20}
+	r, err := newReconnectingPort(c, ReconnectPolicy{Delay: time.Hour}, o.open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if s := r.State(); s != PortDisconnected {
+		t.Errorf("State = %v, want disconnected", s)
+	}
+	if _, err := r.Read(make([]byte, 1)); err != ErrTimeout {
+		t.Errorf("Read while disconnected = %v, want ErrTimeout", err)
+	}
+}
+
+func TestReconnectIdle(t *testing.T) {
+	o := &pipeOpener{peers: make(chan *Port, 4)}
+	lost := make(chan error, 4)
+	policy := ReconnectPolicy{
+		Delay:       10 * time.Millisecond,
+		IdleTimeout: 30 * time.Millisecond,
+		OnStateChange: func(s PortState, err error) {
+			if s == PortDisconnected {
+				lost <- err
+			}
+		},
+	}
+	r, err := newReconnectingPort(&Config{Name: "pipe", Baud: 9600}, policy, o.open)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	o.peer(t)
+	select {
+	case err := <-lost:
+		if err != ErrIdle {
+			t.Errorf("lost the quiet port with %v; want ErrIdle", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the quiet port was not reopened")
+	}
+	o.peer(t)
+	if s := r.Stats(); s.Reopens != 1 {
+		t.Errorf("Reopens = %d; want 1", s.Reopens)
+	}
+}
@@ -0,0 +1,628 @@
+package goserial
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// RFC 2217 drives a serial port on a terminal server (ser2net, Moxa,
+// Digi and the like) through telnet's COM-PORT-OPTION.  OpenPort uses
+// it for names of the form "rfc2217://host:port".  The line settings
+// and InitialDTR and InitialRTS are sent to the server; MonitorDCD,
+// KeepDTROnClose and CRLFTranslate have no remote equivalent and are
+// ignored.
+
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetBinary   = 0
+	telnetSGA      = 3 // suppress go ahead
+	telnetComPort  = 44
+	comPortReplied = 100 // added to a command in the server's reply
+)
+
+// COM-PORT-OPTION commands, as sent by the client.
+const (
+	cpSignature         = 0
+	cpSetBaud           = 1
+	cpSetDataSize       = 2
+	cpSetParity         = 3
+	cpSetStopSize       = 4
+	cpSetControl        = 5
+	cpNotifyModemState  = 7
+	cpFlowSuspend       = 8
+	cpFlowResume        = 9
+	cpSetLineStateMask  = 10
+	cpSetModemStateMask = 11
+	cpPurgeData         = 12
+)
+
+// SET-CONTROL values.
+const (
+	cpFlowRequest  = 0
+	cpFlowNone     = 1
+	cpFlowXON      = 2
+	cpFlowRTS      = 3
+	cpBreakRequest = 4
+	cpBreakOn      = 5
+	cpBreakOff     = 6
+	cpDTRRequest   = 7
+	cpDTROn        = 8
+	cpDTROff       = 9
+	cpRTSRequest   = 10
+	cpRTSOn        = 11
+	cpRTSOff       = 12
+)
+
+// The SET-DATASIZE, SET-PARITY and SET-STOPSIZE values.
+var (
+	cpSizes    = map[ByteSize]byte{Byte5: 5, Byte6: 6, Byte7: 7, Byte8: 8}
+	cpParities = map[ParityMode]byte{ParityNone: 1, ParityOdd: 2, ParityEven: 3, ParityMark: 4, ParitySpace: 5}
+	cpStopBits = map[StopBits]byte{StopBits1: 1, StopBits2: 2, StopBits1Half: 3}
+)
+
+// rfc2217Timeout is how long to wait for the server to acknowledge a
+// command.
+const rfc2217Timeout = 5 * time.Second
+
+// rfc2217Buffer is the size the queue of received data starts at.  It
+// grows as needed, so that replies to commands are still read while
+// nobody reads the data.
+const rfc2217Buffer = 4096
+
+type rfc2217Port struct {
+	conn net.Conn
+	in   *pipeBuffer // data received, with telnet stripped
+
+	wl sync.Mutex // serializes writes to conn
+
+	mu       sync.Mutex
+	replies  map[byte][]byte // last reply to each command
+	refused  bool            // the server will not do COM-PORT-OPTION
+	gone     error           // why the connection ended
+	closed   bool
+	modem    byte // last NOTIFY-MODEMSTATE value
+	modemSeq int  // the number of NOTIFY-MODEMSTATEs received
+	timeout  time.Duration
+	dtr, rts bool
+	flow     FlowControl   // as the server last acknowledged it
+	wake     chan struct{} // closed, and replaced, on every reply
+
+	// Telnet negotiation state, only used by the reading goroutine
+	// once the port is open.
+	weWill, theyWill map[byte]bool
+}
+
+func openRFC2217(addr string, c *Config) (d driver, err error) {
+	conn, err := net.DialTimeout("tcp", addr, rfc2217Timeout)
+	if err != nil {
+		return nil, err
+	}
+	p := &rfc2217Port{
+		conn:     conn,
+		in:       newPipeBuffer(rfc2217Buffer),
+		replies:  make(map[byte][]byte),
+		wake:     make(chan struct{}),
+		weWill:   map[byte]bool{telnetBinary: true, telnetSGA: true, telnetComPort: true},
+		theyWill: map[byte]bool{telnetBinary: true, telnetSGA: true},
+		timeout:  time.Duration(c.ReadTimeout) * time.Millisecond,
+	}
+	defer func() {
+		if err != nil {
+			p.Close()
+		}
+	}()
+
+	err = p.send([]byte{
+		telnetIAC, telnetWILL, telnetBinary,
+		telnetIAC, telnetDO, telnetBinary,
+		telnetIAC, telnetWILL, telnetSGA,
+		telnetIAC, telnetDO, telnetSGA,
+		telnetIAC, telnetWILL, telnetComPort,
+	})
+	if err != nil {
+		return nil, err
+	}
+	go p.readLoop()
+
+	if err = p.setBaud(c.Baud); err != nil {
+		return nil, err
+	}
+	if err = p.setFraming(c.Size, c.Parity, c.StopBits); err != nil {
+		return nil, err
+	}
+	if _, err = p.command(cpSetControl, []byte{cpFlowNone}); err != nil {
+		return nil, err
+	}
+
+	// The server decides what the lines do when a client connects, so
+	// only an explicit state is sent.
+	p.dtr, p.rts = true, true
+	for _, l := range []struct {
+		state LineState
+		set   func(bool) error
+	}{{c.InitialDTR, p.setDTR}, {c.InitialRTS, p.setRTS}} {
+		if l.state == LineHigh || l.state == LineLow {
+			if err = l.set(l.state == LineHigh); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return p, nil
+}
+
+// send writes b to the server.
+func (p *rfc2217Port) send(b []byte) error {
+	p.wl.Lock()
+	defer p.wl.Unlock()
+	_, err := p.conn.Write(b)
+	return err
+}
+
+// command sends a COM-PORT-OPTION command and waits for the server to
+// reply to it, returning the reply's value.
+func (p *rfc2217Port) command(cmd byte, value []byte) ([]byte, error) {
+	sb := []byte{telnetIAC, telnetSB, telnetComPort, cmd}
+	sb = append(sb, escapeIAC(value)...)
+	sb = append(sb, telnetIAC, telnetSE)
+
+	p.mu.Lock()
+	delete(p.replies, cmd+comPortReplied)
+	p.mu.Unlock()
+	if err := p.send(sb); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(rfc2217Timeout)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if r, ok := p.replies[cmd+comPortReplied]; ok {
+			return r, nil
+		}
+		switch {
+		case p.closed:
+			return nil, ErrPortClosed
+		case p.refused:
+			return nil, fmt.Errorf("goserial: %v does not support RFC 2217", p.conn.RemoteAddr())
+		case p.gone != nil:
+			return nil, p.gone
+		}
+		wake := p.wake
+		p.mu.Unlock()
+		t := time.NewTimer(time.Until(deadline))
+		select {
+		case <-wake:
+		case <-t.C:
+		}
+		t.Stop()
+		p.mu.Lock()
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("goserial: no reply from %v to RFC 2217 command %d", p.conn.RemoteAddr(), cmd)
+		}
+	}
+}
+
+// escapeIAC doubles every IAC in b.
+func escapeIAC(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for _, c := range b {
+		out = append(out, c)
+		if c == telnetIAC {
+			out = append(out, telnetIAC)
+		}
+	}
+	return out
+}
+
+// readLoop takes the telnet protocol out of what the server sends,
+// answering negotiation and recording replies, and queues the data for
+// Read.  It never waits for Read, the queue growing instead.
+func (p *rfc2217Port) readLoop() {
+	var err error
+	defer p.in.closeWriter()
+	defer func() {
+		p.mu.Lock()
+		p.gone = err
+		p.changed()
+		p.mu.Unlock()
+	}()
+
+	const (
+		stData = iota
+		stIAC
+		stOption
+		stSub
+		stSubIAC
+	)
+	state, verb := stData, byte(0)
+	var sub []byte
+	buf := make([]byte, 4096)
+	for {
+		var n int
+		n, err = p.conn.Read(buf)
+		data := buf[:0]
+		for _, c := range buf[:n] {
+			switch state {
+			case stData:
+				if c == telnetIAC {
+					state = stIAC
+				} else {
+					data = append(data, c)
+				}
+			case stIAC:
+				switch c {
+				case telnetIAC:
+					data = append(data, c)
+					state = stData
+				case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+					verb, state = c, stOption
+				case telnetSB:
+					sub, state = sub[:0], stSub
+				default:
+					state = stData
+				}
+			case stOption:
+				p.negotiate(verb, c)
+				state = stData
+			case stSub:
+				if c == telnetIAC {
+					state = stSubIAC
+				} else {
+					sub = append(sub, c)
+				}
+			case stSubIAC:
+				switch c {
+				case telnetSE:
+					p.subnegotiation(sub)
+					state = stData
+				default:
+					sub = append(sub, c)
+					state = stSub
+				}
+			}
+		}
+		if len(data) > 0 {
+			if werr := p.in.put(data); werr != nil {
+				err = werr
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// negotiate answers a telnet option request.  It only runs on the
+// reading goroutine, so the option maps need no lock.
+func (p *rfc2217Port) negotiate(verb, opt byte) {
+	var reply byte
+	switch verb {
+	case telnetDO:
+		switch {
+		case opt != telnetBinary && opt != telnetSGA && opt != telnetComPort:
+			reply = telnetWONT
+		case !p.weWill[opt]:
+			p.weWill[opt] = true
+			reply = telnetWILL
+		}
+	case telnetDONT:
+		if opt == telnetComPort {
+			p.mu.Lock()
+			p.refused = true
+			p.changed()
+			p.mu.Unlock()
+		}
+		if p.weWill[opt] {
+			p.weWill[opt] = false
+			reply = telnetWONT
+		}
+	case telnetWILL:
+		switch {
+		case opt != telnetBinary && opt != telnetSGA:
+			reply = telnetDONT
+		case !p.theyWill[opt]:
+			p.theyWill[opt] = true
+			reply = telnetDO
+		}
+	case telnetWONT:
+		if p.theyWill[opt] {
+			p.theyWill[opt] = false
+			reply = telnetDONT
+		}
+	}
+	if reply != 0 {
+		p.send([]byte{telnetIAC, reply, opt})
+	}
+}
+
+func (p *rfc2217Port) subnegotiation(sub []byte) {
+	if len(sub) < 2 || sub[0] != telnetComPort {
+		return
+	}
+	cmd, value := sub[1], append([]byte(nil), sub[2:]...)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if cmd == cpNotifyModemState+comPortReplied && len(value) > 0 {
+		p.modem = value[0]
+		p.modemSeq++
+	}
+	p.replies[cmd] = value
+	p.changed()
+}
+
+// changed wakes everyone waiting for a reply.  p.mu must be held.
+func (p *rfc2217Port) changed() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+func (p *rfc2217Port) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	timeout := p.timeout
+	p.mu.Unlock()
+	var deadline time.Time
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	return p.in.read(b, deadline)
+}
+
+func (p *rfc2217Port) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return 0, ErrPortClosed
+	}
+	if err := p.send(escapeIAC(b)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (p *rfc2217Port) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.changed()
+	p.mu.Unlock()
+	p.in.closeReader()
+	return p.conn.Close()
+}
+
+func (p *rfc2217Port) setBaud(baud int) error {
+	if baud <= 0 {
+		return &ConfigError{Field: "Baud", Value: baud, Err: ErrBadBaudRate}
+	}
+	var v [4]byte
+	binary.BigEndian.PutUint32(v[:], uint32(baud))
+	_, err := p.command(cpSetBaud, v[:])
+	return err
+}
+
+func (p *rfc2217Port) setFraming(size ByteSize, parity ParityMode, stop StopBits) error {
+	if _, err := p.command(cpSetDataSize, []byte{cpSizes[size]}); err != nil {
+		return err
+	}
+	if _, err := p.command(cpSetParity, []byte{cpParities[parity]}); err != nil {
+		return err
+	}
+	_, err := p.command(cpSetStopSize, []byte{cpStopBits[stop]})
+	return err
+}
+
+func (p *rfc2217Port) setReadTimeout(d time.Duration) error {
+	p.mu.Lock()
+	p.timeout = d
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *rfc2217Port) setDTR(on bool) error {
+	v := byte(cpDTROff)
+	if on {
+		v = cpDTROn
+	}
+	if _, err := p.command(cpSetControl, []byte{v}); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.dtr = on
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *rfc2217Port) setRTS(on bool) error {
+	v := byte(cpRTSOff)
+	if on {
+		v = cpRTSOn
+	}
+	if _, err := p.command(cpSetControl, []byte{v}); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.rts = on
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *rfc2217Port) setBreak(on bool) error {
+	v := byte(cpBreakOff)
+	if on {
+		v = cpBreakOn
+	}
+	_, err := p.command(cpSetControl, []byte{v})
+	return err
+}
+
+func (p *rfc2217Port) setFlowControl(f FlowControl) error {
+	v := byte(cpFlowNone)
+	switch f {
+	case FlowRTSCTS:
+		v = cpFlowRTS
+	case FlowXONXOFF:
+		v = cpFlowXON
+	}
+	r, err := p.command(cpSetControl, []byte{v})
+	if err != nil {
+		return err
+	}
+	f = FlowNone
+	if len(r) > 0 {
+		switch r[len(r)-1] {
+		case cpFlowRTS:
+			f = FlowRTSCTS
+		case cpFlowXON:
+			f = FlowXONXOFF
+		}
+	}
+	p.mu.Lock()
+	p.flow = f
+	p.mu.Unlock()
+	return nil
+}
+
+// The line bits of NOTIFY-MODEMSTATE, which are also those of the
+// Windows MS_CTS_ON and so on.
+const (
+	modemCTS = 0x10
+	modemDSR = 0x20
+	modemRI  = 0x40
+	modemDCD = 0x80
+)
+
+// modemStatus returns the lines as the server last reported them.
+func (p *rfc2217Port) modemStatus() (ModemStatus, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return ModemStatus{
+		CTS: p.modem&modemCTS != 0,
+		DSR: p.modem&modemDSR != 0,
+		RI:  p.modem&modemRI != 0,
+		DCD: p.modem&modemDCD != 0,
+	}, nil
+}
+
+// waitModemChange waits for a NOTIFY-MODEMSTATE that changes one of
+// lines, or whose delta bits, in the same order as ModemLines, say one
+// changed and changed back.
+func (p *rfc2217Port) waitModemChange(ctx context.Context, lines ModemLines) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	prior, seq := p.modem, p.modemSeq
+	for {
+		switch {
+		case p.closed:
+			return ErrPortClosed
+		case p.gone != nil:
+			return p.gone
+		}
+		wake := p.wake
+		p.mu.Unlock()
+		select {
+		case <-wake:
+		case <-ctx.Done():
+		}
+		p.mu.Lock()
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p.modemSeq != seq {
+			changed := ModemLines((p.modem^prior)>>4 | p.modem&0x0f)
+			if changed&lines != 0 {
+				return nil
+			}
+			prior, seq = p.modem, p.modemSeq
+		}
+	}
+}
+
+func (p *rfc2217Port) outputLines() (dtr, rts bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dtr, p.rts, nil
+}
+
+func (p *rfc2217Port) flush(in, out bool) error {
+	var v byte
+	switch {
+	case in && out:
+		v = 3
+	case in:
+		v = 1
+	case out:
+		v = 2
+	default:
+		return nil
+	}
+	if in {
+		p.in.reset()
+	}
+	_, err := p.command(cpPurgeData, []byte{v})
+	return err
+}
+
+// getConfig reports the settings as the server last acknowledged them.
+func (p *rfc2217Port) getConfig(c *Config) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	reply := func(cmd byte) byte {
+		r := p.replies[cmd+comPortReplied]
+		if len(r) == 0 {
+			return 0
+		}
+		return r[len(r)-1]
+	}
+	if r := p.replies[cpSetBaud+comPortReplied]; len(r) == 4 {
+		c.Baud = int(binary.BigEndian.Uint32(r))
+	}
+	switch reply(cpSetDataSize) {
+	case 5:
+		c.Size = Byte5
+	case 6:
+		c.Size = Byte6
+	case 7:
+		c.Size = Byte7
+	default:
+		c.Size = Byte8
+	}
+	switch reply(cpSetParity) {
+	case 2:
+		c.Parity = ParityOdd
+	case 3:
+		c.Parity = ParityEven
+	case 4:
+		c.Parity = ParityMark
+	case 5:
+		c.Parity = ParitySpace
+	default:
+		c.Parity = ParityNone
+	}
+	switch reply(cpSetStopSize) {
+	case 2:
+		c.StopBits = StopBits2
+	case 3:
+		c.StopBits = StopBits1Half
+	default:
+		c.StopBits = StopBits1
+	}
+	c.RTSFlowControl, c.XONFlowControl = p.flow == FlowRTSCTS, p.flow == FlowXONXOFF
+	return nil
+}
+
+// restore does nothing: the server sets the port up afresh for the next
+// connection.
+func (p *rfc2217Port) restore() error {
+	return nil
+}
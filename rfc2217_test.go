@@ -0,0 +1,256 @@
+package goserial
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rfc2217Stub is a minimal RFC 2217 server.  It acknowledges every
+// COM-PORT-OPTION command, remembers the settings and echoes data back.
+type rfc2217Stub struct {
+	l      net.Listener
+	refuse bool
+
+	mu       sync.Mutex
+	settings map[byte][]byte
+	controls []byte
+}
+
+func newRFC2217Stub(t *testing.T, refuse bool) *rfc2217Stub {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	s := &rfc2217Stub{l: l, refuse: refuse, settings: make(map[byte][]byte)}
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(c)
+		}
+	}()
+	return s
+}
+
+func (s *rfc2217Stub) name() string {
+	return "rfc2217://" + s.l.Addr().String()
+}
+
+func (s *rfc2217Stub) serve(c net.Conn) {
+	defer c.Close()
+	r := &stubReader{c: c}
+	for {
+		b, err := r.next()
+		if err != nil {
+			return
+		}
+		if b != telnetIAC {
+			c.Write(escapeIAC([]byte{b}))
+			continue
+		}
+		verb, _ := r.next()
+		switch verb {
+		case telnetIAC:
+			c.Write([]byte{telnetIAC, telnetIAC})
+		case telnetWILL:
+			opt, _ := r.next()
+			reply := byte(telnetDO)
+			if opt == telnetComPort && s.refuse {
+				reply = telnetDONT
+			}
+			c.Write([]byte{telnetIAC, reply, opt})
+		case telnetDO:
+			opt, _ := r.next()
+			c.Write([]byte{telnetIAC, telnetWILL, opt})
+		case telnetSB:
+			var sub []byte
+			for {
+				b, err := r.next()
+				if err != nil {
+					return
+				}
+				if b == telnetIAC {
+					if b, _ = r.next(); b == telnetSE {
+						break
+					}
+				}
+				sub = append(sub, b)
+			}
+			cmd, value := sub[1], sub[2:]
+			s.mu.Lock()
+			if cmd == cpSetControl {
+				s.controls = append(s.controls, value[0])
+			} else {
+				s.settings[cmd] = value
+			}
+			s.mu.Unlock()
+			reply := []byte{telnetIAC, telnetSB, telnetComPort, cmd + comPortReplied}
+			reply = append(reply, escapeIAC(value)...)
+			c.Write(append(reply, telnetIAC, telnetSE))
+		default:
+			r.next()
+		}
+	}
+}
+
+type stubReader struct {
+	c   net.Conn
+	buf [1]byte
+}
+
+func (r *stubReader) next() (byte, error) {
+	_, err := io.ReadFull(r.c, r.buf[:])
+	return r.buf[0], err
+}
+
+func TestRFC2217(t *testing.T) {
+	stub := newRFC2217Stub(t, false)
+	defer stub.l.Close()
+
+	// 511 baud puts an IAC in the SET-BAUDRATE value.
+	c := &Config{Name: stub.name(), Baud: 511, Size: Byte7, Parity: ParityEven, StopBits: StopBits2, InitialDTR: LineLow}
+	p, err := OpenPort(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	stub.mu.Lock()
+	baud := binary.BigEndian.Uint32(stub.settings[cpSetBaud])
+	if baud != 511 || stub.settings[cpSetDataSize][0] != 7 ||
+		stub.settings[cpSetParity][0] != 3 || stub.settings[cpSetStopSize][0] != 2 {
+		t.Errorf("server settings: baud %d, %v", baud, stub.settings)
+	}
+	if !bytes.Equal(stub.controls, []byte{cpFlowNone, cpDTROff}) {
+		t.Errorf("server control commands %v", stub.controls)
+	}
+	stub.mu.Unlock()
+
+	data := []byte{1, telnetIAC, 2, telnetIAC, telnetIAC}
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	p.SetReadTimeout(time.Second)
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(p, got); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("echo: %v, %v; want %v", got, err, data)
+	}
+	p.SetReadTimeout(50 * time.Millisecond)
+	if _, err := p.Read(got); err != ErrTimeout {
+		t.Errorf("Read with nothing sent: %v, want ErrTimeout", err)
+	}
+
+	if err := p.SetRTS(false); err != nil {
+		t.Fatal(err)
+	}
+	dtr, rts, _ := p.d.outputLines()
+	if dtr || rts {
+		t.Errorf("output lines dtr %v rts %v, want both off", dtr, rts)
+	}
+
+	stub.mu.Lock()
+	stub.controls = nil
+	stub.mu.Unlock()
+	if err := p.SendBreak(time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	if !bytes.Equal(stub.controls, []byte{cpBreakOn, cpBreakOff}) {
+		t.Errorf("server control commands for a break %v", stub.controls)
+	}
+	stub.mu.Unlock()
+
+	if err := Probe(c); err != nil {
+		t.Errorf("Probe: %v", err)
+	}
+	fc := *c
+	fc.RTSFlowControl = true
+	if err := Probe(&fc); err != nil {
+		t.Errorf("Probe with RTSFlowControl: %v", err)
+	}
+	fc.RTSFlowControl, fc.RS485 = false, &RS485{}
+	if ce, ok := Probe(&fc).(*ConfigError); !ok || ce.Field != "RS485" {
+		t.Errorf("Probe with RS485 on a network port did not fail with an RS485 ConfigError")
+	}
+
+	if err := p.SetFraming(Byte5, ParityMark, StopBits1Half); err != nil {
+		t.Fatal(err)
+	}
+	var pc Config
+	if err := p.d.getConfig(&pc); err != nil || pc.Parity != ParityMark || pc.StopBits != StopBits1Half {
+		t.Errorf("after SetFraming: parity %v, stop bits %v, %v; want mark, 1.5", pc.Parity, pc.StopBits, err)
+	}
+
+	p.Close()
+	if _, err := p.Read(got); err != ErrPortClosed {
+		t.Errorf("Read after Close: %v, want ErrPortClosed", err)
+	}
+}
+
+func TestRFC2217FlowControl(t *testing.T) {
+	stub := newRFC2217Stub(t, false)
+	defer stub.l.Close()
+
+	p, err := OpenPort(&Config{Name: stub.name(), Baud: 115200, Parity: ParityOdd, RTSFlowControl: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err := p.SetFlowControl(FlowXONXOFF); err != nil {
+		t.Fatal(err)
+	}
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if stub.settings[cpSetParity][0] != 2 {
+		t.Errorf("server parity %v, want odd", stub.settings[cpSetParity])
+	}
+	if !bytes.Equal(stub.controls, []byte{cpFlowNone, cpFlowRTS, cpFlowXON}) {
+		t.Errorf("server control commands %v", stub.controls)
+	}
+}
+
+func TestRFC2217Refused(t *testing.T) {
+	stub := newRFC2217Stub(t, true)
+	defer stub.l.Close()
+
+	if s, err := OpenPort(&Config{Name: stub.name(), Baud: 9600}); err == nil {
+		s.Close()
+		t.Error("open succeeded against a server refusing COM-PORT-OPTION")
+	}
+}
+
+func TestRFC2217Unread(t *testing.T) {
+	stub := newRFC2217Stub(t, false)
+	defer stub.l.Close()
+
+	p, err := OpenPort(&Config{Name: stub.name(), Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// The stub echoes all of it, far more than the queue starts with,
+	// before it answers SET-CONTROL.
+	data := make([]byte, 64<<10+5000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetDTR(false); err != nil {
+		t.Fatalf("SetDTR with %d bytes unread: %v", len(data), err)
+	}
+	p.SetReadTimeout(time.Second)
+	got := make([]byte, len(data))
+	if _, err := io.ReadFull(p, got); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("queued data: %v; want all %d bytes sent", err, len(data))
+	}
+}
@@ -0,0 +1,104 @@
+package goserial
+
+import (
+	"errors"
+	"time"
+)
+
+// RS485 configures RTS as the driver enable of a half-duplex RS-485
+// transceiver: raised (or lowered) while the port sends, and returned
+// to the other state once the last byte has gone.
+//
+// On Linux the kernel does it, through TIOCSRS485, if the driver
+// supports that.  On Windows RTS_CONTROL_TOGGLE does it, if the driver
+// accepts it and both delays are zero.  Otherwise the port does it
+// itself around each Write: it sets RTS, waits DelayBeforeSend, writes,
+// drains the output, waits DelayAfterSend and sets RTS back.  That
+// depends on Drain knowing when the last byte has left, see there, and
+// is reported by Port.SetupWarnings.  Meanwhile changing RTS by hand
+// fights with it.
+type RS485 struct {
+	// RTSOnSend and RTSAfterSend are the states of RTS, true meaning
+	// asserted, while sending and after it.  If they are the same,
+	// RTSOnSend is taken as true and RTSAfterSend as false, as Linux
+	// does.
+	RTSOnSend    bool
+	RTSAfterSend bool
+
+	// DelayBeforeSend is how long RTS is held before the first byte,
+	// and DelayAfterSend after the last, for transceivers slow to turn
+	// around.  The kernel counts them in whole milliseconds.
+	DelayBeforeSend time.Duration
+	DelayAfterSend  time.Duration
+}
+
+func (r *RS485) check() error {
+	if r.DelayBeforeSend < 0 {
+		return &ConfigError{Field: "RS485.DelayBeforeSend", Value: r.DelayBeforeSend, Err: errors.New("negative")}
+	}
+	if r.DelayAfterSend < 0 {
+		return &ConfigError{Field: "RS485.DelayAfterSend", Value: r.DelayAfterSend, Err: errors.New("negative")}
+	}
+	return nil
+}
+
+// lines returns the RTS states r selects.
+func (r *RS485) lines() (onSend, afterSend bool) {
+	if r.RTSOnSend == r.RTSAfterSend {
+		return true, false
+	}
+	return r.RTSOnSend, r.RTSAfterSend
+}
+
+// rs485Setter is implemented by drivers that can have the kernel or
+// the driver switch RTS for RS-485.  They return ErrUnsupported when it
+// cannot, so that the port does it itself.
+type rs485Setter interface {
+	setRS485(r *RS485) error
+}
+
+// setRS485 applies Config.RS485, falling back to switching RTS in
+// Write.
+func (p *Port) setRS485(r *RS485) error {
+	err := ErrUnsupported
+	if s, ok := p.d.(rs485Setter); ok {
+		err = s.setRS485(r)
+	}
+	p.traceControl("rs485", err, true)
+	if err != ErrUnsupported {
+		return err
+	}
+	if _, ok := p.d.(drainer); !ok {
+		return &ConfigError{Field: "RS485", Value: true, Err: ErrUnsupported}
+	}
+	rr := *r
+	rr.RTSOnSend, rr.RTSAfterSend = r.lines()
+	if err := p.d.setRTS(rr.RTSAfterSend); err != nil {
+		return err
+	}
+	p.rs485 = &rr
+	p.warnings = append(p.warnings, &ConfigError{Field: "RS485", Value: true,
+		Err: errors.New("not supported by the driver; RTS is switched around each Write")})
+	return nil
+}
+
+// rs485Write is write for a port switching RTS itself.  sl keeps the
+// writes whole, each inside its own RTS pulse.
+func (p *Port) rs485Write(b []byte) (int, error) {
+	r := p.rs485
+	p.sl.Lock()
+	defer p.sl.Unlock()
+	if err := p.d.setRTS(r.RTSOnSend); err != nil {
+		return 0, err
+	}
+	time.Sleep(r.DelayBeforeSend)
+	n, err := p.writeDriver(b)
+	if err == nil {
+		err = p.d.(drainer).drain()
+	}
+	time.Sleep(r.DelayAfterSend)
+	if rerr := p.d.setRTS(r.RTSAfterSend); err == nil {
+		err = rerr
+	}
+	return n, err
+}
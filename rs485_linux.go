@@ -0,0 +1,74 @@
+// +build linux
+
+package goserial
+
+import (
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// serialRS485 is the kernel's struct serial_rs485.
+type serialRS485 struct {
+	flags       uint32
+	delayBefore uint32 // milliseconds
+	delayAfter  uint32
+	padding     [5]uint32
+}
+
+// The serial_rs485 flags.
+const (
+	serRS485Enabled      = 1 << 0
+	serRS485RTSOnSend    = 1 << 1
+	serRS485RTSAfterSend = 1 << 2
+)
+
+// rs485Requests returns TIOCGRS485 and TIOCSRS485, which the syscall
+// package does not export on every architecture.  MIPS encodes the
+// structure's size and direction in them; the rest use the plain
+// numbers.
+func rs485Requests() (get, set uintptr) {
+	if strings.HasPrefix(runtime.GOARCH, "mips") {
+		return 0x4020542e, 0xc020542f
+	}
+	return 0x542e, 0x542f
+}
+
+// setRS485 hands RTS to the kernel, putting back the RS-485 settings the
+// port had when it is closed.  Drivers without RS-485 support, and ptys,
+// fail with ENOTTY or EINVAL.
+func (p *serialPort) setRS485(r *RS485) error {
+	get, set := rs485Requests()
+	var orig serialRS485
+	if err := p.ioctl(get, uintptr(unsafe.Pointer(&orig))); err != nil {
+		return rs485Error(err)
+	}
+	onSend, afterSend := r.lines()
+	s := serialRS485{
+		flags:       serRS485Enabled,
+		delayBefore: uint32((r.DelayBeforeSend + time.Millisecond - 1) / time.Millisecond),
+		delayAfter:  uint32((r.DelayAfterSend + time.Millisecond - 1) / time.Millisecond),
+	}
+	if onSend {
+		s.flags |= serRS485RTSOnSend
+	}
+	if afterSend {
+		s.flags |= serRS485RTSAfterSend
+	}
+	if err := p.ioctl(set, uintptr(unsafe.Pointer(&s))); err != nil {
+		return rs485Error(err)
+	}
+	p.undo = append(p.undo, func() {
+		p.ioctl(set, uintptr(unsafe.Pointer(&orig)))
+	})
+	return nil
+}
+
+func rs485Error(err error) error {
+	if err == syscall.ENOTTY || err == syscall.EINVAL {
+		return ErrUnsupported
+	}
+	return err
+}
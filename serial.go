@@ -12,9 +12,11 @@ manually:
 
 Currently there is very little in the way of configurability.  You can
 set the baud rate.  Then you can Read(), Write(), or Close() the
-connection.  Read() will block until at least one byte is returned.
-Write is the same.  There is currently no exposed way to set the
-timeouts, though patches are welcome.
+connection.  Read() will block until at least one byte is returned,
+unless a read timeout is set with Config.ReadTimeout or
+Port.SetReadTimeout, in which case it returns ErrTimeout when the
+timeout expires.  Write blocks until the data has been handed to the
+driver.
 
 Currently ports are opened with 8 data bits, 1 stop bit, no parity, no hardware
 flow control, and no software flow control by default.  This works fine for
@@ -56,14 +58,91 @@ Example usage:
 package goserial
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ConfigError reports a Config field that could not be satisfied.
+type ConfigError struct {
+	Field string      // name of the Config field
+	Value interface{} // the value asked for
+	Err   error       // what went wrong
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("goserial config: %s %v: %v", e.Field, e.Value, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ErrTimeout is returned by Read when the read timeout expires before
+// any data has arrived, and by Write when Config.WriteTimeout, the one
+// set with SetWriteTimeout or the write timeouts of
+// Config.WindowsTimeouts expire, as well as by both once a deadline
+// has passed.  It has a Timeout method returning true, and errors.Is
+// takes it for os.ErrDeadlineExceeded, as net.Conn has it.
+var ErrTimeout error = timeoutError{}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string        { return "goserial: timeout" }
+func (timeoutError) Timeout() bool        { return true }
+func (timeoutError) Temporary() bool      { return true }
+func (timeoutError) Is(target error) bool { return target == os.ErrDeadlineExceeded }
+
+// ErrOpenTimeout is returned by OpenPort and Probe when the port does
+// not open within Config.OpenTimeout.  Like ErrTimeout it has a Timeout
+// method returning true.
+var ErrOpenTimeout error = openTimeoutError{}
+
+type openTimeoutError struct{}
+
+func (openTimeoutError) Error() string   { return "goserial: open timed out" }
+func (openTimeoutError) Timeout() bool   { return true }
+func (openTimeoutError) Temporary() bool { return true }
+
+// ErrPortClosed is returned by operations on a port that has been
+// closed, and by writes to a Pipe whose other end has been closed.
+var ErrPortClosed = errors.New("goserial: port closed")
+
+// ErrUnsupported is returned by operations the port cannot do.
+var ErrUnsupported = errors.New("goserial: not supported by this port")
+
+// ErrNotSerialPort is returned by OpenPort when the device is not a
+// serial port: on POSIX not a terminal, on Windows a handle that
+// GetCommState rejects.  Config.AllowNonTTY lets such devices open.
+var ErrNotSerialPort = errors.New("goserial: not a serial port")
+
+// ErrPortDisconnected is returned when the device behind an open port
+// goes away, for example when a USB adapter is unplugged.  On Windows,
+// where drivers fail I/O with one of several codes after a surprise
+// removal, Read and Write return it from then on.
+var ErrPortDisconnected = errors.New("goserial: port disconnected")
+
+// ErrPortBusy is returned by OpenPort when another process holds the
+// port exclusively; see Config.Exclusive.
+var ErrPortBusy = errors.New("goserial: port busy")
+
+// The errors a ConfigError wraps for a field with a value out of range.
+// errors.Is matches them.
 var (
-	ErrConfigStopBits = errors.New("goserial config: bad number of stop bits")
-	ErrConfigByteSize = errors.New("goserial config: bad byte size")
-	ErrConfigParity   = errors.New("goserial config: bad parity")
+	ErrConfigStopBits  = errors.New("goserial config: bad number of stop bits")
+	ErrConfigByteSize  = errors.New("goserial config: bad byte size")
+	ErrConfigParity    = errors.New("goserial config: bad parity")
+	ErrConfigLineState = errors.New("goserial config: bad modem line state")
+
+	// ErrBadBaudRate is for a baud rate that is not positive, or that
+	// the platform or driver cannot set.
+	ErrBadBaudRate = errors.New("goserial config: baud rate not supported")
 )
 
 type ParityMode byte
@@ -72,8 +151,31 @@ const (
 	ParityNone = ParityMode(iota)
 	ParityEven
 	ParityOdd
+
+	// ParityMark and ParitySpace fix the parity bit at 1 and 0, as
+	// some multidrop protocols do to mark address bytes.  They need
+	// CMSPAR on POSIX, which Linux has; on the BSDs and macOS OpenPort
+	// and SetFraming return a ConfigError wrapping ErrUnsupported.
+	ParityMark
+	ParitySpace
 )
 
+func (p ParityMode) String() string {
+	switch p {
+	case ParityNone:
+		return "none"
+	case ParityEven:
+		return "even"
+	case ParityOdd:
+		return "odd"
+	case ParityMark:
+		return "mark"
+	case ParitySpace:
+		return "space"
+	}
+	return fmt.Sprintf("ParityMode(%d)", byte(p))
+}
+
 type ByteSize byte
 
 const (
@@ -83,11 +185,61 @@ const (
 	Byte7
 )
 
+func (s ByteSize) String() string {
+	switch s {
+	case Byte5:
+		return "5"
+	case Byte6:
+		return "6"
+	case Byte7:
+		return "7"
+	case Byte8:
+		return "8"
+	}
+	return fmt.Sprintf("ByteSize(%d)", byte(s))
+}
+
 type StopBits byte
 
 const (
 	StopBits1 = StopBits(iota)
 	StopBits2
+
+	// StopBits1Half is 1.5 stop bits, for 5-bit equipment such as
+	// teleprinters.  Windows and RFC 2217 servers take it as it is.
+	// Termios has no such setting, but 16550-style UARTs send 1.5 stop
+	// bits for 5-bit characters with CSTOPB, so on POSIX it needs
+	// Byte5 and reads back as StopBits2.
+	StopBits1Half
+)
+
+func (s StopBits) String() string {
+	switch s {
+	case StopBits1:
+		return "1"
+	case StopBits2:
+		return "2"
+	case StopBits1Half:
+		return "1.5"
+	}
+	return fmt.Sprintf("StopBits(%d)", byte(s))
+}
+
+// LineState selects what OpenPort does with a modem control line.
+//
+// With LineDefault the lines behave as they always have: on POSIX the
+// kernel raises DTR and RTS when the device is opened and the package
+// leaves them alone, while on Windows the package configures both lines
+// off (DTR_CONTROL_DISABLE, RTS_CONTROL_DISABLE), so they end up low
+// after OpenPort even if the driver raised them when the handle was
+// created.
+type LineState byte
+
+const (
+	LineDefault   = LineState(iota)
+	LineHigh      // assert the line
+	LineLow       // deassert the line
+	LineUnchanged // leave the line as the driver has it
 )
 
 // Config contains the information needed to open a serial port.
@@ -105,55 +257,854 @@ const (
 //    c1.Baud = 115200
 //
 type Config struct {
+	// Name is the device to open, such as "/dev/ttyUSB0" or "COM3".
+	// On Windows any COM port number works without the \\.\ prefix.
+	// "rfc2217://host:port" and "tcp://host:port" open network ports,
+	// and "scheme://..." a port of the Driver registered for scheme.
 	Name string
+
+	// Baud is the line rate in bits per second.  Any rate the driver
+	// can produce may be used, not only the standard ones: Linux sets
+	// the others with termios2 and BOTHER, failing if the driver
+	// rounds by more than 2%, macOS with IOSSIOSPEED, and the BSDs and
+	// Windows take the number as it is.  On powerpc Linux and the cgo
+	// platforms, such as Solaris, only the rates termios has constants
+	// for work.
 	Baud int
 
 	Size     ByteSize
 	Parity   ParityMode
 	StopBits StopBits
 
-	// RTSFlowControl bool
+	// RS485, if not nil, has RTS drive an RS-485 transceiver: see
+	// RS485.  It cannot be combined with RTSFlowControl.
+	RS485 *RS485
+
+	// RTSFlowControl turns on hardware flow control with OpenPort, as
+	// SetFlowControl(FlowRTSCTS) does: CRTSCTS on POSIX, fOutxCtsFlow
+	// and RTS_CONTROL_HANDSHAKE on Windows, SET-CONTROL over RFC 2217.
+	// From then on the driver owns RTS and SetRTS returns
+	// ErrRTSFlowControl.  Ports without flow control, such as TCP ports,
+	// fail to open with ErrUnsupported.
+	RTSFlowControl bool
 	// DTRFlowControl bool
-	// XONFlowControl bool
 
-	CRLFTranslate bool // Ignored on Windows.
+	// XONFlowControl turns on software flow control with OpenPort, as
+	// SetFlowControl(FlowXONXOFF) does: IXON and IXOFF on POSIX, fOutX
+	// and fInX on Windows, using XONChar and XOFFChar.  It cannot be
+	// combined with RTSFlowControl.
+	XONFlowControl bool
+
+	// XONChar and XOFFChar are the characters software flow control
+	// uses to restart and stop output, termios VSTART and VSTOP or the
+	// DCB's XonChar and XoffChar.  Zero means the usual DC1 (0x11) and
+	// DC3 (0x13); the two must differ.  XANY lets any received
+	// character restart stopped output, as IXANY does on POSIX; Windows
+	// has no equivalent, and OpenPort there returns ErrUnsupported.
+	XONChar, XOFFChar byte
+	XANY              bool
+
+	// MarkErrors has bytes received with a parity or framing error
+	// marked in what Read returns, instead of passed on as they are, so
+	// that a 9-bit multidrop protocol can spot address bytes sent with
+	// ParityMark while the port expects ParitySpace.  It sets INPCK and
+	// PARMRK on POSIX: a bad byte reads as 0xff 0x00 and the byte, a
+	// break as 0xff 0x00 0x00, and a good 0xff as 0xff 0xff.  See
+	// MarkedReader for undoing the marking.  Windows, which can only
+	// replace bad bytes, returns ErrUnsupported from OpenPort.
+	MarkErrors bool
+
+	// MonitorDCD makes the port honor the modem control lines instead
+	// of ignoring them. By default CLOCAL is set on POSIX, which suits
+	// usb-to-serial converters and bluetooth serial ports that do not
+	// drive carrier detect. With MonitorDCD set CLOCAL is cleared, so the
+	// tty is hung up when DCD drops: Read returns io.EOF and Write fails
+	// from then on, which is how a dropped modem connection is detected.
+	// On Windows this sets fDsrSensitivity, so received bytes are
+	// discarded while DSR is low; no hangup is reported.
+	MonitorDCD bool
+
+	// KeepDTROnClose stops Close from dropping DTR, for devices that
+	// reset or lose their configuration when DTR goes low. On POSIX it
+	// clears HUPCL; by default HUPCL is left as the tty had it. Anything
+	// that puts back the tty's previous termios before closing would
+	// re-enable HUPCL, so such a restore has to keep the flag cleared.
+	// On Windows DTR is asserted while the port is open, unless
+	// InitialDTR says otherwise, and again just before the handle is
+	// closed; whether it stays up afterwards is up to the driver.
+	KeepDTROnClose bool
+
+	// InitialDTR and InitialRTS set the state of DTR and RTS as part of
+	// OpenPort: on POSIX with TIOCMSET straight after the termios
+	// settings, on Windows through fDtrControl and fRtsControl in the
+	// DCB.
+	//
+	// Use LineUnchanged for DTR to attach to a running board that resets
+	// on a DTR edge, such as an Arduino: the package then never touches
+	// the modem control bits.  That cannot stop every reset.  The POSIX
+	// kernel raises DTR when the device is opened, so a board whose DTR
+	// was dropped by the previous Close (see KeepDTROnClose) still sees
+	// an edge, and some usb-to-serial chips and drivers pulse DTR on
+	// open regardless of what the application asks for.
+	InitialDTR LineState
+	InitialRTS LineState
+
+	// Exclusive keeps other processes from opening the port while it
+	// is open, so that two programs cannot interleave their writes.
+	// On POSIX the port is locked with flock, which other Exclusive
+	// ports and tools such as picocom take too, and TIOCEXCL is set,
+	// which the kernel enforces on every later open except by root.
+	// A port already opened without either goes unnoticed.  Windows
+	// always opens ports without sharing.  Either way OpenPort returns
+	// ErrPortBusy when another process holds the port.
+	Exclusive bool
+
+	// CRLFTranslate sets ICRNL on POSIX, so that each CR received
+	// reads as LF.  It is ignored on Windows; a LinePort deals with
+	// line endings the same way everywhere.
+	CRLFTranslate bool
 	// TimeoutStuff int
+
+	// ReadTimeout bounds how long a Read waits for data, in
+	// milliseconds; zero means Read blocks until at least one byte
+	// arrives.  See Port.SetReadTimeout.
 	ReadTimeout uint32
+
+	// InterCharacterTimeout and MinimumReadSize let a Read gather more
+	// than what has arrived when it starts.  Once it has the first
+	// byte, Read goes on reading until it holds MinimumReadSize bytes,
+	// or until b is full if that is zero, or the line has been idle for
+	// InterCharacterTimeout.  That is what VMIN and VTIME do, but timed
+	// as finely as the driver times reads, which on Linux and Windows
+	// is well under VTIME's tenth of a second: a Modbus RTU frame ends
+	// after 3.5 character times, or 1750µs above 19200 baud.  With only
+	// MinimumReadSize set, ReadTimeout bounds each gap instead.  They
+	// cannot be combined with PosixTimeouts.
+	InterCharacterTimeout time.Duration
+	MinimumReadSize       int
+
+	// OpenTimeout, if not zero, bounds how long OpenPort may take.
+	// Some Bluetooth virtual COM ports block in CreateFile for many
+	// seconds while they connect, and a network port may not answer.
+	// The open is then abandoned with ErrOpenTimeout; if it completes
+	// later, the port is closed at once.
+	OpenTimeout time.Duration
+
+	// WriteTimeout, if not zero, bounds how long a Write may block,
+	// such as while flow control holds the line.  See
+	// Port.SetWriteTimeout.  It cannot be combined with PosixTimeouts,
+	// nor on Windows, where it sets WriteTotalTimeoutConstant, with
+	// WindowsTimeouts.
+	WriteTimeout time.Duration
+
+	// ReadBufferSize, if not zero, gives the Port a read buffer of that
+	// many bytes, for Peek, Discard and ReadByte.  Read is then served
+	// from the buffer first, so a port can be peeked at and read
+	// directly without losing bytes.  Zero leaves the port unbuffered.
+	ReadBufferSize int
+
+	// PurgeOnOpen discards the input already queued when the port is
+	// opened, such as boot messages or the partial frames a previous
+	// program left, and PurgeOutputOnOpen the output not yet sent.  The
+	// purge comes after the line settings, so that nothing received
+	// under the old ones survives it, and before OpenPort returns.  It
+	// cannot tell stale bytes from fresh: whatever the device sends in
+	// the moment before the purge, for instance in answer to DTR rising
+	// on open, is discarded too, so a device that speaks first has to
+	// be asked again.
+	PurgeOnOpen       bool
+	PurgeOutputOnOpen bool
+
+	// CloseMode says what Close does with output not yet sent, and
+	// DrainTimeout how long CloseDrain waits for it.  Zero means five
+	// seconds, which takes about 4800 bytes at 9600 baud, fewer when
+	// flow control holds the line.
+	CloseMode    CloseMode
+	DrainTimeout time.Duration
+
+	// LowLatency asks the driver to pass received bytes on at once
+	// rather than in timed bursts, setting ASYNC_LOW_LATENCY on Linux
+	// for as long as the port is open.  Some drivers refuse it; the
+	// failure is then reported by Port.SetupWarnings and the port
+	// opens anyway.  Other platforms report ErrUnsupported there.
+	LowLatency bool
+
+	// LatencyTimer, if not zero, sets the latency timer of an FTDI USB
+	// adapter to this many milliseconds, from 1 to 255, as
+	// Port.SetLatencyTimer does.  A failure, on other devices
+	// ErrUnsupported, is reported by Port.SetupWarnings and the port
+	// opens anyway.
+	LatencyTimer int
+
+	// RawDevice makes OpenPort tolerate the line configuration failing,
+	// for virtual ports such as com0com pairs, serial redirectors and
+	// odd device nodes that reject GetCommState/SetCommState or termios
+	// calls but read and write fine.  The failures are kept for
+	// Port.SetupWarnings.  If the settings could not even be read,
+	// the methods that need them, such as SetBaud, and on POSIX
+	// SetReadTimeout, return ErrUnsupported.
+	RawDevice bool
+
+	// AllowNonTTY lets OpenPort open what is not a serial port at all,
+	// such as a FIFO, a regular file or /dev/null, instead of returning
+	// ErrNotSerialPort.  The port is then only read and written; the
+	// methods that need line settings return ErrUnsupported.  Config
+	// errors on a real serial port still fail the open.  RawDevice
+	// implies it.
+	AllowNonTTY bool
+
+	// Tracer, if not nil, is installed with Port.SetTracer before
+	// OpenPort sets the port up, so that it also sees the setup steps of
+	// the open, such as the flow control and the purge, after an "open"
+	// event with the port's name.  A NewHexTracer logs them all as hex
+	// dumps.
+	Tracer Tracer
+
+	// AdvancedSetup, if set, is called once the port has been
+	// configured and before OpenPort returns, to apply what Config does
+	// not cover: another termios flag, a DCB field, a vendor ioctl.  If
+	// it returns an error, the port is closed and OpenPort returns the
+	// error.  See SetupFunc for what it is passed on each platform.  It
+	// must not close what it is given, and later calls that change the
+	// settings, such as SetBaud, may undo its changes.  Network ports
+	// return ErrUnsupported.
+	AdvancedSetup SetupFunc
+
+	// WindowsTimeouts, if not nil, is used as the port's COMMTIMEOUTS
+	// on Windows instead of the values derived from ReadTimeout.  It is
+	// ignored on other platforms.
+	WindowsTimeouts *WindowsTimeouts
+
+	// WindowsInputQueue and WindowsOutputQueue are the sizes in bytes
+	// asked of the Windows driver for its receive and transmit queues,
+	// with SetupComm.  Zero leaves the driver's default, often 4 KiB,
+	// which a 3 Mbaud adapter overruns in a garbage collection pause;
+	// 64 KiB rides that out.  The driver may round them or ignore them.
+	// They are ignored on other platforms.
+	WindowsInputQueue, WindowsOutputQueue int
+
+	// PosixTimeouts, if not nil, sets VMIN and VTIME directly on POSIX.
+	// It cannot be combined with ReadTimeout.  On Windows OpenPort
+	// returns ErrUnsupported.
+	PosixTimeouts *PosixTimeouts
+}
+
+// PosixTimeouts holds the termios VMIN and VTIME values, for reads that
+// ReadTimeout cannot express, such as returning once a whole frame has
+// arrived.  VTIME counts tenths of a second.  A Read returns:
+//
+//	VMIN = 0, VTIME = 0:
+//		at once, with whatever has been received.
+//	VMIN > 0, VTIME = 0:
+//		once VMIN bytes have been received.
+//	VMIN = 0, VTIME > 0:
+//		as soon as any data is there, or after VTIME.
+//	VMIN > 0, VTIME > 0:
+//		once VMIN bytes have been received, or the line has been
+//		idle for VTIME after the first byte; it waits as long as it
+//		takes for that first byte.
+//
+// A Read never returns more than its buffer holds, however large VMIN
+// is, and one that gets no data returns ErrTimeout.  VMIN and VTIME
+// only act on a blocking descriptor, so on such a port Close does not
+// interrupt a Read in progress.  Port.SetReadTimeout replaces them.
+type PosixTimeouts struct {
+	VMIN, VTIME uint8
+}
+
+// WindowsTimeouts mirrors the Windows COMMTIMEOUTS structure, for
+// tuning beyond what ReadTimeout can express; see the Windows
+// documentation of COMMTIMEOUTS for the exact semantics.  All values
+// are in milliseconds.  Two combinations use MaxDWORD:
+//
+//	ReadIntervalTimeout = MaxDWORD, both read totals 0:
+//		Read returns at once with whatever has been received.
+//	ReadIntervalTimeout = ReadTotalTimeoutMultiplier = MaxDWORD,
+//	0 < ReadTotalTimeoutConstant < MaxDWORD:
+//		Read returns as soon as any data is there, or after
+//		ReadTotalTimeoutConstant.
+//
+// Other uses of MaxDWORD in the read fields are rejected.  A Read that
+// gets no data returns ErrTimeout, and a Write cut short by the write
+// timeouts returns the count written with ErrTimeout.
+//
+// Port.SetReadTimeout replaces the read fields and leaves the write
+// fields as set here.
+type WindowsTimeouts struct {
+	ReadIntervalTimeout         uint32
+	ReadTotalTimeoutMultiplier  uint32
+	ReadTotalTimeoutConstant    uint32
+	WriteTotalTimeoutMultiplier uint32
+	WriteTotalTimeoutConstant   uint32
+}
+
+// MaxDWORD is the special value of the WindowsTimeouts fields.
+const MaxDWORD = 1<<32 - 1
+
+func (t *WindowsTimeouts) check() error {
+	ok := true
+	switch {
+	case t.ReadIntervalTimeout == MaxDWORD:
+		ok = t.ReadTotalTimeoutMultiplier == 0 && t.ReadTotalTimeoutConstant == 0 ||
+			t.ReadTotalTimeoutMultiplier == MaxDWORD &&
+				t.ReadTotalTimeoutConstant > 0 && t.ReadTotalTimeoutConstant < MaxDWORD
+	case t.ReadTotalTimeoutMultiplier == MaxDWORD:
+		ok = false
+	}
+	if !ok {
+		return &ConfigError{Field: "WindowsTimeouts", Value: *t, Err: errors.New("unsupported use of MaxDWORD")}
+	}
+	return nil
 }
 
 func (c *Config) check() error {
+	if c.Baud < 0 {
+		return &ConfigError{Field: "Baud", Value: c.Baud, Err: ErrBadBaudRate}
+	}
+
 	switch c.Size {
 	case Byte5, Byte6, Byte7, Byte8:
 	default:
-		return ErrConfigByteSize
+		return &ConfigError{Field: "Size", Value: c.Size, Err: ErrConfigByteSize}
 	}
 
 	switch c.StopBits {
-	case StopBits1, StopBits2:
+	case StopBits1, StopBits2, StopBits1Half:
 	default:
-		return ErrConfigParity
+		return &ConfigError{Field: "StopBits", Value: c.StopBits, Err: ErrConfigStopBits}
 	}
 
 	switch c.Parity {
-	case ParityNone, ParityEven, ParityOdd:
+	case ParityNone, ParityEven, ParityOdd, ParityMark, ParitySpace:
 	default:
-		return ErrConfigParity
+		return &ConfigError{Field: "Parity", Value: c.Parity, Err: ErrConfigParity}
+	}
+
+	for _, l := range []struct {
+		field string
+		state LineState
+	}{{"InitialDTR", c.InitialDTR}, {"InitialRTS", c.InitialRTS}} {
+		switch l.state {
+		case LineDefault, LineHigh, LineLow, LineUnchanged:
+		default:
+			return &ConfigError{Field: l.field, Value: l.state, Err: ErrConfigLineState}
+		}
+	}
+
+	if c.WindowsTimeouts != nil {
+		if err := c.WindowsTimeouts.check(); err != nil {
+			return err
+		}
+	}
+
+	if c.WriteTimeout < 0 {
+		return &ConfigError{Field: "WriteTimeout", Value: c.WriteTimeout, Err: errors.New("negative")}
+	}
+	if c.WriteTimeout != 0 && c.WindowsTimeouts != nil {
+		return &ConfigError{Field: "WriteTimeout", Value: c.WriteTimeout, Err: errors.New("cannot be combined with WindowsTimeouts")}
+	}
+	if c.WriteTimeout != 0 && c.PosixTimeouts != nil {
+		return &ConfigError{Field: "WriteTimeout", Value: c.WriteTimeout, Err: errors.New("cannot be combined with PosixTimeouts")}
+	}
+
+	if c.CloseMode < CloseDefault || c.CloseMode > CloseDiscard {
+		return &ConfigError{Field: "CloseMode", Value: c.CloseMode, Err: errors.New("unknown mode")}
+	}
+
+	if c.ReadBufferSize < 0 {
+		return &ConfigError{Field: "ReadBufferSize", Value: c.ReadBufferSize, Err: errors.New("negative")}
+	}
+	if c.LatencyTimer < 0 || c.LatencyTimer > 255 {
+		return &ConfigError{Field: "LatencyTimer", Value: c.LatencyTimer, Err: errors.New("must be from 1 to 255 ms")}
+	}
+	if c.WindowsInputQueue < 0 {
+		return &ConfigError{Field: "WindowsInputQueue", Value: c.WindowsInputQueue, Err: errors.New("negative")}
+	}
+	if c.WindowsOutputQueue < 0 {
+		return &ConfigError{Field: "WindowsOutputQueue", Value: c.WindowsOutputQueue, Err: errors.New("negative")}
+	}
+
+	if c.RS485 != nil {
+		if c.RTSFlowControl {
+			return &ConfigError{Field: "RS485", Value: true, Err: errors.New("cannot be combined with RTSFlowControl")}
+		}
+		if err := c.RS485.check(); err != nil {
+			return err
+		}
+	}
+
+	if c.RTSFlowControl && c.XONFlowControl {
+		return &ConfigError{Field: "XONFlowControl", Value: true, Err: errors.New("cannot be combined with RTSFlowControl")}
+	}
+
+	if xon, xoff := c.xonChars(); xon == xoff {
+		return &ConfigError{Field: "XOFFChar", Value: xoff, Err: errors.New("same as XONChar")}
+	}
+
+	if c.PosixTimeouts != nil && c.ReadTimeout != 0 {
+		return &ConfigError{Field: "PosixTimeouts", Value: *c.PosixTimeouts, Err: errors.New("cannot be combined with ReadTimeout")}
+	}
+
+	if c.InterCharacterTimeout < 0 {
+		return &ConfigError{Field: "InterCharacterTimeout", Value: c.InterCharacterTimeout, Err: errors.New("negative")}
+	}
+	if c.MinimumReadSize < 0 {
+		return &ConfigError{Field: "MinimumReadSize", Value: c.MinimumReadSize, Err: errors.New("negative")}
+	}
+	if c.PosixTimeouts != nil && (c.InterCharacterTimeout != 0 || c.MinimumReadSize != 0) {
+		return &ConfigError{Field: "PosixTimeouts", Value: *c.PosixTimeouts, Err: errors.New("cannot be combined with InterCharacterTimeout or MinimumReadSize")}
 	}
 
 	return nil
 }
 
+// checkOpen is check for a Config that names a port to open.
+func (c *Config) checkOpen() error {
+	if c.Name == "" {
+		return &ConfigError{Field: "Name", Value: `""`, Err: errors.New("no port named")}
+	}
+	return c.check()
+}
+
+// The default software flow control characters.
+const (
+	xonDefault  = 0x11 // DC1
+	xoffDefault = 0x13 // DC3
+)
+
+// flowControl returns the flow control c selects.
+func (c *Config) flowControl() FlowControl {
+	switch {
+	case c.RTSFlowControl:
+		return FlowRTSCTS
+	case c.XONFlowControl:
+		return FlowXONXOFF
+	}
+	return FlowNone
+}
+
+// xonChars returns the software flow control characters c selects.
+func (c *Config) xonChars() (xon, xoff byte) {
+	xon, xoff = c.XONChar, c.XOFFChar
+	if xon == 0 {
+		xon = xonDefault
+	}
+	if xoff == 0 {
+		xoff = xoffDefault
+	}
+	return xon, xoff
+}
+
+// advancedSetter is implemented by drivers that can run
+// Config.AdvancedSetup.
+type advancedSetter interface {
+	advancedSetup(f SetupFunc) error
+}
+
+// driver is the platform specific part of a Port.
+type driver interface {
+	io.ReadWriteCloser
+
+	setBaud(baud int) error
+	setReadTimeout(d time.Duration) error
+
+	setDTR(on bool) error
+	setRTS(on bool) error
+	// outputLines reports whether DTR and RTS are currently asserted.
+	outputLines() (dtr, rts bool, err error)
+	// flush discards the untransmitted output and/or unread input.
+	flush(in, out bool) error
+
+	// getConfig reads the line settings back from the driver into c.
+	getConfig(c *Config) error
+	// restore puts back the settings the port had before it was opened.
+	restore() error
+}
+
+// Port is an open serial port, as returned by OpenPort.  It is an
+// io.ReadWriteCloser, with the methods beyond those for the rest.
+type Port struct {
+	stats portStats // first, for alignment
+
+	d    driver
+	name string // as opened, for Addr
+
+	cl   sync.Mutex  // serializes changes to the modem control lines
+	flow FlowControl // as last set, guarded by cl
+
+	// Whether SuspendOutput and SuspendInput are in force, guarded by
+	// cl.
+	outSuspended, inSuspended bool
+
+	tl           sync.Mutex
+	readTimeout  time.Duration // as last set, for helpers that change it
+	writeTimeout time.Duration // as last set, for WriteTimeoutError
+
+	// Config.InterCharacterTimeout and MinimumReadSize, see readGather.
+	interChar time.Duration
+	minRead   int
+
+	// The deadlines for drivers that do not keep their own, see
+	// SetReadDeadline; guarded by tl.
+	rdeadline, wdeadline time.Time
+
+	// The read buffer, if Config.ReadBufferSize asked for one; the
+	// bytes not yet read are rbuf[rpos:rend], and rstamps says when
+	// they arrived.  rr is held by the reads that use the buffer,
+	// across their driver reads, and rl, only ever briefly, guards the
+	// indices; rreset is when the input was last reset, so that what a
+	// driver read under way then returned before it is dropped too.
+	rr         sync.Mutex
+	rl         sync.Mutex
+	rbuf       []byte
+	rpos, rend int
+	rstamps    []readStamp
+	rreset     time.Time
+
+	// The driver's line error totals as last added to stats, see
+	// addLineCounts, and whether they were read yet; guarded by ll.
+	ll         sync.Mutex
+	counts     lineCounts
+	countsSeen bool
+
+	trace   atomic.Value // tracerBox
+	onBreak atomic.Value // breakHandler
+
+	warnings []error // setup problems found by OpenPort itself
+
+	// The RS-485 settings when the port switches RTS itself, and the
+	// lock that keeps each Write inside its RTS pulse.
+	rs485 *RS485
+	sl    sync.Mutex
+
+	closeMode    CloseMode
+	drainTimeout time.Duration
+
+	// Write coalescing, see SetWriteCoalescing.  coalescing and
+	// flushOnRead are set atomically, so that Write and Read need not
+	// take wl when they are off.
+	coalescing  int32
+	flushOnRead int32
+	wl          sync.Mutex
+	wbuf        []byte // the collected writes; its capacity is maxBytes
+	wdelay      time.Duration
+	wtimer      *time.Timer
+	werr        error // from sending wbuf in the background
+
+	// Write pacing, see SetWritePacing; pacing is set atomically and
+	// the rest is guarded by pl, which a paced Write holds throughout.
+	pacing       int32
+	pl           sync.Mutex
+	paceChunk    int
+	paceInterval time.Duration
+	paceNext     time.Time // when the next piece may start
+
+	// The watchdog set by SetIdleTimeout, guarded by il.
+	il   sync.Mutex
+	idle *idleWatch
+}
+
 // OpenPort opens a serial port with the specified configuration
-func OpenPort(c *Config) (io.ReadWriteCloser, error) {
-	if err := c.check(); err != nil {
+func OpenPort(c *Config) (*Port, error) {
+	return OpenPortContext(context.Background(), c)
+}
+
+// OpenPortContext is OpenPort, giving up with ctx's error once ctx is
+// done.  As with Config.OpenTimeout, which it can be combined with, an
+// open that cannot be interrupted, such as CreateFile on a COM port
+// another process holds, is abandoned and the port closed if it opens
+// later.  Once the port is open ctx has no more effect.
+func OpenPortContext(ctx context.Context, c *Config) (*Port, error) {
+	if err := c.checkOpen(); err != nil {
+		return nil, err
+	}
+
+	d, err := openDriver(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return wrapDriver(d, c)
+}
+
+// wrapDriver wraps the driver d, opened for c, in a Port and applies the
+// settings that go through the Port rather than the driver's open.  d
+// is closed if that fails.
+func wrapDriver(d driver, c *Config) (*Port, error) {
+	p := &Port{
+		d:            d,
+		name:         c.Name,
+		readTimeout:  time.Duration(c.ReadTimeout) * time.Millisecond,
+		interChar:    c.InterCharacterTimeout,
+		minRead:      c.MinimumReadSize,
+		closeMode:    c.CloseMode,
+		drainTimeout: c.DrainTimeout,
+	}
+	if c.ReadBufferSize > 0 {
+		p.rbuf = make([]byte, c.ReadBufferSize)
+	}
+	if c.Tracer != nil {
+		p.SetTracer(c.Tracer)
+		p.traceControl("open", nil, c.Name)
+	}
+	if r, ok := d.(lineErrorReporter); ok {
+		r.reportLineErrors(p.lineErrors)
+	}
+	p.addLineCounts()
+	if c.LowLatency {
+		p.setLowLatency()
+	}
+	if c.LatencyTimer != 0 {
+		p.setLatencyTimerOnOpen(c.LatencyTimer)
+	}
+	if c.WriteTimeout > 0 {
+		if err := p.SetWriteTimeout(c.WriteTimeout); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	if f := c.flowControl(); f != FlowNone {
+		if err := p.SetFlowControl(f); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	if c.RS485 != nil {
+		if err := p.setRS485(c.RS485); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	if c.AdvancedSetup != nil {
+		err := error(&ConfigError{Field: "AdvancedSetup", Value: "set", Err: ErrUnsupported})
+		if s, ok := d.(advancedSetter); ok {
+			err = s.advancedSetup(c.AdvancedSetup)
+		}
+		if err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	if c.PurgeOnOpen || c.PurgeOutputOnOpen {
+		if err := p.flush(c.PurgeOnOpen, c.PurgeOutputOnOpen); err != nil {
+			d.Close()
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// openDriver opens the port named by c, giving up after c.OpenTimeout
+// or when ctx is done.
+func openDriver(ctx context.Context, c *Config) (driver, error) {
+	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
+	var timeout <-chan time.Time
+	if c.OpenTimeout > 0 {
+		t := time.NewTimer(c.OpenTimeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	if timeout == nil && ctx.Done() == nil {
+		return openName(c)
+	}
+	type result struct {
+		d   driver
+		err error
+	}
+	done := make(chan result, 1)
+	cc := *c
+	go func() {
+		d, err := openName(&cc)
+		done <- result{d, err}
+	}()
+	abandon := func() {
+		go func() {
+			if r := <-done; r.err == nil {
+				r.d.Close()
+			}
+		}()
+	}
+	select {
+	case r := <-done:
+		return r.d, r.err
+	case <-timeout:
+		abandon()
+		return nil, ErrOpenTimeout
+	case <-ctx.Done():
+		abandon()
+		return nil, ctx.Err()
+	}
+}
 
+// openName opens the port named by c, which may be a local device, a
+// network port such as "rfc2217://host:port" or "tcp://host:port", or
+// a port of a Driver registered for its scheme.
+func openName(c *Config) (driver, error) {
+	switch {
+	case strings.HasPrefix(c.Name, "rfc2217://"):
+		return openRFC2217(strings.TrimPrefix(c.Name, "rfc2217://"), c)
+	case strings.HasPrefix(c.Name, "tcp://"):
+		return openTCP(strings.TrimPrefix(c.Name, "tcp://"), c)
+	}
+	if open, name, ok := registeredDriver(c.Name); ok {
+		return openDriverFunc(open, name, c)
+	}
 	return openPort(c.Name, c)
 }
 
-// func Flush()
+// Read reads from the device, or from the read buffer first if the port
+// has one.  A buffered port reads a buffer's worth from the device at a
+// time, except into a buffer at least as large.
+func (p *Port) Read(b []byte) (int, error) {
+	if p.interChar > 0 || p.minRead > 0 {
+		return p.readGather(b)
+	}
+	return p.readOnce(b)
+}
+
+// readOnce is Read without InterCharacterTimeout and MinimumReadSize.
+func (p *Port) readOnce(b []byte) (int, error) {
+	if p.rbuf == nil {
+		return p.read(b)
+	}
+	p.rr.Lock()
+	defer p.rr.Unlock()
+	var err error
+	if p.Buffered() == 0 {
+		if len(b) >= len(p.rbuf) {
+			return p.read(b)
+		}
+		err = p.fill()
+	}
+	p.rl.Lock()
+	defer p.rl.Unlock()
+	n := copy(b, p.rbuf[p.rpos:p.rend])
+	p.consume(n)
+	if n > 0 {
+		return n, nil
+	}
+	return 0, err
+}
+
+func (p *Port) Write(b []byte) (int, error) {
+	if atomic.LoadInt32(&p.coalescing) != 0 {
+		return p.coalesce(b)
+	}
+	return p.write(b)
+}
+
+// write writes to the driver, paced if SetWritePacing asks for it.
+func (p *Port) write(b []byte) (int, error) {
+	if atomic.LoadInt32(&p.pacing) != 0 {
+		return p.pacedWrite(b)
+	}
+	return p.writeNow(b)
+}
+
+// writeNow writes to the driver, counting and tracing what it takes.
+func (p *Port) writeNow(b []byte) (int, error) {
+	var n int
+	var err error
+	if p.rs485 != nil {
+		n, err = p.rs485Write(b)
+	} else {
+		n, err = p.writeDriver(b)
+	}
+	p.stats.wrote(n, err)
+	if err == ErrTimeout {
+		err = p.writeTimeoutError()
+	}
+	if t := p.tracer(); t != nil {
+		t.OnWrite(b[:n], n, err)
+	}
+	return n, err
+}
+
+// Close closes the port, first draining or discarding the output not
+// yet sent if Config.CloseMode asks for it.  A Read or Write waiting in
+// another goroutine returns ErrPortClosed: on POSIX the descriptor is
+// non-blocking and on the runtime poller, and on Windows the pending
+// I/O is cancelled with CancelIoEx.  The descriptor is not released for
+// reuse until such a call has returned.  Ports opened with
+// PosixTimeouts are the exception, see there.
+func (p *Port) Close() error {
+	return p.CloseWithMode(p.closeMode)
+}
+
+// SetBaud changes the baud rate of the open port.
+func (p *Port) SetBaud(baud int) error {
+	p.flushWrites()
+	err := p.d.setBaud(baud)
+	p.traceControl("baud", err, baud)
+	return err
+}
+
+// SetReadTimeout sets how long Read waits for data before returning
+// ErrTimeout; zero makes Read block until at least one byte arrives.
+// The timeout applies to the wait for the first byte of each Read.
+//
+// On POSIX a tty times reads out with a deadline on the runtime poller,
+// to well within a millisecond.  A port opened with PosixTimeouts, or a
+// descriptor the poller cannot take, which only Config.RawDevice lets
+// through, falls back to VTIME, which rounds the timeout up to a
+// multiple of 100 ms and caps it at 25.5 s.
+func (p *Port) SetReadTimeout(d time.Duration) error {
+	p.tl.Lock()
+	defer p.tl.Unlock()
+	err := p.d.setReadTimeout(d)
+	p.traceControl("read timeout", err, d)
+	if err != nil {
+		return err
+	}
+	p.readTimeout = d
+	return nil
+}
+
+// ReadTimeout returns the read timeout last set on the port.
+func (p *Port) ReadTimeout() time.Duration {
+	p.tl.Lock()
+	defer p.tl.Unlock()
+	return p.readTimeout
+}
 
-// func SendBreak()
+// SetTimeouts sets the read timeout in milliseconds, as Config.ReadTimeout
+// does when the port is opened.
+func (p *Port) SetTimeouts(msec uint32) {
+	p.SetReadTimeout(time.Duration(msec) * time.Millisecond)
+}
 
-// func RegisterBreakHandler(func())
+// SetDTR asserts (on is true) or deasserts DTR.
+func (p *Port) SetDTR(on bool) error {
+	p.cl.Lock()
+	defer p.cl.Unlock()
+	return p.setDTR(on)
+}
+
+// SetRTS asserts (on is true) or deasserts RTS.  It returns
+// ErrRTSFlowControl while RTS/CTS flow control is on.
+func (p *Port) SetRTS(on bool) error {
+	p.cl.Lock()
+	defer p.cl.Unlock()
+	return p.setRTS(on)
+}
+
+// Flush discards both the input received and not yet read and the
+// output written and not yet sent: tcflush(TCIOFLUSH) on POSIX,
+// PurgeComm on Windows.  The read buffer and the writes collected by
+// SetWriteCoalescing go with them.  A tcp:// port can only discard what
+// has already arrived, and leaves its output alone.
+func (p *Port) Flush() error {
+	return p.flush(true, true)
+}
+
+// ResetInputBuffer discards the input received and not yet read, as
+// after a protocol error before resynchronizing.
+func (p *Port) ResetInputBuffer() error {
+	return p.flush(true, false)
+}
+
+// ResetOutputBuffer discards the output written and not yet sent.
+func (p *Port) ResetOutputBuffer() error {
+	return p.flush(false, true)
+}
@@ -0,0 +1,355 @@
+// +build freebsd openbsd netbsd darwin dragonfly
+
+package goserial
+
+import (
+	"os"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// The BSDs keep the baud rate as a plain number in c_ispeed and
+// c_ospeed, so any rate the driver accepts can be set; there is no
+// table of Bnnn constants as on Linux.  macOS keeps it the same way,
+// but its tcsetattr only takes the rates of the B constants, and the
+// others are set with IOSSIOSPEED: see speed_darwin.go.
+
+// Not exported by the syscall package on the BSDs and macOS.
+const (
+	fionread = 0x4004667f // _IOR('f', 127, int)
+	fread    = 0x1        // TIOCFLUSH selectors
+	fwrite   = 0x2
+)
+
+// The BSDs and macOS have no CMSPAR, so no mark or space parity.
+const cmspar = 0
+
+type termios = syscall.Termios
+
+func openPort(name string, c *Config) (d driver, err error) {
+	// Open non-blocking so that a device waiting for carrier detect
+	// (a /dev/ttyu* or macOS /dev/tty.* dial-in node rather than the
+	// call-out /dev/cuau* or /dev/cu.*) cannot hang
+	// open(2).  The descriptor stays that way, for the runtime poller.
+	f, err := os.OpenFile(name, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0666)
+	if err != nil {
+		return nil, openError(err)
+	}
+	return openFile(f, c)
+}
+
+// openFile sets up f, a port opened with O_NONBLOCK, as c says.  f is
+// closed if that fails.
+func openFile(f *os.File, c *Config) (d driver, err error) {
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+
+	if c.Baud <= 0 && !c.RawDevice {
+		return nil, &ConfigError{Field: "Baud", Value: c.Baud, Err: ErrBadBaudRate}
+	}
+
+	p, err := newSerialPort(f)
+	if err != nil {
+		return nil, err
+	}
+	if c.Exclusive {
+		if err = p.lock(); err != nil {
+			return nil, err
+		}
+	}
+
+	var t syscall.Termios
+	err = p.checkCharDevice()
+	if err == nil {
+		err = p.ioctl(syscall.TIOCGETA, uintptr(unsafe.Pointer(&t)))
+		if err == syscall.ENOTTY {
+			err = ErrNotSerialPort
+		}
+	}
+	if err != nil {
+		if err = p.tolerate(c, "tcgetattr", err); err != nil {
+			return nil, err
+		}
+		p.noTermios = true
+		if p.polled {
+			p.setTimeout(time.Duration(c.ReadTimeout)*time.Millisecond, 1)
+		}
+		return p, nil
+	}
+	p.orig = t
+
+	// Select baud rate
+	if c.Baud > 0 {
+		p.setSpeed(&t, c.Baud)
+	} else {
+		p.warnings = append(p.warnings, &ConfigError{Field: "Baud", Value: c.Baud, Err: ErrBadBaudRate})
+	}
+
+	// Select local mode
+	t.Cflag |= syscall.CREAD
+	if c.MonitorDCD {
+		t.Cflag &^= syscall.CLOCAL
+	} else {
+		t.Cflag |= syscall.CLOCAL
+	}
+
+	// Select hangup on close
+	if c.KeepDTROnClose {
+		t.Cflag &^= syscall.HUPCL
+	}
+
+	// Select stop bits, character size and parity mode
+	if err = frameTermios(&t, c.Size, c.Parity, c.StopBits); err != nil {
+		return nil, err
+	}
+
+	// Select CRLF translation
+	if c.CRLFTranslate {
+		t.Iflag |= syscall.ICRNL
+	} else {
+		t.Iflag &^= syscall.ICRNL
+	}
+
+	// Select raw mode.  Software flow control and the other input
+	// processing would otherwise eat or rewrite some byte values.
+	t.Iflag &^= syscall.IXON | syscall.IXOFF | syscall.IXANY |
+		syscall.INLCR | syscall.IGNCR | syscall.ISTRIP
+
+	// Select the software flow control characters
+	xon, xoff := c.xonChars()
+	t.Cc[syscall.VSTART] = xon
+	t.Cc[syscall.VSTOP] = xoff
+	if c.XANY {
+		t.Iflag |= syscall.IXANY
+	}
+
+	// Select parity error marking
+	if c.MarkErrors {
+		t.Iflag |= syscall.INPCK | syscall.PARMRK
+		t.Iflag &^= syscall.IGNPAR | syscall.IGNBRK | syscall.BRKINT
+	}
+
+	t.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ECHOE | syscall.ISIG | syscall.IEXTEN
+	t.Oflag &^= syscall.OPOST
+	vmin, vtime := p.configCC(c)
+	t.Cc[syscall.VMIN] = vmin
+	t.Cc[syscall.VTIME] = vtime
+
+	// tcsetattr, not TIOCSETA alone, so that a rate without a B
+	// constant is set with IOSSIOSPEED as well.
+	err = p.tcsetattr(&t)
+	if err != nil {
+		p.customBaud = 0
+	}
+	if err = p.tolerate(c, "tcsetattr", err); err != nil {
+		return nil, err
+	}
+
+	if err = p.tolerate(c, "TIOCMSET", p.setInitialLines(c)); err != nil {
+		return nil, err
+	}
+
+	// With MonitorDCD set, a Read now waits for carrier detect.
+	p.setTimeout(time.Duration(c.ReadTimeout)*time.Millisecond, vmin)
+	return p, nil
+}
+
+// setSpeed puts baud into t.  A rate that needs setCustomSpeed is kept
+// in p.customBaud instead, for tcsetattr to set.
+func (p *serialPort) setSpeed(t *syscall.Termios, baud int) {
+	p.customBaud = 0
+	if customSpeed(baud) {
+		p.customBaud = baud
+		baud = 9600
+	}
+	t.Ispeed = speed(baud)
+	t.Ospeed = speed(baud)
+}
+
+// tcgetattr and tcsetattr return ErrUnsupported on a RawDevice port
+// whose termios settings could not be read when it was opened.
+func (p *serialPort) tcgetattr(t *syscall.Termios) error {
+	if p.noTermios {
+		return ErrUnsupported
+	}
+	return p.ioctl(syscall.TIOCGETA, uintptr(unsafe.Pointer(t)))
+}
+
+// A rate set with setCustomSpeed has to be set again after every
+// TIOCSETA, which puts back the placeholder speed in t.
+func (p *serialPort) tcsetattr(t *syscall.Termios) error {
+	if p.noTermios {
+		return ErrUnsupported
+	}
+	baud := p.customBaud
+	return p.control(func(fd uintptr) error {
+		if err := ioctl(fd, syscall.TIOCSETA, uintptr(unsafe.Pointer(t))); err != nil {
+			return err
+		}
+		if baud != 0 {
+			return setCustomSpeed(fd, baud)
+		}
+		return nil
+	})
+}
+
+func (p *serialPort) setBaud(baud int) error {
+	if baud <= 0 {
+		return &ConfigError{Field: "Baud", Value: baud, Err: ErrBadBaudRate}
+	}
+	var t syscall.Termios
+	if err := p.tcgetattr(&t); err != nil {
+		return err
+	}
+	prev := p.customBaud
+	p.setSpeed(&t, baud)
+	if err := p.tcsetattr(&t); err != nil {
+		p.customBaud = prev
+		return err
+	}
+	return nil
+}
+
+// setReadTimeout only changes VMIN and VTIME on a port that is not
+// polled.
+func (p *serialPort) setReadTimeout(d time.Duration) error {
+	vmin, vtime := p.readTimeoutCC(d)
+	if !p.polled {
+		var t syscall.Termios
+		if err := p.tcgetattr(&t); err != nil {
+			return err
+		}
+		t.Cc[syscall.VMIN] = vmin
+		t.Cc[syscall.VTIME] = vtime
+		if err := p.tcsetattr(&t); err != nil {
+			return err
+		}
+	}
+	p.setTimeout(d, vmin)
+	return nil
+}
+
+func (p *serialPort) setFlowControl(f FlowControl) error {
+	var t syscall.Termios
+	if err := p.tcgetattr(&t); err != nil {
+		return err
+	}
+	t.Iflag &^= syscall.IXON | syscall.IXOFF
+	t.Cflag &^= crtscts
+	switch f {
+	case FlowRTSCTS:
+		t.Cflag |= crtscts
+	case FlowXONXOFF:
+		t.Iflag |= syscall.IXON | syscall.IXOFF
+	}
+	return p.tcsetattr(&t)
+}
+
+func (p *serialPort) flush(in, out bool) error {
+	var what int32
+	if in {
+		what |= fread
+	}
+	if out {
+		what |= fwrite
+	}
+	if what == 0 {
+		return nil
+	}
+	return p.ioctl(syscall.TIOCFLUSH, uintptr(unsafe.Pointer(&what)))
+}
+
+func (p *serialPort) drain() error {
+	return p.ioctl(syscall.TIOCDRAIN, 0)
+}
+
+// tcflow does what the BSD libc's does: the ioctls TIOCSTOP and
+// TIOCSTART stop and start output, and input is suspended by sending
+// the VSTOP character and resumed by sending VSTART.
+func (p *serialPort) tcflow(a flowAction) error {
+	switch a {
+	case outputOff:
+		return p.ioctl(syscall.TIOCSTOP, 0)
+	case outputOn:
+		return p.ioctl(syscall.TIOCSTART, 0)
+	}
+	var t syscall.Termios
+	if err := p.tcgetattr(&t); err != nil {
+		return err
+	}
+	c := t.Cc[syscall.VSTART]
+	if a == inputOff {
+		c = t.Cc[syscall.VSTOP]
+	}
+	_, err := p.Write([]byte{c})
+	return err
+}
+
+func (p *serialPort) queued() (in, out int, err error) {
+	var n int32
+	if err := p.ioctl(fionread, uintptr(unsafe.Pointer(&n))); err != nil {
+		return 0, 0, err
+	}
+	in = int(n)
+	if err := p.ioctl(syscall.TIOCOUTQ, uintptr(unsafe.Pointer(&n))); err != nil {
+		return 0, 0, err
+	}
+	return in, int(n), nil
+}
+
+func (p *serialPort) getConfig(c *Config) error {
+	var t syscall.Termios
+	if err := p.tcgetattr(&t); err != nil {
+		return err
+	}
+
+	c.Baud = int(t.Ospeed)
+	if p.customBaud != 0 {
+		c.Baud = p.customBaud
+	}
+
+	switch t.Cflag & syscall.CSIZE {
+	case syscall.CS5:
+		c.Size = Byte5
+	case syscall.CS6:
+		c.Size = Byte6
+	case syscall.CS7:
+		c.Size = Byte7
+	default:
+		c.Size = Byte8
+	}
+
+	c.XONChar = t.Cc[syscall.VSTART]
+	c.XOFFChar = t.Cc[syscall.VSTOP]
+	c.XANY = t.Iflag&syscall.IXANY != 0
+	c.MarkErrors = t.Iflag&syscall.PARMRK != 0
+	c.RTSFlowControl = t.Cflag&crtscts != 0
+	c.XONFlowControl = t.Iflag&syscall.IXON != 0
+	c.MonitorDCD = t.Cflag&syscall.CLOCAL == 0
+	c.CRLFTranslate = t.Iflag&syscall.ICRNL != 0
+
+	c.StopBits = StopBits1
+	if t.Cflag&syscall.CSTOPB != 0 {
+		c.StopBits = StopBits2
+	}
+
+	switch {
+	case t.Cflag&syscall.PARENB == 0:
+		c.Parity = ParityNone
+	case t.Cflag&syscall.PARODD != 0:
+		c.Parity = ParityOdd
+	default:
+		c.Parity = ParityEven
+	}
+	return nil
+}
+
+func (p *serialPort) restore() error {
+	t := p.orig
+	p.customBaud = 0
+	return p.tcsetattr(&t)
+}
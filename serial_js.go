@@ -0,0 +1,499 @@
+// +build js,wasm
+
+package goserial
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall/js"
+	"time"
+)
+
+// In the browser, ports go through the Web Serial API.  A page only
+// sees the ports the user has granted it, with RequestPort or on an
+// earlier visit, and they are named "webserial:0", "webserial:1" and so
+// on, in the order navigator.serial.getPorts returns them.
+//
+// Every call waits for a JavaScript promise, which settles only while
+// the browser's event loop runs, so none of them may be made straight
+// from a js.Func callback: start a goroutine there instead.
+
+// webSerialPrefix starts the names of Web Serial ports.
+const webSerialPrefix = "webserial:"
+
+// webSerialBuffer bounds the input held between Reads; beyond it the
+// port stops reading, and the browser's own buffer fills.
+const webSerialBuffer = 64 << 10
+
+// SetupFunc is the type of Config.AdvancedSetup.  In the browser it is
+// passed the open SerialPort object.
+type SetupFunc func(port js.Value) error
+
+// RequestPort shows the browser's port chooser and returns the name of
+// the port the user picks, for Config.Name.  The browser only shows the
+// chooser in response to a user gesture, so call it from a goroutine
+// started by a click handler.  Outside the browser it returns
+// ErrUnsupported.
+func RequestPort() (string, error) {
+	serial, err := webSerial()
+	if err != nil {
+		return "", err
+	}
+	port, err := await(serial.Call("requestPort"))
+	if err != nil {
+		return "", err
+	}
+	ports, err := grantedPorts()
+	if err != nil {
+		return "", err
+	}
+	for i, p := range ports {
+		if p.Equal(port) {
+			return webSerialPrefix + strconv.Itoa(i), nil
+		}
+	}
+	return "", errors.New("goserial: requested port not granted")
+}
+
+// webSerial returns navigator.serial, or ErrUnsupported in a browser
+// without it.
+func webSerial() (js.Value, error) {
+	nav := js.Global().Get("navigator")
+	if !nav.Truthy() || !nav.Get("serial").Truthy() {
+		return js.Value{}, ErrUnsupported
+	}
+	return nav.Get("serial"), nil
+}
+
+// grantedPorts returns the SerialPort objects the page may open.
+func grantedPorts() ([]js.Value, error) {
+	serial, err := webSerial()
+	if err != nil {
+		return nil, err
+	}
+	list, err := await(serial.Call("getPorts"))
+	if err != nil {
+		return nil, err
+	}
+	ports := make([]js.Value, list.Length())
+	for i := range ports {
+		ports[i] = list.Index(i)
+	}
+	return ports, nil
+}
+
+// await waits for promise to settle and returns its value, or the
+// value it was rejected with as a js.Error.
+func await(promise js.Value) (js.Value, error) {
+	type result struct {
+		v   js.Value
+		err error
+	}
+	done := make(chan result, 1)
+	arg := func(args []js.Value) js.Value {
+		if len(args) == 0 {
+			return js.Undefined()
+		}
+		return args[0]
+	}
+	then := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		done <- result{v: arg(args)}
+		return nil
+	})
+	defer then.Release()
+	catch := js.FuncOf(func(this js.Value, args []js.Value) interface{} {
+		done <- result{err: js.Error{Value: arg(args)}}
+		return nil
+	})
+	defer catch.Release()
+	promise.Call("then", then, catch)
+	r := <-done
+	return r.v, r.err
+}
+
+func listPorts() ([]string, error) {
+	ports, err := grantedPorts()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(ports))
+	for i := range ports {
+		names[i] = webSerialPrefix + strconv.Itoa(i)
+	}
+	return names, nil
+}
+
+// enumeratePorts fills in the USB IDs SerialPort.getInfo reports; the
+// browser gives no serial number or names.
+func enumeratePorts() ([]PortInfo, error) {
+	ports, err := grantedPorts()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]PortInfo, len(ports))
+	for i, port := range ports {
+		infos[i].Name = webSerialPrefix + strconv.Itoa(i)
+		info := port.Call("getInfo")
+		if vid := info.Get("usbVendorId"); vid.Type() == js.TypeNumber {
+			infos[i].IsUSB = true
+			infos[i].VID = uint16(vid.Int())
+			if pid := info.Get("usbProductId"); pid.Type() == js.TypeNumber {
+				infos[i].PID = uint16(pid.Int())
+			}
+		}
+	}
+	return infos, nil
+}
+
+// webSerialPort is a port opened through the Web Serial API.  A
+// goroutine reads the port's ReadableStream into buf for Read.
+//
+// The line settings are fixed when a SerialPort is opened, so SetBaud
+// and SetFraming return ErrUnsupported and SetFlowControl only takes
+// the flow control the port was opened with: close the port and open
+// it again to change them.  Web Serial has no software flow control,
+// 5- or 6-bit characters, mark or space parity, or 1.5 stop bits.
+type webSerialPort struct {
+	port           js.Value
+	reader, writer js.Value
+	config         Config // as opened, for getConfig
+	flow           FlowControl
+
+	mu       sync.Mutex
+	buf      []byte
+	err      error         // why reading stopped, once buf is drained
+	wake     chan struct{} // closed and replaced when buf or err change
+	timeout  time.Duration
+	dtr, rts bool // as last set; Web Serial cannot read them back
+	closed   bool
+}
+
+func openPort(name string, c *Config) (driver, error) {
+	if !strings.HasPrefix(name, webSerialPrefix) {
+		return nil, fmt.Errorf("goserial: %q is not a Web Serial port name", name)
+	}
+	i, err := strconv.Atoi(strings.TrimPrefix(name, webSerialPrefix))
+	if err != nil {
+		return nil, fmt.Errorf("goserial: %q is not a Web Serial port name", name)
+	}
+	if c.Baud <= 0 {
+		return nil, &ConfigError{Field: "Baud", Value: c.Baud, Err: ErrBadBaudRate}
+	}
+	opts, err := webSerialOptions(c)
+	if err != nil {
+		return nil, err
+	}
+	ports, err := grantedPorts()
+	if err != nil {
+		return nil, err
+	}
+	if i < 0 || i >= len(ports) {
+		return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+
+	port := ports[i]
+	if _, err := await(port.Call("open", opts)); err != nil {
+		// SerialPort.open fails so when the port is open already, in
+		// this page or another.
+		if je, ok := err.(js.Error); ok && je.Get("name").String() == "InvalidStateError" {
+			return nil, ErrPortBusy
+		}
+		return nil, err
+	}
+	p := &webSerialPort{
+		port:    port,
+		reader:  port.Get("readable").Call("getReader"),
+		writer:  port.Get("writable").Call("getWriter"),
+		config:  *c,
+		flow:    c.flowControl(),
+		wake:    make(chan struct{}),
+		timeout: time.Duration(c.ReadTimeout) * time.Millisecond,
+		dtr:     true,
+		rts:     true,
+	}
+	if c.InitialDTR != LineDefault || c.InitialRTS != LineDefault {
+		signals := map[string]interface{}{}
+		if c.InitialDTR != LineDefault {
+			p.dtr = c.InitialDTR == LineHigh
+			signals["dataTerminalReady"] = p.dtr
+		}
+		if c.InitialRTS != LineDefault {
+			p.rts = c.InitialRTS == LineHigh
+			signals["requestToSend"] = p.rts
+		}
+		if _, err := await(port.Call("setSignals", signals)); err != nil {
+			p.Close()
+			return nil, err
+		}
+	}
+	go p.run()
+	return p, nil
+}
+
+// webSerialOptions turns c into the SerialOptions of SerialPort.open.
+func webSerialOptions(c *Config) (map[string]interface{}, error) {
+	opts := map[string]interface{}{"baudRate": c.Baud}
+	switch c.Size {
+	case Byte7:
+		opts["dataBits"] = 7
+	case Byte8:
+		opts["dataBits"] = 8
+	default:
+		return nil, &ConfigError{Field: "Size", Value: c.Size, Err: ErrUnsupported}
+	}
+	switch c.StopBits {
+	case StopBits1:
+		opts["stopBits"] = 1
+	case StopBits2:
+		opts["stopBits"] = 2
+	default:
+		return nil, &ConfigError{Field: "StopBits", Value: c.StopBits, Err: ErrUnsupported}
+	}
+	switch c.Parity {
+	case ParityNone:
+		opts["parity"] = "none"
+	case ParityEven:
+		opts["parity"] = "even"
+	case ParityOdd:
+		opts["parity"] = "odd"
+	default:
+		return nil, &ConfigError{Field: "Parity", Value: c.Parity, Err: ErrUnsupported}
+	}
+	switch c.flowControl() {
+	case FlowNone:
+		opts["flowControl"] = "none"
+	case FlowRTSCTS:
+		opts["flowControl"] = "hardware"
+	default:
+		return nil, &ConfigError{Field: "XONFlowControl", Value: true, Err: ErrUnsupported}
+	}
+	return opts, nil
+}
+
+// run reads the port's stream into p.buf until it ends, waiting while
+// p.buf is full.
+func (p *webSerialPort) run() {
+	for {
+		p.mu.Lock()
+		for len(p.buf) >= webSerialBuffer && !p.closed {
+			wake := p.wake
+			p.mu.Unlock()
+			<-wake
+			p.mu.Lock()
+		}
+		closed := p.closed
+		p.mu.Unlock()
+		if closed {
+			return
+		}
+
+		chunk, err := await(p.reader.Call("read"))
+		p.mu.Lock()
+		switch {
+		case err != nil:
+			// The stream fails once the device has gone, and only then.
+			p.stop(ErrPortDisconnected)
+		case chunk.Get("done").Bool():
+			p.stop(ErrPortClosed)
+		default:
+			v := chunk.Get("value")
+			b := make([]byte, v.Length())
+			js.CopyBytesToGo(b, v)
+			p.buf = append(p.buf, b...)
+			p.changed()
+		}
+		stopped := p.err != nil
+		p.mu.Unlock()
+		if stopped {
+			return
+		}
+	}
+}
+
+// changed wakes a Read waiting for data and run waiting for room.
+// p.mu must be held.
+func (p *webSerialPort) changed() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// stop ends reading with err.  p.mu must be held.
+func (p *webSerialPort) stop(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+	p.changed()
+}
+
+func (p *webSerialPort) Read(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var timeout <-chan time.Time
+	if p.timeout > 0 {
+		t := time.NewTimer(p.timeout)
+		defer t.Stop()
+		timeout = t.C
+	}
+	for len(p.buf) == 0 {
+		if p.err != nil {
+			return 0, p.err
+		}
+		wake := p.wake
+		p.mu.Unlock()
+		select {
+		case <-wake:
+			p.mu.Lock()
+		case <-timeout:
+			p.mu.Lock()
+			if len(p.buf) == 0 {
+				return 0, ErrTimeout
+			}
+		}
+	}
+	n := copy(b, p.buf)
+	p.buf = p.buf[n:]
+	if len(p.buf) == 0 {
+		p.buf = nil
+	}
+	p.changed()
+	return n, nil
+}
+
+// Write returns once the browser has taken the data; it does not wait
+// for the data to go out on the line.
+func (p *webSerialPort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	closed := p.closed
+	p.mu.Unlock()
+	if closed {
+		return 0, ErrPortClosed
+	}
+	a := js.Global().Get("Uint8Array").New(len(b))
+	js.CopyBytesToJS(a, b)
+	if _, err := await(p.writer.Call("write", a)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Close cancels the read in progress and closes the port, which gives
+// up the locks on its streams first.
+func (p *webSerialPort) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPortClosed
+	}
+	p.closed = true
+	p.stop(ErrPortClosed)
+	p.mu.Unlock()
+
+	await(p.reader.Call("cancel"))
+	p.reader.Call("releaseLock")
+	p.writer.Call("releaseLock")
+	_, err := await(p.port.Call("close"))
+	return err
+}
+
+func (p *webSerialPort) setBaud(baud int) error {
+	return ErrUnsupported
+}
+
+func (p *webSerialPort) setReadTimeout(d time.Duration) error {
+	p.mu.Lock()
+	p.timeout = d
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *webSerialPort) setFlowControl(f FlowControl) error {
+	if f != p.flow {
+		return ErrUnsupported
+	}
+	return nil
+}
+
+func (p *webSerialPort) setDTR(on bool) error {
+	return p.setSignal("dataTerminalReady", on, &p.dtr)
+}
+
+func (p *webSerialPort) setRTS(on bool) error {
+	return p.setSignal("requestToSend", on, &p.rts)
+}
+
+// setSignal sets one of the output lines with SerialPort.setSignals and
+// records it in *state.
+func (p *webSerialPort) setSignal(name string, on bool, state *bool) error {
+	if _, err := await(p.port.Call("setSignals", map[string]interface{}{name: on})); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	*state = on
+	p.mu.Unlock()
+	return nil
+}
+
+// outputLines reports the lines as last set: Web Serial asserts both
+// when it opens a port, and cannot read them back.
+func (p *webSerialPort) outputLines() (dtr, rts bool, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.dtr, p.rts, nil
+}
+
+func (p *webSerialPort) modemStatus() (ModemStatus, error) {
+	s, err := await(p.port.Call("getSignals"))
+	if err != nil {
+		return ModemStatus{}, err
+	}
+	return ModemStatus{
+		CTS: s.Get("clearToSend").Bool(),
+		DSR: s.Get("dataSetReady").Bool(),
+		RI:  s.Get("ringIndicator").Bool(),
+		DCD: s.Get("dataCarrierDetect").Bool(),
+	}, nil
+}
+
+// flush discards the input read from the stream and not yet returned.
+// Written data is the browser's once Write returns, so there is no
+// output to discard.
+func (p *webSerialPort) flush(in, out bool) error {
+	if in {
+		p.mu.Lock()
+		p.buf = nil
+		p.changed()
+		p.mu.Unlock()
+	}
+	return nil
+}
+
+func (p *webSerialPort) queued() (in, out int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.buf), 0, nil
+}
+
+// getConfig reports the settings the port was opened with.
+func (p *webSerialPort) getConfig(c *Config) error {
+	c.Baud = p.config.Baud
+	c.Size = p.config.Size
+	c.Parity = p.config.Parity
+	c.StopBits = p.config.StopBits
+	c.RTSFlowControl = p.flow == FlowRTSCTS
+	return nil
+}
+
+func (p *webSerialPort) restore() error {
+	return nil
+}
+
+func (p *webSerialPort) advancedSetup(f SetupFunc) error {
+	return f(p.port)
+}
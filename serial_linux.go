@@ -1,90 +1,471 @@
-// +build linux,!cgo
+// +build linux
 
-package serial
+package goserial
 
 import (
-	"io"
+	"context"
 	"os"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
-func openPort(name string, baud int) (rwc io.ReadWriteCloser, err error) {
-
-	var bauds = map[int]uint32{
-		50:      syscall.B50,
-		75:      syscall.B75,
-		110:     syscall.B110,
-		134:     syscall.B134,
-		150:     syscall.B150,
-		200:     syscall.B200,
-		300:     syscall.B300,
-		600:     syscall.B600,
-		1200:    syscall.B1200,
-		1800:    syscall.B1800,
-		2400:    syscall.B2400,
-		4800:    syscall.B4800,
-		9600:    syscall.B9600,
-		19200:   syscall.B19200,
-		38400:   syscall.B38400,
-		57600:   syscall.B57600,
-		115200:  syscall.B115200,
-		230400:  syscall.B230400,
-		460800:  syscall.B460800,
-		500000:  syscall.B500000,
-		576000:  syscall.B576000,
-		921600:  syscall.B921600,
-		1000000: syscall.B1000000,
-		1152000: syscall.B1152000,
-		1500000: syscall.B1500000,
-		2000000: syscall.B2000000,
-		2500000: syscall.B2500000,
-		3000000: syscall.B3000000,
-		3500000: syscall.B3500000,
-		4000000: syscall.B4000000,
-	}
+var bauds = map[int]uint32{
+	50:      syscall.B50,
+	75:      syscall.B75,
+	110:     syscall.B110,
+	134:     syscall.B134,
+	150:     syscall.B150,
+	200:     syscall.B200,
+	300:     syscall.B300,
+	600:     syscall.B600,
+	1200:    syscall.B1200,
+	1800:    syscall.B1800,
+	2400:    syscall.B2400,
+	4800:    syscall.B4800,
+	9600:    syscall.B9600,
+	19200:   syscall.B19200,
+	38400:   syscall.B38400,
+	57600:   syscall.B57600,
+	115200:  syscall.B115200,
+	230400:  syscall.B230400,
+	460800:  syscall.B460800,
+	500000:  syscall.B500000,
+	576000:  syscall.B576000,
+	921600:  syscall.B921600,
+	1000000: syscall.B1000000,
+	1152000: syscall.B1152000,
+	1500000: syscall.B1500000,
+	2000000: syscall.B2000000,
+	2500000: syscall.B2500000,
+	3000000: syscall.B3000000,
+	3500000: syscall.B3500000,
+	4000000: syscall.B4000000,
+}
 
-	rate := bauds[baud]
+type termios = syscall.Termios
 
-	if rate == 0 {
-		return
-	}
+// Not exported by the syscall package; the same on every architecture.
+const (
+	crtscts = 0x80000000
+	cmspar  = 0x40000000 // with PARENB, PARODD selects mark parity
+)
 
+func openPort(name string, c *Config) (d driver, err error) {
+	// Open non-blocking so that a device waiting for carrier detect
+	// (e.g. a modem port with CLOCAL clear) cannot hang open(2).  The
+	// descriptor stays that way, for the runtime poller.
 	f, err := os.OpenFile(name, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0666)
 	if err != nil {
-		return nil, err
+		return nil, openError(err)
 	}
+	return openFile(f, c)
+}
 
+// openFile sets up f, a port opened with O_NONBLOCK, as c says.  f is
+// closed if that fails.
+func openFile(f *os.File, c *Config) (d driver, err error) {
 	defer func() {
-		if err != nil && f != nil {
+		if err != nil {
 			f.Close()
 		}
 	}()
 
-	fd := f.Fd()
-	t := syscall.Termios{
-		Iflag:  syscall.IGNPAR,
-		Cflag:  syscall.CS8 | syscall.CREAD | syscall.CLOCAL | rate,
-		Cc:     [32]uint8{syscall.VMIN: 1},
-		Ispeed: rate,
-		Ospeed: rate,
+	rate := bauds[c.Baud]
+	if c.Baud <= 0 && !c.RawDevice {
+		return nil, &ConfigError{Field: "Baud", Value: c.Baud, Err: ErrBadBaudRate}
+	}
+
+	p, err := newSerialPort(f)
+	if err != nil {
+		return nil, err
+	}
+	if c.Exclusive {
+		if err = p.lock(); err != nil {
+			return nil, err
+		}
+	}
+
+	var t syscall.Termios
+	err = p.checkCharDevice()
+	if err == nil {
+		err = p.ioctl(syscall.TCGETS, uintptr(unsafe.Pointer(&t)))
+		if err == syscall.ENOTTY {
+			err = ErrNotSerialPort
+		}
+	}
+	if err != nil {
+		if err = p.tolerate(c, "tcgetattr", err); err != nil {
+			return nil, err
+		}
+		p.noTermios = true
+		if p.polled {
+			p.setTimeout(time.Duration(c.ReadTimeout)*time.Millisecond, 1)
+		}
+		return p, nil
+	}
+	p.orig = t
+
+	// Select baud rate.  One without a B constant is set with termios2
+	// once the rest is in place.
+	if rate != 0 {
+		t.Cflag &^= cbaud
+		t.Cflag |= rate
+	} else if c.Baud <= 0 {
+		p.warnings = append(p.warnings, &ConfigError{Field: "Baud", Value: c.Baud, Err: ErrBadBaudRate})
+	}
+
+	// Select local mode
+	t.Cflag |= syscall.CREAD
+	if c.MonitorDCD {
+		t.Cflag &^= syscall.CLOCAL
+	} else {
+		t.Cflag |= syscall.CLOCAL
+	}
+
+	// Select hangup on close
+	if c.KeepDTROnClose {
+		t.Cflag &^= syscall.HUPCL
+	}
+
+	// Select stop bits, character size and parity mode
+	if err = frameTermios(&t, c.Size, c.Parity, c.StopBits); err != nil {
+		return nil, err
+	}
+
+	// Select CRLF translation
+	if c.CRLFTranslate {
+		t.Iflag |= syscall.ICRNL
+	} else {
+		t.Iflag &^= syscall.ICRNL
+	}
+
+	// Select raw mode.  Software flow control and the other input
+	// processing would otherwise eat or rewrite some byte values.
+	t.Iflag &^= syscall.IXON | syscall.IXOFF | syscall.IXANY |
+		syscall.INLCR | syscall.IGNCR | syscall.ISTRIP
+
+	// Select the software flow control characters
+	xon, xoff := c.xonChars()
+	t.Cc[syscall.VSTART] = xon
+	t.Cc[syscall.VSTOP] = xoff
+	if c.XANY {
+		t.Iflag |= syscall.IXANY
+	}
+
+	// Select parity error marking
+	if c.MarkErrors {
+		t.Iflag |= syscall.INPCK | syscall.PARMRK
+		t.Iflag &^= syscall.IGNPAR | syscall.IGNBRK | syscall.BRKINT
+	}
+
+	t.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ECHOE | syscall.ISIG | syscall.IEXTEN
+	t.Oflag &^= syscall.OPOST
+	vmin, vtime := p.configCC(c)
+	t.Cc[syscall.VMIN] = vmin
+	t.Cc[syscall.VTIME] = vtime
+
+	err = p.ioctl(syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+	if err = p.tolerate(c, "tcsetattr", err); err != nil {
+		return nil, err
+	}
+	if rate == 0 && c.Baud > 0 {
+		if err = p.tolerate(c, "TCSETS2", p.setCustomBaud(c.Baud)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = p.tolerate(c, "TIOCMSET", p.setInitialLines(c)); err != nil {
+		return nil, err
 	}
 
-	if _, _, errno := syscall.Syscall6(
-		syscall.SYS_IOCTL,
-		uintptr(fd),
-		uintptr(syscall.TCSETS),
-		uintptr(unsafe.Pointer(&t)),
-		0,
-		0,
-		0,
-	); errno != 0 {
-		return nil, errno
+	// With MonitorDCD set, a Read now waits for carrier detect.
+	p.setTimeout(time.Duration(c.ReadTimeout)*time.Millisecond, vmin)
+	return p, nil
+}
+
+// tcgetattr and tcsetattr return ErrUnsupported on a RawDevice port
+// whose termios settings could not be read when it was opened.
+func (p *serialPort) tcgetattr(t *syscall.Termios) error {
+	if p.noTermios {
+		return ErrUnsupported
 	}
+	return p.ioctl(syscall.TCGETS, uintptr(unsafe.Pointer(t)))
+}
 
-	if err = syscall.SetNonblock(int(fd), false); err != nil {
-		return
+func (p *serialPort) tcsetattr(t *syscall.Termios) error {
+	if p.noTermios {
+		return ErrUnsupported
 	}
+	return p.ioctl(syscall.TCSETS, uintptr(unsafe.Pointer(t)))
+}
+
+func (p *serialPort) setBaud(baud int) error {
+	rate := bauds[baud]
+	if rate == 0 {
+		if baud <= 0 {
+			return &ConfigError{Field: "Baud", Value: baud, Err: ErrBadBaudRate}
+		}
+		return p.setCustomBaud(baud)
+	}
+	var t syscall.Termios
+	if err := p.tcgetattr(&t); err != nil {
+		return err
+	}
+	t.Cflag &^= cbaud
+	t.Cflag |= rate
+	return p.tcsetattr(&t)
+}
+
+// setReadTimeout only changes VMIN and VTIME on a port that is not
+// polled.
+func (p *serialPort) setReadTimeout(d time.Duration) error {
+	vmin, vtime := p.readTimeoutCC(d)
+	if !p.polled {
+		var t syscall.Termios
+		if err := p.tcgetattr(&t); err != nil {
+			return err
+		}
+		t.Cc[syscall.VMIN] = vmin
+		t.Cc[syscall.VTIME] = vtime
+		if err := p.tcsetattr(&t); err != nil {
+			return err
+		}
+	}
+	p.setTimeout(d, vmin)
+	return nil
+}
+
+func (p *serialPort) setFlowControl(f FlowControl) error {
+	var t syscall.Termios
+	if err := p.tcgetattr(&t); err != nil {
+		return err
+	}
+	t.Iflag &^= syscall.IXON | syscall.IXOFF
+	t.Cflag &^= crtscts
+	switch f {
+	case FlowRTSCTS:
+		t.Cflag |= crtscts
+	case FlowXONXOFF:
+		t.Iflag |= syscall.IXON | syscall.IXOFF
+	}
+	return p.tcsetattr(&t)
+}
+
+func (p *serialPort) flush(in, out bool) error {
+	var q uintptr
+	switch {
+	case in && out:
+		q = syscall.TCIOFLUSH
+	case in:
+		q = syscall.TCIFLUSH
+	case out:
+		q = syscall.TCOFLUSH
+	default:
+		return nil
+	}
+	return p.ioctl(tcflsh, q)
+}
+
+// drain is tcdrain(3), which is TCSBRK with a non-zero argument.
+func (p *serialPort) drain() error {
+	return p.ioctl(tcsbrk, 1)
+}
+
+// tcflow is TCXONC, whose argument is the action itself.
+func (p *serialPort) tcflow(a flowAction) error {
+	return p.ioctl(tcxonc, uintptr(a))
+}
+
+func (p *serialPort) queued() (in, out int, err error) {
+	var n int32
+	if err := p.ioctl(syscall.TIOCINQ, uintptr(unsafe.Pointer(&n))); err != nil {
+		return 0, 0, err
+	}
+	in = int(n)
+	if err := p.ioctl(syscall.TIOCOUTQ, uintptr(unsafe.Pointer(&n))); err != nil {
+		return 0, 0, err
+	}
+	return in, int(n), nil
+}
+
+// serialStruct is the kernel's struct serial_struct.
+type serialStruct struct {
+	typ, line     int32
+	port          uint32
+	irq, flags    int32
+	xmitFifoSize  int32
+	customDivisor int32
+	baudBase      int32
+	closeDelay    uint16
+	ioType        byte
+	reservedChar  [1]byte
+	hub6          int32
+	closingWait   uint16
+	closingWait2  uint16
+	iomemBase     uintptr
+	iomemRegShift uint16
+	portHigh      uint32
+	iomapBase     uintptr
+}
+
+const asyncLowLatency = 1 << 13 // ASYNC_LOW_LATENCY
+
+// serialICounter is struct serial_icounter_struct, which TIOCGICOUNT
+// fills in.
+type serialICounter struct {
+	cts, dsr, rng, dcd, rx, tx int32
+	frame, overrun, parity     int32
+	brk, bufOverrun            int32
+	reserved                   [9]int32
+}
+
+// lineCounts reads the driver's receive error totals.  Overruns of the
+// tty's own buffer count with those of the UART.
+func (p *serialPort) lineCounts() (lineCounts, error) {
+	var ic serialICounter
+	if err := p.ioctl(syscall.TIOCGICOUNT, uintptr(unsafe.Pointer(&ic))); err != nil {
+		return lineCounts{}, err
+	}
+	return lineCounts{
+		overrun: uint32(ic.overrun) + uint32(ic.bufOverrun),
+		parity:  uint32(ic.parity),
+		framing: uint32(ic.frame),
+		breaks:  uint32(ic.brk),
+	}, nil
+}
+
+// modemChanges reads TIOCGICOUNT's count of the changes on lines.  RI
+// counts only its trailing edges, as it does for TIOCMIWAIT.
+func (p *serialPort) modemChanges(lines ModemLines) (uint32, error) {
+	var ic serialICounter
+	if err := p.ioctl(syscall.TIOCGICOUNT, uintptr(unsafe.Pointer(&ic))); err != nil {
+		return 0, err
+	}
+	var n uint32
+	for _, c := range []struct {
+		line ModemLines
+		n    int32
+	}{{ModemCTS, ic.cts}, {ModemDSR, ic.dsr}, {ModemRI, ic.rng}, {ModemDCD, ic.dcd}} {
+		if lines&c.line != 0 {
+			n += uint32(c.n)
+		}
+	}
+	return n, nil
+}
+
+// waitModemChange waits for the count of changes on lines to move.  A
+// driver without TIOCGICOUNT gives ErrUnsupported, for
+// WaitForLineChange to read the lines themselves.
+func (p *serialPort) waitModemChange(ctx context.Context, lines ModemLines) error {
+	prior, err := p.modemChanges(lines)
+	if err == ErrPortClosed {
+		return err
+	}
+	if err != nil {
+		return ErrUnsupported
+	}
+	t := time.NewTicker(modemPoll)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		n, err := p.modemChanges(lines)
+		if err != nil || n != prior {
+			return err
+		}
+	}
+}
+
+// setLowLatency sets ASYNC_LOW_LATENCY, so that the driver hands
+// received data to the tty layer at once instead of on a timer.  If
+// the flag was not already set, Close clears it again.
+func (p *serialPort) setLowLatency() error {
+	var ss serialStruct
+	if err := p.ioctl(syscall.TIOCGSERIAL, uintptr(unsafe.Pointer(&ss))); err != nil {
+		return err
+	}
+	if ss.flags&asyncLowLatency != 0 {
+		return nil
+	}
+	ss.flags |= asyncLowLatency
+	if err := p.ioctl(syscall.TIOCSSERIAL, uintptr(unsafe.Pointer(&ss))); err != nil {
+		return err
+	}
+	p.undo = append(p.undo, func() {
+		var ss serialStruct
+		if p.ioctl(syscall.TIOCGSERIAL, uintptr(unsafe.Pointer(&ss))) == nil {
+			ss.flags &^= asyncLowLatency
+			p.ioctl(syscall.TIOCSSERIAL, uintptr(unsafe.Pointer(&ss)))
+		}
+	})
+	return nil
+}
+
+func (p *serialPort) getConfig(c *Config) error {
+	var t syscall.Termios
+	if err := p.tcgetattr(&t); err != nil {
+		return err
+	}
+
+	c.Baud = 0
+	for baud, rate := range bauds {
+		if t.Cflag&cbaud == rate {
+			c.Baud = baud
+		}
+	}
+	if c.Baud == 0 {
+		baud, err := p.readCustomBaud()
+		if err != nil {
+			return err
+		}
+		c.Baud = baud
+	}
+
+	switch t.Cflag & syscall.CSIZE {
+	case syscall.CS5:
+		c.Size = Byte5
+	case syscall.CS6:
+		c.Size = Byte6
+	case syscall.CS7:
+		c.Size = Byte7
+	default:
+		c.Size = Byte8
+	}
+
+	c.XONChar = t.Cc[syscall.VSTART]
+	c.XOFFChar = t.Cc[syscall.VSTOP]
+	c.XANY = t.Iflag&syscall.IXANY != 0
+	c.MarkErrors = t.Iflag&syscall.PARMRK != 0
+	c.RTSFlowControl = t.Cflag&crtscts != 0
+	c.XONFlowControl = t.Iflag&syscall.IXON != 0
+	c.MonitorDCD = t.Cflag&syscall.CLOCAL == 0
+	c.CRLFTranslate = t.Iflag&syscall.ICRNL != 0
+
+	c.StopBits = StopBits1
+	if t.Cflag&syscall.CSTOPB != 0 {
+		c.StopBits = StopBits2
+	}
+
+	switch {
+	case t.Cflag&syscall.PARENB == 0:
+		c.Parity = ParityNone
+	case t.Cflag&cmspar != 0 && t.Cflag&syscall.PARODD != 0:
+		c.Parity = ParityMark
+	case t.Cflag&cmspar != 0:
+		c.Parity = ParitySpace
+	case t.Cflag&syscall.PARODD != 0:
+		c.Parity = ParityOdd
+	default:
+		c.Parity = ParityEven
+	}
+	return nil
+}
 
-	return f, nil
+func (p *serialPort) restore() error {
+	t := p.orig
+	return p.tcsetattr(&t)
 }
@@ -0,0 +1,620 @@
+// +build linux
+
+package goserial
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// portFile returns the file underlying a port opened by OpenPort.
+func portFile(s *Port) *os.File {
+	return s.d.(*serialPort).f
+}
+
+// A tty is left non-blocking for the runtime poller; Read still waits
+// for data, as TestNoReadTimeoutBlocks checks.
+func TestOpenNonblock(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	s, err := OpenPort(&Config{Name: name, Baud: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Use the raw conn so that asking for the descriptor does not
+	// itself change its blocking mode.
+	rc, err := portFile(s).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var flags uintptr
+	var errno syscall.Errno
+	rc.Control(func(fd uintptr) {
+		flags, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, syscall.F_GETFL, 0)
+	})
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	if flags&syscall.O_NONBLOCK == 0 {
+		t.Errorf("O_NONBLOCK cleared after open: flags %#x", flags)
+	}
+	if !s.d.(*serialPort).polled {
+		t.Error("tty not on the runtime poller")
+	}
+	if flags&syscall.O_ACCMODE != syscall.O_RDWR {
+		t.Errorf("port not opened read/write: flags %#x", flags)
+	}
+}
+
+// portTermios returns the termios settings currently applied to an open
+// port.
+func portTermios(t *testing.T, s *Port) syscall.Termios {
+	rc, err := portFile(s).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st syscall.Termios
+	rc.Control(func(fd uintptr) {
+		err = ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&st)))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestKeepDTROnClose(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	s, err := OpenPort(&Config{Name: name, Baud: 9600, KeepDTROnClose: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	if st := portTermios(t, s); st.Cflag&syscall.HUPCL != 0 {
+		t.Errorf("HUPCL still set: cflag %#o", st.Cflag)
+	}
+}
+
+func TestMonitorDCD(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	for _, monitor := range []bool{false, true} {
+		s, err := OpenPort(&Config{Name: name, Baud: 9600, MonitorDCD: monitor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		local := portTermios(t, s).Cflag&syscall.CLOCAL != 0
+		s.Close()
+		if local == monitor {
+			t.Errorf("MonitorDCD %v: CLOCAL set is %v", monitor, local)
+		}
+	}
+}
+
+func TestInitialLinesUnchanged(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	// A pty has no modem lines and rejects TIOCMGET/TIOCMSET, so an
+	// open only succeeds if the package leaves them alone.
+	for _, l := range []LineState{LineDefault, LineUnchanged} {
+		s, err := OpenPort(&Config{Name: name, Baud: 9600, InitialDTR: l, InitialRTS: l})
+		if err != nil {
+			t.Errorf("line state %d: %v", l, err)
+			continue
+		}
+		s.Close()
+	}
+
+	if s, err := OpenPort(&Config{Name: name, Baud: 9600, InitialDTR: LineHigh}); err == nil {
+		s.Close()
+		t.Error("LineHigh did not try to set DTR")
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	s, err := OpenPort(&Config{Name: name, Baud: 9600, ReadTimeout: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	buf := make([]byte, 8)
+	if n, err := s.Read(buf); n != 0 || err != ErrTimeout {
+		t.Fatalf("Read on idle port = %d, %v; want 0, ErrTimeout", n, err)
+	}
+
+	m.Write([]byte("hi"))
+	if n, err := s.Read(buf); err != nil || string(buf[:n]) != "hi" {
+		t.Fatalf("Read = %q, %v; want \"hi\"", buf[:n], err)
+	}
+}
+
+func TestProbeRestores(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	// Keep the slave open so that its settings survive between opens.
+	f, err := os.OpenFile(name, os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var before, after syscall.Termios
+	ioctl(f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&before)))
+
+	if err := Probe(&Config{Name: name, Baud: 19200, StopBits: StopBits2}); err != nil {
+		t.Fatal(err)
+	}
+	ioctl(f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&after)))
+	if before != after {
+		t.Errorf("settings not restored:\nbefore %+v\nafter  %+v", before, after)
+	}
+
+	if err := Probe(&Config{Name: name, Baud: 19200, XONFlowControl: true}); err != nil {
+		t.Errorf("Probe with XONFlowControl on a pty: %v", err)
+	}
+	ioctl(f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&after)))
+	if before != after {
+		t.Errorf("settings not restored after probing flow control")
+	}
+
+	// A pty always forces 8 data bits without parity.
+	err = Probe(&Config{Name: name, Baud: 19200, Size: Byte7})
+	if ce, ok := err.(*ConfigError); !ok || ce.Field != "Size" {
+		t.Errorf("Probe with 7 data bits on a pty: got %v, want a Size ConfigError", err)
+	}
+	ioctl(f.Fd(), syscall.TCGETS, uintptr(unsafe.Pointer(&after)))
+	if before != after {
+		t.Errorf("settings not restored after a failed probe")
+	}
+}
+
+func TestLoopbackTest(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	p, err := OpenPort(&Config{Name: name, Baud: 115200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	if _, err := p.LoopbackTest([]byte("x"), 200*time.Millisecond); err != ErrNoLoopback {
+		t.Errorf("without a jumper: got %v, want ErrNoLoopback", err)
+	}
+
+	// Take the unanswered byte off the master, then echo everything
+	// back from there, corrupting byte 300 once asked to.
+	m.Read(make([]byte, 1))
+	corrupt := make(chan bool, 1)
+	go func() {
+		buf := make([]byte, 1024)
+		off, bad := 0, false
+		for {
+			n, err := m.Read(buf)
+			if err != nil {
+				return
+			}
+			select {
+			case bad = <-corrupt:
+				off = 0
+			default:
+			}
+			if bad && off <= 300 && 300 < off+n {
+				buf[300-off] ^= 0xff
+			}
+			off += n
+			m.Write(buf[:n])
+		}
+	}()
+
+	r, err := p.LoopbackTest(nil, 2*time.Second)
+	if err != nil {
+		t.Fatalf("with a jumper: %v (%+v)", err, r)
+	}
+	if r.Sent != 1024 || r.Received != 1024 || r.Mismatch != -1 {
+		t.Errorf("with a jumper: got %+v", r)
+	}
+
+	corrupt <- true
+	r, err = p.LoopbackTest(nil, 2*time.Second)
+	if err != ErrLoopbackCorrupt || r.Mismatch != 300 {
+		t.Errorf("corrupted: got %v, %+v; want ErrLoopbackCorrupt at 300", err, r)
+	}
+}
+
+func TestInputWaiting(t *testing.T) {
+	m, p := openPtyPort(t, Config{})
+	defer m.Close()
+	defer p.Close()
+
+	m.Write([]byte("queued"))
+	time.Sleep(50 * time.Millisecond)
+	if n, err := p.InputWaiting(); n != 6 || err != nil {
+		t.Errorf("InputWaiting = %d, %v; want 6", n, err)
+	}
+	if _, err := p.OutputPending(); err != nil {
+		t.Errorf("OutputPending: %v", err)
+	}
+}
+
+func TestRawDevice(t *testing.T) {
+	name := t.TempDir() + "/fifo"
+	if err := syscall.Mkfifo(name, 0600); err != nil {
+		t.Skip("mkfifo:", err)
+	}
+	if s, err := OpenPort(&Config{Name: name, Baud: 9600}); err == nil {
+		s.Close()
+		t.Fatal("opened a FIFO without RawDevice")
+	}
+
+	p, err := OpenPort(&Config{Name: name, Baud: 9600, RawDevice: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if w := p.SetupWarnings(); len(w) != 1 {
+		t.Errorf("SetupWarnings = %v, want the tcgetattr failure", w)
+	}
+	if err := p.SetBaud(19200); err != ErrUnsupported {
+		t.Errorf("SetBaud = %v, want ErrUnsupported", err)
+	}
+
+	if _, err := p.Write([]byte("raw")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 3)
+	readFull(t, p, buf)
+	if string(buf) != "raw" {
+		t.Errorf("read back %q", buf)
+	}
+}
+
+// TestTermiosConstants checks the hand-written termios constants
+// against the syscall package's for the architecture being built.
+func TestTermiosConstants(t *testing.T) {
+	for baud, rate := range bauds {
+		if rate&^cbaud != 0 {
+			t.Errorf("B%d = %#x has bits outside CBAUD %#x", baud, rate, cbaud)
+		}
+	}
+	// Where the ioctl number encodes the argument size, the kernel
+	// termios must fit in syscall.Termios.
+	if size := uintptr(syscall.TCGETS >> 16 & 0x1fff); syscall.TCGETS>>16 != 0 && size > unsafe.Sizeof(syscall.Termios{}) {
+		t.Errorf("TCGETS reads %d bytes, syscall.Termios has %d", size, unsafe.Sizeof(syscall.Termios{}))
+	}
+	if syscall.VMIN >= len(syscall.Termios{}.Cc) || syscall.VTIME >= len(syscall.Termios{}.Cc) {
+		t.Errorf("VMIN %d or VTIME %d outside c_cc", syscall.VMIN, syscall.VTIME)
+	}
+}
+
+// A pty has no serial_struct, so LowLatency is refused but the port
+// still opens.
+func TestLowLatencyWarning(t *testing.T) {
+	_, name := openPty(t)
+	p, err := OpenPort(&Config{Name: name, Baud: 9600, LowLatency: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	w := p.SetupWarnings()
+	if len(w) != 1 {
+		t.Fatalf("SetupWarnings = %v, want the LowLatency failure", w)
+	}
+	if e, ok := w[0].(*ConfigError); !ok || e.Field != "LowLatency" {
+		t.Errorf("SetupWarnings = %v", w)
+	}
+}
+
+func TestLatencyTimerNotFTDI(t *testing.T) {
+	_, name := openPty(t)
+	p, err := OpenPort(&Config{Name: name, Baud: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, err := p.LatencyTimer(); err != ErrUnsupported {
+		t.Errorf("LatencyTimer = %v, want ErrUnsupported", err)
+	}
+	if err := p.SetLatencyTimer(2); err != ErrUnsupported {
+		t.Errorf("SetLatencyTimer = %v, want ErrUnsupported", err)
+	}
+	if err := p.SetLatencyTimer(0); err == nil {
+		t.Error("SetLatencyTimer(0) succeeded")
+	}
+
+	// Config.LatencyTimer is refused the same way, as a setup warning.
+	q, err := Open(name, WithLowLatency())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+	w := q.SetupWarnings()
+	if len(w) != 2 {
+		t.Fatalf("SetupWarnings = %v, want the LowLatency and LatencyTimer failures", w)
+	}
+	if e, ok := w[1].(*ConfigError); !ok || e.Field != "LatencyTimer" || e.Err != ErrUnsupported {
+		t.Errorf("SetupWarnings = %v", w)
+	}
+}
+
+func TestXONChars(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	s, err := OpenPort(&Config{Name: name, Baud: 9600, XONChar: 0x05, XOFFChar: 0x06, XANY: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	st := portTermios(t, s)
+	if st.Cc[syscall.VSTART] != 0x05 || st.Cc[syscall.VSTOP] != 0x06 || st.Iflag&syscall.IXANY == 0 {
+		t.Errorf("VSTART %#x, VSTOP %#x, iflag %#x", st.Cc[syscall.VSTART], st.Cc[syscall.VSTOP], st.Iflag)
+	}
+
+	var c Config
+	if err := s.d.getConfig(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.XONChar != 0x05 || c.XOFFChar != 0x06 || !c.XANY {
+		t.Errorf("getConfig: XON %#x, XOFF %#x, XANY %v", c.XONChar, c.XOFFChar, c.XANY)
+	}
+}
+
+func TestSetFlowControl(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	p, err := OpenPort(&Config{Name: name, Baud: 9600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for _, tc := range []struct {
+		f           FlowControl
+		xon, rtscts bool
+	}{
+		{FlowRTSCTS, false, true},
+		{FlowXONXOFF, true, false},
+		{FlowNone, false, false},
+	} {
+		if err := p.SetFlowControl(tc.f); err != nil {
+			t.Fatalf("%v: %v", tc.f, err)
+		}
+		st := portTermios(t, p)
+		if xon := st.Iflag&(syscall.IXON|syscall.IXOFF) == syscall.IXON|syscall.IXOFF; xon != tc.xon {
+			t.Errorf("%v: iflag %#x", tc.f, st.Iflag)
+		}
+		if rtscts := st.Cflag&0x80000000 != 0; rtscts != tc.rtscts { // CRTSCTS
+			t.Errorf("%v: cflag %#x", tc.f, st.Cflag)
+		}
+	}
+
+	// RTS belongs to the driver while RTS/CTS is on.
+	p.SetFlowControl(FlowRTSCTS)
+	if err := p.SetRTS(true); err != ErrRTSFlowControl {
+		t.Errorf("SetRTS under RTS/CTS = %v, want ErrRTSFlowControl", err)
+	}
+	if err := p.SetFlowControl(FlowControl(9)); err == nil {
+		t.Error("SetFlowControl accepted an unknown mode")
+	}
+}
+
+func TestOpenFlowControl(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	p, err := OpenPort(&Config{Name: name, Baud: 230400, RTSFlowControl: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st := portTermios(t, p); st.Cflag&0x80000000 == 0 { // CRTSCTS
+		t.Errorf("RTSFlowControl: cflag %#x, want CRTSCTS", st.Cflag)
+	}
+	if err := p.SetRTS(false); err != ErrRTSFlowControl {
+		t.Errorf("SetRTS = %v, want ErrRTSFlowControl", err)
+	}
+	p.Close()
+
+	p, err = OpenPort(&Config{Name: name, Baud: 9600, XONFlowControl: true, XONChar: 0x05, XOFFChar: 0x06})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	st := portTermios(t, p)
+	if st.Iflag&(syscall.IXON|syscall.IXOFF) != syscall.IXON|syscall.IXOFF || st.Cflag&0x80000000 != 0 {
+		t.Errorf("XONFlowControl: iflag %#x, cflag %#x", st.Iflag, st.Cflag)
+	}
+	if st.Cc[syscall.VSTART] != 0x05 || st.Cc[syscall.VSTOP] != 0x06 {
+		t.Errorf("XONFlowControl: VSTART %#x, VSTOP %#x", st.Cc[syscall.VSTART], st.Cc[syscall.VSTOP])
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	p, err := OpenPort(&Config{Name: name, Baud: 9600, ReadTimeout: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, err := m.Write([]byte("sync")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A pty keeps CS8 and no parity whatever it is told, so only the
+	// stop bits show that the framing was applied.
+	err = p.Reconfigure(&Config{Baud: 115200, StopBits: StopBits2, XONFlowControl: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c Config
+	if err := p.d.getConfig(&c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Baud != 115200 || c.StopBits != StopBits2 {
+		t.Errorf("after Reconfigure: %v %v%v%v", c.Baud, c.Size, c.Parity, c.StopBits)
+	}
+	if st := portTermios(t, p); st.Iflag&syscall.IXON == 0 {
+		t.Errorf("after Reconfigure: iflag %#x, want IXON", st.Iflag)
+	}
+
+	// What arrived before is still there to be read.
+	buf := make([]byte, 4)
+	if n, err := p.Read(buf); string(buf[:n]) != "sync" {
+		t.Errorf("Read after Reconfigure = %q, %v", buf[:n], err)
+	}
+
+	if err := p.SetFraming(Byte8, ParityNone, StopBits1); err != nil {
+		t.Fatal(err)
+	}
+	if st := portTermios(t, p); st.Cflag&syscall.CSTOPB != 0 {
+		t.Errorf("after SetFraming: cflag %#x, want no CSTOPB", st.Cflag)
+	}
+	if err := p.SetFraming(Byte8, ParityMode(9), StopBits1); !errors.Is(err, ErrConfigParity) {
+		t.Errorf("SetFraming with a bad parity: %v", err)
+	}
+}
+
+func TestNotSerialPort(t *testing.T) {
+	file := t.TempDir() + "/file"
+	if err := os.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, pty := openPty(t)
+
+	for _, tc := range []struct {
+		name        string
+		strict, lax error // from OpenPort without and with AllowNonTTY
+	}{
+		{file, ErrNotSerialPort, nil},
+		{"/dev/null", ErrNotSerialPort, nil},
+		{pty, nil, nil},
+	} {
+		for _, allow := range []bool{false, true} {
+			want := tc.strict
+			if allow {
+				want = tc.lax
+			}
+			s, err := OpenPort(&Config{Name: tc.name, Baud: 9600, AllowNonTTY: allow})
+			if err == nil {
+				s.Close()
+			}
+			if err != want {
+				t.Errorf("%s, AllowNonTTY %v: %v, want %v", tc.name, allow, err, want)
+			}
+		}
+	}
+
+	// A directory cannot even be opened read/write.
+	if s, err := OpenPort(&Config{Name: t.TempDir(), Baud: 9600, AllowNonTTY: true}); err == nil {
+		s.Close()
+		t.Error("opened a directory")
+	}
+}
+
+func TestAdvancedSetup(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+	s, err := OpenPort(&Config{Name: name, Baud: 115200, AdvancedSetup: func(fd uintptr) error {
+		var st syscall.Termios
+		if err := ioctl(fd, syscall.TCGETS, uintptr(unsafe.Pointer(&st))); err != nil {
+			return err
+		}
+		if st.Cflag&syscall.CSIZE != syscall.CS8 {
+			t.Error("AdvancedSetup called before the line was configured")
+		}
+		st.Iflag |= syscall.IUTF8
+		return ioctl(fd, syscall.TCSETS, uintptr(unsafe.Pointer(&st)))
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if st := portTermios(t, s); st.Iflag&syscall.IUTF8 == 0 {
+		t.Error("IUTF8 set by AdvancedSetup is not applied")
+	}
+	if !s.d.(*serialPort).polled {
+		t.Error("port taken off the runtime poller by AdvancedSetup")
+	}
+
+	fail := errors.New("setup failed")
+	if _, err := OpenPort(&Config{Name: name, Baud: 115200, AdvancedSetup: func(uintptr) error { return fail }}); err != fail {
+		t.Errorf("OpenPort with a failing AdvancedSetup = %v; want its error", err)
+	}
+}
+
+func TestPhantom(t *testing.T) {
+	dir := t.TempDir()
+	for name, typ := range map[string]string{"ttyS1": "0\n", "ttyS0": "4\n"} {
+		os.Mkdir(dir+"/"+name, 0777)
+		ioutil.WriteFile(dir+"/"+name+"/type", []byte(typ), 0666)
+	}
+	os.Mkdir(dir+"/ttyUSB0", 0777)
+	for name, want := range map[string]bool{"ttyS1": true, "ttyS0": false, "ttyUSB0": false} {
+		if got := phantom(dir + "/" + name); got != want {
+			t.Errorf("phantom(%s) = %v; want %v", name, got, want)
+		}
+	}
+	names, err := ListPorts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range names {
+		if _, err := os.Stat(n); err != nil {
+			t.Errorf("ListPorts returned %s: %v", n, err)
+		}
+	}
+}
+
+func TestUSBInfo(t *testing.T) {
+	// The layout of an FTDI adapter: the tty's device is the driver's
+	// port, under the interface, under the USB device.
+	usb := t.TempDir() + "/usb1/1-2"
+	iface := usb + "/1-2:1.0"
+	port := iface + "/ttyUSB0"
+	os.MkdirAll(port, 0777)
+	for name, v := range map[string]string{
+		"idVendor": "0403\n", "idProduct": "6001\n", "serial": "A6008isP\n",
+		"manufacturer": "FTDI\n", "product": "FT232R USB UART\n",
+	} {
+		ioutil.WriteFile(usb+"/"+name, []byte(v), 0666)
+	}
+	var pi PortInfo
+	usbInfo(&pi, port)
+	want := PortInfo{IsUSB: true, VID: 0x0403, PID: 0x6001, SerialNumber: "A6008isP", Manufacturer: "FTDI", Product: "FT232R USB UART"}
+	if pi != want {
+		t.Errorf("usbInfo = %+v; want %+v", pi, want)
+	}
+	pi.Name = "/dev/ttyUSB0"
+	if s := pi.String(); s != "/dev/ttyUSB0 USB 0403:6001 serial A6008isP (FTDI FT232R USB UART)" {
+		t.Errorf("String = %q", s)
+	}
+
+	pi = PortInfo{}
+	usbInfo(&pi, t.TempDir())
+	if pi != (PortInfo{}) {
+		t.Errorf("usbInfo of a non-USB device = %+v", pi)
+	}
+	if _, err := EnumeratePorts(); err != nil {
+		t.Error(err)
+	}
+}
@@ -1,89 +1,271 @@
-// +build !windows,cgo
+// +build !windows,!linux,!freebsd,!openbsd,!netbsd,!darwin,cgo
 
 package goserial
 
+// #include <sys/ioctl.h>
 // #include <termios.h>
 // #include <unistd.h>
+//
+// #ifndef CMSPAR
+// #define CMSPAR 0
+// #endif
 import "C"
 
 // TODO: Maybe change to using syscall package + ioctl instead of cgo
 
 import (
 	"errors"
-	"fmt"
-	"io"
 	"os"
 	"syscall"
+	"time"
 	//"unsafe"
 )
 
-func openPort(name string, c *Config) (rwc io.ReadWriteCloser, err error) {
+func openPort(name string, c *Config) (d driver, err error) {
+	// Open non-blocking so that a device waiting for carrier detect
+	// (e.g. a Solaris /dev/term/* dial-in node) cannot hang open(2).  The
+	// descriptor stays that way, for the runtime poller.
 	f, err := os.OpenFile(name, syscall.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0666)
 	if err != nil {
+		err = openError(err)
 		return
 	}
+	return openFile(f, c)
+}
 
+// openFile sets up f, a port opened with O_NONBLOCK, as c says.  f is
+// closed if that fails.
+func openFile(f *os.File, c *Config) (d driver, err error) {
 	defer func() {
 		if err != nil {
 			f.Close()
 		}
 	}()
 
-	fd := C.int(f.Fd())
-	if C.isatty(fd) != 1 {
-		return nil, errors.New("File is not a tty")
+	p, err := newSerialPort(f)
+	if err != nil {
+		return nil, err
+	}
+	if c.Exclusive {
+		if err = p.lock(); err != nil {
+			return nil, err
+		}
 	}
 
 	var st C.struct_termios
-	_, err = C.tcgetattr(fd, &st)
+	err = p.checkCharDevice()
+	if err == nil {
+		err = p.control(func(fd uintptr) error {
+			if C.isatty(C.int(fd)) != 1 {
+				return ErrNotSerialPort
+			}
+			_, err := C.tcgetattr(C.int(fd), &st)
+			return err
+		})
+	}
 	if err != nil {
+		if err = p.tolerate(c, "tcgetattr", err); err != nil {
+			return nil, err
+		}
+		p.noTermios = true
+		if p.polled {
+			p.setTimeout(time.Duration(c.ReadTimeout)*time.Millisecond, 1)
+		}
+		return p, nil
+	}
+	p.orig = st
+	if err = p.setSpeed(&st, c.Baud); err != nil {
+		if !c.RawDevice {
+			return nil, err
+		}
+		p.warnings = append(p.warnings, err)
+	}
+
+	// Select local mode
+	st.c_cflag |= C.CREAD
+	if c.MonitorDCD {
+		st.c_cflag &^= C.CLOCAL
+	} else {
+		st.c_cflag |= C.CLOCAL
+	}
+
+	// Select hangup on close
+	if c.KeepDTROnClose {
+		st.c_cflag &^= C.HUPCL
+	}
+
+	// Select stop bits, character size and parity mode
+	if err = frameTermios(&st, c.Size, c.Parity, c.StopBits); err != nil {
 		return nil, err
 	}
-	var speed C.speed_t
-	switch c.Baud {
-	case 115200:
-		speed = C.B115200
-	case 57600:
-		speed = C.B57600
-	case 38400:
-		speed = C.B38400
-	case 19200:
-		speed = C.B19200
-	case 9600:
-		speed = C.B9600
-	case 4800:
-		speed = C.B4800
-	case 2400:
-		speed = C.B2400
-	default:
-		return nil, fmt.Errorf("Unknown baud rate %v", c.Baud)
+
+	// Select CRLF translation
+	if c.CRLFTranslate {
+		st.c_iflag |= C.ICRNL
+	} else {
+		st.c_iflag &^= C.ICRNL
 	}
 
-	_, err = C.cfsetispeed(&st, speed)
-	if err != nil {
+	// Select raw mode.  Software flow control and the other input
+	// processing would otherwise eat or rewrite some byte values.
+	st.c_iflag &^= C.IXON | C.IXOFF | C.IXANY | C.INLCR | C.IGNCR | C.ISTRIP
+
+	// Select the software flow control characters
+	xon, xoff := c.xonChars()
+	st.c_cc[C.VSTART] = C.cc_t(xon)
+	st.c_cc[C.VSTOP] = C.cc_t(xoff)
+	if c.XANY {
+		st.c_iflag |= C.IXANY
+	}
+
+	// Select parity error marking
+	if c.MarkErrors {
+		st.c_iflag |= C.INPCK | C.PARMRK
+		st.c_iflag &^= C.IGNPAR | C.IGNBRK | C.BRKINT
+	}
+
+	st.c_lflag &^= C.ICANON | C.ECHO | C.ECHOE | C.ISIG | C.IEXTEN
+	st.c_oflag &^= C.OPOST
+	vmin, vtime := p.configCC(c)
+	st.c_cc[C.VMIN] = C.cc_t(vmin)
+	st.c_cc[C.VTIME] = C.cc_t(vtime)
+
+	err = p.tcsetattr(&st)
+	if err = p.tolerate(c, "tcsetattr", err); err != nil {
 		return nil, err
 	}
-	_, err = C.cfsetospeed(&st, speed)
-	if err != nil {
+
+	if err = p.tolerate(c, "TIOCMSET", p.setInitialLines(c)); err != nil {
 		return nil, err
 	}
 
-	// Select local mode
-	st.c_cflag |= C.CLOCAL | C.CREAD
+	// With MonitorDCD set, a Read now waits for carrier detect.
+
+	p.setTimeout(time.Duration(c.ReadTimeout)*time.Millisecond, vmin)
+	return p, nil
+}
+
+type termios = C.struct_termios
+
+// tcgetattr and tcsetattr return ErrUnsupported on a RawDevice port
+// whose termios settings could not be read when it was opened.
+func (p *serialPort) tcgetattr(st *C.struct_termios) error {
+	if p.noTermios {
+		return ErrUnsupported
+	}
+	return p.control(func(fd uintptr) error {
+		_, err := C.tcgetattr(C.int(fd), st)
+		return err
+	})
+}
+
+// termios has no room for a rate set with setCustomSpeed, so tcsetattr
+// sets a placeholder and then the rate again.
+func (p *serialPort) tcsetattr(st *C.struct_termios) error {
+	if p.noTermios {
+		return ErrUnsupported
+	}
+	baud := p.customBaud
+	if baud != 0 {
+		t := *st
+		st = &t
+		C.cfsetispeed(st, C.B9600)
+		C.cfsetospeed(st, C.B9600)
+	}
+	return p.control(func(fd uintptr) error {
+		if _, err := C.tcsetattr(C.int(fd), C.TCSANOW, st); err != nil {
+			return err
+		}
+		if baud != 0 {
+			return setCustomSpeed(fd, baud)
+		}
+		return nil
+	})
+}
+
+var bauds = map[int]C.speed_t{
+	50:     C.B50,
+	75:     C.B75,
+	110:    C.B110,
+	134:    C.B134,
+	150:    C.B150,
+	200:    C.B200,
+	300:    C.B300,
+	600:    C.B600,
+	1200:   C.B1200,
+	1800:   C.B1800,
+	2400:   C.B2400,
+	4800:   C.B4800,
+	9600:   C.B9600,
+	19200:  C.B19200,
+	38400:  C.B38400,
+	57600:  C.B57600,
+	115200: C.B115200,
+	230400: C.B230400,
+}
+
+// setSpeed puts baud into st.  A rate without a B constant is kept in
+// p.customBaud, for tcsetattr to set with setCustomSpeed where the
+// platform has a way.
+func (p *serialPort) setSpeed(st *C.struct_termios, baud int) error {
+	speed, ok := bauds[baud]
+	if !ok {
+		if baud <= 0 || !customSpeeds {
+			return &ConfigError{Field: "Baud", Value: baud, Err: ErrBadBaudRate}
+		}
+		speed = C.B9600
+	}
+	if _, err := C.cfsetispeed(st, speed); err != nil {
+		return err
+	}
+	if _, err := C.cfsetospeed(st, speed); err != nil {
+		return err
+	}
+	p.customBaud = 0
+	if !ok {
+		p.customBaud = baud
+	}
+	return nil
+}
+
+func (p *serialPort) setBaud(baud int) error {
+	var st C.struct_termios
+	if err := p.tcgetattr(&st); err != nil {
+		return err
+	}
+	prev := p.customBaud
+	if err := p.setSpeed(&st, baud); err != nil {
+		return err
+	}
+	if err := p.tcsetattr(&st); err != nil {
+		p.customBaud = prev
+		return err
+	}
+	return nil
+}
 
-	// Select stop bits
-	switch c.StopBits {
+// frameTermios selects the stop bits, character size and parity mode in
+// st.  Config.check has already rejected values outside the enums; mark
+// and space parity need CMSPAR, which Solaris does not have, and 1.5 stop
+// bits are CSTOPB with 5-bit characters.
+func frameTermios(st *C.struct_termios, size ByteSize, parity ParityMode, stop StopBits) error {
+	if stop == StopBits1Half && size != Byte5 {
+		return &ConfigError{Field: "StopBits", Value: stop, Err: errors.New("1.5 needs Byte5 on POSIX")}
+	}
+	if (parity == ParityMark || parity == ParitySpace) && C.CMSPAR == 0 {
+		return &ConfigError{Field: "Parity", Value: parity, Err: ErrUnsupported}
+	}
+	switch stop {
 	case StopBits1:
 		st.c_cflag &^= C.CSTOPB
-	case StopBits2:
+	case StopBits2, StopBits1Half:
 		st.c_cflag |= C.CSTOPB
 	default:
-		panic(c.StopBits)
+		panic(stop)
 	}
 
-	// Select character size
 	st.c_cflag &^= C.CSIZE
-	switch c.Size {
+	switch size {
 	case Byte5:
 		st.c_cflag |= C.CS5
 	case Byte6:
@@ -93,11 +275,11 @@ func openPort(name string, c *Config) (rwc io.ReadWriteCloser, err error) {
 	case Byte8:
 		st.c_cflag |= C.CS8
 	default:
-		panic(c.Size)
+		panic(size)
 	}
 
-	// Select parity mode
-	switch c.Parity {
+	st.c_cflag &^= C.CMSPAR
+	switch parity {
 	case ParityNone:
 		st.c_cflag &^= C.PARENB
 	case ParityEven:
@@ -106,46 +288,208 @@ func openPort(name string, c *Config) (rwc io.ReadWriteCloser, err error) {
 	case ParityOdd:
 		st.c_cflag |= C.PARENB
 		st.c_cflag |= C.PARODD
+	case ParityMark:
+		st.c_cflag |= C.PARENB | C.CMSPAR
+		st.c_cflag |= C.PARODD
+	case ParitySpace:
+		st.c_cflag |= C.PARENB | C.CMSPAR
+		st.c_cflag &^= C.PARODD
 	default:
-		panic(c.Parity)
+		panic(parity)
+	}
+	return nil
+}
+
+func (p *serialPort) setFraming(size ByteSize, parity ParityMode, stop StopBits) error {
+	var st C.struct_termios
+	if err := p.tcgetattr(&st); err != nil {
+		return err
+	}
+	if err := frameTermios(&st, size, parity, stop); err != nil {
+		return err
 	}
+	return p.tcsetattr(&st)
+}
 
-	// Select CRLF translation
-	if c.CRLFTranslate {
-		st.c_iflag |= C.ICRNL
+// setReadTimeout only changes VMIN and VTIME on a port that is not
+// polled.
+func (p *serialPort) setReadTimeout(d time.Duration) error {
+	vmin, vtime := p.readTimeoutCC(d)
+	if !p.polled {
+		var st C.struct_termios
+		if err := p.tcgetattr(&st); err != nil {
+			return err
+		}
+		st.c_cc[C.VMIN] = C.cc_t(vmin)
+		st.c_cc[C.VTIME] = C.cc_t(vtime)
+		if err := p.tcsetattr(&st); err != nil {
+			return err
+		}
+	}
+	p.setTimeout(d, vmin)
+	return nil
+}
+
+func (p *serialPort) setFlowControl(f FlowControl) error {
+	var st C.struct_termios
+	if err := p.tcgetattr(&st); err != nil {
+		return err
+	}
+	st.c_iflag &^= C.IXON | C.IXOFF
+	st.c_cflag &^= C.CRTSCTS
+	switch f {
+	case FlowRTSCTS:
+		st.c_cflag |= C.CRTSCTS
+	case FlowXONXOFF:
+		st.c_iflag |= C.IXON | C.IXOFF
+	}
+	return p.tcsetattr(&st)
+}
+
+func (p *serialPort) flush(in, out bool) error {
+	var q C.int
+	switch {
+	case in && out:
+		q = C.TCIOFLUSH
+	case in:
+		q = C.TCIFLUSH
+	case out:
+		q = C.TCOFLUSH
+	default:
+		return nil
+	}
+	return p.control(func(fd uintptr) error {
+		_, err := C.tcflush(C.int(fd), q)
+		return err
+	})
+}
+
+func (p *serialPort) drain() error {
+	return p.control(func(fd uintptr) error {
+		_, err := C.tcdrain(C.int(fd))
+		return err
+	})
+}
+
+// The termios flags Settings reports, in stty's order.
+var (
+	iflagNames = []flagName{
+		{C.IGNBRK, "ignbrk"}, {C.BRKINT, "brkint"},
+		{C.IGNPAR, "ignpar"}, {C.PARMRK, "parmrk"},
+		{C.INPCK, "inpck"}, {C.ISTRIP, "istrip"},
+		{C.INLCR, "inlcr"}, {C.IGNCR, "igncr"},
+		{C.ICRNL, "icrnl"}, {C.IXON, "ixon"},
+		{C.IXOFF, "ixoff"}, {C.IXANY, "ixany"},
+		{C.IMAXBEL, "imaxbel"},
+	}
+	oflagNames = []flagName{
+		{C.OPOST, "opost"}, {C.ONLCR, "onlcr"},
+	}
+	cflagNames = []flagName{
+		{C.PARENB, "parenb"}, {C.PARODD, "parodd"},
+		{C.HUPCL, "hupcl"}, {C.CSTOPB, "cstopb"},
+		{C.CREAD, "cread"}, {C.CLOCAL, "clocal"},
+		{C.CRTSCTS, "crtscts"},
+	}
+	lflagNames = []flagName{
+		{C.ISIG, "isig"}, {C.ICANON, "icanon"},
+		{C.IEXTEN, "iexten"}, {C.ECHO, "echo"},
+		{C.ECHOE, "echoe"}, {C.ECHOK, "echok"},
+		{C.ECHONL, "echonl"}, {C.NOFLSH, "noflsh"},
+		{C.TOSTOP, "tostop"}, {C.ECHOCTL, "echoctl"},
+		{C.ECHOKE, "echoke"},
+	}
+	csizeNames = map[uint64]string{
+		C.CS5: "cs5", C.CS6: "cs6", C.CS7: "cs7", C.CS8: "cs8",
+	}
+)
+
+// settings reports the termios settings and the modem lines.
+func (p *serialPort) settings(s *Settings) {
+	var st C.struct_termios
+	if err := p.tcgetattr(&st); err != nil {
+		s.failed("termios", err)
 	} else {
-		st.c_iflag &^= C.ICRNL
+		s.add("termios.iflag", "%s", flagWord(uint64(st.c_iflag), iflagNames))
+		s.add("termios.oflag", "%s", flagWord(uint64(st.c_oflag), oflagNames))
+		s.add("termios.cflag", "%s %s", csizeNames[uint64(st.c_cflag)&C.CSIZE], flagWord(uint64(st.c_cflag), cflagNames))
+		s.add("termios.lflag", "%s", flagWord(uint64(st.c_lflag), lflagNames))
+		s.add("termios.cc", "vmin=%d vtime=%d vstart=0x%02x vstop=0x%02x",
+			st.c_cc[C.VMIN], st.c_cc[C.VTIME], st.c_cc[C.VSTART], st.c_cc[C.VSTOP])
 	}
+	p.modemSettings(s)
+}
 
-	// Select raw mode
-	st.c_lflag &^= C.ICANON | C.ECHO | C.ECHOE | C.ISIG
-	st.c_oflag &^= C.OPOST
+var tcflowActions = [...]C.int{
+	outputOff: C.TCOOFF,
+	outputOn:  C.TCOON,
+	inputOff:  C.TCIOFF,
+	inputOn:   C.TCION,
+}
 
-	_, err = C.tcsetattr(fd, C.TCSANOW, &st)
-	if err != nil {
-		return nil, err
+func (p *serialPort) tcflow(a flowAction) error {
+	return p.control(func(fd uintptr) error {
+		_, err := C.tcflow(C.int(fd), tcflowActions[a])
+		return err
+	})
+}
+
+func (p *serialPort) getConfig(c *Config) error {
+	var st C.struct_termios
+	if err := p.tcgetattr(&st); err != nil {
+		return err
+	}
+
+	c.Baud = p.customBaud
+	speed := C.cfgetospeed(&st)
+	for baud, s := range bauds {
+		if s == speed && p.customBaud == 0 {
+			c.Baud = baud
+		}
+	}
+
+	switch st.c_cflag & C.CSIZE {
+	case C.CS5:
+		c.Size = Byte5
+	case C.CS6:
+		c.Size = Byte6
+	case C.CS7:
+		c.Size = Byte7
+	default:
+		c.Size = Byte8
 	}
 
-	//fmt.Println("Tweaking", name)
-	r1, _, e := syscall.Syscall(syscall.SYS_FCNTL,
-		uintptr(f.Fd()),
-		uintptr(syscall.F_SETFL),
-		uintptr(0))
-	if e != 0 || r1 != 0 {
-		s := fmt.Sprint("Clearing NONBLOCK syscall error:", e, r1)
-		return nil, errors.New(s)
-	}
-
-	/*
-				r1, _, e = syscall.Syscall(syscall.SYS_IOCTL,
-			                uintptr(f.Fd()),
-			                uintptr(0x80045402), // IOSSIOSPEED
-			                uintptr(unsafe.Pointer(&baud)));
-			        if e != 0 || r1 != 0 {
-			                s := fmt.Sprint("Baudrate syscall error:", e, r1)
-		                        return nil, os.NewError(s)
-				}
-	*/
-
-	return f, nil
+	c.XONChar = byte(st.c_cc[C.VSTART])
+	c.XOFFChar = byte(st.c_cc[C.VSTOP])
+	c.XANY = st.c_iflag&C.IXANY != 0
+	c.MarkErrors = st.c_iflag&C.PARMRK != 0
+	c.RTSFlowControl = st.c_cflag&C.CRTSCTS != 0
+	c.XONFlowControl = st.c_iflag&C.IXON != 0
+	c.MonitorDCD = st.c_cflag&C.CLOCAL == 0
+	c.CRLFTranslate = st.c_iflag&C.ICRNL != 0
+
+	c.StopBits = StopBits1
+	if st.c_cflag&C.CSTOPB != 0 {
+		c.StopBits = StopBits2
+	}
+
+	switch {
+	case st.c_cflag&C.PARENB == 0:
+		c.Parity = ParityNone
+	case st.c_cflag&C.CMSPAR != 0 && st.c_cflag&C.PARODD != 0:
+		c.Parity = ParityMark
+	case st.c_cflag&C.CMSPAR != 0:
+		c.Parity = ParitySpace
+	case st.c_cflag&C.PARODD != 0:
+		c.Parity = ParityOdd
+	default:
+		c.Parity = ParityEven
+	}
+	return nil
+}
+
+func (p *serialPort) restore() error {
+	st := p.orig
+	p.customBaud = 0
+	return p.tcsetattr(&st)
 }
@@ -0,0 +1,169 @@
+package goserial
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWindowsTimeoutsCheck(t *testing.T) {
+	for _, tc := range []struct {
+		t  WindowsTimeouts
+		ok bool
+	}{
+		{WindowsTimeouts{}, true},
+		{WindowsTimeouts{ReadIntervalTimeout: 10, ReadTotalTimeoutConstant: 500, WriteTotalTimeoutConstant: 1000}, true},
+		{WindowsTimeouts{ReadIntervalTimeout: MaxDWORD}, true},
+		{WindowsTimeouts{ReadIntervalTimeout: MaxDWORD, ReadTotalTimeoutMultiplier: MaxDWORD, ReadTotalTimeoutConstant: 100}, true},
+		{WindowsTimeouts{ReadIntervalTimeout: MaxDWORD, ReadTotalTimeoutMultiplier: MaxDWORD}, false},
+		{WindowsTimeouts{ReadIntervalTimeout: MaxDWORD, ReadTotalTimeoutMultiplier: MaxDWORD, ReadTotalTimeoutConstant: MaxDWORD}, false},
+		{WindowsTimeouts{ReadIntervalTimeout: MaxDWORD, ReadTotalTimeoutConstant: 100}, false},
+		{WindowsTimeouts{ReadTotalTimeoutMultiplier: MaxDWORD, ReadTotalTimeoutConstant: 100}, false},
+	} {
+		wt := tc.t
+		err := (&Config{WindowsTimeouts: &wt}).check()
+		if tc.ok && err != nil {
+			t.Errorf("%+v: %v", tc.t, err)
+		}
+		if ce, isCE := err.(*ConfigError); !tc.ok && (!isCE || ce.Field != "WindowsTimeouts") {
+			t.Errorf("%+v: got %v, want a WindowsTimeouts ConfigError", tc.t, err)
+		}
+	}
+}
+
+func TestPosixTimeoutsCheck(t *testing.T) {
+	pt := &PosixTimeouts{VMIN: 12, VTIME: 1}
+	if err := (&Config{PosixTimeouts: pt}).check(); err != nil {
+		t.Error(err)
+	}
+	err := (&Config{PosixTimeouts: pt, ReadTimeout: 100}).check()
+	if ce, ok := err.(*ConfigError); !ok || ce.Field != "PosixTimeouts" {
+		t.Errorf("PosixTimeouts with ReadTimeout: got %v, want a PosixTimeouts ConfigError", err)
+	}
+}
+
+func TestWindowsQueuesCheck(t *testing.T) {
+	if err := (&Config{WindowsInputQueue: 65536, WindowsOutputQueue: 4096}).check(); err != nil {
+		t.Error(err)
+	}
+	err := (&Config{WindowsOutputQueue: -1}).check()
+	if ce, ok := err.(*ConfigError); !ok || ce.Field != "WindowsOutputQueue" {
+		t.Errorf("negative WindowsOutputQueue: got %v, want a WindowsOutputQueue ConfigError", err)
+	}
+}
+
+func TestXONCharsCheck(t *testing.T) {
+	for _, tc := range []struct {
+		xon, xoff byte
+		ok        bool
+	}{
+		{0, 0, true},
+		{0x05, 0x06, true},
+		{0x13, 0, false}, // collides with the default XOFF
+		{0x05, 0x05, false},
+	} {
+		err := (&Config{XONChar: tc.xon, XOFFChar: tc.xoff}).check()
+		if ce, isCE := err.(*ConfigError); tc.ok != (err == nil) || !tc.ok && (!isCE || ce.Field != "XOFFChar") {
+			t.Errorf("XON %#x, XOFF %#x: %v", tc.xon, tc.xoff, err)
+		}
+	}
+}
+
+func TestFlowControlCheck(t *testing.T) {
+	err := (&Config{RTSFlowControl: true, XONFlowControl: true}).check()
+	if ce, ok := err.(*ConfigError); !ok || ce.Field != "XONFlowControl" {
+		t.Errorf("RTSFlowControl with XONFlowControl: got %v, want an XONFlowControl ConfigError", err)
+	}
+}
+
+func TestMarkSpaceParity(t *testing.T) {
+	for _, p := range []ParityMode{ParityMark, ParitySpace} {
+		if err := (&Config{Parity: p}).check(); err != nil {
+			t.Errorf("%v parity: %v", p, err)
+		}
+	}
+	if s := ParityMark.String() + " " + ParitySpace.String(); s != "mark space" {
+		t.Errorf("String = %q", s)
+	}
+	if err := (&Config{Parity: ParitySpace + 1}).check(); !errors.Is(err, ErrConfigParity) {
+		t.Errorf("parity past ParitySpace: %v", err)
+	}
+}
+
+func TestStopBits1Half(t *testing.T) {
+	if err := (&Config{Size: Byte5, StopBits: StopBits1Half}).check(); err != nil {
+		t.Errorf("1.5 stop bits: %v", err)
+	}
+	if s := StopBits1Half.String(); s != "1.5" {
+		t.Errorf("String = %q", s)
+	}
+	if err := (&Config{StopBits: StopBits1Half + 1}).check(); !errors.Is(err, ErrConfigStopBits) {
+		t.Errorf("stop bits past StopBits1Half: %v", err)
+	}
+}
+
+func TestConfigErrorFields(t *testing.T) {
+	for _, tc := range []struct {
+		c     Config
+		field string
+		err   error
+	}{
+		{Config{Name: "x", Baud: -1}, "Baud", ErrBadBaudRate},
+		{Config{Name: "x", Size: 9}, "Size", ErrConfigByteSize},
+		{Config{Name: "x", StopBits: 7}, "StopBits", ErrConfigStopBits},
+		{Config{Name: "x", Parity: 'Q'}, "Parity", ErrConfigParity},
+		{Config{Name: "x", InitialRTS: 9}, "InitialRTS", ErrConfigLineState},
+		{Config{Baud: 9600}, "Name", nil},
+	} {
+		err := tc.c.checkOpen()
+		var ce *ConfigError
+		if !errors.As(err, &ce) || ce.Field != tc.field {
+			t.Errorf("%+v: %v; want a ConfigError for %s", tc.c, err, tc.field)
+			continue
+		}
+		if tc.err != nil && !errors.Is(err, tc.err) {
+			t.Errorf("%+v: %v; want it to wrap %v", tc.c, err, tc.err)
+		}
+	}
+}
+
+func TestRS485Check(t *testing.T) {
+	for _, tc := range []struct {
+		c     Config
+		field string
+	}{
+		{Config{RS485: &RS485{}, RTSFlowControl: true}, "RS485"},
+		{Config{RS485: &RS485{DelayBeforeSend: -1}}, "RS485.DelayBeforeSend"},
+		{Config{RS485: &RS485{DelayAfterSend: -1}}, "RS485.DelayAfterSend"},
+	} {
+		if ce, ok := tc.c.check().(*ConfigError); !ok || ce.Field != tc.field {
+			t.Errorf("%+v: got %v, want a %s ConfigError", *tc.c.RS485, ce, tc.field)
+		}
+	}
+	if err := (&Config{RS485: &RS485{DelayAfterSend: time.Millisecond}}).check(); err != nil {
+		t.Errorf("RS485 with a delay: %v", err)
+	}
+}
+
+func TestOpenTimeout(t *testing.T) {
+	// The listener's backlog completes the TCP handshake, but nothing
+	// ever answers the telnet negotiation.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	defer l.Close()
+
+	start := time.Now()
+	_, err = OpenPort(&Config{Name: "rfc2217://" + l.Addr().String(), Baud: 9600, OpenTimeout: 100 * time.Millisecond})
+	if err != ErrOpenTimeout {
+		t.Fatalf("OpenPort = %v, want ErrOpenTimeout", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("OpenPort took %v", d)
+	}
+	if te, ok := err.(interface{ Timeout() bool }); !ok || !te.Timeout() {
+		t.Error("ErrOpenTimeout is not a timeout")
+	}
+}
@@ -0,0 +1,485 @@
+// +build linux darwin freebsd netbsd openbsd dragonfly solaris
+
+package goserial
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+type serialPort struct {
+	timeout  int64 // the read timeout, set atomically; first for alignment
+	wtimeout int64 // the write timeout, likewise
+
+	// The read and write deadlines in Unix nanoseconds, or zero; they
+	// bound every Read and Write as well as the timeouts.
+	rdeadline, wdeadline int64
+
+	vmin0 int32 // set atomically while VMIN is 0 on a blocking descriptor
+
+	f    *os.File
+	rc   syscall.RawConn
+	orig termios // the settings found when the port was opened
+
+	// polled is set when the descriptor is on the runtime poller, so
+	// that reads time out with a deadline.  Otherwise it is in blocking
+	// mode and they time out with VTIME.
+	polled bool
+
+	// customBaud is a rate set with setCustomSpeed, which termios
+	// cannot hold, or 0; macOS and the cgo backend only.
+	customBaud int
+
+	// With Config.RawDevice, the setup steps that failed, and whether
+	// the termios settings could not even be read.
+	warnings  []error
+	noTermios bool
+
+	// undo puts back what was changed outside termios after the port
+	// was opened, such as LowLatency; Close runs it in reverse order.
+	undo         []func()
+	latencySaved bool // whether undo restores the FTDI latency timer
+}
+
+// newSerialPort wraps f, a port opened with O_NONBLOCK.  A tty goes on
+// the runtime poller, which times reads out to the nanosecond rather
+// than to VTIME's tenth of a second and lets Close interrupt them.  A
+// descriptor the poller will not take, such as a regular file opened
+// with RawDevice, is put back into blocking mode instead.
+func newSerialPort(f *os.File) (*serialPort, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	p := &serialPort{f: f, rc: rc}
+	if f.SetReadDeadline(time.Time{}) == nil {
+		p.polled = true
+		return p, nil
+	}
+	if err := p.control(clearNonblock); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// control calls fn with the port's descriptor.  Everything that needs
+// the descriptor goes through here: f.Fd would put it back into
+// blocking mode, taking it off the poller for good.  Control itself
+// only fails once the port has been closed.
+func (p *serialPort) control(fn func(fd uintptr) error) error {
+	var ferr error
+	if err := p.rc.Control(func(fd uintptr) { ferr = fn(fd) }); err != nil {
+		return ErrPortClosed
+	}
+	return ferr
+}
+
+func (p *serialPort) syscallConn() (syscall.RawConn, error) {
+	return p.rc, nil
+}
+
+func (p *serialPort) ioctl(req, arg uintptr) error {
+	return p.control(func(fd uintptr) error {
+		return ioctl(fd, req, arg)
+	})
+}
+
+// SetupFunc is the type of Config.AdvancedSetup.  On POSIX systems it
+// is passed the port's file descriptor, which is in non-blocking mode
+// and must be left that way.
+type SetupFunc func(fd uintptr) error
+
+func (p *serialPort) advancedSetup(f SetupFunc) error {
+	return p.control(f)
+}
+
+func (p *serialPort) setupWarnings() []error {
+	return p.warnings
+}
+
+// tolerate returns err, unless c.RawDevice is set, or err is
+// ErrNotSerialPort and c.AllowNonTTY is, in which case it is recorded as
+// a setup warning against the named call.
+func (p *serialPort) tolerate(c *Config, call string, err error) error {
+	if err == nil || !c.RawDevice && !(c.AllowNonTTY && err == ErrNotSerialPort) {
+		return err
+	}
+	p.warnings = append(p.warnings, os.NewSyscallError(call, err))
+	return nil
+}
+
+// lock keeps other processes out of the port, for Config.Exclusive.  A
+// port another holds gives ErrPortBusy.
+func (p *serialPort) lock() error {
+	err := p.control(flock)
+	if err == syscall.EWOULDBLOCK {
+		return ErrPortBusy
+	}
+	if err != nil {
+		return err
+	}
+	switch err := p.ioctl(syscall.TIOCEXCL, 0); err {
+	case nil:
+		p.undo = append(p.undo, func() { p.ioctl(syscall.TIOCNXCL, 0) })
+	case syscall.ENOTTY, syscall.EINVAL:
+		// Not a tty, as with RawDevice: the flock has to do.
+	default:
+		return err
+	}
+	return nil
+}
+
+// openError returns ErrPortBusy for an open refused because the tty is
+// held with TIOCEXCL, and err otherwise.
+func openError(err error) error {
+	if pe, ok := err.(*os.PathError); ok && pe.Err == syscall.EBUSY {
+		return ErrPortBusy
+	}
+	return err
+}
+
+// checkCharDevice returns ErrNotSerialPort unless the port is a
+// character device.  /dev/null and the like are caught later, when
+// their termios settings cannot be read.
+func (p *serialPort) checkCharDevice() error {
+	var st syscall.Stat_t
+	if err := p.control(func(fd uintptr) error { return syscall.Fstat(int(fd), &st) }); err != nil {
+		return err
+	}
+	if st.Mode&syscall.S_IFMT != syscall.S_IFCHR {
+		return ErrNotSerialPort
+	}
+	return nil
+}
+
+func (p *serialPort) Read(b []byte) (int, error) {
+	if p.polled {
+		d := time.Duration(atomic.LoadInt64(&p.timeout))
+		if t, ok := deadline(d, &p.rdeadline); ok {
+			p.f.SetReadDeadline(t)
+		}
+	}
+	n, err := p.f.Read(b)
+	switch {
+	case err == nil:
+	case errors.Is(err, os.ErrDeadlineExceeded):
+		err = ErrTimeout
+	case n == 0 && err == io.EOF && atomic.LoadInt32(&p.vmin0) != 0:
+		// With VMIN 0 a read returns nothing once VTIME expires.
+		err = ErrTimeout
+	default:
+		err = closedErr(err)
+	}
+	return n, err
+}
+
+func (p *serialPort) Write(b []byte) (int, error) {
+	if p.polled {
+		d := time.Duration(atomic.LoadInt64(&p.wtimeout))
+		if t, ok := deadline(d, &p.wdeadline); ok {
+			p.f.SetWriteDeadline(t)
+		}
+	}
+	n, err := p.f.Write(b)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, ErrTimeout
+	}
+	return n, closedErr(err)
+}
+
+// waitReadable waits on the runtime poller until input is queued,
+// which FIONREAD tells, as the poller may report the descriptor
+// readable once more after a Read took the data.  ctx ends the wait
+// through the read deadline, as with ReadContext, so the two should not
+// be left to run alongside a Read.
+func (p *serialPort) waitReadable(ctx context.Context) error {
+	q, ok := interface{}(p).(queueReporter)
+	if !p.polled || !ok {
+		return ErrUnsupported
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	set := fromUnixNano(atomic.LoadInt64(&p.rdeadline))
+	p.f.SetReadDeadline(set)
+	defer p.f.SetReadDeadline(set)
+	if ctx.Done() != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				p.f.SetReadDeadline(time.Now())
+			case <-stop:
+			}
+		}()
+	}
+
+	for {
+		in, _, err := q.queued()
+		if err != nil || in > 0 {
+			return err
+		}
+		waited := false
+		err = p.rc.Read(func(uintptr) bool {
+			waited = !waited
+			return !waited
+		})
+		switch {
+		case err == nil:
+		case ctx.Err() != nil:
+			return ctx.Err()
+		case errors.Is(err, os.ErrDeadlineExceeded):
+			return ErrTimeout
+		default:
+			return ErrPortClosed
+		}
+	}
+}
+
+// deadline returns the deadline for an operation with timeout d, given
+// the deadline set on the port, if there is either.
+func deadline(d time.Duration, set *int64) (time.Time, bool) {
+	t := fromUnixNano(atomic.LoadInt64(set))
+	if d > 0 {
+		if e := time.Now().Add(d); t.IsZero() || e.Before(t) {
+			t = e
+		}
+	}
+	return t, !t.IsZero()
+}
+
+// setReadDeadline and setWriteDeadline need the runtime poller.  With
+// no timeout the deadline is applied at once, so that it also bounds a
+// Read or Write already waiting; otherwise it takes effect from the
+// next call.
+func (p *serialPort) setReadDeadline(t time.Time) error {
+	if !p.polled {
+		return ErrUnsupported
+	}
+	atomic.StoreInt64(&p.rdeadline, unixNano(t))
+	if atomic.LoadInt64(&p.timeout) <= 0 {
+		p.f.SetReadDeadline(t)
+	}
+	return nil
+}
+
+func (p *serialPort) setWriteDeadline(t time.Time) error {
+	if !p.polled {
+		return ErrUnsupported
+	}
+	atomic.StoreInt64(&p.wdeadline, unixNano(t))
+	if atomic.LoadInt64(&p.wtimeout) <= 0 {
+		p.f.SetWriteDeadline(t)
+	}
+	return nil
+}
+
+// unixNano is t.UnixNano, with zero for the zero Time, and fromUnixNano
+// its inverse.
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// setWriteTimeout needs the runtime poller, which times writes out
+// with a deadline.
+func (p *serialPort) setWriteTimeout(d time.Duration) error {
+	if !p.polled {
+		return ErrUnsupported
+	}
+	atomic.StoreInt64(&p.wtimeout, int64(d))
+	if d <= 0 {
+		p.f.SetWriteDeadline(fromUnixNano(atomic.LoadInt64(&p.wdeadline)))
+	}
+	return nil
+}
+
+// outputHold reads CTS with TIOCMGET, and the output queue where the
+// platform can report it.
+func (p *serialPort) outputHold() (outputHold, error) {
+	h := outputHold{queued: -1}
+	if q, ok := interface{}(p).(queueReporter); ok {
+		if _, out, err := q.queued(); err == nil {
+			h.queued = out
+		}
+	}
+	var bits int32
+	if err := p.ioctl(syscall.TIOCMGET, uintptr(unsafe.Pointer(&bits))); err != nil {
+		return h, err
+	}
+	h.ctsLow = bits&syscall.TIOCM_CTS == 0
+	return h, nil
+}
+
+// closedErr turns the error from I/O on a closed File into
+// ErrPortClosed.
+func closedErr(err error) error {
+	if errors.Is(err, os.ErrClosed) {
+		return ErrPortClosed
+	}
+	return err
+}
+
+func (p *serialPort) Close() error {
+	for i := len(p.undo) - 1; i >= 0; i-- {
+		p.undo[i]()
+	}
+	p.undo = nil
+	return p.f.Close()
+}
+
+func (p *serialPort) setDTR(on bool) error {
+	return p.setModemBits(syscall.TIOCM_DTR, on)
+}
+
+func (p *serialPort) setRTS(on bool) error {
+	return p.setModemBits(syscall.TIOCM_RTS, on)
+}
+
+// setModemBits sets or clears bits with TIOCMBIS or TIOCMBIC.  The modem
+// bit ioctls take a C int: an int32, not a Go int, which on 64-bit
+// big-endian machines would hand the kernel the wrong half.
+func (p *serialPort) setModemBits(bits int32, on bool) error {
+	req := uintptr(syscall.TIOCMBIC)
+	if on {
+		req = syscall.TIOCMBIS
+	}
+	return p.ioctl(req, uintptr(unsafe.Pointer(&bits)))
+}
+
+func (p *serialPort) setBreak(on bool) error {
+	req := uintptr(syscall.TIOCCBRK)
+	if on {
+		req = syscall.TIOCSBRK
+	}
+	return p.ioctl(req, 0)
+}
+
+func (p *serialPort) modemStatus() (ModemStatus, error) {
+	var bits int32
+	if err := p.ioctl(syscall.TIOCMGET, uintptr(unsafe.Pointer(&bits))); err != nil {
+		return ModemStatus{}, err
+	}
+	return ModemStatus{
+		CTS: bits&syscall.TIOCM_CTS != 0,
+		DSR: bits&syscall.TIOCM_DSR != 0,
+		RI:  bits&syscall.TIOCM_RNG != 0,
+		DCD: bits&syscall.TIOCM_CAR != 0,
+	}, nil
+}
+
+func (p *serialPort) outputLines() (dtr, rts bool, err error) {
+	var bits int32
+	if err := p.ioctl(syscall.TIOCMGET, uintptr(unsafe.Pointer(&bits))); err != nil {
+		return false, false, err
+	}
+	return bits&syscall.TIOCM_DTR != 0, bits&syscall.TIOCM_RTS != 0, nil
+}
+
+var modemNames = []flagName{
+	{syscall.TIOCM_CTS, "cts"}, {syscall.TIOCM_DSR, "dsr"},
+	{syscall.TIOCM_CAR, "dcd"}, {syscall.TIOCM_RNG, "ri"},
+}
+
+// modemSettings adds the modem status lines, for Settings.
+func (p *serialPort) modemSettings(s *Settings) {
+	var bits int32
+	if err := p.ioctl(syscall.TIOCMGET, uintptr(unsafe.Pointer(&bits))); err != nil {
+		s.failed("modem_lines", err)
+		return
+	}
+	s.add("modem_lines", "%s", flagWord(uint64(bits), modemNames))
+}
+
+// clearNonblock clears O_NONBLOCK on fd, leaving the other status flags
+// as they are.
+func clearNonblock(fd uintptr) error {
+	return syscall.SetNonblock(int(fd), false)
+}
+
+// readTimeoutCC returns the VMIN and VTIME values for a read timeout of
+// d.  VTIME counts tenths of a second, so d is rounded up and capped at
+// 25.5 s.  A polled port uses a deadline instead, leaving VMIN 1 and
+// VTIME 0.
+func (p *serialPort) readTimeoutCC(d time.Duration) (vmin, vtime uint8) {
+	if d <= 0 || p.polled {
+		return 1, 0
+	}
+	t := (d + 100*time.Millisecond - 1) / (100 * time.Millisecond)
+	if t > 255 {
+		t = 255
+	}
+	return 0, uint8(t)
+}
+
+// configCC returns the VMIN and VTIME values to open the port with,
+// from c.PosixTimeouts or else c.ReadTimeout.  With PosixTimeouts the
+// descriptor is first taken off the poller and put into blocking mode
+// for good, which is what f.Fd does.
+func (p *serialPort) configCC(c *Config) (vmin, vtime uint8) {
+	if t := c.PosixTimeouts; t != nil {
+		p.f.Fd()
+		p.polled = false
+		return t.VMIN, t.VTIME
+	}
+	return p.readTimeoutCC(time.Duration(c.ReadTimeout) * time.Millisecond)
+}
+
+// setTimeout records the read timeout and VMIN for Read, once the tty
+// has been set to match.
+func (p *serialPort) setTimeout(d time.Duration, vmin uint8) {
+	atomic.StoreInt64(&p.timeout, int64(d))
+	var v int32
+	if vmin == 0 {
+		v = 1
+	}
+	atomic.StoreInt32(&p.vmin0, v)
+	if d <= 0 && p.polled {
+		p.f.SetReadDeadline(fromUnixNano(atomic.LoadInt64(&p.rdeadline)))
+	}
+}
+
+// setInitialLines applies Config.InitialDTR and InitialRTS with a single
+// TIOCMSET, so both lines change together. If neither line is to be
+// changed the modem bits are not touched at all.
+func (p *serialPort) setInitialLines(c *Config) error {
+	var set, clr int32
+	switch c.InitialDTR {
+	case LineHigh:
+		set |= syscall.TIOCM_DTR
+	case LineLow:
+		clr |= syscall.TIOCM_DTR
+	}
+	switch c.InitialRTS {
+	case LineHigh:
+		set |= syscall.TIOCM_RTS
+	case LineLow:
+		clr |= syscall.TIOCM_RTS
+	}
+	if set|clr == 0 {
+		return nil
+	}
+
+	var bits int32
+	if err := p.ioctl(syscall.TIOCMGET, uintptr(unsafe.Pointer(&bits))); err != nil {
+		return err
+	}
+	bits = bits&^clr | set
+	return p.ioctl(syscall.TIOCMSET, uintptr(unsafe.Pointer(&bits)))
+}
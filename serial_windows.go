@@ -3,11 +3,15 @@
 package goserial
 
 import (
+	"context"
 	"fmt"
-	"io"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -16,20 +20,64 @@ type serialPort struct {
 	fd syscall.Handle
 	rl sync.Mutex
 	wl sync.Mutex
+	el sync.Mutex // held by waitReadable
 	ro *syscall.Overlapped
 	wo *syscall.Overlapped
+	eo *syscall.Overlapped // for WaitCommEvent
 	st *structTimeouts
+
+	// The byte counts filled in for ro, wo and eo, guarded by the same
+	// locks.  They live here because a pointer handed to the kernel
+	// escapes, so a local would be allocated on every call.
+	rn, wn, en uint32
+	emask      uint32 // the events eo reports, guarded by el
+
+	closed int32 // set by Close
+	gone   int32 // set once the device is found to have been removed
+
+	report func(lineErrors) // set by OpenPort
+
+	// With Config.RawDevice, the setup steps that failed, and which of
+	// the settings could not be read or armed.
+	warnings                    []error
+	noDCB, noTimeouts, noEvents bool
+
+	keepDTR bool
+
+	dtr, rts bool // last state set on the lines
+
+	// The settings found when the port was opened.
+	origDCB      DCB
+	origTimeouts structTimeouts
 }
 
-type structDCB struct {
+// DCB is the Win32 DCB structure, for Config.AdvancedSetup.  Flags
+// holds its bit fields, from fBinary in bit 0 to fAbortOnError in
+// bit 14.
+type DCB struct {
 	DCBlength, BaudRate                            uint32
-	flags                                          [4]byte
+	Flags                                          uint32
 	wReserved, XonLim, XoffLim                     uint16
 	ByteSize, Parity, StopBits                     byte
 	XonChar, XoffChar, ErrorChar, EofChar, EvtChar byte
 	wReserved1                                     uint16
 }
 
+// Bits of DCB.Flags.
+const (
+	dcbBinary           = 0x00000001
+	dcbOutxCtsFlow      = 0x00000004
+	dcbDtrControlEnable = 0x00000010
+	dcbDtrControlMask   = 0x00000030
+	dcbDsrSensitivity   = 0x00000040
+	dcbOutX             = 0x00000100
+	dcbInX              = 0x00000200
+	dcbRtsControlEnable = 0x00001000
+	dcbRtsHandshake     = 0x00002000
+	dcbRtsToggle        = 0x00003000
+	dcbRtsControlMask   = 0x00003000
+)
+
 type structTimeouts struct {
 	ReadIntervalTimeout         uint32
 	ReadTotalTimeoutMultiplier  uint32
@@ -38,6 +86,28 @@ type structTimeouts struct {
 	WriteTotalTimeoutConstant   uint32
 }
 
+type structComstat struct {
+	flags, cbInQue, cbOutQue uint32
+}
+
+// Comm events, for SetCommMask and WaitCommEvent.
+const (
+	evRxChar = 0x0001 // a character received
+	evCTS    = 0x0008
+	evDSR    = 0x0010
+	evRLSD   = 0x0020 // DCD
+	evRing   = 0x0100
+)
+
+// Error bits returned by ClearCommError.
+const (
+	ceRxOver   = 0x0001 // input buffer overflow
+	ceOverrun  = 0x0002 // hardware overrun
+	ceRxParity = 0x0004
+	ceFrame    = 0x0008
+	ceBreak    = 0x0010
+)
+
 type EscapeCommParam int
 
 const (
@@ -53,10 +123,61 @@ const (
 
 
 
-func openPort(name string, c *Config) (rwc io.ReadWriteCloser, err error) {
+// portPath turns a port name into the device path to open.  COM ports
+// above COM9 can only be opened through the \\.\ device namespace, so
+// COM port names are always given that prefix, after dropping blanks
+// and leading zeros: "com007 " and \\.\com7 both open \\.\COM7.
+// Other names not starting with a backslash get the prefix as well;
+// paths are left alone.
+func portPath(name string) string {
+	s := strings.TrimSpace(name)
+	if n, ok := comNumber(strings.TrimPrefix(s, `\\.\`)); ok {
+		return `\\.\COM` + strconv.Itoa(n)
+	}
 	if len(name) > 0 && name[0] != '\\' {
-		name = "\\\\.\\" + name
+		return `\\.\` + name
 	}
+	return name
+}
+
+// comNumber returns n if s is COMn, in any case.
+func comNumber(s string) (int, bool) {
+	if len(s) < 4 || !strings.EqualFold(s[:3], "COM") {
+		return 0, false
+	}
+	n := 0
+	for _, c := range s[3:] {
+		if c < '0' || c > '9' || n > 1000 {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+	return n, n > 0
+}
+
+// checkWindows loads the calls a port needs and rejects what c asks
+// for that Windows cannot do.
+func checkWindows(c *Config) error {
+	if err := loadProcs(portProcs...); err != nil {
+		return err
+	}
+	if c.PosixTimeouts != nil {
+		return &ConfigError{Field: "PosixTimeouts", Value: *c.PosixTimeouts, Err: ErrUnsupported}
+	}
+	if c.XANY {
+		return &ConfigError{Field: "XANY", Value: true, Err: ErrUnsupported}
+	}
+	if c.MarkErrors {
+		return &ConfigError{Field: "MarkErrors", Value: true, Err: ErrUnsupported}
+	}
+	return nil
+}
+
+func openPort(name string, c *Config) (d driver, err error) {
+	if err := checkWindows(c); err != nil {
+		return nil, err
+	}
+	name = portPath(name)
 
 	h, err := syscall.CreateFile(syscall.StringToUTF16Ptr(name),
 		syscall.GENERIC_READ|syscall.GENERIC_WRITE,
@@ -65,9 +186,20 @@ func openPort(name string, c *Config) (rwc io.ReadWriteCloser, err error) {
 		syscall.OPEN_EXISTING,
 		syscall.FILE_ATTRIBUTE_NORMAL|syscall.FILE_FLAG_OVERLAPPED,
 		0)
+	if err == syscall.ERROR_ACCESS_DENIED || err == syscall.Errno(32) { // ERROR_SHARING_VIOLATION
+		// Ports open without sharing, so this is another process
+		// holding it.
+		return nil, ErrPortBusy
+	}
 	if err != nil {
 		return nil, err
 	}
+	return openHandle(h, name, c)
+}
+
+// openHandle sets up h, a port opened with FILE_FLAG_OVERLAPPED, as c
+// says.  h is closed if that fails.
+func openHandle(h syscall.Handle, name string, c *Config) (d driver, err error) {
 	f := os.NewFile(uintptr(h), name)
 	defer func() {
 		if err != nil {
@@ -75,45 +207,141 @@ func openPort(name string, c *Config) (rwc io.ReadWriteCloser, err error) {
 		}
 	}()
 
-	if err = setCommState(h, c); err != nil {
+	port := new(serialPort)
+	port.f = f
+	port.fd = h
+	port.keepDTR = c.KeepDTROnClose
+
+	// With RawDevice each step may fail; what could not be read
+	// cannot be relied on, or put back, later.  A handle that is not
+	// a comm device at all fails every step, so AllowNonTTY lets the
+	// rest through as RawDevice would.
+	dcbErr := getCommState(h, &port.origDCB)
+	if isNotCommDevice(h, dcbErr) {
+		dcbErr = ErrNotSerialPort
+		if c.AllowNonTTY && !c.RawDevice {
+			cc := *c
+			cc.RawDevice = true
+			c = &cc
+		}
+	}
+	if err = port.tolerate(c, "GetCommState", dcbErr); err != nil {
 		return
 	}
-	if err = setupComm(h, 64, 64); err != nil {
+	port.noDCB = dcbErr != nil
+	timeoutsErr := getCommTimeouts(h, &port.origTimeouts)
+	if err = port.tolerate(c, "GetCommTimeouts", timeoutsErr); err != nil {
 		return
 	}
-	if err = setCommMask(h); err != nil {
+	port.noTimeouts = timeoutsErr != nil
+
+	if !port.noDCB {
+		if err = port.tolerate(c, "SetCommState", setCommState(h, c)); err != nil {
+			return
+		}
+	}
+	if err = port.tolerate(c, "SetupComm", setupComm(h, queueSize(c.WindowsInputQueue), queueSize(c.WindowsOutputQueue))); err != nil {
 		return
 	}
-	ro, err := newOverlapped()
-	if err != nil {
+	maskErr := setCommMask(h)
+	if err = port.tolerate(c, "SetCommMask", maskErr); err != nil {
 		return
 	}
-	wo, err := newOverlapped()
-	if err != nil {
+	port.noEvents = maskErr != nil
+	if port.ro, err = newOverlapped(); err != nil {
+		return
+	}
+	if port.wo, err = newOverlapped(); err != nil {
+		return
+	}
+	if port.eo, err = newOverlapped(); err != nil {
 		return
 	}
 
-	port := new(serialPort)
-	port.f = f
-	port.fd = h
-	port.ro = ro
-	port.wo = wo
-
+	var st DCB
+	if !port.noDCB {
+		if err = port.tolerate(c, "GetCommState", getCommState(h, &st)); err != nil {
+			return
+		}
+	}
+	port.dtr = st.Flags&dcbDtrControlMask == dcbDtrControlEnable
+	port.rts = st.Flags&dcbRtsControlMask == dcbRtsControlEnable
 
 	var timeouts structTimeouts
 	port.st = &timeouts
-	port.SetTimeouts( c.ReadTimeout )
-
+	if c.WindowsTimeouts != nil {
+		timeouts = structTimeouts(*c.WindowsTimeouts)
+		err = setCommTimeouts(h, &timeouts)
+	} else {
+		err = port.setTimeouts(c.ReadTimeout)
+	}
+	if err = port.tolerate(c, "SetCommTimeouts", err); err != nil {
+		return
+	}
 
 	return port, nil
 }
 
+func (p *serialPort) setWriteTimeout(d time.Duration) error {
+	if p.noTimeouts {
+		return ErrUnsupported
+	}
+	p.st.WriteTotalTimeoutConstant = uint32((d + time.Millisecond - 1) / time.Millisecond)
+	return setCommTimeouts(p.fd, p.st)
+}
+
+// outputHold reads the hold flags and output queue from ClearCommError.
+func (p *serialPort) outputHold() (outputHold, error) {
+	const (
+		fCtsHold  = 1 << 0
+		fXoffHold = 1 << 3
+	)
+	st, _, err := p.commStatus()
+	if err != nil {
+		return outputHold{queued: -1}, err
+	}
+	return outputHold{
+		ctsLow:   st.flags&fCtsHold != 0,
+		xoffHeld: st.flags&fXoffHold != 0,
+		queued:   int(st.cbOutQue),
+	}, nil
+}
+
+// SetupFunc is the type of Config.AdvancedSetup.  On Windows it is
+// passed the port's handle and its DCB, as configured, which is applied
+// with SetCommState afterwards if the function changed it.  The DCB is
+// nil on a RawDevice port whose comm state could not be read.
+type SetupFunc func(h syscall.Handle, dcb *DCB) error
+
+func (p *serialPort) advancedSetup(f SetupFunc) error {
+	if p.noDCB {
+		return f(p.fd, nil)
+	}
+	var dcb DCB
+	if err := getCommState(p.fd, &dcb); err != nil {
+		return err
+	}
+	before := dcb
+	if err := f(p.fd, &dcb); err != nil {
+		return err
+	}
+	if dcb == before {
+		return nil
+	}
+	if err := setDCB(p.fd, &dcb); err != nil {
+		return err
+	}
+	p.dtr = dcb.Flags&dcbDtrControlMask == dcbDtrControlEnable
+	p.rts = dcb.Flags&dcbRtsControlMask == dcbRtsControlEnable
+	return nil
+}
+
 
 //see github.com/doun/goserial commit b463a6314f6c1a0b8aa9e36a525ed04d7f135abb
-func (p *serialPort) SetTimeouts(msec uint32){
+func (p *serialPort) setTimeouts(msec uint32) error {
 
 	//mimic old behaviour
-	const MAXDWORD = 1<<32 - 1
+	const MAXDWORD = MaxDWORD
 	offset := uint32(0)
     divisor := uint32(10)
 
@@ -151,29 +379,69 @@ func (p *serialPort) SetTimeouts(msec uint32){
  	*/
 
     p.st = timeouts
-    setCommTimeouts(p.fd, timeouts)
-
+    return setCommTimeouts(p.fd, timeouts)
 }
 
 
 
+func (p *serialPort) syscallConn() (syscall.RawConn, error) {
+	return p.f.SyscallConn()
+}
+
+// Close cancels any Read, Write or waitReadable in progress, which then
+// return ErrPortClosed, and closes the handle.  Once they have returned
+// it closes their events too; later calls do not touch them.
 func (p *serialPort) Close() error {
-	return p.f.Close()
+	if !atomic.CompareAndSwapInt32(&p.closed, 0, 1) {
+		return p.f.Close()
+	}
+	if p.keepDTR {
+		// Best effort: the handle is going away either way.
+		escapeCommFunction(p.fd, SETDTR)
+	}
+	cancelIoEx(p.fd, nil)
+	err := p.f.Close()
+
+	p.rl.Lock()
+	defer p.rl.Unlock()
+	p.wl.Lock()
+	defer p.wl.Unlock()
+	p.el.Lock()
+	defer p.el.Unlock()
+	for _, o := range []*syscall.Overlapped{p.ro, p.wo, p.eo} {
+		if o != nil {
+			syscall.CloseHandle(o.HEvent)
+		}
+	}
+	return err
 }
 
 func (p *serialPort) Write(buf []byte) (int, error) {
 	p.wl.Lock()
 	defer p.wl.Unlock()
 
+	switch {
+	case atomic.LoadInt32(&p.closed) != 0:
+		return 0, ErrPortClosed
+	case atomic.LoadInt32(&p.gone) != 0:
+		return 0, ErrPortDisconnected
+	}
 	if err := resetEvent(p.wo.HEvent); err != nil {
 		return 0, err
 	}
-	var n uint32
-	err := syscall.WriteFile(p.fd, buf, &n, p.wo)
+	err := syscall.WriteFile(p.fd, buf, &p.wn, p.wo)
 	if err != nil && err != syscall.ERROR_IO_PENDING {
-		return int(n), err
+		return int(p.wn), p.ioErr(err)
+	}
+	written, err := getOverlappedResult(p.fd, p.wo, &p.wn)
+	if err != nil {
+		return written, p.ioErr(err)
 	}
-	return getOverlappedResult(p.fd, p.wo)
+	if written < len(buf) {
+		// Cut short by the write timeouts.
+		return written, ErrTimeout
+	}
+	return written, nil
 }
 
 func (p *serialPort) Read(buf []byte) (int, error) {
@@ -184,101 +452,551 @@ func (p *serialPort) Read(buf []byte) (int, error) {
 	p.rl.Lock()
 	defer p.rl.Unlock()
 
+	switch {
+	case atomic.LoadInt32(&p.closed) != 0:
+		return 0, ErrPortClosed
+	case atomic.LoadInt32(&p.gone) != 0:
+		return 0, ErrPortDisconnected
+	}
+	n, err := p.read(buf)
+	if err != nil || n == 0 && len(buf) > 0 {
+		// After a line error some drivers fail reads, or stop
+		// delivering data, until the error state is cleared.
+		_, errs, cerr := p.commStatus()
+		if cerr == nil && errs != 0 && atomic.LoadInt32(&p.closed) == 0 {
+			n, err = p.read(buf)
+		}
+	}
+	if n == 0 && err == nil && len(buf) > 0 {
+		// The read completed empty: the timeouts expired.
+		return 0, ErrTimeout
+	}
+	return n, p.ioErr(err)
+}
+
+// read makes one overlapped ReadFile.  p.rl must be held.  The error is
+// left for Read to classify, after the retry for line errors.
+func (p *serialPort) read(buf []byte) (int, error) {
 	if err := resetEvent(p.ro.HEvent); err != nil {
 		return 0, err
 	}
-	var done uint32
-	err := syscall.ReadFile(p.fd, buf, &done, p.ro)
+	err := syscall.ReadFile(p.fd, buf, &p.rn, p.ro)
 	if err != nil && err != syscall.ERROR_IO_PENDING {
-		return int(done), err
+		return int(p.rn), err
 	}
-	return getOverlappedResult(p.fd, p.ro)
+	return getOverlappedResult(p.fd, p.ro, &p.rn)
 }
 
-func (p *serialPort) SetDTR(flag bool) (error) {
-	if p == nil || p.f == nil {
-		return  fmt.Errorf("Invalid port on SetDTR %v %v", p, p.f)
+// commStatus calls ClearCommError, which returns the queue depths and
+// clears the driver's error state, and reports the errors it found.
+func (p *serialPort) commStatus() (st structComstat, errs uint32, err error) {
+	if errs, err = clearCommError(p.fd, &st); err != nil {
+		return st, 0, err
+	}
+	if errs != 0 && p.report != nil {
+		p.report(lineErrors{
+			overrun: errs&(ceRxOver|ceOverrun) != 0,
+			parity:  errs&ceRxParity != 0,
+			framing: errs&ceFrame != 0,
+			breaks:  errs&ceBreak != 0,
+		})
 	}
+	return st, errs, nil
+}
 
-	if flag {
-		if err := escapeCommFunction(p.fd, SETDTR); err != nil {
-			return  err
-		} else {
-			return  err
-		}
+func (p *serialPort) reportLineErrors(f func(lineErrors)) {
+	p.report = f
+}
 
-	} else {
-		if err := escapeCommFunction(p.fd, CLRDTR); err != nil {
-			return  err
-		} else {
-			return  err
+func (p *serialPort) queued() (in, out int, err error) {
+	st, _, err := p.commStatus()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(st.cbInQue), int(st.cbOutQue), nil
+}
+
+func (p *serialPort) setupWarnings() []error {
+	return p.warnings
+}
+
+// isNotCommDevice reports whether err, from GetCommState on h, shows
+// that h is not a comm device: it is not a character device, or is one,
+// such as NUL, that has no comm state.
+func isNotCommDevice(h syscall.Handle, err error) bool {
+	if err == nil {
+		return false
+	}
+	if t, terr := syscall.GetFileType(h); terr == nil && t != syscall.FILE_TYPE_CHAR {
+		return true
+	}
+	return err == syscall.Errno(1) // ERROR_INVALID_FUNCTION
+}
+
+// tolerate returns err, unless c.RawDevice is set, in which case it is
+// recorded as a setup warning against the named call.
+func (p *serialPort) tolerate(c *Config, call string, err error) error {
+	if err == nil || !c.RawDevice {
+		return err
+	}
+	p.warnings = append(p.warnings, os.NewSyscallError(call, err))
+	return nil
+}
+
+// waitReadable waits for EV_RXCHAR, which the comm mask set at open
+// selects, with an overlapped WaitCommEvent of its own so that Read and
+// Write carry on meanwhile.  A character that arrived before the wait
+// was armed raises no event, so the input queue is checked after arming
+// and the wait cancelled if it already holds data.
+func (p *serialPort) waitReadable(ctx context.Context) error {
+	if p.noEvents {
+		return ErrUnsupported
+	}
+	p.el.Lock()
+	defer p.el.Unlock()
+
+	for {
+		if atomic.LoadInt32(&p.closed) != 0 {
+			return ErrPortClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := resetEvent(p.eo.HEvent); err != nil {
+			return err
 		}
+		var mask uint32
+		pending, err := waitCommEvent(p.fd, &mask, p.eo)
+		if err != nil {
+			return p.ioErr(err)
+		}
+		st, _, err := p.commStatus()
+		if err != nil {
+			if pending {
+				p.cancelWait()
+			}
+			return p.ioErr(err)
+		}
+		if st.cbInQue > 0 {
+			if pending {
+				p.cancelWait()
+			}
+			return nil
+		}
+		if pending {
+			if err := p.awaitEvent(ctx); err != nil {
+				return err
+			}
+		}
+		// An event with an empty queue is a modem line change, or a
+		// concurrent Read took the data; wait again.
 	}
+}
 
+// modemEvents are the comm events for a change on each line.
+var modemEvents = []struct {
+	line  ModemLines
+	event uint32
+}{
+	{ModemCTS, evCTS}, {ModemDSR, evDSR}, {ModemRI, evRing}, {ModemDCD, evRLSD},
 }
 
-func (p *serialPort) SetRTS(flag bool) (error) {
-	if p == nil || p.f == nil {
-		return  fmt.Errorf("Invalid port on SetRTS %v %v", p, p.f)
+// waitModemChange waits for the comm event of a change on one of lines,
+// with the same WaitCommEvent as waitReadable, skipping the others.
+func (p *serialPort) waitModemChange(ctx context.Context, lines ModemLines) error {
+	if p.noEvents {
+		return ErrUnsupported
+	}
+	var want uint32
+	for _, e := range modemEvents {
+		if lines&e.line != 0 {
+			want |= e.event
+		}
 	}
+	p.el.Lock()
+	defer p.el.Unlock()
 
-	if flag {
-		if err := escapeCommFunction(p.fd, SETRTS); err != nil {
-			return  err
-		} else {
-			return  err
+	for {
+		if atomic.LoadInt32(&p.closed) != 0 {
+			return ErrPortClosed
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := resetEvent(p.eo.HEvent); err != nil {
+			return err
+		}
+		pending, err := waitCommEvent(p.fd, &p.emask, p.eo)
+		if err != nil {
+			return p.ioErr(err)
 		}
+		if pending {
+			if err := p.awaitEvent(ctx); err != nil {
+				return err
+			}
+		}
+		if p.emask&want != 0 {
+			return nil
+		}
+	}
+}
 
-	} else {
-		if err := escapeCommFunction(p.fd, CLRRTS); err != nil {
-			return  err
-		} else {
-			return  err
+// awaitEvent waits for the pending WaitCommEvent to complete, giving up
+// when ctx is done or the port is closed.  Closing the handle completes
+// the wait, but the event may be missed, so closed is polled as well.
+func (p *serialPort) awaitEvent(ctx context.Context) error {
+	const poll = 50 // milliseconds
+	for {
+		ev, err := syscall.WaitForSingleObject(p.eo.HEvent, poll)
+		switch ev {
+		case syscall.WAIT_OBJECT_0:
+			if _, err := getOverlappedResult(p.fd, p.eo, &p.en); err != nil {
+				return p.ioErr(err)
+			}
+			return nil
+		case syscall.WAIT_TIMEOUT:
+			if atomic.LoadInt32(&p.closed) != 0 {
+				return ErrPortClosed
+			}
+			if err := ctx.Err(); err != nil {
+				p.cancelWait()
+				return err
+			}
+		default:
+			p.cancelWait()
+			return err
 		}
 	}
+}
 
+// cancelWait cancels the pending WaitCommEvent and waits for it to
+// finish, so that eo can be used again.
+func (p *serialPort) cancelWait() {
+	cancelIoEx(p.fd, p.eo)
+	getOverlappedResult(p.fd, p.eo, &p.en)
 }
 
+// ioErr classifies the error of a failed operation on the handle: one
+// cut short by Close gives ErrPortClosed, and one of the errors drivers
+// use once the device has been unplugged gives ErrPortDisconnected, for
+// this and every later Read and Write.  Close remains safe to call.
+func (p *serialPort) ioErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case atomic.LoadInt32(&p.closed) != 0:
+		return ErrPortClosed
+	case isDisconnect(err):
+		atomic.StoreInt32(&p.gone, 1)
+		return ErrPortDisconnected
+	}
+	return err
+}
 
+// disconnectErrors are what I/O on a comm handle fails with, depending
+// on the driver, after the device has been surprise-removed.
+var disconnectErrors = map[syscall.Errno]bool{
+	syscall.ERROR_ACCESS_DENIED:     true,
+	22:                              true, // ERROR_BAD_COMMAND
+	31:                              true, // ERROR_GEN_FAILURE
+	433:                             true, // ERROR_NO_SUCH_DEVICE
+	syscall.ERROR_OPERATION_ABORTED: true,
+	1167:                            true, // ERROR_DEVICE_NOT_CONNECTED
+	1617:                            true, // ERROR_DEVICE_REMOVED
+}
 
-var (
-	nEscapeCommFunction,
-	nSetCommState,
-	nSetCommTimeouts,
-	nSetCommMask,
-	nSetupComm,
-	nGetOverlappedResult,
-	nCreateEvent,
-	nResetEvent uintptr
-)
+func isDisconnect(err error) bool {
+	e, ok := err.(syscall.Errno)
+	return ok && disconnectErrors[e]
+}
 
-func init() {
-	k32, err := syscall.LoadLibrary("kernel32.dll")
-	if err != nil {
-		panic("LoadLibrary " + err.Error())
+func (p *serialPort) setBaud(baud int) error {
+	if p.noDCB {
+		return ErrUnsupported
 	}
-	defer syscall.FreeLibrary(k32)
+	var params DCB
+	if err := getCommState(p.fd, &params); err != nil {
+		return err
+	}
+	params.BaudRate = uint32(baud)
+	return setDCB(p.fd, &params)
+}
 
-	nEscapeCommFunction = getProcAddr(k32, "EscapeCommFunction")
-	nSetCommState = getProcAddr(k32, "SetCommState")
-	nSetCommTimeouts = getProcAddr(k32, "SetCommTimeouts")
-	nSetCommMask = getProcAddr(k32, "SetCommMask")
-	nSetupComm = getProcAddr(k32, "SetupComm")
-	nGetOverlappedResult = getProcAddr(k32, "GetOverlappedResult")
-	nCreateEvent = getProcAddr(k32, "CreateEventW")
-	nResetEvent = getProcAddr(k32, "ResetEvent")
+func (p *serialPort) setFraming(size ByteSize, parity ParityMode, stop StopBits) error {
+	if p.noDCB {
+		return ErrUnsupported
+	}
+	var params DCB
+	if err := getCommState(p.fd, &params); err != nil {
+		return err
+	}
+	frameDCB(&params, size, parity, stop)
+	return setDCB(p.fd, &params)
 }
 
-func getProcAddr(lib syscall.Handle, name string) uintptr {
-	addr, err := syscall.GetProcAddress(lib, name)
-	if err != nil {
-		panic(name + " " + err.Error())
+func (p *serialPort) setReadTimeout(d time.Duration) error {
+	msec := uint32((d + time.Millisecond - 1) / time.Millisecond)
+	return p.setTimeouts(msec)
+}
+
+func (p *serialPort) setDTR(on bool) error {
+	f := CLRDTR
+	if on {
+		f = SETDTR
+	}
+	if err := escapeCommFunction(p.fd, f); err != nil {
+		return err
+	}
+	p.dtr = on
+	return nil
+}
+
+// tcflow suspends output with SETXOFF, which makes the port act as if
+// it had received XOFF, and suspends input by sending the DCB's XOFF
+// character ahead of any pending output with TransmitCommChar.
+func (p *serialPort) tcflow(a flowAction) error {
+	switch a {
+	case outputOff:
+		return escapeCommFunction(p.fd, SETXOFF)
+	case outputOn:
+		return escapeCommFunction(p.fd, SETXON)
+	}
+	var dcb DCB
+	if err := getCommState(p.fd, &dcb); err != nil {
+		return err
+	}
+	c := dcb.XonChar
+	if a == inputOff {
+		c = dcb.XoffChar
+	}
+	return transmitCommChar(p.fd, c)
+}
+
+func (p *serialPort) setRTS(on bool) error {
+	f := CLRRTS
+	if on {
+		f = SETRTS
+	}
+	if err := escapeCommFunction(p.fd, f); err != nil {
+		return err
+	}
+	p.rts = on
+	return nil
+}
+
+func (p *serialPort) setBreak(on bool) error {
+	f := CLRBREAK
+	if on {
+		f = SETBREAK
+	}
+	return escapeCommFunction(p.fd, f)
+}
+
+// outputLines reports the line states last set through the port, as
+// Windows has no call to read them back.
+func (p *serialPort) outputLines() (dtr, rts bool, err error) {
+	return p.dtr, p.rts, nil
+}
+
+// setFlowControl changes the DCB in place.  fInX needs the XonLim and
+// XoffLim thresholds, which a DCB built by setCommState leaves at zero,
+// so they are given usual values if so.
+func (p *serialPort) setFlowControl(f FlowControl) error {
+	if p.noDCB {
+		return ErrUnsupported
+	}
+	var params DCB
+	if err := getCommState(p.fd, &params); err != nil {
+		return err
+	}
+	params.Flags &^= dcbOutxCtsFlow | dcbOutX | dcbInX | dcbRtsControlMask
+	switch f {
+	case FlowRTSCTS:
+		params.Flags |= dcbOutxCtsFlow | dcbRtsHandshake
+	case FlowXONXOFF:
+		params.Flags |= dcbOutX | dcbInX
+		if params.XonLim == 0 && params.XoffLim == 0 {
+			params.XonLim, params.XoffLim = 2048, 512
+		}
+	}
+	if f != FlowRTSCTS && p.rts {
+		params.Flags |= dcbRtsControlEnable
+	}
+	return setDCB(p.fd, &params)
+}
+
+// setRS485 uses RTS_CONTROL_TOGGLE, which raises RTS while there is
+// output and has no delays.  Many usb-to-serial drivers refuse it, and
+// the port then switches RTS itself.
+func (p *serialPort) setRS485(r *RS485) error {
+	onSend, afterSend := r.lines()
+	if p.noDCB || !onSend || afterSend || r.DelayBeforeSend != 0 || r.DelayAfterSend != 0 {
+		return ErrUnsupported
+	}
+	var params DCB
+	if err := getCommState(p.fd, &params); err != nil {
+		return err
+	}
+	params.Flags = params.Flags&^dcbRtsControlMask | dcbRtsToggle
+	if setDCB(p.fd, &params) != nil {
+		return ErrUnsupported
+	}
+	return nil
+}
+
+func (p *serialPort) getConfig(c *Config) error {
+	if p.noDCB {
+		return ErrUnsupported
 	}
-	return addr
+	var params DCB
+	if err := getCommState(p.fd, &params); err != nil {
+		return err
+	}
+
+	c.Baud = int(params.BaudRate)
+
+	switch params.ByteSize {
+	case 5:
+		c.Size = Byte5
+	case 6:
+		c.Size = Byte6
+	case 7:
+		c.Size = Byte7
+	default:
+		c.Size = Byte8
+	}
+
+	switch params.Parity {
+	case 1:
+		c.Parity = ParityOdd
+	case 2:
+		c.Parity = ParityEven
+	case 3:
+		c.Parity = ParityMark
+	case 4:
+		c.Parity = ParitySpace
+	default:
+		c.Parity = ParityNone
+	}
+
+	c.XONChar, c.XOFFChar = params.XonChar, params.XoffChar
+	c.RTSFlowControl = params.Flags&dcbOutxCtsFlow != 0
+	c.XONFlowControl = params.Flags&dcbOutX != 0
+	c.MonitorDCD = params.Flags&dcbDsrSensitivity != 0
+
+	switch params.StopBits {
+	case 1:
+		c.StopBits = StopBits1Half
+	case 2:
+		c.StopBits = StopBits2
+	default:
+		c.StopBits = StopBits1
+	}
+
+	var timeouts structTimeouts
+	if err := getCommTimeouts(p.fd, &timeouts); err != nil {
+		return err
+	}
+	wt := WindowsTimeouts(timeouts)
+	c.WindowsTimeouts = &wt
+	return nil
+}
+
+func (p *serialPort) restore() error {
+	if !p.noDCB {
+		dcb := p.origDCB
+		if err := setDCB(p.fd, &dcb); err != nil {
+			return err
+		}
+	}
+	if p.noTimeouts {
+		return nil
+	}
+	timeouts := p.origTimeouts
+	return setCommTimeouts(p.fd, &timeouts)
+}
+
+func (p *serialPort) flush(in, out bool) error {
+	const (
+		PURGE_TXCLEAR = 0x0004
+		PURGE_RXCLEAR = 0x0008
+	)
+	var flags uintptr
+	if in {
+		flags |= PURGE_RXCLEAR
+	}
+	if out {
+		flags |= PURGE_TXCLEAR
+	}
+	if flags == 0 {
+		return nil
+	}
+	r, _, err := syscall.Syscall(nPurgeComm.Addr(), 2, uintptr(p.fd), flags, 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// drain waits for the output to be sent.  FlushFileBuffers on a comm
+// handle returns once the driver's transmit buffer is empty.
+func (p *serialPort) drain() error {
+	return syscall.FlushFileBuffers(p.fd)
+}
+
+// The procs are resolved when first needed rather than when the package
+// is initialized, so that merely importing it cannot panic where a DLL
+// or proc is missing.  openPort, listPorts and setLatencyTimer check
+// theirs with loadProcs and turn a failure into an error.
+var (
+	modkernel32 = syscall.NewLazyDLL("kernel32.dll")
+	modadvapi32 = syscall.NewLazyDLL("advapi32.dll")
+
+	nEscapeCommFunction  = modkernel32.NewProc("EscapeCommFunction")
+	nGetCommState        = modkernel32.NewProc("GetCommState")
+	nSetCommState        = modkernel32.NewProc("SetCommState")
+	nGetCommTimeouts     = modkernel32.NewProc("GetCommTimeouts")
+	nSetCommTimeouts     = modkernel32.NewProc("SetCommTimeouts")
+	nSetCommMask         = modkernel32.NewProc("SetCommMask")
+	nSetupComm           = modkernel32.NewProc("SetupComm")
+	nWaitCommEvent       = modkernel32.NewProc("WaitCommEvent")
+	nClearCommError      = modkernel32.NewProc("ClearCommError")
+	nPurgeComm           = modkernel32.NewProc("PurgeComm")
+	nGetOverlappedResult = modkernel32.NewProc("GetOverlappedResult")
+	nCreateEvent         = modkernel32.NewProc("CreateEventW")
+	nResetEvent          = modkernel32.NewProc("ResetEvent")
+	nCancelIoEx          = modkernel32.NewProc("CancelIoEx")
+	nTransmitCommChar    = modkernel32.NewProc("TransmitCommChar")
+	nGetCommModemStatus  = modkernel32.NewProc("GetCommModemStatus")
+
+	nRegEnumValue  = modadvapi32.NewProc("RegEnumValueW")
+	nRegSetValueEx = modadvapi32.NewProc("RegSetValueExW")
+)
+
+// portProcs are the procs an open port uses.
+var portProcs = []*syscall.LazyProc{
+	nEscapeCommFunction, nGetCommState, nSetCommState,
+	nGetCommTimeouts, nSetCommTimeouts, nSetCommMask, nSetupComm,
+	nWaitCommEvent, nClearCommError, nPurgeComm,
+	nGetOverlappedResult, nCreateEvent, nResetEvent, nCancelIoEx,
+	nTransmitCommChar, nGetCommModemStatus,
+}
+
+// findProc resolves a proc; tests replace it.
+var findProc = (*syscall.LazyProc).Find
+
+// loadProcs resolves procs, so that calling them cannot panic.
+func loadProcs(procs ...*syscall.LazyProc) error {
+	for _, proc := range procs {
+		if err := findProc(proc); err != nil {
+			return fmt.Errorf("goserial: %v", err)
+		}
+	}
+	return nil
 }
 
 func escapeCommFunction(h syscall.Handle, flag EscapeCommParam) (error) {
-	r, _, err := syscall.Syscall(nEscapeCommFunction, 2, uintptr(h), uintptr(flag), 0)
+	r, _, err := syscall.Syscall(nEscapeCommFunction.Addr(), 2, uintptr(h), uintptr(flag), 0)
 	if r == 0 {
 		return err
 	}
@@ -286,17 +1004,66 @@ func escapeCommFunction(h syscall.Handle, flag EscapeCommParam) (error) {
 
 }
 
+func getCommState(h syscall.Handle, params *DCB) error {
+	params.DCBlength = uint32(unsafe.Sizeof(*params))
+	r, _, err := syscall.Syscall(nGetCommState.Addr(), 2, uintptr(h), uintptr(unsafe.Pointer(params)), 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
 func setCommState(h syscall.Handle, c *Config) error {
-	var params structDCB
+	var params DCB
 	params.DCBlength = uint32(unsafe.Sizeof(params))
 
-	params.flags[0] = 0x01  // fBinary
-	//params.flags[0] |= 0x10 // Assert DSR  //do not assert DSR on connect (mimic *nix rs232)
+	params.Flags = dcbBinary
+	//params.Flags |= 0x10 // Assert DSR  //do not assert DSR on connect (mimic *nix rs232)
+	if c.MonitorDCD {
+		params.Flags |= dcbDsrSensitivity
+	}
+
+	// Select the initial modem line states.  LineUnchanged keeps the
+	// control setting the driver already has.
+	if c.InitialDTR == LineUnchanged || c.InitialRTS == LineUnchanged {
+		var cur DCB
+		if err := getCommState(h, &cur); err != nil {
+			return err
+		}
+		if c.InitialDTR == LineUnchanged {
+			params.Flags |= cur.Flags & dcbDtrControlMask
+		}
+		if c.InitialRTS == LineUnchanged {
+			params.Flags |= cur.Flags & dcbRtsControlMask
+		}
+	}
+	switch c.InitialDTR {
+	case LineDefault:
+		if c.KeepDTROnClose {
+			params.Flags |= dcbDtrControlEnable
+		}
+	case LineHigh:
+		params.Flags |= dcbDtrControlEnable
+	}
+	if c.InitialRTS == LineHigh {
+		params.Flags |= dcbRtsControlEnable
+	}
 
 	params.BaudRate = uint32(c.Baud)
 
-	// Select byte size.
-	switch c.Size {
+	// Select byte size, parity mode and stop bits.
+	frameDCB(&params, c.Size, c.Parity, c.StopBits)
+
+	// Select the software flow control characters.
+	params.XonChar, params.XoffChar = c.xonChars()
+
+	return setDCB(h, &params)
+}
+
+// frameDCB selects the byte size, parity mode and stop bits in params.
+// Config.check has already rejected values outside the enums.
+func frameDCB(params *DCB, size ByteSize, parity ParityMode, stop StopBits) {
+	switch size {
 	case Byte5:
 		params.ByteSize = 5
 	case Byte6:
@@ -306,32 +1073,38 @@ func setCommState(h syscall.Handle, c *Config) error {
 	case Byte8:
 		params.ByteSize = 8
 	default:
-		panic(c.Size)
+		panic(size)
 	}
 
-	// Select parity mode.
-	switch c.Parity {
+	switch parity {
 	case ParityNone:
 		params.Parity = 0
 	case ParityEven:
 		params.Parity = 2
 	case ParityOdd:
 		params.Parity = 1
+	case ParityMark:
+		params.Parity = 3
+	case ParitySpace:
+		params.Parity = 4
 	default:
-		panic(c.Parity)
+		panic(parity)
 	}
 
-	// Selet stop bits.
-	switch c.StopBits {
+	switch stop {
 	case StopBits1:
 		params.StopBits = 0
 	case StopBits2:
 		params.StopBits = 2
+	case StopBits1Half:
+		params.StopBits = 1
 	default:
-		panic(c.StopBits)
+		panic(stop)
 	}
+}
 
-	r, _, err := syscall.Syscall(nSetCommState, 2, uintptr(h), uintptr(unsafe.Pointer(&params)), 0)
+func setDCB(h syscall.Handle, params *DCB) error {
+	r, _, err := syscall.Syscall(nSetCommState.Addr(), 2, uintptr(h), uintptr(unsafe.Pointer(params)), 0)
 	if r == 0 {
 		return err
 	}
@@ -340,32 +1113,87 @@ func setCommState(h syscall.Handle, c *Config) error {
 
 //see github.com/doun/goserial commit b463a6314f6c1a0b8aa9e36a525ed04d7f135abb
 func setCommTimeouts(h syscall.Handle, timeouts *structTimeouts) error {
-	r, _, err := syscall.Syscall(nSetCommTimeouts, 2, uintptr(h), uintptr(unsafe.Pointer(timeouts)), 0)
+	r, _, err := syscall.Syscall(nSetCommTimeouts.Addr(), 2, uintptr(h), uintptr(unsafe.Pointer(timeouts)), 0)
 	if r == 0 {
 		return err
 	}
 	return nil
 }
 
+func getCommTimeouts(h syscall.Handle, timeouts *structTimeouts) error {
+	r, _, err := syscall.Syscall(nGetCommTimeouts.Addr(), 2, uintptr(h), uintptr(unsafe.Pointer(timeouts)), 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// queueSize returns the SetupComm size for Config.WindowsInputQueue or
+// WindowsOutputQueue.  When they are zero it asks for 64 bytes, as
+// OpenPort always did, which is less than drivers allocate anyway, so
+// they keep their defaults.
+func queueSize(n int) int {
+	if n == 0 {
+		return 64
+	}
+	return n
+}
+
 func setupComm(h syscall.Handle, in, out int) error {
-	r, _, err := syscall.Syscall(nSetupComm, 3, uintptr(h), uintptr(in), uintptr(out))
+	r, _, err := syscall.Syscall(nSetupComm.Addr(), 3, uintptr(h), uintptr(in), uintptr(out))
 	if r == 0 {
 		return err
 	}
 	return nil
 }
 
+// setCommMask arms the events waitReadable and waitModemChange wait
+// for: a character received, and a change on any modem status line.
 func setCommMask(h syscall.Handle) error {
-	const EV_RXCHAR = 0x0001
-	r, _, err := syscall.Syscall(nSetCommMask, 2, uintptr(h), EV_RXCHAR, 0)
+	const mask = evRxChar | evCTS | evDSR | evRLSD | evRing
+	r, _, err := syscall.Syscall(nSetCommMask.Addr(), 2, uintptr(h), mask, 0)
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// waitCommEvent starts an overlapped wait for the events in the comm
+// mask, telling whether it is still pending or completed at once.
+func waitCommEvent(h syscall.Handle, mask *uint32, overlapped *syscall.Overlapped) (pending bool, err error) {
+	r, _, err := syscall.Syscall(nWaitCommEvent.Addr(), 3, uintptr(h), uintptr(unsafe.Pointer(mask)), uintptr(unsafe.Pointer(overlapped)))
+	if r != 0 {
+		return false, nil
+	}
+	if err == syscall.ERROR_IO_PENDING {
+		return true, nil
+	}
+	return false, err
+}
+
+func clearCommError(h syscall.Handle, st *structComstat) (uint32, error) {
+	var errs uint32
+	r, _, err := syscall.Syscall(nClearCommError.Addr(), 3, uintptr(h), uintptr(unsafe.Pointer(&errs)), uintptr(unsafe.Pointer(st)))
+	if r == 0 {
+		return 0, err
+	}
+	return errs, nil
+}
+
+func transmitCommChar(h syscall.Handle, c byte) error {
+	r, _, err := syscall.Syscall(nTransmitCommChar.Addr(), 2, uintptr(h), uintptr(c), 0)
 	if r == 0 {
 		return err
 	}
 	return nil
 }
 
+func cancelIoEx(h syscall.Handle, overlapped *syscall.Overlapped) {
+	syscall.Syscall(nCancelIoEx.Addr(), 2, uintptr(h), uintptr(unsafe.Pointer(overlapped)), 0)
+}
+
 func resetEvent(h syscall.Handle) error {
-	r, _, err := syscall.Syscall(nResetEvent, 1, uintptr(h), 0, 0)
+	r, _, err := syscall.Syscall(nResetEvent.Addr(), 1, uintptr(h), 0, 0)
 	if r == 0 {
 		return err
 	}
@@ -374,7 +1202,7 @@ func resetEvent(h syscall.Handle) error {
 
 func newOverlapped() (*syscall.Overlapped, error) {
 	var overlapped syscall.Overlapped
-	r, _, err := syscall.Syscall6(nCreateEvent, 4, 0, 1, 0, 0, 0, 0)
+	r, _, err := syscall.Syscall6(nCreateEvent.Addr(), 4, 0, 1, 0, 0, 0, 0)
 	if r == 0 {
 		return nil, err
 	}
@@ -382,15 +1210,17 @@ func newOverlapped() (*syscall.Overlapped, error) {
 	return &overlapped, nil
 }
 
-func getOverlappedResult(h syscall.Handle, overlapped *syscall.Overlapped) (int, error) {
-	var n int
-	r, _, err := syscall.Syscall6(nGetOverlappedResult, 4,
+// getOverlappedResult waits for the operation on overlapped and returns
+// its byte count, which the kernel writes through n: a DWORD, whatever
+// the size of int.
+func getOverlappedResult(h syscall.Handle, overlapped *syscall.Overlapped, n *uint32) (int, error) {
+	r, _, err := syscall.Syscall6(nGetOverlappedResult.Addr(), 4,
 		uintptr(h),
 		uintptr(unsafe.Pointer(overlapped)),
-		uintptr(unsafe.Pointer(&n)), 1, 0, 0)
+		uintptr(unsafe.Pointer(n)), 1, 0, 0)
 	if r == 0 {
-		return n, err
+		return int(*n), err
 	}
 
-	return n, nil
+	return int(*n), nil
 }
@@ -0,0 +1,336 @@
+// +build windows
+
+package goserial
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+func TestPortPath(t *testing.T) {
+	for _, tc := range []struct{ name, want string }{
+		{"COM1", `\\.\COM1`},
+		{"COM10", `\\.\COM10`},
+		{"com007", `\\.\COM7`},
+		{"COM3 ", `\\.\COM3`},
+		{" com12\t", `\\.\COM12`},
+		{`\\.\COM4`, `\\.\COM4`},
+		{`\\.\com010`, `\\.\COM10`},
+		{"CNCA0", `\\.\CNCA0`},
+		{"COM", `\\.\COM`},
+		{"COM0", `\\.\COM0`},
+		{"COM1x", `\\.\COM1x`},
+		{`\\?\USB#VID_0403&PID_6001#A1#{86e0d1e0-8089-11d0-9ce4-08003e301f73}`, `\\?\USB#VID_0403&PID_6001#A1#{86e0d1e0-8089-11d0-9ce4-08003e301f73}`},
+		{`\\.\Global\CNCB0`, `\\.\Global\CNCB0`},
+	} {
+		if got := portPath(tc.name); got != tc.want {
+			t.Errorf("portPath(%q) = %q, want %q", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestMissingProc(t *testing.T) {
+	defer func(f func(*syscall.LazyProc) error) { findProc = f }(findProc)
+	findProc = func(p *syscall.LazyProc) error {
+		if p.Name == "WaitCommEvent" {
+			return errors.New("Failed to find WaitCommEvent procedure in kernel32.dll")
+		}
+		return p.Find()
+	}
+	_, err := OpenPort(&Config{Name: "COM1", Baud: 9600})
+	if err == nil || !strings.Contains(err.Error(), "WaitCommEvent") {
+		t.Errorf("OpenPort with a missing proc: %v", err)
+	}
+}
+
+func TestIsDisconnect(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want bool
+	}{
+		{syscall.ERROR_OPERATION_ABORTED, true},
+		{syscall.ERROR_ACCESS_DENIED, true},
+		{syscall.Errno(22), true},   // ERROR_BAD_COMMAND
+		{syscall.Errno(1167), true}, // ERROR_DEVICE_NOT_CONNECTED
+		{syscall.ERROR_FILE_NOT_FOUND, false},
+		{syscall.ERROR_IO_PENDING, false},
+		{ErrTimeout, false},
+		{errors.New("other"), false},
+	} {
+		if got := isDisconnect(tc.err); got != tc.want {
+			t.Errorf("isDisconnect(%v) = %v, want %v", tc.err, got, tc.want)
+		}
+	}
+
+	p := &serialPort{}
+	if err := p.ioErr(syscall.ERROR_ACCESS_DENIED); err != ErrPortDisconnected {
+		t.Errorf("ioErr = %v, want ErrPortDisconnected", err)
+	}
+	if n, err := p.Write([]byte("x")); err != ErrPortDisconnected {
+		t.Errorf("Write after removal = %d, %v", n, err)
+	}
+	p.closed = 1
+	if err := p.ioErr(syscall.ERROR_OPERATION_ABORTED); err != ErrPortClosed {
+		t.Errorf("ioErr after Close = %v, want ErrPortClosed", err)
+	}
+}
+
+// TestStructLayout checks the sizes of the structures passed to the
+// Windows API, which are the same on 386, amd64 and arm64.
+func TestUSBInstanceID(t *testing.T) {
+	for _, tc := range []struct {
+		id   string
+		want PortInfo
+		ok   bool
+	}{
+		{`USB\VID_0403&PID_6001\A6008isP`, PortInfo{IsUSB: true, VID: 0x0403, PID: 0x6001, SerialNumber: "A6008isP"}, true},
+		{`USB\VID_2341&PID_8036&MI_00\6&2A3D1F2B&0&0000`, PortInfo{IsUSB: true, VID: 0x2341, PID: 0x8036}, true},
+		{`FTDIBUS\VID_0403+PID_6001+A6008ISPA\0000`, PortInfo{}, false},
+		{`ACPI\PNP0501\1`, PortInfo{}, false},
+	} {
+		var pi PortInfo
+		if ok := usbInstanceID(&pi, tc.id); ok != tc.ok || pi != tc.want {
+			t.Errorf("usbInstanceID(%q) = %+v, %v; want %+v, %v", tc.id, pi, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestStructLayout(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		got, want uintptr
+	}{
+		{"DCB", unsafe.Sizeof(DCB{}), 28},
+		{"COMMTIMEOUTS", unsafe.Sizeof(structTimeouts{}), 20},
+		{"COMSTAT", unsafe.Sizeof(structComstat{}), 12},
+		{"DCB.XonLim", unsafe.Offsetof(DCB{}.XonLim), 14},
+		{"DCB.ByteSize", unsafe.Offsetof(DCB{}.ByteSize), 18},
+		{"DCB.wReserved1", unsafe.Offsetof(DCB{}.wReserved1), 26},
+		{"SP_DEVINFO_DATA", unsafe.Sizeof(spDevinfoData{}), 24 + unsafe.Sizeof(uintptr(0))},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("%s: %d, want %d", tc.name, tc.got, tc.want)
+		}
+	}
+}
+
+var nCreateNamedPipe = modkernel32.NewProc("CreateNamedPipeW")
+
+// overlappedPipe returns two Ports joined by a named pipe, which takes
+// the same overlapped ReadFile and WriteFile as a comm handle, so that
+// the I/O path can be measured without a serial port.
+func overlappedPipe(tb testing.TB) (*Port, *Port) {
+	const (
+		pipeAccessDuplex   = 0x3
+		fileFlagOverlapped = 0x40000000
+	)
+	name := fmt.Sprintf(`\\.\pipe\goserial-test-%d-%d`, os.Getpid(), time.Now().UnixNano())
+	namep, err := syscall.UTF16PtrFromString(name)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	r, _, err := nCreateNamedPipe.Call(uintptr(unsafe.Pointer(namep)),
+		pipeAccessDuplex|fileFlagOverlapped, 0, 1, 4096, 4096, 0, 0)
+	if syscall.Handle(r) == syscall.InvalidHandle {
+		tb.Fatal("CreateNamedPipe:", err)
+	}
+	server := syscall.Handle(r)
+	client, err := syscall.CreateFile(namep, syscall.GENERIC_READ|syscall.GENERIC_WRITE,
+		0, nil, syscall.OPEN_EXISTING, fileFlagOverlapped, 0)
+	if err != nil {
+		syscall.CloseHandle(server)
+		tb.Fatal("CreateFile:", err)
+	}
+	return overlappedPort(tb, server, name), overlappedPort(tb, client, name)
+}
+
+func overlappedPort(tb testing.TB, h syscall.Handle, name string) *Port {
+	p := &serialPort{f: os.NewFile(uintptr(h), name), fd: h}
+	for _, o := range []**syscall.Overlapped{&p.ro, &p.wo, &p.eo} {
+		var err error
+		if *o, err = newOverlapped(); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	tb.Cleanup(func() { p.Close() })
+	return &Port{d: p}
+}
+
+func TestReadWriteAllocs(t *testing.T) {
+	a, b := overlappedPipe(t)
+	wbuf, rbuf := make([]byte, 64), make([]byte, 64)
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := a.Write(wbuf); err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < len(wbuf); {
+			k, err := b.Read(rbuf[n:])
+			if err != nil {
+				t.Fatal(err)
+			}
+			n += k
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Write and Read allocate %v times per call; want 0", allocs)
+	}
+}
+
+func BenchmarkWrite(b *testing.B) {
+	w, r := overlappedPipe(b)
+	go io.Copy(io.Discard, r)
+	buf := make([]byte, 1024)
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := w.Write(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRead(b *testing.B) {
+	w, r := overlappedPipe(b)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			if _, err := w.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+	buf := make([]byte, 1024)
+	b.SetBytes(int64(len(buf)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestConcurrentReadWrite runs several writers on one end while the
+// other end streams data back, checking that each Write arrives whole
+// and in order and that no direction holds up the other.
+func TestConcurrentReadWrite(t *testing.T) {
+	a, b := overlappedPipe(t)
+	const (
+		writers = 4
+		chunks  = 500
+		size    = 64
+		bulk    = 1 << 20
+	)
+
+	errs := make(chan error, writers+3)
+	for w := 0; w < writers; w++ {
+		go func(w int) {
+			chunk := make([]byte, size)
+			for i := 0; i < chunks; i++ {
+				chunk[0], chunk[1], chunk[2] = byte(w), byte(i), byte(i>>8)
+				if _, err := a.Write(chunk); err != nil {
+					errs <- fmt.Errorf("writer %d: %v", w, err)
+					return
+				}
+			}
+			errs <- nil
+		}(w)
+	}
+	go func() {
+		var next [writers]int
+		chunk := make([]byte, size)
+		for i := 0; i < writers*chunks; i++ {
+			if _, err := io.ReadFull(b, chunk); err != nil {
+				errs <- fmt.Errorf("reader: %v", err)
+				return
+			}
+			w, seq := int(chunk[0]), int(chunk[1])|int(chunk[2])<<8
+			if w >= writers || seq != next[w] {
+				errs <- fmt.Errorf("chunk %d is writer %d's %d; want its %d", i, w, seq, next[w])
+				return
+			}
+			next[w]++
+		}
+		errs <- nil
+	}()
+
+	data := make([]byte, bulk)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	go func() {
+		_, err := b.Write(data)
+		errs <- err
+	}()
+	go func() {
+		got := make([]byte, bulk)
+		if _, err := io.ReadFull(a, got); err != nil {
+			errs <- err
+			return
+		}
+		for i := range got {
+			if got[i] != data[i] {
+				errs <- fmt.Errorf("bulk data differs at byte %d", i)
+				return
+			}
+		}
+		errs <- nil
+	}()
+
+	timeout := time.After(30 * time.Second)
+	for i := 0; i < writers+3; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-timeout:
+			t.Fatal("concurrent reads and writes did not finish")
+		}
+	}
+}
+
+// TestCloseCancelsIO checks that Close ends a Read waiting for data and
+// a Write waiting for room, and that both fail quietly afterwards.
+func TestCloseCancelsIO(t *testing.T) {
+	w, _ := overlappedPipe(t)
+	_, r := overlappedPipe(t)
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := w.Write(make([]byte, 1<<20)) // far more than the pipe holds
+		done <- err
+	}()
+	go func() {
+		_, err := r.Read(make([]byte, 16))
+		done <- err
+	}()
+	time.Sleep(100 * time.Millisecond)
+	w.Close()
+	r.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-done:
+			if err != ErrPortClosed {
+				t.Errorf("I/O across Close = %v; want ErrPortClosed", err)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Close did not end the pending I/O")
+		}
+	}
+
+	if _, err := r.Read(make([]byte, 1)); err != ErrPortClosed {
+		t.Errorf("Read after Close = %v; want ErrPortClosed", err)
+	}
+	if _, err := w.Write([]byte("x")); err != ErrPortClosed {
+		t.Errorf("Write after Close = %v; want ErrPortClosed", err)
+	}
+}
@@ -0,0 +1,308 @@
+// Package serialtest provides fake serial devices for testing code that
+// uses goserial.
+package serialtest
+
+import (
+	"bytes"
+	"regexp"
+	"sync"
+	"time"
+
+	serial "github.com/tarm/goserial"
+)
+
+// A MockPort is a scripted fake device.  It can stand in for the port
+// returned by serial.OpenPort: it has the same Read, Write, Close and
+// read timeout methods.  Data written to it is recorded and matched
+// against its rules, which queue replies to be read back.
+type MockPort struct {
+	mu      sync.Mutex
+	rules   []*Rule
+	pending []byte // written but not yet matched by a rule
+	written []byte // everything written
+	input   []byte // waiting to be read
+	nread   int    // bytes returned by Read so far
+	reads   int    // calls to Read so far
+	timeout time.Duration
+	closed  bool
+	timers  []*time.Timer
+	wake    chan struct{} // closed, and replaced, on every change
+
+	readErrs  map[int]error
+	failAt    int
+	failAtErr error
+}
+
+// NewMockPort returns a MockPort with no rules.  Until rules are added
+// it swallows everything written to it and has nothing to read.
+func NewMockPort() *MockPort {
+	return &MockPort{wake: make(chan struct{}), failAt: -1}
+}
+
+// A Rule answers data written to a MockPort.  Each time its pattern
+// matches the data written since the last match, the data up to the end
+// of the match is consumed and the rule's reply is queued to be read.
+// Rules should be set up before the port is used.
+type Rule struct {
+	match func(b []byte) (start, end int)
+	reply func(req []byte) []byte
+	delay time.Duration
+	left  int // matches remaining, or -1 for no limit
+}
+
+// On adds a rule matching the exact bytes req.
+func (m *MockPort) On(req string) *Rule {
+	return m.addRule(func(b []byte) (int, int) {
+		i := bytes.Index(b, []byte(req))
+		if i < 0 {
+			return 0, 0
+		}
+		return i, i + len(req)
+	})
+}
+
+// OnRegexp adds a rule matching re.
+func (m *MockPort) OnRegexp(re *regexp.Regexp) *Rule {
+	return m.addRule(func(b []byte) (int, int) {
+		loc := re.FindIndex(b)
+		if loc == nil {
+			return 0, 0
+		}
+		return loc[0], loc[1]
+	})
+}
+
+// OnFunc adds a rule that calls match with the unmatched data written
+// so far.  Match returns how many bytes of b, counting from the start,
+// the request takes up, or 0 if b does not yet hold a whole request.
+func (m *MockPort) OnFunc(match func(b []byte) int) *Rule {
+	return m.addRule(func(b []byte) (int, int) {
+		return 0, match(b)
+	})
+}
+
+func (m *MockPort) addRule(match func(b []byte) (start, end int)) *Rule {
+	r := &Rule{match: match, left: -1}
+	m.mu.Lock()
+	m.rules = append(m.rules, r)
+	m.mu.Unlock()
+	return r
+}
+
+// Reply sets the data the rule sends back.
+func (r *Rule) Reply(s string) *Rule {
+	return r.ReplyFunc(func([]byte) []byte { return []byte(s) })
+}
+
+// ReplyFunc sets a function computing the reply from the matched
+// request; for a rule added with OnFunc that is all the data consumed.
+// A nil or empty reply sends nothing.
+func (r *Rule) ReplyFunc(f func(req []byte) []byte) *Rule {
+	r.reply = f
+	return r
+}
+
+// After delays the reply by d.
+func (r *Rule) After(d time.Duration) *Rule {
+	r.delay = d
+	return r
+}
+
+// Times limits the rule to its first n matches.  After that the rule is
+// ignored, so a device can be made to go silent.
+func (r *Rule) Times(n int) *Rule {
+	r.left = n
+	return r
+}
+
+// Send queues data to be read as if the device had sent it unasked.
+func (m *MockPort) Send(s string) {
+	m.mu.Lock()
+	m.input = append(m.input, s...)
+	m.changed()
+	m.mu.Unlock()
+}
+
+// FailRead makes the nth call to Read, counting from 1, return err
+// instead of data.
+func (m *MockPort) FailRead(n int, err error) {
+	m.mu.Lock()
+	if m.readErrs == nil {
+		m.readErrs = make(map[int]error)
+	}
+	m.readErrs[n] = err
+	m.mu.Unlock()
+}
+
+// FailAfter makes Read return err once off bytes have been read, as if
+// the device had gone away part way through a transfer.  Reads before
+// then are cut short so that exactly off bytes are delivered.
+func (m *MockPort) FailAfter(off int, err error) {
+	m.mu.Lock()
+	m.failAt, m.failAtErr = off, err
+	m.mu.Unlock()
+}
+
+// Written returns a copy of everything written to the port.
+func (m *MockPort) Written() []byte {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]byte(nil), m.written...)
+}
+
+// SetReadTimeout sets how long Read waits for data before returning
+// serial.ErrTimeout.  Zero, the default, waits forever.
+func (m *MockPort) SetReadTimeout(d time.Duration) error {
+	m.mu.Lock()
+	m.timeout = d
+	m.mu.Unlock()
+	return nil
+}
+
+// ReadTimeout returns the current read timeout.
+func (m *MockPort) ReadTimeout() time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.timeout
+}
+
+func (m *MockPort) Read(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, serial.ErrPortClosed
+	}
+	m.reads++
+	if err := m.readErrs[m.reads]; err != nil {
+		return 0, err
+	}
+
+	var deadline time.Time
+	if m.timeout > 0 {
+		deadline = time.Now().Add(m.timeout)
+	}
+	for len(m.input) == 0 || m.nread == m.failAt {
+		switch {
+		case m.closed:
+			return 0, serial.ErrPortClosed
+		case m.nread == m.failAt:
+			return 0, m.failAtErr
+		}
+		if !m.wait(deadline) {
+			return 0, serial.ErrTimeout
+		}
+	}
+
+	if m.failAt >= 0 && m.nread+len(b) > m.failAt {
+		b = b[:m.failAt-m.nread]
+	}
+	n := copy(b, m.input)
+	m.input = m.input[n:]
+	m.nread += n
+	return n, nil
+}
+
+func (m *MockPort) Write(b []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return 0, serial.ErrPortClosed
+	}
+	m.written = append(m.written, b...)
+	m.pending = append(m.pending, b...)
+	m.runRules()
+	return len(b), nil
+}
+
+// runRules answers every request in m.pending.  m.mu must be held.
+func (m *MockPort) runRules() {
+	for {
+		r, start, end := m.firstMatch()
+		if r == nil {
+			return
+		}
+		req := append([]byte(nil), m.pending[start:end]...)
+		m.pending = m.pending[end:]
+		if r.left > 0 {
+			r.left--
+		}
+		if r.reply == nil {
+			continue
+		}
+		reply := r.reply(req)
+		if len(reply) == 0 {
+			continue
+		}
+		if r.delay <= 0 {
+			m.input = append(m.input, reply...)
+			m.changed()
+			continue
+		}
+		m.timers = append(m.timers, time.AfterFunc(r.delay, func() {
+			m.mu.Lock()
+			if !m.closed {
+				m.input = append(m.input, reply...)
+				m.changed()
+			}
+			m.mu.Unlock()
+		}))
+	}
+}
+
+// firstMatch returns the live rule whose match ends earliest in
+// m.pending, the first one added winning a tie.
+func (m *MockPort) firstMatch() (best *Rule, start, end int) {
+	for _, r := range m.rules {
+		if r.left == 0 {
+			continue
+		}
+		s, e := r.match(m.pending)
+		if e <= 0 || e > len(m.pending) || s < 0 || s > e {
+			continue
+		}
+		if best == nil || e < end {
+			best, start, end = r, s, e
+		}
+	}
+	return best, start, end
+}
+
+func (m *MockPort) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return serial.ErrPortClosed
+	}
+	m.closed = true
+	for _, t := range m.timers {
+		t.Stop()
+	}
+	m.changed()
+	return nil
+}
+
+// changed wakes everyone waiting on m.  m.mu must be held.
+func (m *MockPort) changed() {
+	close(m.wake)
+	m.wake = make(chan struct{})
+}
+
+// wait releases m.mu until m changes or the deadline passes, returning
+// false in the latter case.
+func (m *MockPort) wait(deadline time.Time) bool {
+	wake := m.wake
+	m.mu.Unlock()
+	defer m.mu.Lock()
+	if deadline.IsZero() {
+		<-wake
+		return true
+	}
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case <-wake:
+		return true
+	case <-t.C:
+		return false
+	}
+}
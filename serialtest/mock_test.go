@@ -0,0 +1,88 @@
+package serialtest
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+	"time"
+
+	serial "github.com/tarm/goserial"
+)
+
+func TestMockPortRules(t *testing.T) {
+	m := NewMockPort()
+	m.On("AT\r").Reply("OK\r\n").After(20 * time.Millisecond).Times(3)
+	m.OnRegexp(regexp.MustCompile(`ATI\d\r`)).ReplyFunc(func(req []byte) []byte {
+		return append([]byte("ID"), req[3])
+	})
+	m.SetReadTimeout(200 * time.Millisecond)
+
+	buf := make([]byte, 16)
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		m.Write([]byte("AT\r"))
+		n, err := m.Read(buf)
+		if err != nil || string(buf[:n]) != "OK\r\n" {
+			t.Fatalf("command %d: got %q, %v", i, buf[:n], err)
+		}
+		if d := time.Since(start); d < 20*time.Millisecond {
+			t.Errorf("command %d: reply after %v, want 20ms", i, d)
+		}
+	}
+	m.Write([]byte("AT\r"))
+	if _, err := m.Read(buf); err != serial.ErrTimeout {
+		t.Errorf("fourth command: got %v, want ErrTimeout", err)
+	}
+
+	m.Write([]byte("ATI"))
+	m.Write([]byte("7\r"))
+	if n, err := m.Read(buf); err != nil || string(buf[:n]) != "ID7" {
+		t.Errorf("ATI7: got %q, %v", buf[:n], err)
+	}
+
+	if w := m.Written(); !bytes.Equal(w, []byte("AT\rAT\rAT\rAT\rATI7\r")) {
+		t.Errorf("Written = %q", w)
+	}
+
+	m.Close()
+	if _, err := m.Read(buf); err != serial.ErrPortClosed {
+		t.Errorf("Read after Close: got %v, want ErrPortClosed", err)
+	}
+}
+
+func TestMockPortFailures(t *testing.T) {
+	m := NewMockPort()
+	m.FailRead(2, serial.ErrTimeout)
+	m.FailAfter(5, serial.ErrPortDisconnected)
+	m.Send("abcdefgh")
+
+	buf := make([]byte, 3)
+	if n, err := m.Read(buf); n != 3 || err != nil {
+		t.Fatalf("first read: %d, %v", n, err)
+	}
+	if _, err := m.Read(buf); err != serial.ErrTimeout {
+		t.Errorf("second read: got %v, want ErrTimeout", err)
+	}
+	if n, err := m.Read(buf); n != 2 || err != nil {
+		t.Errorf("third read: %d, %v; want 2 bytes", n, err)
+	}
+	if _, err := m.Read(buf); err != serial.ErrPortDisconnected {
+		t.Errorf("fourth read: got %v, want ErrPortDisconnected", err)
+	}
+}
+
+func TestMockPortCopyUntilIdle(t *testing.T) {
+	m := NewMockPort()
+	m.On("ATI\r").Reply("model 7\r\n").After(20 * time.Millisecond)
+
+	m.Write([]byte("ATI\r"))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		m.Send("OK\r\n")
+	}()
+	var got bytes.Buffer
+	n, err := serial.CopyUntilIdle(&got, m, 100*time.Millisecond, time.Second)
+	if err != nil || got.String() != "model 7\r\nOK\r\n" || n != int64(got.Len()) {
+		t.Errorf("CopyUntilIdle = %d, %v, %q", n, err, got.String())
+	}
+}
@@ -0,0 +1,81 @@
+package serialtest
+
+import (
+	"sync"
+
+	serial "github.com/tarm/goserial"
+)
+
+// A PipePort is one end of a Pipe.  It is a *serial.Port, with its
+// deadlines, timeouts and modem lines, that can also be told to fail.
+type PipePort struct {
+	*serial.Port
+
+	mu        sync.Mutex
+	reads     int // calls to Read so far
+	writes    int // calls to Write so far
+	readErrs  map[int]error
+	writeErrs map[int]error
+}
+
+// Pipe returns the two ends of an in-memory null-modem cable, as
+// serial.Pipe does: each end's DTR shows up as the other's DSR and DCD,
+// and its RTS as the other's CTS.  On top of that, reads and writes can
+// be made to fail with FailRead and FailWrite.
+func Pipe() (*PipePort, *PipePort) {
+	return NewPipe(nil)
+}
+
+// NewPipe is like Pipe but takes a configuration; c may be nil.
+func NewPipe(c *serial.PipeConfig) (*PipePort, *PipePort) {
+	a, b := serial.NewPipe(c)
+	return &PipePort{Port: a}, &PipePort{Port: b}
+}
+
+// FailRead makes the nth call to Read, counting from 1, return err
+// without reading anything.
+func (p *PipePort) FailRead(n int, err error) {
+	p.mu.Lock()
+	if p.readErrs == nil {
+		p.readErrs = make(map[int]error)
+	}
+	p.readErrs[n] = err
+	p.mu.Unlock()
+}
+
+// FailWrite makes the nth call to Write, counting from 1, return err
+// without writing anything.
+func (p *PipePort) FailWrite(n int, err error) {
+	p.mu.Lock()
+	if p.writeErrs == nil {
+		p.writeErrs = make(map[int]error)
+	}
+	p.writeErrs[n] = err
+	p.mu.Unlock()
+}
+
+// Read reads from the other end, unless FailRead picked this call.
+// Only Read and Write count calls and fail: ReadContext, ReadByte and
+// the like go straight to the port.
+func (p *PipePort) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	p.reads++
+	err := p.readErrs[p.reads]
+	p.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return p.Port.Read(b)
+}
+
+// Write writes to the other end, unless FailWrite picked this call.
+func (p *PipePort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	p.writes++
+	err := p.writeErrs[p.writes]
+	p.mu.Unlock()
+	if err != nil {
+		return 0, err
+	}
+	return p.Port.Write(b)
+}
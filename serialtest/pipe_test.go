@@ -0,0 +1,43 @@
+package serialtest
+
+import (
+	"testing"
+	"time"
+
+	serial "github.com/tarm/goserial"
+)
+
+func TestPipe(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	var _ Port = a
+
+	a.FailWrite(2, serial.ErrPortDisconnected)
+	b.FailRead(1, serial.ErrTimeout)
+
+	if _, err := a.Write([]byte("one")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Write([]byte("two")); err != serial.ErrPortDisconnected {
+		t.Errorf("second write: got %v, want ErrPortDisconnected", err)
+	}
+	buf := make([]byte, 8)
+	if _, err := b.Read(buf); err != serial.ErrTimeout {
+		t.Errorf("first read: got %v, want ErrTimeout", err)
+	}
+	if n, err := b.Read(buf); err != nil || string(buf[:n]) != "one" {
+		t.Errorf("second read: %q, %v; want \"one\"", buf[:n], err)
+	}
+
+	b.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	if _, err := b.Read(buf); err != serial.ErrTimeout {
+		t.Errorf("read past deadline: got %v, want ErrTimeout", err)
+	}
+
+	a.SetDTR(true)
+	a.SetRTS(false)
+	if s, err := b.ModemStatus(); err != nil || !s.DSR || !s.DCD || s.CTS {
+		t.Errorf("ModemStatus = %+v, %v; want DSR and DCD only", s, err)
+	}
+}
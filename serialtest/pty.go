@@ -0,0 +1,54 @@
+// +build linux darwin freebsd
+
+package serialtest
+
+import (
+	"os"
+	"syscall"
+)
+
+// A Pty is a pseudo-terminal pair.  Open the slave, Name, with
+// serial.OpenPort and drive the other end through Master.  Unlike Pipe
+// or MockPort this runs the package's real termios code, though a pty
+// has no baud rate or modem lines.
+type Pty struct {
+	Master *os.File
+	Name   string
+}
+
+// NewPty allocates a new pseudo-terminal.
+func NewPty() (*Pty, error) {
+	m, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	rc, err := m.SyscallConn()
+	if err != nil {
+		m.Close()
+		return nil, err
+	}
+	var name string
+	if cerr := rc.Control(func(fd uintptr) {
+		name, err = unlockpt(fd)
+	}); cerr != nil {
+		err = cerr
+	}
+	if err != nil {
+		m.Close()
+		return nil, &os.PathError{Op: "unlockpt", Path: m.Name(), Err: err}
+	}
+	return &Pty{Master: m, Name: name}, nil
+}
+
+// Close closes the master, which hangs up the slave.
+func (p *Pty) Close() error {
+	return p.Master.Close()
+}
+
+func ioctl(fd, req, arg uintptr) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, arg)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
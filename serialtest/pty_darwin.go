@@ -0,0 +1,27 @@
+package serialtest
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// unlockpt grants and unlocks the slave of the pty master fd and
+// returns its name.
+func unlockpt(fd uintptr) (string, error) {
+	if err := ioctl(fd, syscall.TIOCPTYGRANT, 0); err != nil {
+		return "", err
+	}
+	if err := ioctl(fd, syscall.TIOCPTYUNLK, 0); err != nil {
+		return "", err
+	}
+	var buf [128]byte
+	if err := ioctl(fd, syscall.TIOCPTYGNAME, uintptr(unsafe.Pointer(&buf[0]))); err != nil {
+		return "", err
+	}
+	for i, c := range buf {
+		if c == 0 {
+			return string(buf[:i]), nil
+		}
+	}
+	return string(buf[:]), nil
+}
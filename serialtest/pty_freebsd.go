@@ -0,0 +1,27 @@
+package serialtest
+
+import (
+	"bytes"
+	"unsafe"
+)
+
+// fiodgnameArg is struct fiodgname_arg, the argument of FIODGNAME.
+type fiodgnameArg struct {
+	len int32
+	buf unsafe.Pointer
+}
+
+// unlockpt returns the name of the slave of the pty master fd.  FreeBSD
+// creates the slave granted and unlocked.
+func unlockpt(fd uintptr) (string, error) {
+	var buf [64]byte
+	arg := fiodgnameArg{len: int32(len(buf)), buf: unsafe.Pointer(&buf[0])}
+	req := 0x80000000 | unsafe.Sizeof(arg)<<16 | 'f'<<8 | 120 // FIODGNAME
+	if err := ioctl(fd, req, uintptr(unsafe.Pointer(&arg))); err != nil {
+		return "", err
+	}
+	if i := bytes.IndexByte(buf[:], 0); i >= 0 {
+		return "/dev/" + string(buf[:i]), nil
+	}
+	return "/dev/" + string(buf[:]), nil
+}
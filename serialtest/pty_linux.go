@@ -0,0 +1,21 @@
+package serialtest
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+// unlockpt unlocks the slave of the pty master fd and returns its name.
+// Linux needs no grantpt.
+func unlockpt(fd uintptr) (string, error) {
+	unlock := int32(0)
+	if err := ioctl(fd, syscall.TIOCSPTLCK, uintptr(unsafe.Pointer(&unlock))); err != nil {
+		return "", err
+	}
+	var n uint32
+	if err := ioctl(fd, syscall.TIOCGPTN, uintptr(unsafe.Pointer(&n))); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("/dev/pts/%d", n), nil
+}
@@ -0,0 +1,34 @@
+// +build linux darwin freebsd
+
+package serialtest
+
+import (
+	"io"
+	"testing"
+
+	serial "github.com/tarm/goserial"
+)
+
+func TestNewPty(t *testing.T) {
+	pty, err := NewPty()
+	if err != nil {
+		t.Skip("no pty support:", err)
+	}
+	defer pty.Close()
+
+	s, err := serial.OpenPort(&serial.Config{Name: pty.Name, Baud: 9600, ReadTimeout: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	pty.Master.Write([]byte("ping"))
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(s, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("read %q, %v; want \"ping\"", buf, err)
+	}
+	s.Write([]byte("pong"))
+	if _, err := io.ReadFull(pty.Master, buf); err != nil || string(buf) != "pong" {
+		t.Fatalf("master read %q, %v; want \"pong\"", buf, err)
+	}
+}
@@ -0,0 +1,323 @@
+package serialtest
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	serial "github.com/tarm/goserial"
+)
+
+// Port is what Record wraps and Replay imitates.  *serial.Port, *PipePort,
+// *MockPort, *Recorder and *Replayer all satisfy it.
+type Port interface {
+	io.ReadWriteCloser
+	SetReadTimeout(d time.Duration) error
+}
+
+// An Event is one line of a recording.  Recordings are JSON Lines, for
+// example
+//
+//	{"t":0,"dir":"w","data":"41540d"}
+//	{"t":20311000,"dir":"r","data":"4f4b0d0a"}
+//
+// T is the time in nanoseconds since the recording started, Dir is "w"
+// for data written to the device and "r" for data read from it, and
+// Data is the bytes transferred in hex.
+type Event struct {
+	T    int64  `json:"t"`
+	Dir  string `json:"dir"`
+	Data string `json:"data"`
+}
+
+// A Recorder passes traffic through to a port while logging it.
+type Recorder struct {
+	p     Port
+	start time.Time
+
+	mu  sync.Mutex
+	enc *json.Encoder
+	err error
+}
+
+// Record returns a port that reads and writes through p and logs every
+// transfer to w in the format described at Event.
+func Record(p Port, w io.Writer) *Recorder {
+	return &Recorder{p: p, start: time.Now(), enc: json.NewEncoder(w)}
+}
+
+func (r *Recorder) log(dir string, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	e := Event{T: int64(time.Since(r.start)), Dir: dir, Data: hex.EncodeToString(b)}
+	r.mu.Lock()
+	if err := r.enc.Encode(&e); err != nil && r.err == nil {
+		r.err = err
+	}
+	r.mu.Unlock()
+}
+
+func (r *Recorder) Read(b []byte) (int, error) {
+	n, err := r.p.Read(b)
+	r.log("r", b[:n])
+	return n, err
+}
+
+func (r *Recorder) Write(b []byte) (int, error) {
+	n, err := r.p.Write(b)
+	r.log("w", b[:n])
+	return n, err
+}
+
+func (r *Recorder) SetReadTimeout(d time.Duration) error {
+	return r.p.SetReadTimeout(d)
+}
+
+// Close closes the underlying port.  If writing the recording failed it
+// returns that error instead.
+func (r *Recorder) Close() error {
+	err := r.p.Close()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	return err
+}
+
+// A MismatchError reports data written during a replay that differs
+// from the recording.
+type MismatchError struct {
+	Offset int64  // offset of the first differing byte in the written stream
+	Got    []byte // what was written from Offset on
+	Want   []byte // what the recording has from Offset on, if anything
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("serialtest: replay mismatch at byte %d: wrote %q, recording has %q", e.Offset, e.Got, e.Want)
+}
+
+// A Replayer plays back the device side of a recording.  Data the
+// device sent becomes readable once everything written before it in the
+// recording has been written, after the gap seen in the recording.
+type Replayer struct {
+	events []replayEvent
+	scale  float64
+	start  time.Time
+
+	mu      sync.Mutex
+	ri, wi  int   // next read and write events
+	roff    int   // bytes of events[ri] already read
+	woff    int   // bytes of events[wi] already written
+	written int64 // total bytes written
+	timeout time.Duration
+	closed  bool
+	err     error
+	wake    chan struct{} // closed, and replaced, on every change
+}
+
+type replayEvent struct {
+	t    time.Duration
+	read bool
+	data []byte
+	done time.Time // when the event was fully read or written
+}
+
+// Replay reads a recording made by Record and returns a port that
+// plays it back.  Gaps between events are multiplied by scale, so 1
+// keeps the original timing and 0 removes it.  Events with no data,
+// which Record does not write, are skipped.
+func Replay(r io.Reader, scale float64) (*Replayer, error) {
+	p := &Replayer{scale: scale, start: time.Now(), wake: make(chan struct{})}
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1<<24)
+	for line := 1; s.Scan(); line++ {
+		if len(s.Bytes()) == 0 {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("serialtest: recording line %d: %v", line, err)
+		}
+		data, err := hex.DecodeString(e.Data)
+		if err != nil {
+			return nil, fmt.Errorf("serialtest: recording line %d: %v", line, err)
+		}
+		if e.Dir != "r" && e.Dir != "w" {
+			return nil, fmt.Errorf("serialtest: recording line %d: bad direction %q", line, e.Dir)
+		}
+		if len(data) == 0 {
+			continue
+		}
+		p.events = append(p.events, replayEvent{t: time.Duration(e.T), read: e.Dir == "r", data: data})
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	p.ri = p.next(0, true)
+	p.wi = p.next(0, false)
+	return p, nil
+}
+
+// next returns the index of the first read or write event at or after
+// i, or len(p.events).
+func (p *Replayer) next(i int, read bool) int {
+	for i < len(p.events) && p.events[i].read != read {
+		i++
+	}
+	return i
+}
+
+// readyAt returns when event i becomes readable, or false if that
+// depends on data not yet written.  p.mu must be held.
+func (p *Replayer) readyAt(i int) (time.Time, bool) {
+	if p.roff > 0 {
+		return time.Time{}, true
+	}
+	base, prev := p.start, time.Duration(0)
+	if i > 0 {
+		e := p.events[i-1]
+		if e.done.IsZero() {
+			return time.Time{}, false
+		}
+		base, prev = e.done, e.t
+	}
+	gap := time.Duration(float64(p.events[i].t-prev) * p.scale)
+	return base.Add(gap), true
+}
+
+func (p *Replayer) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var deadline time.Time
+	if p.timeout > 0 {
+		deadline = time.Now().Add(p.timeout)
+	}
+	for {
+		if p.closed {
+			return 0, serial.ErrPortClosed
+		}
+		if p.ri == len(p.events) {
+			return 0, io.EOF
+		}
+		ready, ok := p.readyAt(p.ri)
+		if ok && !time.Now().Before(ready) {
+			break
+		}
+		until := deadline
+		if ok && (until.IsZero() || ready.Before(until)) {
+			until = ready
+		}
+		if !p.wait(until) && until == deadline {
+			return 0, serial.ErrTimeout
+		}
+	}
+
+	e := &p.events[p.ri]
+	n := copy(b, e.data[p.roff:])
+	p.roff += n
+	if p.roff == len(e.data) {
+		e.done = time.Now()
+		p.ri = p.next(p.ri+1, true)
+		p.roff = 0
+		p.changed()
+	}
+	return n, nil
+}
+
+// Write checks b against the recording.  At the first difference it
+// returns a *MismatchError, and so does every later call.
+func (p *Replayer) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, serial.ErrPortClosed
+	}
+	if p.err != nil {
+		return 0, p.err
+	}
+	n := 0
+	for n < len(b) {
+		if p.wi == len(p.events) {
+			p.err = &MismatchError{Offset: p.written, Got: append([]byte(nil), b[n:]...)}
+			return n, p.err
+		}
+		e := &p.events[p.wi]
+		if b[n] != e.data[p.woff] {
+			p.err = &MismatchError{
+				Offset: p.written,
+				Got:    append([]byte(nil), b[n:]...),
+				Want:   append([]byte(nil), e.data[p.woff:]...),
+			}
+			return n, p.err
+		}
+		n++
+		p.written++
+		p.woff++
+		if p.woff == len(e.data) {
+			e.done = time.Now()
+			p.wi = p.next(p.wi+1, false)
+			p.woff = 0
+			p.changed()
+		}
+	}
+	return n, nil
+}
+
+// Err returns the first mismatch seen, if any.
+func (p *Replayer) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// SetReadTimeout sets how long Read waits for replayed data before
+// returning serial.ErrTimeout.  Zero, the default, waits forever.
+func (p *Replayer) SetReadTimeout(d time.Duration) error {
+	p.mu.Lock()
+	p.timeout = d
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *Replayer) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return serial.ErrPortClosed
+	}
+	p.closed = true
+	p.changed()
+	return nil
+}
+
+// changed wakes everyone waiting on p.  p.mu must be held.
+func (p *Replayer) changed() {
+	close(p.wake)
+	p.wake = make(chan struct{})
+}
+
+// wait releases p.mu until p changes or the deadline passes, returning
+// false in the latter case.
+func (p *Replayer) wait(deadline time.Time) bool {
+	wake := p.wake
+	p.mu.Unlock()
+	defer p.mu.Lock()
+	if deadline.IsZero() {
+		<-wake
+		return true
+	}
+	t := time.NewTimer(time.Until(deadline))
+	defer t.Stop()
+	select {
+	case <-wake:
+		return true
+	case <-t.C:
+		return false
+	}
+}
@@ -0,0 +1,78 @@
+package serialtest
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	serial "github.com/tarm/goserial"
+)
+
+// session talks to a device behind p the way a driver under test would.
+func session(p Port) (string, error) {
+	if _, err := p.Write([]byte("AT\r")); err != nil {
+		return "", err
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(p, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+func TestRecordReplay(t *testing.T) {
+	m := NewMockPort()
+	m.On("AT\r").Reply("OK\r\n").After(50 * time.Millisecond)
+
+	var rec bytes.Buffer
+	r := Record(m, &rec)
+	if got, err := session(r); err != nil || got != "OK\r\n" {
+		t.Fatalf("live session: %q, %v", got, err)
+	}
+	r.Close()
+	if n := strings.Count(rec.String(), "\n"); n != 2 {
+		t.Fatalf("recording has %d lines, want 2:\n%s", n, rec.String())
+	}
+
+	p, err := Replay(bytes.NewReader(rec.Bytes()), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetReadTimeout(20 * time.Millisecond)
+	p.Write([]byte("AT\r"))
+	if _, err := p.Read(make([]byte, 4)); err != serial.ErrTimeout {
+		t.Errorf("read before the recorded gap: %v, want ErrTimeout", err)
+	}
+	p.SetReadTimeout(time.Second)
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(p, buf); err != nil || string(buf) != "OK\r\n" {
+		t.Errorf("replayed reply %q, %v", buf, err)
+	}
+	if _, err := p.Read(buf); err != io.EOF {
+		t.Errorf("read past the recording: %v, want io.EOF", err)
+	}
+
+	p, _ = Replay(bytes.NewReader(rec.Bytes()), 0)
+	_, err = p.Write([]byte("ATZ\r"))
+	me, ok := err.(*MismatchError)
+	if !ok || me.Offset != 2 || string(me.Got) != "Z\r" || string(me.Want) != "\r" {
+		t.Errorf("mismatched write: got %v", err)
+	}
+}
+
+func TestReplayEmptyEvents(t *testing.T) {
+	rec := `{"t":0,"dir":"w","data":""}
+{"t":0,"dir":"w","data":"41540d"}
+{"t":0,"dir":"r","data":""}
+{"t":0,"dir":"r","data":"4f4b0d0a"}
+`
+	p, err := Replay(strings.NewReader(rec), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := session(p); err != nil || got != "OK\r\n" {
+		t.Errorf("session over a recording with empty events: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,564 @@
+package goserial
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// ErrServerClosed is returned by Server.Serve once Close was called.
+var ErrServerClosed = errors.New("goserial: server closed")
+
+// A Server shares a port with clients on the network, as ser2net does:
+// what the port receives goes to every connected client, and what any
+// client sends is written to the port.  A client that falls too far
+// behind is disconnected rather than holding up the rest.  The Server
+// reads the port from the first Serve until Close, so nothing else may
+// read it meanwhile.
+//
+// With RFC2217 set the connections speak the telnet com port control
+// protocol, so that OpenPort with an "rfc2217://" name, or any other
+// RFC 2217 client, can change the line settings, flow control and
+// output lines, and is told when the modem status lines change.  The
+// settings are the port's, so what one client sets holds for all of
+// them.  Otherwise the connections carry the bare data, for "tcp://"
+// clients, and the port keeps the settings it was opened with.
+type Server struct {
+	Port    *Port
+	RFC2217 bool
+
+	mu        sync.Mutex
+	started   bool
+	closed    bool
+	err       error // why the port could not be read, if it could not
+	modem     byte  // the modem status last seen, in RFC 2217's bits
+	brk       bool  // a client has the break condition on
+	listeners map[net.Listener]struct{}
+	clients   map[*serverConn]struct{}
+	done      chan struct{} // closed on shutdown
+	stopped   chan struct{} // closed when readPort has returned
+}
+
+// Serve shares p with the clients that connect to l, speaking the bare
+// data.  See Server.
+func Serve(p *Port, l net.Listener) error {
+	return (&Server{Port: p}).Serve(l)
+}
+
+// serverPoll is how long the port reader waits for data before it looks
+// at the modem status lines and whether the server was closed.
+const serverPoll = 100 * time.Millisecond
+
+// serverQueue is how many messages may wait to go to a client before it
+// counts as too slow.
+const serverQueue = 256
+
+// Serve accepts connections on l and serves each on its own goroutine,
+// as http.Server.Serve does.  It may be called with several listeners.
+// It returns ErrServerClosed after Close, the error that stopped the
+// port from being read, or the one from Accept; l is closed either way.
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	if !s.started {
+		s.started = true
+		s.listeners = make(map[net.Listener]struct{})
+		s.clients = make(map[*serverConn]struct{})
+		s.done = make(chan struct{})
+		s.stopped = make(chan struct{})
+		s.modem = s.modemState()
+		go s.readPort()
+	}
+	s.listeners[l] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			delete(s.listeners, l)
+			switch {
+			case !s.closed:
+				return err
+			case s.err != nil:
+				return s.err
+			}
+			return ErrServerClosed
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			continue
+		}
+		c := &serverConn{
+			s:        s,
+			conn:     conn,
+			out:      make(chan []byte, serverQueue),
+			gone:     make(chan struct{}),
+			weWill:   make(map[byte]bool),
+			theyWill: make(map[byte]bool),
+			mask:     0xff,
+		}
+		s.clients[c] = struct{}{}
+		if s.RFC2217 {
+			c.greet(s.modem)
+		}
+		s.mu.Unlock()
+		go c.serve()
+	}
+}
+
+// Close stops the server: the listeners and the client connections are
+// closed, and it waits for the port reader to stop, which takes up to
+// serverPoll.  The port itself is left open, with its read deadline
+// cleared.
+func (s *Server) Close() error {
+	s.shutdown(nil)
+	s.mu.Lock()
+	started := s.started
+	s.mu.Unlock()
+	if started {
+		<-s.stopped
+	}
+	return nil
+}
+
+func (s *Server) shutdown(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.err = err
+	if s.done != nil {
+		close(s.done)
+	}
+	for l := range s.listeners {
+		l.Close()
+	}
+	for c := range s.clients {
+		c.close()
+	}
+}
+
+// readPort copies what the port receives to the clients.  The deadline
+// wakes it up regularly, also on ports without a read timeout.
+func (s *Server) readPort() {
+	defer close(s.stopped)
+	defer s.Port.SetReadDeadline(time.Time{})
+	buf := make([]byte, 4096)
+	polled := time.Now()
+	for {
+		s.Port.SetReadDeadline(time.Now().Add(serverPoll))
+		n, err := s.Port.Read(buf)
+		if n > 0 {
+			s.broadcast(buf[:n])
+		}
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+		if err != nil && err != ErrTimeout {
+			s.shutdown(err)
+			return
+		}
+		if s.RFC2217 && time.Since(polled) >= serverPoll {
+			polled = time.Now()
+			s.notifyModem()
+		}
+	}
+}
+
+// broadcast queues data from the port for every client.
+func (s *Server) broadcast(b []byte) {
+	if s.RFC2217 {
+		b = escapeIAC(b)
+	} else {
+		b = append([]byte(nil), b...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.clients {
+		c.queue(b)
+	}
+}
+
+// modemState returns the port's modem status lines in the bits of
+// NOTIFY-MODEMSTATE, or zero if it cannot read them.
+func (s *Server) modemState() byte {
+	m, err := s.Port.ModemStatus()
+	if err != nil {
+		return 0
+	}
+	var v byte
+	if m.CTS {
+		v |= modemCTS
+	}
+	if m.DSR {
+		v |= modemDSR
+	}
+	if m.RI {
+		v |= modemRI
+	}
+	if m.DCD {
+		v |= modemDCD
+	}
+	return v
+}
+
+// notifyModem tells the clients that asked for it about the modem
+// status lines that changed, with the delta bits set for them.
+func (s *Server) notifyModem() {
+	v := s.modemState()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := v ^ s.modem
+	s.modem = v
+	if changed == 0 {
+		return
+	}
+	for c := range s.clients {
+		if changed&c.mask != 0 {
+			c.queue(comPortMessage(cpNotifyModemState, []byte{v | changed>>4}))
+		}
+	}
+}
+
+// comPortMessage returns an RFC 2217 message from the server.
+func comPortMessage(cmd byte, value []byte) []byte {
+	b := []byte{telnetIAC, telnetSB, telnetComPort, cmd + comPortReplied}
+	b = append(b, escapeIAC(value)...)
+	return append(b, telnetIAC, telnetSE)
+}
+
+// serverConn is one client of a Server.
+type serverConn struct {
+	s    *Server
+	conn net.Conn
+	out  chan []byte // what is to be sent, see queue
+	once sync.Once
+	gone chan struct{} // closed by close
+
+	mask byte // SET-MODEMSTATE-MASK, guarded by s.mu
+
+	// The telnet state, only used by serve once the connection is
+	// registered.
+	weWill, theyWill map[byte]bool
+	state, verb      byte
+	sub              []byte
+}
+
+// queue has writeLoop send b.  A client whose queue is full is
+// disconnected.
+func (c *serverConn) queue(b []byte) {
+	select {
+	case c.out <- b:
+	default:
+		c.close()
+	}
+}
+
+func (c *serverConn) close() {
+	c.once.Do(func() {
+		close(c.gone)
+		c.conn.Close()
+	})
+}
+
+// greet offers the telnet options RFC 2217 needs and reports the modem
+// status lines.  s.mu must be held.
+func (c *serverConn) greet(modem byte) {
+	c.queue([]byte{
+		telnetIAC, telnetDO, telnetComPort,
+		telnetIAC, telnetWILL, telnetBinary,
+		telnetIAC, telnetDO, telnetBinary,
+		telnetIAC, telnetWILL, telnetSGA,
+		telnetIAC, telnetDO, telnetSGA,
+	})
+	c.weWill[telnetBinary], c.weWill[telnetSGA] = true, true
+	c.theyWill[telnetComPort], c.theyWill[telnetBinary], c.theyWill[telnetSGA] = true, true, true
+	c.queue(comPortMessage(cpNotifyModemState, []byte{modem}))
+}
+
+func (c *serverConn) writeLoop() {
+	for {
+		select {
+		case b := <-c.out:
+			if _, err := c.conn.Write(b); err != nil {
+				c.close()
+				return
+			}
+		case <-c.gone:
+			return
+		}
+	}
+}
+
+// serve writes what the client sends to the port.
+func (c *serverConn) serve() {
+	defer func() {
+		c.close()
+		c.s.mu.Lock()
+		delete(c.s.clients, c)
+		c.s.mu.Unlock()
+	}()
+	go c.writeLoop()
+	buf := make([]byte, 4096)
+	for {
+		n, err := c.conn.Read(buf)
+		data := buf[:n]
+		if c.s.RFC2217 {
+			data = c.telnet(data)
+		}
+		if len(data) > 0 {
+			if _, werr := c.s.Port.Write(data); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// The states of telnet, as in rfc2217Port.readLoop.
+const (
+	tnData = iota
+	tnIAC
+	tnOption
+	tnSub
+	tnSubIAC
+)
+
+// telnet takes the telnet protocol out of b, acting on it, and returns
+// the data that is left, in b's space.
+func (c *serverConn) telnet(b []byte) []byte {
+	data := b[:0]
+	for _, x := range b {
+		switch c.state {
+		case tnData:
+			if x == telnetIAC {
+				c.state = tnIAC
+			} else {
+				data = append(data, x)
+			}
+		case tnIAC:
+			switch x {
+			case telnetIAC:
+				data = append(data, x)
+				c.state = tnData
+			case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+				c.verb, c.state = x, tnOption
+			case telnetSB:
+				c.sub, c.state = c.sub[:0], tnSub
+			default:
+				c.state = tnData
+			}
+		case tnOption:
+			c.negotiate(c.verb, x)
+			c.state = tnData
+		case tnSub:
+			if x == telnetIAC {
+				c.state = tnSubIAC
+			} else {
+				c.sub = append(c.sub, x)
+			}
+		case tnSubIAC:
+			switch x {
+			case telnetSE:
+				if len(c.sub) >= 2 && c.sub[0] == telnetComPort {
+					c.command(c.sub[1], c.sub[2:])
+				}
+				c.state = tnData
+			default:
+				c.sub = append(c.sub, x)
+				c.state = tnSub
+			}
+		}
+	}
+	return data
+}
+
+// negotiate answers a telnet option request, taking binary mode, SGA
+// and COM-PORT-OPTION and refusing the rest.
+func (c *serverConn) negotiate(verb, opt byte) {
+	var reply byte
+	switch verb {
+	case telnetWILL:
+		switch {
+		case opt != telnetBinary && opt != telnetSGA && opt != telnetComPort:
+			reply = telnetDONT
+		case !c.theyWill[opt]:
+			c.theyWill[opt] = true
+			reply = telnetDO
+		}
+	case telnetWONT:
+		if c.theyWill[opt] {
+			c.theyWill[opt] = false
+			reply = telnetDONT
+		}
+	case telnetDO:
+		switch {
+		case opt != telnetBinary && opt != telnetSGA:
+			reply = telnetWONT
+		case !c.weWill[opt]:
+			c.weWill[opt] = true
+			reply = telnetWILL
+		}
+	case telnetDONT:
+		if c.weWill[opt] {
+			c.weWill[opt] = false
+			reply = telnetWONT
+		}
+	}
+	if reply != 0 {
+		c.queue([]byte{telnetIAC, reply, opt})
+	}
+}
+
+// command carries out a COM-PORT-OPTION command and answers it with
+// the setting now in force, which is also how a zero value, asking for
+// the current one, is answered.  Settings the port refuses are simply
+// reported as they stayed.
+func (c *serverConn) command(cmd byte, v []byte) {
+	p := c.s.Port
+	var cur Config
+	p.d.getConfig(&cur)
+	reply := append([]byte(nil), v...)
+	switch cmd {
+	case cpSignature:
+		if len(v) == 0 {
+			reply = []byte("goserial")
+		}
+	case cpSetBaud:
+		if len(v) != 4 {
+			return
+		}
+		if baud := binary.BigEndian.Uint32(v); baud != 0 && p.SetBaud(int(baud)) == nil {
+			cur.Baud = int(baud)
+		}
+		binary.BigEndian.PutUint32(reply, uint32(cur.Baud))
+	case cpSetDataSize, cpSetParity, cpSetStopSize:
+		if len(v) != 1 {
+			return
+		}
+		size, parity, stop := cur.Size, cur.Parity, cur.StopBits
+		switch cmd {
+		case cpSetDataSize:
+			for k, x := range cpSizes {
+				if x == v[0] {
+					size = k
+				}
+			}
+		case cpSetParity:
+			for k, x := range cpParities {
+				if x == v[0] {
+					parity = k
+				}
+			}
+		case cpSetStopSize:
+			for k, x := range cpStopBits {
+				if x == v[0] {
+					stop = k
+				}
+			}
+		}
+		if p.SetFraming(size, parity, stop) == nil {
+			cur.Size, cur.Parity, cur.StopBits = size, parity, stop
+		}
+		switch cmd {
+		case cpSetDataSize:
+			reply[0] = cpSizes[cur.Size]
+		case cpSetParity:
+			reply[0] = cpParities[cur.Parity]
+		case cpSetStopSize:
+			reply[0] = cpStopBits[cur.StopBits]
+		}
+	case cpSetControl:
+		if len(v) != 1 {
+			return
+		}
+		reply = []byte{c.control(v[0])}
+	case cpSetModemStateMask:
+		if len(v) != 1 {
+			return
+		}
+		c.s.mu.Lock()
+		c.mask = v[0]
+		c.s.mu.Unlock()
+	case cpPurgeData:
+		if len(v) != 1 {
+			return
+		}
+		p.flush(v[0]&1 != 0, v[0]&2 != 0)
+	case cpSetLineStateMask, cpFlowSuspend, cpFlowResume:
+	default:
+		return
+	}
+	c.queue(comPortMessage(cmd, reply))
+}
+
+// control carries out a SET-CONTROL value and returns the one to reply
+// with.
+func (c *serverConn) control(v byte) byte {
+	p := c.s.Port
+	switch v {
+	case cpFlowNone, cpFlowXON, cpFlowRTS:
+		f := map[byte]FlowControl{cpFlowNone: FlowNone, cpFlowXON: FlowXONXOFF, cpFlowRTS: FlowRTSCTS}[v]
+		p.SetFlowControl(f)
+		fallthrough
+	case cpFlowRequest:
+		p.cl.Lock()
+		f := p.flow
+		p.cl.Unlock()
+		return map[FlowControl]byte{FlowNone: cpFlowNone, FlowXONXOFF: cpFlowXON, FlowRTSCTS: cpFlowRTS}[f]
+	case cpBreakOn, cpBreakOff:
+		if b, ok := p.d.(breaker); ok {
+			p.flushWrites()
+			p.cl.Lock()
+			err := b.setBreak(v == cpBreakOn)
+			p.cl.Unlock()
+			p.traceControl("break", err, v == cpBreakOn)
+			if err == nil {
+				c.s.mu.Lock()
+				c.s.brk = v == cpBreakOn
+				c.s.mu.Unlock()
+			}
+		}
+		fallthrough
+	case cpBreakRequest:
+		c.s.mu.Lock()
+		defer c.s.mu.Unlock()
+		if c.s.brk {
+			return cpBreakOn
+		}
+		return cpBreakOff
+	case cpDTROn, cpDTROff:
+		p.SetDTR(v == cpDTROn)
+		fallthrough
+	case cpDTRRequest:
+		if dtr, _, err := p.d.outputLines(); err == nil && !dtr {
+			return cpDTROff
+		}
+		return cpDTROn
+	case cpRTSOn, cpRTSOff:
+		p.SetRTS(v == cpRTSOn)
+		fallthrough
+	case cpRTSRequest:
+		if _, rts, err := p.d.outputLines(); err == nil && !rts {
+			return cpRTSOff
+		}
+		return cpRTSOn
+	}
+	return v
+}
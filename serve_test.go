@@ -0,0 +1,153 @@
+package goserial
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// startServer serves a on a local listener and returns its address and
+// the channel Serve's result arrives on.
+func startServer(t *testing.T, s *Server) (string, chan error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(l) }()
+	return l.Addr().String(), done
+}
+
+func TestServe(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	s := &Server{Port: a}
+	addr, done := startServer(t, s)
+
+	var clients []net.Conn
+	for i := 0; i < 2; i++ {
+		c, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+		clients = append(clients, c)
+	}
+	// Let the server register both before the port has data for them.
+	time.Sleep(50 * time.Millisecond)
+
+	data := []byte{'h', 'i', telnetIAC}
+	if _, err := b.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range clients {
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		got := make([]byte, len(data))
+		if _, err := io.ReadFull(c, got); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("client %d read %v, %v; want %v", i, got, err, data)
+		}
+	}
+
+	if _, err := clients[1].Write([]byte("up")); err != nil {
+		t.Fatal(err)
+	}
+	b.SetReadTimeout(time.Second)
+	got := make([]byte, 2)
+	if _, err := io.ReadFull(b, got); err != nil || string(got) != "up" {
+		t.Errorf("port read %q, %v; want \"up\"", got, err)
+	}
+
+	s.Close()
+	if err := <-done; err != ErrServerClosed {
+		t.Errorf("Serve = %v, want ErrServerClosed", err)
+	}
+	clients[0].SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := clients[0].Read(got); err != io.EOF {
+		t.Errorf("client Read after Close: %v, want io.EOF", err)
+	}
+
+	// The port is usable again, without the server's deadline.
+	a.SetReadTimeout(20 * time.Millisecond)
+	b.Write([]byte("x"))
+	if n, err := a.Read(got); err != nil || string(got[:n]) != "x" {
+		t.Errorf("port Read after Close = %q, %v", got[:n], err)
+	}
+}
+
+func TestServePortClosed(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	_, done := startServer(t, &Server{Port: a})
+	time.Sleep(20 * time.Millisecond)
+	a.Close()
+	select {
+	case err := <-done:
+		if err != ErrPortClosed {
+			t.Errorf("Serve = %v, want ErrPortClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Serve did not return once the port was closed")
+	}
+}
+
+func TestServeRFC2217(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+	s := &Server{Port: a, RFC2217: true}
+	addr, done := startServer(t, s)
+	defer func() {
+		s.Close()
+		<-done
+	}()
+
+	c := &Config{Name: "rfc2217://" + addr, Baud: 19200, Size: Byte7, Parity: ParityEven, InitialRTS: LineHigh}
+	p, err := OpenPort(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var got Config
+	a.d.getConfig(&got)
+	if got.Baud != 19200 || got.Size != Byte7 || got.Parity != ParityEven {
+		t.Errorf("port settings %d %v%v%v", got.Baud, got.Size, got.Parity, got.StopBits)
+	}
+	if err := Probe(c); err != nil {
+		t.Errorf("Probe: %v", err)
+	}
+	if m, _ := b.ModemStatus(); !m.CTS {
+		t.Error("RTS set by the client did not reach the port")
+	}
+
+	data := []byte{1, telnetIAC, 2}
+	if _, err := p.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	b.SetReadTimeout(time.Second)
+	buf := make([]byte, len(data))
+	if _, err := io.ReadFull(b, buf); err != nil || !bytes.Equal(buf, data) {
+		t.Errorf("port read %v, %v; want %v", buf, err, data)
+	}
+	b.Write(data)
+	p.SetReadTimeout(time.Second)
+	if _, err := io.ReadFull(p, buf); err != nil || !bytes.Equal(buf, data) {
+		t.Errorf("client read %v, %v; want %v", buf, err, data)
+	}
+
+	// The server reports the modem status lines as they change.
+	b.SetDTR(true)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if m, _ := p.ModemStatus(); m.DSR {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("DSR never reached the client")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,207 @@
+package goserial
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// A Setting is one item of a port's state.
+type Setting struct {
+	Name  string // such as "baud" or "termios.iflag"
+	Value string
+}
+
+// Settings is a snapshot of a port's state, read back from the driver,
+// as returned by Port.Settings.  The items come in a fixed order, and
+// their names and the form of their values stay the same from run to
+// run, so that two snapshots can be compared with DiffSettings or as
+// text.
+type Settings []Setting
+
+// Get returns the value of the named setting.
+func (s Settings) Get(name string) (string, bool) {
+	for _, e := range s {
+		if e.Name == name {
+			return e.Value, true
+		}
+	}
+	return "", false
+}
+
+// String returns s one setting to a line, as "name: value".
+func (s Settings) String() string {
+	var b strings.Builder
+	for _, e := range s {
+		fmt.Fprintf(&b, "%s: %s\n", e.Name, e.Value)
+	}
+	return b.String()
+}
+
+func (s *Settings) add(name string, format string, args ...interface{}) {
+	*s = append(*s, Setting{name, fmt.Sprintf(format, args...)})
+}
+
+// failed adds name with an "error: " value.
+func (s *Settings) failed(name string, err error) {
+	s.add(name, "error: %v", err)
+}
+
+// settingsReporter is implemented by drivers that can report their
+// platform's own view of the port: termios flags, or the DCB and
+// COMMTIMEOUTS on Windows.  What they cannot read they add with
+// failed.
+type settingsReporter interface {
+	settings(s *Settings)
+}
+
+// Settings reads back what the port is doing: the line settings and
+// flow control, the timeouts, the states of the modem lines and the
+// queues, and on local ports the settings of the operating system from
+// which they derive.  An item that cannot be read, such as the modem
+// lines of a pty, has a value starting "error: ".  The error returned
+// is that of reading the line settings, as when the port is closed;
+// the rest is returned all the same.
+func (p *Port) Settings() (Settings, error) {
+	var s Settings
+	s.add("port", "%s", p.name)
+	var c Config
+	lerr := p.d.getConfig(&c)
+	if lerr != nil {
+		s.failed("line", lerr)
+	} else {
+		s.add("baud", "%d", c.Baud)
+		s.add("size", "%d", c.Size)
+		s.add("parity", "%v", c.Parity)
+		s.add("stop_bits", "%v", c.StopBits)
+		s.add("xon_char", "0x%02x", c.XONChar)
+		s.add("xoff_char", "0x%02x", c.XOFFChar)
+		s.add("xany", "%v", c.XANY)
+	}
+
+	p.cl.Lock()
+	s.add("flow_control", "%v", p.flow)
+	s.add("output_suspended", "%v", p.outSuspended)
+	s.add("input_suspended", "%v", p.inSuspended)
+	p.cl.Unlock()
+	if dtr, rts, err := p.d.outputLines(); err != nil {
+		s.failed("output_lines", err)
+	} else {
+		s.add("dtr", "%v", dtr)
+		s.add("rts", "%v", rts)
+	}
+
+	p.tl.Lock()
+	s.add("read_timeout", "%v", p.readTimeout)
+	s.add("write_timeout", "%v", p.writeTimeout)
+	p.tl.Unlock()
+
+	s.add("read_buffer", "%d", len(p.rbuf))
+	p.wl.Lock()
+	if atomic.LoadInt32(&p.coalescing) != 0 {
+		s.add("write_coalescing", "%v %d", p.wdelay, cap(p.wbuf))
+	} else {
+		s.add("write_coalescing", "off")
+	}
+	p.wl.Unlock()
+	if q, ok := p.d.(queueReporter); ok {
+		if in, out, err := q.queued(); err != nil {
+			s.failed("queued", err)
+		} else {
+			s.add("input_queued", "%d", in+p.Buffered())
+			s.add("output_queued", "%d", out)
+		}
+	}
+
+	if r, ok := p.d.(settingsReporter); ok {
+		r.settings(&s)
+	}
+	return s, lerr
+}
+
+// Config returns the port's configuration as the driver reads it back,
+// rather than as it was asked for: drivers round baud rates, and some
+// restrict the framing or ignore flow control.  The baud rate, framing,
+// flow control characters and the termios or DCB flags behind
+// MarkErrors, XANY, MonitorDCD, CRLFTranslate and the flow control come
+// from the driver, and on Windows so does WindowsTimeouts; the timeouts
+// and the fields that only the Port acts on are reported as last set.
+// Drivers that cannot read flow control back, such as RFC 2217 ports,
+// report the FlowControl last set.  TCP ports know no line settings and
+// report them zero.
+func (p *Port) Config() (Config, error) {
+	var c Config
+	if err := p.d.getConfig(&c); err != nil {
+		return Config{}, err
+	}
+	c.Name = p.name
+	c.InterCharacterTimeout = p.interChar
+	c.MinimumReadSize = p.minRead
+	c.ReadBufferSize = len(p.rbuf)
+	c.CloseMode = p.closeMode
+	c.DrainTimeout = p.drainTimeout
+
+	p.cl.Lock()
+	if !c.RTSFlowControl && !c.XONFlowControl {
+		c.RTSFlowControl = p.flow == FlowRTSCTS
+		c.XONFlowControl = p.flow == FlowXONXOFF
+	}
+	p.cl.Unlock()
+
+	p.tl.Lock()
+	WithReadTimeout(p.readTimeout)(&c)
+	c.WriteTimeout = p.writeTimeout
+	p.tl.Unlock()
+	return c, nil
+}
+
+// DumpSettings returns Settings as text, one "name: value" per line,
+// for logging.
+func (p *Port) DumpSettings() (string, error) {
+	s, err := p.Settings()
+	return s.String(), err
+}
+
+// DiffSettings returns the settings that differ between a and b, one
+// to a line as "name: a-value -> b-value", or "" if there are none.  A
+// setting only in b shows as changed from "(none)", and one only in a
+// as changed to it.
+func DiffSettings(a, b Settings) string {
+	var d strings.Builder
+	seen := make(map[string]bool, len(a))
+	for _, e := range a {
+		seen[e.Name] = true
+		v, ok := b.Get(e.Name)
+		if !ok {
+			v = "(none)"
+		}
+		if v != e.Value {
+			fmt.Fprintf(&d, "%s: %s -> %s\n", e.Name, e.Value, v)
+		}
+	}
+	for _, e := range b {
+		if !seen[e.Name] {
+			fmt.Fprintf(&d, "%s: (none) -> %s\n", e.Name, e.Value)
+		}
+	}
+	return d.String()
+}
+
+// A flagName names a bit of a flag word, as stty(1) names it.
+type flagName struct {
+	bit  uint64
+	name string
+}
+
+// flagWord lists the bits of v named in names in stty's form: each
+// name, preceded by "-" if the bit is clear.
+func flagWord(v uint64, names []flagName) string {
+	words := make([]string, len(names))
+	for i, f := range names {
+		words[i] = f.name
+		if v&f.bit == 0 {
+			words[i] = "-" + f.name
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,85 @@
+// +build windows
+
+package goserial
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// The DCB and COMSTAT flags Settings reports.
+var (
+	dcbFlagNames = []flagName{
+		{1 << 0, "fBinary"}, {1 << 1, "fParity"},
+		{1 << 2, "fOutxCtsFlow"}, {1 << 3, "fOutxDsrFlow"},
+		{1 << 6, "fDsrSensitivity"}, {1 << 7, "fTXContinueOnXoff"},
+		{1 << 8, "fOutX"}, {1 << 9, "fInX"},
+		{1 << 10, "fErrorChar"}, {1 << 11, "fNull"},
+		{1 << 14, "fAbortOnError"},
+	}
+	comstatNames = []flagName{
+		{1 << 0, "fCtsHold"}, {1 << 1, "fDsrHold"},
+		{1 << 2, "fRlsdHold"}, {1 << 3, "fXoffHold"},
+		{1 << 4, "fXoffSent"}, {1 << 5, "fEof"}, {1 << 6, "fTxim"},
+	}
+	modemNames = []flagName{
+		{modemCTS, "cts"}, {modemDSR, "dsr"}, {modemDCD, "dcd"}, {modemRI, "ri"},
+	}
+	controlNames = [...]string{"disable", "enable", "handshake", "toggle"}
+)
+
+// settings reports the DCB, the COMMTIMEOUTS, the COMSTAT flags and the
+// modem lines.
+func (p *serialPort) settings(s *Settings) {
+	var dcb DCB
+	if err := getCommState(p.fd, &dcb); err != nil {
+		s.failed("dcb", err)
+	} else {
+		s.add("dcb", "BaudRate=%d ByteSize=%d Parity=%d StopBits=%d XonLim=%d XoffLim=%d",
+			dcb.BaudRate, dcb.ByteSize, dcb.Parity, dcb.StopBits, dcb.XonLim, dcb.XoffLim)
+		s.add("dcb.chars", "XonChar=0x%02x XoffChar=0x%02x ErrorChar=0x%02x EofChar=0x%02x EvtChar=0x%02x",
+			dcb.XonChar, dcb.XoffChar, dcb.ErrorChar, dcb.EofChar, dcb.EvtChar)
+		s.add("dcb.flags", "%s fDtrControl=%s fRtsControl=%s", flagWord(uint64(dcb.Flags), dcbFlagNames),
+			controlNames[dcb.Flags>>4&3], controlNames[dcb.Flags>>12&3])
+	}
+	var t structTimeouts
+	if err := getCommTimeouts(p.fd, &t); err != nil {
+		s.failed("timeouts", err)
+	} else {
+		s.add("timeouts", "ReadIntervalTimeout=%d ReadTotalTimeoutMultiplier=%d ReadTotalTimeoutConstant=%d WriteTotalTimeoutMultiplier=%d WriteTotalTimeoutConstant=%d",
+			t.ReadIntervalTimeout, t.ReadTotalTimeoutMultiplier, t.ReadTotalTimeoutConstant,
+			t.WriteTotalTimeoutMultiplier, t.WriteTotalTimeoutConstant)
+	}
+	if st, _, err := p.commStatus(); err != nil {
+		s.failed("comstat", err)
+	} else {
+		s.add("comstat", "%s", flagWord(uint64(st.flags), comstatNames))
+	}
+	if bits, err := getCommModemStatus(p.fd); err != nil {
+		s.failed("modem_lines", err)
+	} else {
+		s.add("modem_lines", "%s", flagWord(uint64(bits), modemNames))
+	}
+}
+
+func (p *serialPort) modemStatus() (ModemStatus, error) {
+	bits, err := getCommModemStatus(p.fd)
+	if err != nil {
+		return ModemStatus{}, err
+	}
+	return ModemStatus{
+		CTS: bits&modemCTS != 0,
+		DSR: bits&modemDSR != 0,
+		RI:  bits&modemRI != 0,
+		DCD: bits&modemDCD != 0,
+	}, nil
+}
+
+func getCommModemStatus(h syscall.Handle) (uint32, error) {
+	var bits uint32
+	r, _, err := syscall.Syscall(nGetCommModemStatus.Addr(), 2, uintptr(h), uintptr(unsafe.Pointer(&bits)), 0)
+	if r == 0 {
+		return 0, err
+	}
+	return bits, nil
+}
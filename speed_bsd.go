@@ -0,0 +1,11 @@
+// +build freebsd openbsd netbsd dragonfly
+
+package goserial
+
+// customSpeed says whether baud needs setCustomSpeed.  The BSDs take
+// any rate in the termios.
+func customSpeed(baud int) bool { return false }
+
+func setCustomSpeed(fd uintptr, baud int) error {
+	return ErrUnsupported
+}
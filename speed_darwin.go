@@ -0,0 +1,31 @@
+package goserial
+
+import "unsafe"
+
+// speed is the type of the termios speed fields.
+type speed = uint64
+
+// crtscts is CCTS_OFLOW|CRTS_IFLOW, which the syscall package lacks.
+const crtscts = 0x00030000
+
+// iossiospeed is IOSSIOSPEED from IOKit/serial/ioss.h,
+// _IOW('T', 2, speed_t).
+const iossiospeed = 0x80085402
+
+// customSpeed says whether baud needs setCustomSpeed: tcsetattr only
+// takes the rates termios has B constants for.
+func customSpeed(baud int) bool {
+	switch baud {
+	case 50, 75, 110, 134, 150, 200, 300, 600, 1200, 1800, 2400, 4800,
+		9600, 19200, 38400, 57600, 115200, 230400:
+		return false
+	}
+	return true
+}
+
+// setCustomSpeed sets the rate with IOSSIOSPEED, which has to follow
+// every tcsetattr: that puts back the speed in the termios.
+func setCustomSpeed(fd uintptr, baud int) error {
+	s := speed(baud)
+	return ioctl(fd, iossiospeed, uintptr(unsafe.Pointer(&s)))
+}
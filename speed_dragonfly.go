@@ -0,0 +1,7 @@
+package goserial
+
+// speed is the type of the termios speed fields.
+type speed = uint32
+
+// crtscts is CCTS_OFLOW|CRTS_IFLOW, which the syscall package lacks.
+const crtscts = 0x00030000
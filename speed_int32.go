@@ -0,0 +1,9 @@
+// +build netbsd openbsd
+
+package goserial
+
+// speed is the type of the termios speed fields.
+type speed = int32
+
+// crtscts is CRTSCTS, which the syscall package lacks.
+const crtscts = 0x00010000
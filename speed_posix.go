@@ -0,0 +1,11 @@
+// +build !windows,!linux,!freebsd,!openbsd,!netbsd,!darwin,cgo
+
+package goserial
+
+// customSpeeds says whether setCustomSpeed can set rates termios has no
+// constant for.
+const customSpeeds = false
+
+func setCustomSpeed(fd uintptr, baud int) error {
+	return ErrUnsupported
+}
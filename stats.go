@@ -0,0 +1,152 @@
+package goserial
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// PortStats is a snapshot of a port's transfer counters.  The counters
+// only increase, until ResetStats sets them back to zero.  Every Read
+// and Write on the Port is counted, including those made by the
+// package's own helpers.
+type PortStats struct {
+	BytesRead    uint64
+	BytesWritten uint64
+	Reads        uint64 // calls to Read
+	Writes       uint64 // calls to Write
+	Timeouts     uint64 // reads that returned ErrTimeout
+	Errors       uint64 // reads and writes that failed otherwise
+
+	// Receive line errors.  Windows reports them as flags, which are
+	// counted once each time they are found set rather than per
+	// character.  Linux counts each one with TIOCGICOUNT, read when
+	// Stats is called, on drivers that support it; ptys and many USB
+	// adapters do not.  Other ports leave them at zero.
+	Overruns      uint64 // hardware or input buffer overruns
+	ParityErrors  uint64
+	FramingErrors uint64
+	Breaks        uint64 // breaks received
+
+	// LastRead and LastWrite are when data last moved each way, or the
+	// zero time if it has not since the counters were reset.
+	LastRead  time.Time
+	LastWrite time.Time
+
+	// Reopens counts the times a ReconnectingPort has opened its device
+	// again after losing it, or after the first open failed.  It is
+	// zero for a Port.
+	Reopens uint64
+}
+
+// add adds the counters of o to s, keeping the later of the times.
+func (s *PortStats) add(o PortStats) {
+	s.BytesRead += o.BytesRead
+	s.BytesWritten += o.BytesWritten
+	s.Reads += o.Reads
+	s.Writes += o.Writes
+	s.Timeouts += o.Timeouts
+	s.Errors += o.Errors
+	s.Overruns += o.Overruns
+	s.ParityErrors += o.ParityErrors
+	s.FramingErrors += o.FramingErrors
+	s.Breaks += o.Breaks
+	s.Reopens += o.Reopens
+	if o.LastRead.After(s.LastRead) {
+		s.LastRead = o.LastRead
+	}
+	if o.LastWrite.After(s.LastWrite) {
+		s.LastWrite = o.LastWrite
+	}
+}
+
+// LastActivity returns the later of s.LastRead and s.LastWrite.
+func (s PortStats) LastActivity() time.Time {
+	if s.LastRead.After(s.LastWrite) {
+		return s.LastRead
+	}
+	return s.LastWrite
+}
+
+// portStats holds the live counters.  It is the first field of Port so
+// that the 64-bit atomics are aligned on 32-bit platforms.
+type portStats struct {
+	bytesRead, bytesWritten uint64
+	reads, writes           uint64
+	timeouts, errors        uint64
+	overruns, parityErrors  uint64
+	framingErrors, breaks   uint64
+	lastRead, lastWrite     int64 // UnixNano, or 0
+}
+
+func (s *portStats) read(n int, err error) {
+	atomic.AddUint64(&s.reads, 1)
+	if n > 0 {
+		atomic.AddUint64(&s.bytesRead, uint64(n))
+		atomic.StoreInt64(&s.lastRead, time.Now().UnixNano())
+	}
+	s.failed(err)
+}
+
+func (s *portStats) wrote(n int, err error) {
+	atomic.AddUint64(&s.writes, 1)
+	if n > 0 {
+		atomic.AddUint64(&s.bytesWritten, uint64(n))
+		atomic.StoreInt64(&s.lastWrite, time.Now().UnixNano())
+	}
+	s.failed(err)
+}
+
+func (s *portStats) failed(err error) {
+	switch {
+	case err == nil:
+	case err == ErrTimeout:
+		atomic.AddUint64(&s.timeouts, 1)
+	default:
+		atomic.AddUint64(&s.errors, 1)
+	}
+}
+
+func unixTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// Stats returns the port's transfer counters.  Each counter is read
+// atomically, but a transfer in progress may be seen in some and not
+// yet in others.  Stats is cheap enough to be called on every scrape of
+// a metrics endpoint, such as from an expvar.Func or a Prometheus
+// collector.
+func (p *Port) Stats() PortStats {
+	p.addLineCounts()
+	s := &p.stats
+	return PortStats{
+		BytesRead:    atomic.LoadUint64(&s.bytesRead),
+		BytesWritten: atomic.LoadUint64(&s.bytesWritten),
+		Reads:        atomic.LoadUint64(&s.reads),
+		Writes:       atomic.LoadUint64(&s.writes),
+		Timeouts:     atomic.LoadUint64(&s.timeouts),
+		Errors:       atomic.LoadUint64(&s.errors),
+
+		Overruns:      atomic.LoadUint64(&s.overruns),
+		ParityErrors:  atomic.LoadUint64(&s.parityErrors),
+		FramingErrors: atomic.LoadUint64(&s.framingErrors),
+		Breaks:        atomic.LoadUint64(&s.breaks),
+
+		LastRead:  unixTime(atomic.LoadInt64(&s.lastRead)),
+		LastWrite: unixTime(atomic.LoadInt64(&s.lastWrite)),
+	}
+}
+
+// ResetStats sets the port's transfer counters back to zero.
+func (p *Port) ResetStats() {
+	p.addLineCounts()
+	s := &p.stats
+	for _, c := range []*uint64{&s.bytesRead, &s.bytesWritten, &s.reads, &s.writes, &s.timeouts, &s.errors,
+		&s.overruns, &s.parityErrors, &s.framingErrors, &s.breaks} {
+		atomic.StoreUint64(c, 0)
+	}
+	atomic.StoreInt64(&s.lastRead, 0)
+	atomic.StoreInt64(&s.lastWrite, 0)
+}
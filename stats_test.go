@@ -0,0 +1,86 @@
+package goserial
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStats(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+
+	start := time.Now()
+	a.Write([]byte("hello"))
+	b.Write([]byte("hi"))
+	a.Read(make([]byte, 8))
+	a.SetReadTimeout(10 * time.Millisecond)
+	a.Read(make([]byte, 8))
+	b.Close()
+	a.Write([]byte("x"))
+
+	s := a.Stats()
+	want := PortStats{BytesRead: 2, BytesWritten: 5, Reads: 2, Writes: 2, Timeouts: 1, Errors: 1}
+	got := s
+	got.LastRead, got.LastWrite = time.Time{}, time.Time{}
+	if got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+	if s.LastWrite.Before(start) || s.LastRead.Before(s.LastWrite) || s.LastActivity() != s.LastRead {
+		t.Errorf("bad activity times: %+v", s)
+	}
+
+	a.ResetStats()
+	if s := a.Stats(); s != (PortStats{}) {
+		t.Errorf("Stats after reset = %+v", s)
+	}
+}
+
+func TestLineErrors(t *testing.T) {
+	p, _ := Pipe()
+	breaks := 0
+	p.RegisterBreakHandler(func() { breaks++ })
+
+	p.lineErrors(lineErrors{overrun: true, breaks: true})
+	p.lineErrors(lineErrors{parity: true, framing: true})
+	s := p.Stats()
+	if s.Overruns != 1 || s.ParityErrors != 1 || s.FramingErrors != 1 || s.Breaks != 1 {
+		t.Errorf("Stats = %+v", s)
+	}
+	if breaks != 1 {
+		t.Errorf("break handler called %d times, want 1", breaks)
+	}
+
+	p.RegisterBreakHandler(nil)
+	p.lineErrors(lineErrors{breaks: true})
+	if breaks != 1 {
+		t.Error("break handler called after removal")
+	}
+}
+
+// countingPipe is a pipe end whose driver keeps line error totals, as
+// a Linux serial driver does.
+type countingPipe struct {
+	*pipeEnd
+	n lineCounts
+}
+
+func (c *countingPipe) lineCounts() (lineCounts, error) { return c.n, nil }
+
+func TestLineCounts(t *testing.T) {
+	p, _ := Pipe()
+	d := &countingPipe{pipeEnd: p.d.(*pipeEnd), n: lineCounts{overrun: 5, parity: 1}}
+	p.d = d
+	p.addLineCounts() // as OpenPort does
+
+	d.n = lineCounts{overrun: 7, parity: 1, framing: 3, breaks: 1}
+	s := p.Stats()
+	if s.Overruns != 2 || s.ParityErrors != 0 || s.FramingErrors != 3 || s.Breaks != 1 {
+		t.Errorf("Stats = %+v", s)
+	}
+	d.n.parity = 4
+	p.ResetStats()
+	d.n.parity = 6
+	if s := p.Stats(); s.ParityErrors != 2 || s.Overruns != 0 {
+		t.Errorf("Stats after reset = %+v", s)
+	}
+}
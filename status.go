@@ -0,0 +1,155 @@
+package goserial
+
+import "sync/atomic"
+
+// queueReporter is implemented by drivers that can tell how much data
+// is waiting in their queues.
+type queueReporter interface {
+	queued() (in, out int, err error)
+}
+
+// InputWaiting returns the number of bytes received and not yet read,
+// including those in the read buffer.  It is implemented for local
+// ports and by Pipe; network ports, and those on Solaris and illumos,
+// return ErrUnsupported.
+func (p *Port) InputWaiting() (int, error) {
+	q, ok := p.d.(queueReporter)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	in, _, err := q.queued()
+	return in + p.Buffered(), err
+}
+
+// OutputPending returns the number of bytes written and not yet sent
+// on the line.  It is implemented like InputWaiting.
+func (p *Port) OutputPending() (int, error) {
+	q, ok := p.d.(queueReporter)
+	if !ok {
+		return 0, ErrUnsupported
+	}
+	_, out, err := q.queued()
+	return out, err
+}
+
+// lineErrors are the receive errors a driver found at one check.
+type lineErrors struct {
+	overrun, parity, framing, breaks bool
+}
+
+// lineErrorReporter is implemented by drivers that detect receive line
+// errors.  OpenPort hands them the function to report them through.
+type lineErrorReporter interface {
+	reportLineErrors(f func(lineErrors))
+}
+
+// lineCounts are a driver's running totals of receive line errors.
+type lineCounts struct {
+	overrun, parity, framing, breaks uint32
+}
+
+// lineCounter is implemented by drivers that keep their own totals of
+// receive line errors, as Linux does with TIOCGICOUNT.
+type lineCounter interface {
+	lineCounts() (lineCounts, error)
+}
+
+// addLineCounts adds what the driver counted since the last call to the
+// port's stats.  The first call, from OpenPort, only notes the totals,
+// so that errors from before the port was opened are left out.
+func (p *Port) addLineCounts() {
+	c, ok := p.d.(lineCounter)
+	if !ok {
+		return
+	}
+	p.ll.Lock()
+	defer p.ll.Unlock()
+	n, err := c.lineCounts()
+	if err != nil {
+		return
+	}
+	if p.countsSeen {
+		s := &p.stats
+		atomic.AddUint64(&s.overruns, uint64(n.overrun-p.counts.overrun))
+		atomic.AddUint64(&s.parityErrors, uint64(n.parity-p.counts.parity))
+		atomic.AddUint64(&s.framingErrors, uint64(n.framing-p.counts.framing))
+		atomic.AddUint64(&s.breaks, uint64(n.breaks-p.counts.breaks))
+	}
+	p.counts, p.countsSeen = n, true
+}
+
+type breakHandler struct{ f func() }
+
+// RegisterBreakHandler sets f to be called each time the port detects
+// a received break, replacing any earlier handler; nil removes it.  f
+// runs on the goroutine that found the break, usually one in Read, so
+// it should return quickly.  Windows finds breaks itself.  On POSIX a
+// break is only seen in the stream of a port opened with
+// Config.MarkErrors, so f is called when a MarkedReader reading the
+// port comes to one.
+func (p *Port) RegisterBreakHandler(f func()) {
+	p.onBreak.Store(breakHandler{f})
+}
+
+// breakReceived calls the break handler, if there is one.
+func (p *Port) breakReceived() {
+	if h, _ := p.onBreak.Load().(breakHandler); h.f != nil {
+		h.f()
+	}
+}
+
+func (p *Port) lineErrors(e lineErrors) {
+	s := &p.stats
+	for _, c := range []struct {
+		seen bool
+		n    *uint64
+	}{
+		{e.overrun, &s.overruns},
+		{e.parity, &s.parityErrors},
+		{e.framing, &s.framingErrors},
+		{e.breaks, &s.breaks},
+	} {
+		if c.seen {
+			atomic.AddUint64(c.n, 1)
+		}
+	}
+	if e.breaks {
+		p.breakReceived()
+	}
+}
+
+// setupWarner is implemented by drivers that can open with RawDevice.
+type setupWarner interface {
+	setupWarnings() []error
+}
+
+// SetupWarnings returns the configuration steps that failed, and were
+// skipped, while the port was opened: those of a Config.RawDevice port,
+// the ErrNotSerialPort let through by AllowNonTTY, and a LowLatency
+// or LatencyTimer request the driver refused.  It is nil if everything
+// succeeded.
+func (p *Port) SetupWarnings() []error {
+	var warnings []error
+	if w, ok := p.d.(setupWarner); ok {
+		warnings = append(warnings, w.setupWarnings()...)
+	}
+	return append(warnings, p.warnings...)
+}
+
+// lowLatencySetter is implemented by drivers that support
+// Config.LowLatency.
+type lowLatencySetter interface {
+	setLowLatency() error
+}
+
+// setLowLatency applies Config.LowLatency, recording a failure as a
+// setup warning.
+func (p *Port) setLowLatency() {
+	err := ErrUnsupported
+	if l, ok := p.d.(lowLatencySetter); ok {
+		err = l.setLowLatency()
+	}
+	if err != nil {
+		p.warnings = append(p.warnings, &ConfigError{Field: "LowLatency", Value: true, Err: err})
+	}
+}
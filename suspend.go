@@ -0,0 +1,84 @@
+package goserial
+
+// flowAction is an action of tcflow(3), numbered as Linux numbers them.
+type flowAction int
+
+const (
+	outputOff flowAction = iota // TCOOFF: stop sending
+	outputOn                    // TCOON: restart sending
+	inputOff                    // TCIOFF: send the XOFF character
+	inputOn                     // TCION: send the XON character
+)
+
+// suspender is implemented by drivers that can suspend and resume the
+// data flowing each way.
+type suspender interface {
+	tcflow(a flowAction) error
+}
+
+// SuspendOutput stops the port sending, as if the other side had sent
+// XOFF, until ResumeOutput is called.  Writes then block, or time out,
+// once the driver's output buffer is full.  It does nothing if output
+// is already suspended.  Network ports return ErrUnsupported.
+func (p *Port) SuspendOutput() error {
+	return p.suspend(&p.outSuspended, true, outputOff, "suspend output")
+}
+
+// ResumeOutput undoes SuspendOutput.
+func (p *Port) ResumeOutput() error {
+	return p.suspend(&p.outSuspended, false, outputOn, "resume output")
+}
+
+// SuspendInput asks the other side to stop sending by sending it the
+// XOFF character, as tcflow's TCIOFF does, until ResumeInput sends XON.
+// The port itself keeps receiving, and its flow control settings are
+// not changed, so the other side must honour XON/XOFF for this to
+// work.  It does nothing if input is already suspended.
+func (p *Port) SuspendInput() error {
+	return p.suspend(&p.inSuspended, true, inputOff, "suspend input")
+}
+
+// ResumeInput undoes SuspendInput.
+func (p *Port) ResumeInput() error {
+	return p.suspend(&p.inSuspended, false, inputOn, "resume input")
+}
+
+// OutputSuspended and InputSuspended report whether SuspendOutput or
+// SuspendInput is in force.
+func (p *Port) OutputSuspended() bool {
+	p.cl.Lock()
+	defer p.cl.Unlock()
+	return p.outSuspended
+}
+
+func (p *Port) InputSuspended() bool {
+	p.cl.Lock()
+	defer p.cl.Unlock()
+	return p.inSuspended
+}
+
+// suspend sets *state to on with action a, if it is not on already.
+func (p *Port) suspend(state *bool, on bool, a flowAction, op string) error {
+	p.cl.Lock()
+	defer p.cl.Unlock()
+	if *state == on {
+		return nil
+	}
+	s, ok := p.d.(suspender)
+	if !ok {
+		return ErrUnsupported
+	}
+	err := s.tcflow(a)
+	p.traceControl(op, err)
+	if err == nil {
+		*state = on
+	}
+	return err
+}
+
+// resumeAll resumes both directions before the port is closed, so that
+// the device is not left waiting for an XON that never comes.
+func (p *Port) resumeAll() {
+	p.ResumeOutput()
+	p.ResumeInput()
+}
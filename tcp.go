@@ -0,0 +1,163 @@
+package goserial
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// tcpPort is a port reached as a plain TCP socket carrying the bytes,
+// such as ser2net in raw mode or an ESP-Link.  OpenPort uses it for
+// names of the form "tcp://host:port".
+//
+// The bridge owns the line settings, so Baud, Size, Parity and StopBits
+// are accepted and ignored when the port is opened; Probe reports them
+// as not applied.  SetBaud and the modem control lines fail with
+// ErrUnsupported.
+type tcpPort struct {
+	conn net.Conn
+
+	mu                   sync.Mutex
+	timeout              time.Duration
+	wtimeout             time.Duration
+	rdeadline, wdeadline time.Time
+}
+
+func openTCP(addr string, c *Config) (driver, error) {
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	return &tcpPort{conn: conn, timeout: time.Duration(c.ReadTimeout) * time.Millisecond}, nil
+}
+
+func (p *tcpPort) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	timeout, deadline := p.timeout, p.rdeadline
+	p.mu.Unlock()
+	if timeout > 0 {
+		deadline = earliest(deadline, time.Now().Add(timeout))
+	}
+	if err := p.conn.SetReadDeadline(deadline); err != nil {
+		return 0, tcpError(err)
+	}
+	n, err := p.conn.Read(b)
+	return n, tcpError(err)
+}
+
+func (p *tcpPort) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	timeout, deadline := p.wtimeout, p.wdeadline
+	p.mu.Unlock()
+	if timeout > 0 {
+		deadline = earliest(deadline, time.Now().Add(timeout))
+	}
+	if err := p.conn.SetWriteDeadline(deadline); err != nil {
+		return 0, tcpError(err)
+	}
+	n, err := p.conn.Write(b)
+	return n, tcpError(err)
+}
+
+// tcpError translates socket errors into the package's own.
+func tcpError(err error) error {
+	var ne net.Error
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, net.ErrClosed):
+		return ErrPortClosed
+	case errors.As(err, &ne) && ne.Timeout():
+		return ErrTimeout
+	}
+	return err
+}
+
+func (p *tcpPort) Close() error {
+	return p.conn.Close()
+}
+
+func (p *tcpPort) setBaud(baud int) error {
+	return ErrUnsupported
+}
+
+func (p *tcpPort) setReadTimeout(d time.Duration) error {
+	p.mu.Lock()
+	p.timeout = d
+	p.mu.Unlock()
+	return nil
+}
+
+// setReadDeadline and setWriteDeadline also apply the deadline to the
+// socket at once, so that it bounds a Read or Write already waiting.
+func (p *tcpPort) setReadDeadline(t time.Time) error {
+	p.mu.Lock()
+	p.rdeadline = t
+	deadline := t
+	if p.timeout > 0 {
+		deadline = earliest(t, time.Now().Add(p.timeout))
+	}
+	p.mu.Unlock()
+	return tcpError(p.conn.SetReadDeadline(deadline))
+}
+
+func (p *tcpPort) setWriteDeadline(t time.Time) error {
+	p.mu.Lock()
+	p.wdeadline = t
+	deadline := t
+	if p.wtimeout > 0 {
+		deadline = earliest(t, time.Now().Add(p.wtimeout))
+	}
+	p.mu.Unlock()
+	return tcpError(p.conn.SetWriteDeadline(deadline))
+}
+
+func (p *tcpPort) setWriteTimeout(d time.Duration) error {
+	p.mu.Lock()
+	p.wtimeout = d
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *tcpPort) setDTR(on bool) error {
+	return ErrUnsupported
+}
+
+func (p *tcpPort) setRTS(on bool) error {
+	return ErrUnsupported
+}
+
+func (p *tcpPort) outputLines() (dtr, rts bool, err error) {
+	return false, false, ErrUnsupported
+}
+
+// flush discards input that has already arrived.  Output is handed
+// straight to the socket, so there is none to discard.
+func (p *tcpPort) flush(in, out bool) error {
+	if !in {
+		return nil
+	}
+	defer p.conn.SetReadDeadline(time.Time{})
+	buf := make([]byte, 1024)
+	for {
+		if err := p.conn.SetReadDeadline(time.Now().Add(time.Millisecond)); err != nil {
+			return tcpError(err)
+		}
+		if _, err := p.conn.Read(buf); err != nil {
+			if err = tcpError(err); err == ErrTimeout {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// getConfig leaves c zeroed: the line settings are not known.
+func (p *tcpPort) getConfig(c *Config) error {
+	return nil
+}
+
+func (p *tcpPort) restore() error {
+	return nil
+}
@@ -0,0 +1,70 @@
+package goserial
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestTCPPort(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen:", err)
+	}
+	defer l.Close()
+	go func() {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		io.Copy(c, c)
+	}()
+
+	c := &Config{Name: "tcp://" + l.Addr().String(), Baud: 115200, ReadTimeout: 1000}
+	p, err := OpenPort(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	p.Write([]byte("stale"))
+	time.Sleep(50 * time.Millisecond)
+	if err := p.flush(true, true); err != nil {
+		t.Fatal(err)
+	}
+	p.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(p, buf); err != nil || string(buf) != "hello" {
+		t.Errorf("echo: %q, %v", buf, err)
+	}
+
+	p.SetReadTimeout(50 * time.Millisecond)
+	if _, err := p.Read(buf); err != ErrTimeout {
+		t.Errorf("Read with nothing sent: %v, want ErrTimeout", err)
+	}
+	if err := p.SetBaud(9600); err != ErrUnsupported {
+		t.Errorf("SetBaud: %v, want ErrUnsupported", err)
+	}
+	if ce, ok := Probe(c).(*ConfigError); !ok || ce.Field != "Baud" {
+		t.Errorf("Probe did not report the baud rate as unapplied")
+	}
+	if err := p.Drain(); err != ErrUnsupported {
+		t.Errorf("Drain: %v, want ErrUnsupported", err)
+	}
+	if err := p.SetFraming(Byte7, ParityEven, StopBits1); err != ErrUnsupported {
+		t.Errorf("SetFraming: %v, want ErrUnsupported", err)
+	}
+	if s, err := OpenPort(&Config{Name: c.Name, RTSFlowControl: true}); err != ErrUnsupported {
+		if err == nil {
+			s.Close()
+		}
+		t.Errorf("open with RTSFlowControl: %v, want ErrUnsupported", err)
+	}
+
+	p.Close()
+	if _, err := p.Read(buf); err != ErrPortClosed {
+		t.Errorf("Read after Close: %v, want ErrPortClosed", err)
+	}
+}
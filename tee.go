@@ -0,0 +1,188 @@
+package goserial
+
+import (
+	"io"
+	"sync"
+)
+
+// A Tee reads a port on behalf of several consumers, each of which gets
+// a reader that sees the whole incoming stream from the time it was
+// made, while writes still go straight to the port.  It saves the
+// consumers from racing each other for the port's Read.
+type Tee struct {
+	p  io.ReadWriter
+	wl sync.Mutex // serializes Write
+
+	mu      sync.Mutex
+	readers map[*TeeReader]struct{}
+	err     error // why the tee stopped, once it has
+}
+
+// defaultTeeBuffer is how much a reader from NewReader holds.
+const defaultTeeBuffer = 64 << 10
+
+// NewTee starts reading p and returns the Tee handing out what it
+// reads.  From then on only the Tee should read p.  Reads that time out
+// are retried, so the port's read timeout does not stop the Tee.
+func NewTee(p io.ReadWriter) *Tee {
+	t := &Tee{p: p, readers: make(map[*TeeReader]struct{})}
+	go t.run()
+	return t
+}
+
+func (t *Tee) run() {
+	buf := make([]byte, 4096)
+	for {
+		n, err := t.p.Read(buf)
+		if n > 0 {
+			t.mu.Lock()
+			for r := range t.readers {
+				r.put(buf[:n])
+			}
+			t.mu.Unlock()
+		}
+		switch err {
+		case nil, ErrTimeout:
+		case ErrPortClosed:
+			t.stop(io.EOF)
+			return
+		default:
+			t.stop(err)
+			return
+		}
+	}
+}
+
+// stop ends every reader with err, and any made later.
+func (t *Tee) stop(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return
+	}
+	t.err = err
+	for r := range t.readers {
+		r.finish(err)
+	}
+	t.readers = nil
+}
+
+// NewReader returns a reader of everything the port sends from now on,
+// holding up to 64 KiB for a consumer that falls behind.
+func (t *Tee) NewReader() *TeeReader {
+	return t.NewReaderSize(defaultTeeBuffer)
+}
+
+// NewReaderSize is NewReader with a buffer of size bytes.  When the
+// buffer is full the oldest bytes are dropped to make room, and counted
+// by Dropped: a slow consumer loses data rather than holding up the
+// others.
+func (t *Tee) NewReaderSize(size int) *TeeReader {
+	if size <= 0 {
+		size = defaultTeeBuffer
+	}
+	r := &TeeReader{t: t, size: size}
+	r.cond.L = &r.mu
+	t.mu.Lock()
+	if t.err != nil {
+		r.err = t.err
+	} else {
+		t.readers[r] = struct{}{}
+	}
+	t.mu.Unlock()
+	return r
+}
+
+// Write writes to the port, one Write at a time.
+func (t *Tee) Write(b []byte) (int, error) {
+	t.wl.Lock()
+	defer t.wl.Unlock()
+	return t.p.Write(b)
+}
+
+// Close ends every reader with io.EOF and closes the port, if it can be
+// closed, which stops the Tee reading it.  Closing the port directly
+// does the same.
+func (t *Tee) Close() error {
+	t.stop(io.EOF)
+	if c, ok := t.p.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// A TeeReader is one consumer's view of a Tee.
+type TeeReader struct {
+	t *Tee
+
+	mu      sync.Mutex
+	cond    sync.Cond
+	buf     []byte
+	size    int
+	dropped int64
+	err     error // returned once buf is empty
+}
+
+// put adds b to r's buffer, dropping the oldest bytes if it would
+// overflow.  The Tee's mu is held.
+func (r *TeeReader) put(b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if excess := len(r.buf) + len(b) - r.size; excess > 0 {
+		if excess > len(r.buf) {
+			b = b[excess-len(r.buf):]
+			r.buf = r.buf[:0]
+		} else {
+			r.buf = r.buf[excess:]
+		}
+		r.dropped += int64(excess)
+	}
+	r.buf = append(r.buf, b...)
+	r.cond.Broadcast()
+}
+
+func (r *TeeReader) finish(err error) {
+	r.mu.Lock()
+	r.err = err
+	r.cond.Broadcast()
+	r.mu.Unlock()
+}
+
+// Read waits for data from the port.  Once the Tee or the port has been
+// closed, it returns what is left and then io.EOF; if the port failed,
+// it returns the port's error instead.
+func (r *TeeReader) Read(b []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.buf) == 0 && r.err == nil {
+		r.cond.Wait()
+	}
+	if len(r.buf) == 0 {
+		return 0, r.err
+	}
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// Dropped returns the number of bytes dropped because r's buffer was
+// full.
+func (r *TeeReader) Dropped() int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.dropped
+}
+
+// Close detaches r from the Tee, discarding what it holds.  Later Reads
+// return io.EOF.
+func (r *TeeReader) Close() error {
+	r.t.mu.Lock()
+	delete(r.t.readers, r)
+	r.t.mu.Unlock()
+	r.mu.Lock()
+	r.buf = nil
+	r.err = io.EOF
+	r.cond.Broadcast()
+	r.mu.Unlock()
+	return nil
+}
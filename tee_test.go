@@ -0,0 +1,72 @@
+package goserial
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestTee(t *testing.T) {
+	a, b := Pipe()
+	tee := NewTee(b)
+	r1, r2 := tee.NewReader(), tee.NewReaderSize(4)
+
+	a.Write([]byte("hello world"))
+	buf := make([]byte, 11)
+	if _, err := io.ReadFull(r1, buf); err != nil || string(buf) != "hello world" {
+		t.Fatalf("first reader got %q, %v", buf, err)
+	}
+	// The second reader only holds the last four bytes.
+	for deadline := time.Now().Add(time.Second); r2.Dropped() < 7 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if n, err := r2.Read(buf); string(buf[:n]) != "orld" || err != nil || r2.Dropped() != 7 {
+		t.Errorf("small reader got %q, %v, dropped %d; want \"orld\", 7 dropped", buf[:n], err, r2.Dropped())
+	}
+
+	if _, err := tee.Write([]byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := a.Read(buf); string(buf[:n]) != "ok" || err != nil {
+		t.Errorf("peer got %q, %v from Tee.Write", buf[:n], err)
+	}
+
+	r2.Close()
+	if _, err := r2.Read(buf); err != io.EOF {
+		t.Errorf("Read after reader Close = %v; want io.EOF", err)
+	}
+
+	a.Write([]byte("bye"))
+	a.Close()
+	if got, err := io.ReadAll(r1); string(got) != "bye" || err != nil {
+		t.Errorf("after the peer closed, got %q, %v; want \"bye\" and EOF", got, err)
+	}
+	if _, err := tee.NewReader().Read(buf); err != io.EOF {
+		t.Errorf("new reader on a stopped tee: %v; want io.EOF", err)
+	}
+}
+
+func TestTeeClose(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	tee := NewTee(b)
+	r := tee.NewReader()
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		done <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	tee.Close()
+	select {
+	case err := <-done:
+		if err != io.EOF {
+			t.Errorf("Read after Tee.Close = %v; want io.EOF", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Tee.Close did not end a blocked Read")
+	}
+	if _, err := b.Write([]byte("x")); err != ErrPortClosed {
+		t.Errorf("port after Tee.Close: Write = %v; want ErrPortClosed", err)
+	}
+}
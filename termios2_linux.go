@@ -0,0 +1,11 @@
+// +build linux,!ppc64,!ppc64le,!mips,!mipsle,!mips64,!mips64le
+
+package goserial
+
+// The kernel's termios2, as TCGETS2 and TCSETS2 take it.  Neither is
+// exported by the syscall package.
+const (
+	nccs2   = 19
+	tcgets2 = 0x802c542a // _IOR('T', 0x2A, struct termios2)
+	tcsets2 = 0x402c542b // _IOW('T', 0x2B, struct termios2)
+)
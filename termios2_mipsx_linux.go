@@ -0,0 +1,10 @@
+// +build linux,mips linux,mipsle linux,mips64 linux,mips64le
+
+package goserial
+
+// MIPS has more control characters, and its own ioctl encoding.
+const (
+	nccs2   = 23
+	tcgets2 = 0x4030542a
+	tcsets2 = 0x8030542b
+)
@@ -0,0 +1,60 @@
+// +build linux freebsd netbsd openbsd darwin dragonfly
+
+package goserial
+
+import "syscall"
+
+// The termios flags Settings reports, in stty's order.
+var (
+	iflagNames = []flagName{
+		{syscall.IGNBRK, "ignbrk"}, {syscall.BRKINT, "brkint"},
+		{syscall.IGNPAR, "ignpar"}, {syscall.PARMRK, "parmrk"},
+		{syscall.INPCK, "inpck"}, {syscall.ISTRIP, "istrip"},
+		{syscall.INLCR, "inlcr"}, {syscall.IGNCR, "igncr"},
+		{syscall.ICRNL, "icrnl"}, {syscall.IXON, "ixon"},
+		{syscall.IXOFF, "ixoff"}, {syscall.IXANY, "ixany"},
+		{syscall.IMAXBEL, "imaxbel"},
+	}
+	oflagNames = []flagName{
+		{syscall.OPOST, "opost"}, {syscall.ONLCR, "onlcr"},
+	}
+	cflagNames = []flagName{
+		{syscall.PARENB, "parenb"}, {syscall.PARODD, "parodd"},
+		{syscall.HUPCL, "hupcl"}, {syscall.CSTOPB, "cstopb"},
+		{syscall.CREAD, "cread"}, {syscall.CLOCAL, "clocal"},
+		{crtscts, "crtscts"},
+	}
+	lflagNames = []flagName{
+		{syscall.ISIG, "isig"}, {syscall.ICANON, "icanon"},
+		{syscall.IEXTEN, "iexten"}, {syscall.ECHO, "echo"},
+		{syscall.ECHOE, "echoe"}, {syscall.ECHOK, "echok"},
+		{syscall.ECHONL, "echonl"}, {syscall.NOFLSH, "noflsh"},
+		{syscall.TOSTOP, "tostop"}, {syscall.ECHOCTL, "echoctl"},
+		{syscall.ECHOKE, "echoke"},
+	}
+	csizeNames = map[uint64]string{
+		syscall.CS5: "cs5", syscall.CS6: "cs6", syscall.CS7: "cs7", syscall.CS8: "cs8",
+	}
+)
+
+// termiosSettings adds the four flag words of a termios, and the
+// control characters that matter to a serial port.
+func termiosSettings(s *Settings, t *syscall.Termios) {
+	s.add("termios.iflag", "%s", flagWord(uint64(t.Iflag), iflagNames))
+	s.add("termios.oflag", "%s", flagWord(uint64(t.Oflag), oflagNames))
+	s.add("termios.cflag", "%s %s", csizeNames[uint64(t.Cflag)&syscall.CSIZE], flagWord(uint64(t.Cflag), cflagNames))
+	s.add("termios.lflag", "%s", flagWord(uint64(t.Lflag), lflagNames))
+	s.add("termios.cc", "vmin=%d vtime=%d vstart=0x%02x vstop=0x%02x",
+		t.Cc[syscall.VMIN], t.Cc[syscall.VTIME], t.Cc[syscall.VSTART], t.Cc[syscall.VSTOP])
+}
+
+// settings reports the termios settings and the modem lines.
+func (p *serialPort) settings(s *Settings) {
+	var t syscall.Termios
+	if err := p.tcgetattr(&t); err != nil {
+		s.failed("termios", err)
+	} else {
+		termiosSettings(s, &t)
+	}
+	p.modemSettings(s)
+}
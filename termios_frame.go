@@ -0,0 +1,75 @@
+// +build linux freebsd netbsd openbsd darwin dragonfly
+
+package goserial
+
+import (
+	"errors"
+	"syscall"
+)
+
+// frameTermios selects the stop bits, character size and parity mode in
+// t.  Config.check has already rejected values outside the enums; mark
+// and space parity need CMSPAR, which only Linux has, and 1.5 stop bits
+// are CSTOPB with 5-bit characters.
+func frameTermios(t *syscall.Termios, size ByteSize, parity ParityMode, stop StopBits) error {
+	if stop == StopBits1Half && size != Byte5 {
+		return &ConfigError{Field: "StopBits", Value: stop, Err: errors.New("1.5 needs Byte5 on POSIX")}
+	}
+	if (parity == ParityMark || parity == ParitySpace) && cmspar == 0 {
+		return &ConfigError{Field: "Parity", Value: parity, Err: ErrUnsupported}
+	}
+	switch stop {
+	case StopBits1:
+		t.Cflag &^= syscall.CSTOPB
+	case StopBits2, StopBits1Half:
+		t.Cflag |= syscall.CSTOPB
+	default:
+		panic(stop)
+	}
+
+	t.Cflag &^= syscall.CSIZE
+	switch size {
+	case Byte5:
+		t.Cflag |= syscall.CS5
+	case Byte6:
+		t.Cflag |= syscall.CS6
+	case Byte7:
+		t.Cflag |= syscall.CS7
+	case Byte8:
+		t.Cflag |= syscall.CS8
+	default:
+		panic(size)
+	}
+
+	t.Cflag &^= cmspar
+	switch parity {
+	case ParityNone:
+		t.Cflag &^= syscall.PARENB
+	case ParityEven:
+		t.Cflag |= syscall.PARENB
+		t.Cflag &^= syscall.PARODD
+	case ParityOdd:
+		t.Cflag |= syscall.PARENB
+		t.Cflag |= syscall.PARODD
+	case ParityMark:
+		t.Cflag |= syscall.PARENB | cmspar
+		t.Cflag |= syscall.PARODD
+	case ParitySpace:
+		t.Cflag |= syscall.PARENB | cmspar
+		t.Cflag &^= syscall.PARODD
+	default:
+		panic(parity)
+	}
+	return nil
+}
+
+func (p *serialPort) setFraming(size ByteSize, parity ParityMode, stop StopBits) error {
+	var t syscall.Termios
+	if err := p.tcgetattr(&t); err != nil {
+		return err
+	}
+	if err := frameTermios(&t, size, parity, stop); err != nil {
+		return err
+	}
+	return p.tcsetattr(&t)
+}
@@ -0,0 +1,64 @@
+// +build !ppc64,!ppc64le
+
+package goserial
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// The syscall package does not export CBAUD.  This value holds on every
+// architecture but powerpc.
+const cbaud = 0x100f
+
+// bother in the CBAUD bits says the rate is the number in c_ospeed.
+const bother = 0x1000
+
+// termios2 is the kernel's struct termios2, which unlike termios has
+// room for any rate.
+type termios2 struct {
+	Iflag, Oflag, Cflag, Lflag uint32
+	Line                       uint8
+	Cc                         [nccs2]uint8
+	Ispeed, Ospeed             uint32
+}
+
+// setCustomBaud sets a rate that has no B constant with BOTHER, and
+// reads it back: a driver that cannot reach it closely either fails or
+// rounds it, and rounding by more than 2% is an error too.
+func (p *serialPort) setCustomBaud(baud int) error {
+	if p.noTermios {
+		return ErrUnsupported
+	}
+	var t termios2
+	if err := p.ioctl(tcgets2, uintptr(unsafe.Pointer(&t))); err != nil {
+		return err
+	}
+	// With the input rate bits (CIBAUD) clear, input runs at the
+	// output rate.
+	t.Cflag = t.Cflag&^(cbaud|cbaud<<16) | bother
+	t.Ispeed, t.Ospeed = uint32(baud), uint32(baud)
+	if err := p.ioctl(tcsets2, uintptr(unsafe.Pointer(&t))); err != nil {
+		return fmt.Errorf("baud rate %d: %v", baud, err)
+	}
+	got, err := p.readCustomBaud()
+	if err != nil {
+		return err
+	}
+	if d := got - baud; d*50 > baud || -d*50 > baud {
+		return fmt.Errorf("baud rate %d not supported by the driver, which set %d", baud, got)
+	}
+	return nil
+}
+
+// readCustomBaud returns the rate in c_ospeed if BOTHER is set, or 0.
+func (p *serialPort) readCustomBaud() (int, error) {
+	var t termios2
+	if err := p.ioctl(tcgets2, uintptr(unsafe.Pointer(&t))); err != nil {
+		return 0, err
+	}
+	if t.Cflag&cbaud != bother {
+		return 0, nil
+	}
+	return int(t.Ospeed), nil
+}
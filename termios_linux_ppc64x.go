@@ -0,0 +1,17 @@
+// +build linux,ppc64 linux,ppc64le
+
+package goserial
+
+// On powerpc the baud rate occupies the low byte of c_cflag, and the
+// rates above 38400 have no separate CBAUDEX bit.
+const cbaud = 0xff
+
+// powerpc has no termios2, so only the rates with a B constant can be
+// set.
+func (p *serialPort) setCustomBaud(baud int) error {
+	return &ConfigError{Field: "Baud", Value: baud, Err: ErrBadBaudRate}
+}
+
+func (p *serialPort) readCustomBaud() (int, error) {
+	return 0, nil
+}
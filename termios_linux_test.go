@@ -0,0 +1,85 @@
+// +build !ppc64,!ppc64le
+
+package goserial
+
+import (
+	"syscall"
+	"testing"
+	"unsafe"
+)
+
+func TestTermios2Layout(t *testing.T) {
+	for _, req := range []uintptr{tcgets2, tcsets2} {
+		if size := req >> 16 & 0x1fff; size != unsafe.Sizeof(termios2{}) {
+			t.Errorf("ioctl %#x takes %d bytes, termios2 has %d", req, size, unsafe.Sizeof(termios2{}))
+		}
+	}
+}
+
+func TestCustomBaud(t *testing.T) {
+	m, name := openPty(t)
+	defer m.Close()
+
+	p, err := OpenPort(&Config{Name: name, Baud: 250000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	for _, baud := range []int{250000, 14400, 115200, 31250} {
+		if baud != 250000 {
+			if err := p.SetBaud(baud); err != nil {
+				t.Fatalf("SetBaud(%d): %v", baud, err)
+			}
+		}
+		var c Config
+		if err := p.d.getConfig(&c); err != nil {
+			t.Fatal(err)
+		}
+		if c.Baud != baud {
+			t.Errorf("getConfig after setting %d: baud %d", baud, c.Baud)
+		}
+	}
+
+	// Changing other settings keeps the rate in c_ospeed.
+	p.SetBaud(250000)
+	p.SetFlowControl(FlowXONXOFF)
+	var c Config
+	if p.d.getConfig(&c); c.Baud != 250000 {
+		t.Errorf("baud after SetFlowControl = %d, want 250000", c.Baud)
+	}
+	if err := p.SetBaud(-1); err == nil {
+		t.Error("SetBaud(-1) succeeded")
+	}
+}
+
+func TestFrameTermiosMarkSpace(t *testing.T) {
+	var st syscall.Termios
+	for _, tc := range []struct {
+		parity ParityMode
+		cflag  uint32
+	}{
+		{ParityMark, syscall.PARENB | syscall.PARODD | cmspar},
+		{ParitySpace, syscall.PARENB | cmspar},
+		{ParityOdd, syscall.PARENB | syscall.PARODD},
+	} {
+		if err := frameTermios(&st, Byte8, tc.parity, StopBits1); err != nil {
+			t.Fatal(err)
+		}
+		if got := st.Cflag & (syscall.PARENB | syscall.PARODD | cmspar); got != tc.cflag {
+			t.Errorf("%v parity: cflag %#x, want %#x", tc.parity, got, tc.cflag)
+		}
+	}
+}
+
+func TestFrameTermiosStopBits1Half(t *testing.T) {
+	var st syscall.Termios
+	if err := frameTermios(&st, Byte5, ParityNone, StopBits1Half); err != nil {
+		t.Fatal(err)
+	}
+	if st.Cflag&(syscall.CSIZE|syscall.CSTOPB) != syscall.CS5|syscall.CSTOPB {
+		t.Errorf("cflag %#x, want CS5|CSTOPB", st.Cflag)
+	}
+	if ce, ok := frameTermios(&st, Byte8, ParityNone, StopBits1Half).(*ConfigError); !ok || ce.Field != "StopBits" {
+		t.Errorf("1.5 stop bits with Byte8: got %v, want a StopBits ConfigError", ce)
+	}
+}
@@ -0,0 +1,49 @@
+package goserial
+
+import "time"
+
+// ReadTimestamped is Read, also returning when the bytes arrived: the
+// time the driver's read returned, taken before tracing or buffering.
+// All the bytes of one call share the time, so a chunk the driver
+// delivered at once has one time for all of it.  On a port with a read
+// buffer, a call returns bytes from one driver read at most, with that
+// read's time.  The time is zero if no bytes were read.
+//
+// The time is when the bytes reached the program, not when they crossed
+// the wire, and is only as good as the path between:
+//
+//   - A UART on the motherboard interrupts per FIFO fill, typically 14
+//     bytes, and the wakeup adds tens of microseconds of scheduling
+//     delay on Linux and the BSDs, more on a loaded machine.
+//   - A USB adapter delivers in USB frames, every millisecond at full
+//     speed, and an FTDI one also holds short packets for its latency
+//     timer, 16 ms by default (see SetLatencyTimer).
+//   - On Windows the thread wakes when the driver completes the read,
+//     which USB drivers also batch by the millisecond.
+//   - Network ports see the bytes when the TCP stack hands them over.
+//
+// Gaps of a few milliseconds, such as the Modbus RTU silent interval at
+// high baud rates, are at or below what these paths resolve.
+func (p *Port) ReadTimestamped(b []byte) (int, time.Time, error) {
+	if p.rbuf == nil {
+		return p.readAt(b)
+	}
+	p.rr.Lock()
+	defer p.rr.Unlock()
+	var err error
+	if p.Buffered() == 0 {
+		if len(b) >= len(p.rbuf) {
+			return p.readAt(b)
+		}
+		err = p.fill()
+	}
+	p.rl.Lock()
+	defer p.rl.Unlock()
+	if p.rpos == p.rend {
+		return 0, time.Time{}, err
+	}
+	s := p.rstamps[0]
+	n := copy(b, p.rbuf[p.rpos:s.end])
+	p.consume(n)
+	return n, s.at, nil
+}
@@ -0,0 +1,75 @@
+package goserial
+
+import (
+	"fmt"
+	"time"
+)
+
+// TouchReset puts a board with a "1200 baud touch" bootloader, such as
+// the Arduino Leonardo and Micro and many SAMD boards, into its
+// bootloader: it opens the port at 1200 baud, drops DTR and closes it
+// again.  The board then re-enumerates, possibly under another name.
+func TouchReset(name string) error {
+	p, err := OpenPort(&Config{Name: name, Baud: 1200})
+	if err != nil {
+		return err
+	}
+	if err := p.SetDTR(false); err != nil {
+		p.Close()
+		return err
+	}
+	return p.Close()
+}
+
+// TouchResetWait does a TouchReset and then waits up to timeout for the
+// bootloader's port to show up, returning its name.  The bootloader may
+// come back under the same name after disappearing briefly (usual on
+// Linux) or under a new one (a new COM number on Windows).  If nothing
+// new appears but the original port is still there when the timeout
+// expires, the board is assumed not to have re-enumerated and name is
+// returned.
+func TouchResetWait(name string, timeout time.Duration) (string, error) {
+	before, err := listPorts()
+	if err != nil {
+		return "", err
+	}
+	if err := TouchReset(name); err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		time.Sleep(100 * time.Millisecond)
+		now, err := listPorts()
+		if err != nil {
+			return "", err
+		}
+		if n := newPort(before, now); n != "" {
+			return n, nil
+		}
+		before = now
+
+		if time.Now().After(deadline) {
+			for _, n := range now {
+				if n == name {
+					return name, nil
+				}
+			}
+			return "", fmt.Errorf("goserial: no port appeared within %v after resetting %s", timeout, name)
+		}
+	}
+}
+
+// newPort returns the first name in now that is not in before.
+func newPort(before, now []string) string {
+	seen := make(map[string]bool, len(before))
+	for _, n := range before {
+		seen[n] = true
+	}
+	for _, n := range now {
+		if !seen[n] {
+			return n
+		}
+	}
+	return ""
+}
@@ -0,0 +1,144 @@
+package goserial
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// A Tracer is told about everything done through a Port.  Its methods
+// are called synchronously, from the goroutine doing the operation, so
+// they should be quick.  Reads and writes may be reported concurrently.
+type Tracer interface {
+	// OnRead reports a Read; p holds the bytes actually read.
+	OnRead(p []byte, err error)
+	// OnWrite reports a Write; p holds the n bytes actually written.
+	OnWrite(p []byte, n int, err error)
+	// OnControl reports any other operation, such as "baud" or "dtr",
+	// with its arguments.
+	OnControl(op string, err error, args ...interface{})
+}
+
+// tracerBox lets a nil Tracer be kept in an atomic.Value.
+type tracerBox struct{ t Tracer }
+
+// SetTracer makes t see all further operations on the port.  A nil t
+// turns tracing off.
+func (p *Port) SetTracer(t Tracer) {
+	p.trace.Store(tracerBox{t})
+}
+
+func (p *Port) tracer() Tracer {
+	b, _ := p.trace.Load().(tracerBox)
+	return b.t
+}
+
+func (p *Port) traceControl(op string, err error, args ...interface{}) {
+	if t := p.tracer(); t != nil {
+		t.OnControl(op, err, args...)
+	}
+}
+
+// The helpers below are how the rest of the package works the driver,
+// so that tracers see every change.
+
+func (p *Port) setDTR(on bool) error {
+	err := p.d.setDTR(on)
+	p.traceControl("dtr", err, on)
+	return err
+}
+
+func (p *Port) setRTS(on bool) error {
+	if p.flow == FlowRTSCTS {
+		return ErrRTSFlowControl
+	}
+	err := p.d.setRTS(on)
+	p.traceControl("rts", err, on)
+	return err
+}
+
+func (p *Port) flush(in, out bool) error {
+	if in {
+		p.dropBuffered()
+	}
+	if out {
+		p.discardWrites()
+	}
+	err := p.d.flush(in, out)
+	p.traceControl("flush", err, in, out)
+	return err
+}
+
+// HexTracer is a Tracer writing hex dumps, one line per 16 bytes, like
+//
+//	0.000000 W 41 54 0d                                         |AT.|
+//	0.020311 R 4f 4b 0d 0a                                      |OK..|
+//	0.120417 R error: goserial: read timeout
+//	0.120502 C dtr false
+//
+// Each line starts with the seconds since the tracer was made, so that
+// traces of the same exchange compare well.
+type HexTracer struct {
+	w     io.Writer
+	start time.Time
+	mu    sync.Mutex
+}
+
+// NewHexTracer returns a HexTracer writing to w.
+func NewHexTracer(w io.Writer) *HexTracer {
+	return &HexTracer{w: w, start: time.Now()}
+}
+
+func (h *HexTracer) OnRead(p []byte, err error) {
+	h.dump('R', p, err)
+}
+
+func (h *HexTracer) OnWrite(p []byte, n int, err error) {
+	h.dump('W', p, err)
+}
+
+func (h *HexTracer) OnControl(op string, err error, args ...interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	line := fmt.Sprintf("%s C %s", h.stamp(), op)
+	for _, a := range args {
+		line += fmt.Sprintf(" %v", a)
+	}
+	if err != nil {
+		line += fmt.Sprintf(" error: %v", err)
+	}
+	fmt.Fprintln(h.w, line)
+}
+
+func (h *HexTracer) stamp() string {
+	return fmt.Sprintf("%.6f", time.Since(h.start).Seconds())
+}
+
+func (h *HexTracer) dump(dir byte, p []byte, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ts := h.stamp()
+	for len(p) > 0 {
+		n := len(p)
+		if n > 16 {
+			n = 16
+		}
+		var hex, text []byte
+		for i, c := range p[:n] {
+			if i > 0 {
+				hex = append(hex, ' ')
+			}
+			hex = append(hex, fmt.Sprintf("%02x", c)...)
+			if c < 0x20 || c > 0x7e {
+				c = '.'
+			}
+			text = append(text, c)
+		}
+		fmt.Fprintf(h.w, "%s %c %-47s  |%s|\n", ts, dir, hex, text)
+		p = p[n:]
+	}
+	if err != nil {
+		fmt.Fprintf(h.w, "%s %c error: %v\n", ts, dir, err)
+	}
+}
@@ -0,0 +1,56 @@
+package goserial
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+)
+
+func TestHexTracer(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+
+	var out bytes.Buffer
+	a.SetTracer(NewHexTracer(&out))
+	b.Write([]byte("OK\r\n"))
+	a.Read(make([]byte, 16))
+	a.SetDTR(true)
+	a.Write([]byte("0123456789abcdefXYZ"))
+	a.Close()
+	a.SetTracer(nil)
+	a.Write([]byte("untraced"))
+
+	// Strip the timestamps, which vary.
+	got := regexp.MustCompile(`(?m)^\d+\.\d{6} `).ReplaceAllString(out.String(), "")
+	want := "" +
+		"R 4f 4b 0d 0a                                      |OK..|\n" +
+		"C dtr true\n" +
+		"W 30 31 32 33 34 35 36 37 38 39 61 62 63 64 65 66  |0123456789abcdef|\n" +
+		"W 58 59 5a                                         |XYZ|\n" +
+		"C close\n"
+	if got != want {
+		t.Errorf("trace:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestConfigTracer(t *testing.T) {
+	a, b := Pipe()
+	defer b.Close()
+	registerTestDriver("testtrace", func(string, *Config) (Driver, error) { return a, nil })
+
+	var out bytes.Buffer
+	p, err := OpenPort(&Config{Name: "testtrace://x", Baud: 9600, PurgeOnOpen: true, Tracer: NewHexTracer(&out)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Close()
+
+	got := regexp.MustCompile(`(?m)^\d+\.\d{6} `).ReplaceAllString(out.String(), "")
+	want := "" +
+		"C open testtrace://x\n" +
+		"C flush true false\n" +
+		"C close\n"
+	if got != want {
+		t.Errorf("trace:\n%s\nwant:\n%s", got, want)
+	}
+}
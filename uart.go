@@ -0,0 +1,37 @@
+package goserial
+
+// UARTInfo describes the hardware and driver behind a port, as far as
+// the operating system says.  What it does not say is left zero.
+type UARTInfo struct {
+	// Type is the UART the driver reports, such as "16550A", or
+	// "unknown" if it reports none, as USB adapters mostly do.
+	Type string
+
+	Port         uint64 // I/O port base address, for legacy ports
+	IRQ          int
+	XmitFIFOSize int // transmit FIFO size in bytes
+	BaseBaud     int // UART clock divided by 16
+
+	// Driver is the kernel driver bound to the device, such as
+	// "ftdi_sio" or "serial8250" on Linux, or the driver service, such
+	// as "FTDIBUS" or "Serial", on Windows.
+	Driver string
+}
+
+// driverInformer is implemented by drivers that can describe the
+// hardware behind them.
+type driverInformer interface {
+	driverInfo() (UARTInfo, error)
+}
+
+// DriverInfo describes the UART and driver behind the port.  Linux
+// reports everything it can through TIOCGSERIAL and sysfs, and Windows
+// the driver service; other systems and network ports return
+// ErrUnsupported.
+func (p *Port) DriverInfo() (UARTInfo, error) {
+	d, ok := p.d.(driverInformer)
+	if !ok {
+		return UARTInfo{}, ErrUnsupported
+	}
+	return d.driverInfo()
+}
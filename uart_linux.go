@@ -0,0 +1,83 @@
+// +build linux
+
+package goserial
+
+import (
+	"fmt"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// uartTypes names the PORT_ values of serial_struct.type, from the
+// kernel's serial_core.h.
+var uartTypes = []string{
+	0:  "unknown",
+	1:  "8250",
+	2:  "16450",
+	3:  "16550",
+	4:  "16550A",
+	5:  "Cirrus",
+	6:  "16650",
+	7:  "16650V2",
+	8:  "16750",
+	9:  "Startech",
+	10: "16C950",
+	11: "16654",
+	12: "16850",
+	13: "RSA",
+	14: "NS16550A",
+	15: "XScale",
+	16: "RM9000",
+	17: "Octeon",
+	18: "AR7",
+	19: "U6_16550A",
+	20: "Tegra",
+	21: "XR17D15X",
+	22: "LPC3220",
+	23: "8250_CIR",
+	24: "XR17V35X",
+	25: "BRCM_TRUMANAGE",
+	26: "ALTR_16550_F32",
+	27: "ALTR_16550_F64",
+	28: "ALTR_16550_F128",
+	29: "RT2880",
+	30: "16550A_FSL64",
+}
+
+func uartType(t int32) string {
+	if t >= 0 && int(t) < len(uartTypes) {
+		return uartTypes[t]
+	}
+	return fmt.Sprintf("type %d", t)
+}
+
+// driverInfo reads serial_struct with TIOCGSERIAL, which ptys and some
+// USB drivers do not support, and the driver bound to the device from
+// sysfs.  Only a closed port is an error.
+func (p *serialPort) driverInfo() (UARTInfo, error) {
+	var info UARTInfo
+	var ss serialStruct
+	var serr error
+	err := p.control(func(fd uintptr) error {
+		serr = ioctl(fd, syscall.TIOCGSERIAL, uintptr(unsafe.Pointer(&ss)))
+		return nil
+	})
+	if err != nil {
+		return info, err
+	}
+	if serr == nil {
+		info.Type = uartType(ss.typ)
+		info.Port = uint64(ss.port) | uint64(ss.portHigh)<<32
+		info.IRQ = int(ss.irq)
+		info.XmitFIFOSize = int(ss.xmitFifoSize)
+		info.BaseBaud = int(ss.baudBase)
+	}
+	if dev, err := filepath.EvalSymlinks(p.f.Name()); err == nil {
+		drv, err := filepath.EvalSymlinks("/sys/class/tty/" + filepath.Base(dev) + "/device/driver")
+		if err == nil {
+			info.Driver = filepath.Base(drv)
+		}
+	}
+	return info, nil
+}
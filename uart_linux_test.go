@@ -0,0 +1,30 @@
+// +build linux
+
+package goserial
+
+import "testing"
+
+func TestDriverInfo(t *testing.T) {
+	// A pty has no serial_struct and no device in sysfs, which leaves
+	// the fields empty rather than failing.
+	m, p := openPtyPort(t, Config{})
+	defer m.Close()
+	info, err := p.DriverInfo()
+	if err != nil || info != (UARTInfo{}) {
+		t.Errorf("DriverInfo of a pty = %+v, %v; want nothing", info, err)
+	}
+	p.Close()
+	if _, err := p.DriverInfo(); err == nil {
+		t.Error("DriverInfo after Close succeeded")
+	}
+
+	for typ, want := range map[int32]string{0: "unknown", 4: "16550A", 99: "type 99"} {
+		if got := uartType(typ); got != want {
+			t.Errorf("uartType(%d) = %q; want %q", typ, got, want)
+		}
+	}
+	a, _ := Pipe()
+	if _, err := a.DriverInfo(); err != ErrUnsupported {
+		t.Errorf("DriverInfo of a pipe = %v; want ErrUnsupported", err)
+	}
+}
@@ -0,0 +1,128 @@
+// +build windows
+
+package goserial
+
+import (
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	modsetupapi = syscall.NewLazyDLL("setupapi.dll")
+
+	nSetupDiGetClassDevs              = modsetupapi.NewProc("SetupDiGetClassDevsW")
+	nSetupDiEnumDeviceInfo            = modsetupapi.NewProc("SetupDiEnumDeviceInfo")
+	nSetupDiOpenDevRegKey             = modsetupapi.NewProc("SetupDiOpenDevRegKey")
+	nSetupDiGetDeviceRegistryProperty = modsetupapi.NewProc("SetupDiGetDeviceRegistryPropertyW")
+	nSetupDiDestroyDeviceInfoList     = modsetupapi.NewProc("SetupDiDestroyDeviceInfoList")
+
+	modcfgmgr32 = syscall.NewLazyDLL("cfgmgr32.dll")
+
+	nCMGetParent   = modcfgmgr32.NewProc("CM_Get_Parent")
+	nCMGetDeviceID = modcfgmgr32.NewProc("CM_Get_Device_IDW")
+)
+
+// guidDevClassPorts is GUID_DEVCLASS_PORTS, the setup class of COM and
+// LPT ports.
+var guidDevClassPorts = syscall.GUID{
+	Data1: 0x4d36e978, Data2: 0xe325, Data3: 0x11ce,
+	Data4: [8]byte{0xbf, 0xc1, 0x08, 0x00, 0x2b, 0xe1, 0x03, 0x18},
+}
+
+const (
+	digcfPresent    = 0x2 // DIGCF_PRESENT
+	dicsFlagGlobal  = 0x1 // DICS_FLAG_GLOBAL
+	diregDev        = 0x1 // DIREG_DEV
+	spdrpDeviceDesc = 0x0 // SPDRP_DEVICEDESC
+	spdrpService    = 0x4 // SPDRP_SERVICE
+	spdrpMfg        = 0xb // SPDRP_MFG
+	invalidHandle   = ^uintptr(0)
+)
+
+// spDevinfoData is SP_DEVINFO_DATA.
+type spDevinfoData struct {
+	size      uint32
+	classGUID syscall.GUID
+	devInst   uint32
+	reserved  uintptr
+}
+
+// driverInfo finds the port among the present devices of the Ports
+// class by its PortName, and returns the service of its driver.
+// Windows says nothing of the UART itself, so if the port is not found
+// the UARTInfo is empty.
+func (p *serialPort) driverInfo() (UARTInfo, error) {
+	com := strings.TrimPrefix(p.f.Name(), `\\.\`)
+	var info UARTInfo
+	err := portDevices(func(set uintptr, data *spDevinfoData, name string) bool {
+		if !strings.EqualFold(name, com) {
+			return true
+		}
+		info.Driver = devProperty(set, data, spdrpService)
+		return false
+	})
+	return info, err
+}
+
+// portDevices calls fn with each present device of the Ports class and
+// its PortName, until fn returns false.
+func portDevices(fn func(set uintptr, data *spDevinfoData, name string) bool) error {
+	err := loadProcs(nSetupDiGetClassDevs, nSetupDiEnumDeviceInfo, nSetupDiOpenDevRegKey,
+		nSetupDiGetDeviceRegistryProperty, nSetupDiDestroyDeviceInfoList)
+	if err != nil {
+		return err
+	}
+	set, _, err := syscall.Syscall6(nSetupDiGetClassDevs.Addr(), 4,
+		uintptr(unsafe.Pointer(&guidDevClassPorts)), 0, 0, digcfPresent, 0, 0)
+	if set == invalidHandle {
+		return err
+	}
+	defer syscall.Syscall(nSetupDiDestroyDeviceInfoList.Addr(), 1, set, 0, 0)
+
+	for i := uintptr(0); ; i++ {
+		data := spDevinfoData{size: uint32(unsafe.Sizeof(spDevinfoData{}))}
+		r, _, _ := syscall.Syscall(nSetupDiEnumDeviceInfo.Addr(), 3, set, i, uintptr(unsafe.Pointer(&data)))
+		if r == 0 {
+			return nil
+		}
+		if !fn(set, &data, devPortName(set, &data)) {
+			return nil
+		}
+	}
+}
+
+// devProperty returns a string property of the device, the first of a
+// list, or "" if it has none.
+func devProperty(set uintptr, data *spDevinfoData, prop uintptr) string {
+	buf := make([]uint16, 512)
+	var typ uint32
+	r, _, _ := syscall.Syscall9(nSetupDiGetDeviceRegistryProperty.Addr(), 7,
+		set, uintptr(unsafe.Pointer(data)), prop,
+		uintptr(unsafe.Pointer(&typ)), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)*2),
+		0, 0, 0)
+	if r == 0 || typ != syscall.REG_SZ && typ != syscall.REG_MULTI_SZ {
+		return ""
+	}
+	return syscall.UTF16ToString(buf)
+}
+
+// devPortName returns the PortName value from the device's hardware
+// key, or "" if it has none.
+func devPortName(set uintptr, data *spDevinfoData) string {
+	h, _, _ := syscall.Syscall6(nSetupDiOpenDevRegKey.Addr(), 6,
+		set, uintptr(unsafe.Pointer(data)), dicsFlagGlobal, 0, diregDev, syscall.KEY_READ)
+	if h == invalidHandle {
+		return ""
+	}
+	defer syscall.RegCloseKey(syscall.Handle(h))
+	buf := make([]uint16, 64)
+	var typ uint32
+	n := uint32(len(buf) * 2)
+	err := syscall.RegQueryValueEx(syscall.Handle(h), syscall.StringToUTF16Ptr("PortName"),
+		nil, &typ, (*byte)(unsafe.Pointer(&buf[0])), &n)
+	if err != nil || typ != syscall.REG_SZ {
+		return ""
+	}
+	return syscall.UTF16ToString(buf[:n/2])
+}
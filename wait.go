@@ -0,0 +1,28 @@
+package goserial
+
+import "context"
+
+// readWaiter is implemented by drivers that can wait for input without
+// reading it.
+type readWaiter interface {
+	waitReadable(ctx context.Context) error
+}
+
+// WaitReadable blocks until the port has received data, so that a Read
+// would return at once, until ctx is done, or until the port is closed,
+// in which case it returns ErrPortClosed.  It lets an event loop sleep
+// until there is something to read instead of polling with short read
+// timeouts.  It is implemented on Windows, by Pipe, and on POSIX for
+// ports on the runtime poller, where it waits as a Read does, without
+// holding a thread, and a deadline set with SetReadDeadline ends it
+// with ErrTimeout.  Other ports return ErrUnsupported.
+func (p *Port) WaitReadable(ctx context.Context) error {
+	w, ok := p.d.(readWaiter)
+	if !ok {
+		return ErrUnsupported
+	}
+	if p.Buffered() > 0 {
+		return nil
+	}
+	return w.waitReadable(ctx)
+}
@@ -0,0 +1,104 @@
+package goserial
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// A PortEvent reports a serial port that appeared or went away.
+type PortEvent struct {
+	// Port is the port as EnumeratePorts described it; for one that
+	// went away, as it was when last seen.
+	Port    PortInfo
+	Removed bool
+}
+
+// watchPoll is how often Watch lists the ports where there is nothing
+// to tell it of changes, and watchRecheck how often it does anyway
+// where there is.
+const (
+	watchPoll    = time.Second
+	watchRecheck = 10 * time.Second
+)
+
+// Watch reports serial ports as they are plugged in and unplugged,
+// until ctx is done, when the channel is closed.  The ports already
+// there come first, as added, so that a program can connect to its
+// device whether or not it was plugged in before.
+//
+// On Linux the kernel's uevents for ttys tell Watch when to look; it
+// then lists the ports as ListPorts does.  Elsewhere it lists them
+// every second, so an event may come up to that late, and a device
+// unplugged and plugged back within the second goes unnoticed.
+func Watch(ctx context.Context) (<-chan PortEvent, error) {
+	ports, err := EnumeratePorts()
+	if err != nil {
+		return nil, err
+	}
+	changed := watchTrigger(ctx)
+	interval := watchPoll
+	if changed != nil {
+		interval = watchRecheck
+	}
+
+	ch := make(chan PortEvent)
+	go func() {
+		defer close(ch)
+		seen := make(map[string]PortInfo)
+		events := portChanges(seen, ports)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			for _, e := range events {
+				select {
+				case ch <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			events = nil
+			select {
+			case name := <-changed:
+				// Report a removal straight away, in case the
+				// device is back by the time the ports are
+				// listed.
+				if pi, ok := seen[name]; ok {
+					delete(seen, name)
+					events = append(events, PortEvent{Port: pi, Removed: true})
+				}
+			case <-t.C:
+			case <-ctx.Done():
+				return
+			}
+			if ports, err := EnumeratePorts(); err == nil {
+				events = append(events, portChanges(seen, ports)...)
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// portChanges returns the events that take seen, a map from name to
+// port, to ports, updating seen to match.  Additions come first, in the
+// order of ports, then removals sorted by name.
+func portChanges(seen map[string]PortInfo, ports []PortInfo) []PortEvent {
+	var events []PortEvent
+	now := make(map[string]bool, len(ports))
+	for _, pi := range ports {
+		now[pi.Name] = true
+		if _, ok := seen[pi.Name]; !ok {
+			seen[pi.Name] = pi
+			events = append(events, PortEvent{Port: pi})
+		}
+	}
+	var gone []PortEvent
+	for name, pi := range seen {
+		if !now[name] {
+			delete(seen, name)
+			gone = append(gone, PortEvent{Port: pi, Removed: true})
+		}
+	}
+	sort.Slice(gone, func(i, j int) bool { return gone[i].Port.Name < gone[j].Port.Name })
+	return append(events, gone...)
+}
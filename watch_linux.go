@@ -0,0 +1,87 @@
+// +build linux
+
+package goserial
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"syscall"
+)
+
+// watchTrigger listens to the kernel's uevents and sends on the channel
+// whenever a tty is added or removed: the name of the device for a
+// removal, "" for an addition.  Without a netlink socket, as in some
+// sandboxes, it returns nil and Watch polls.
+func watchTrigger(ctx context.Context) <-chan string {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK,
+		syscall.NETLINK_KOBJECT_UEVENT)
+	if err != nil {
+		return nil
+	}
+	// Group 1 has the kernel's own events, rather than udev's.
+	if err := syscall.Bind(fd, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK, Groups: 1}); err != nil {
+		syscall.Close(fd)
+		return nil
+	}
+	// The descriptor is non-blocking, so the file goes on the runtime
+	// poller and closing it ends a Read.
+	f := os.NewFile(uintptr(fd), "uevent")
+	go func() {
+		<-ctx.Done()
+		f.Close()
+	}()
+
+	ch := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 8192)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+			if name, ok := ttyUevent(buf[:n]); ok {
+				select {
+				case ch <- name:
+				default:
+					// Watch lists the ports regularly anyway.
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// ttyUevent parses a uevent, "ACTION@DEVPATH" followed by KEY=value
+// fields, each NUL-terminated.  It reports whether it is a tty being
+// added or removed, and for a removal the device's name.
+func ttyUevent(b []byte) (removed string, ok bool) {
+	var action, subsystem, devname string
+	for _, f := range bytes.Split(b, []byte{0}) {
+		kv := bytes.SplitN(f, []byte{'='}, 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch string(kv[0]) {
+		case "ACTION":
+			action = string(kv[1])
+		case "SUBSYSTEM":
+			subsystem = string(kv[1])
+		case "DEVNAME":
+			devname = string(kv[1])
+		}
+	}
+	if subsystem != "tty" {
+		return "", false
+	}
+	switch action {
+	case "add":
+		return "", true
+	case "remove":
+		if devname != "" {
+			return "/dev/" + devname, true
+		}
+		return "", true
+	}
+	return "", false
+}
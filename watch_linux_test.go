@@ -0,0 +1,27 @@
+package goserial
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTTYUevent(t *testing.T) {
+	uevent := func(fields ...string) []byte {
+		return []byte(strings.Join(fields, "\x00") + "\x00")
+	}
+	for _, tc := range []struct {
+		b       []byte
+		removed string
+		ok      bool
+	}{
+		{uevent("add@/devices/pci0000:00/usb1/1-1/1-1:1.0/ttyUSB0/tty/ttyUSB0", "ACTION=add",
+			"DEVPATH=/devices/pci0000:00/usb1/1-1/1-1:1.0/ttyUSB0/tty/ttyUSB0", "SUBSYSTEM=tty", "DEVNAME=ttyUSB0"), "", true},
+		{uevent("remove@/devices/virtual/tty/ttyACM0", "ACTION=remove", "SUBSYSTEM=tty", "DEVNAME=ttyACM0"), "/dev/ttyACM0", true},
+		{uevent("add@/devices/pci0000:00/usb1/1-1", "ACTION=add", "SUBSYSTEM=usb", "DEVNAME=bus/usb/001/002"), "", false},
+		{uevent("change@/devices/virtual/tty/tty1", "ACTION=change", "SUBSYSTEM=tty", "DEVNAME=tty1"), "", false},
+	} {
+		if removed, ok := ttyUevent(tc.b); removed != tc.removed || ok != tc.ok {
+			t.Errorf("%q: %q, %v; want %q, %v", tc.b, removed, ok, tc.removed, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package goserial
+
+import "context"
+
+// watchTrigger has nothing to go on here, so Watch polls.
+func watchTrigger(ctx context.Context) <-chan string {
+	return nil
+}
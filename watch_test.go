@@ -0,0 +1,46 @@
+package goserial
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPortChanges(t *testing.T) {
+	seen := make(map[string]PortInfo)
+	a, b, c := PortInfo{Name: "a"}, PortInfo{Name: "b", IsUSB: true, VID: 0x0403}, PortInfo{Name: "c"}
+	for _, tc := range []struct {
+		ports []PortInfo
+		want  []PortEvent
+	}{
+		{[]PortInfo{a, b}, []PortEvent{{Port: a}, {Port: b}}},
+		{[]PortInfo{a, b}, nil},
+		{[]PortInfo{c}, []PortEvent{{Port: c}, {Port: a, Removed: true}, {Port: b, Removed: true}}},
+		{nil, []PortEvent{{Port: c, Removed: true}}},
+	} {
+		if got := portChanges(seen, tc.ports); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("ports %v: events %v, want %v", tc.ports, got, tc.want)
+		}
+	}
+}
+
+func TestWatchCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := Watch(ctx)
+	if err != nil {
+		t.Skip("cannot list ports:", err)
+	}
+	cancel()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Watch did not close its channel once ctx was done")
+		}
+	}
+}
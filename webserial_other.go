@@ -0,0 +1,9 @@
+// +build !js
+
+package goserial
+
+// RequestPort returns ErrUnsupported: it is only implemented in the
+// browser, on js/wasm.
+func RequestPort() (string, error) {
+	return "", ErrUnsupported
+}
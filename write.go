@@ -0,0 +1,105 @@
+package goserial
+
+import (
+	"fmt"
+	"time"
+)
+
+// A WriteTimeoutError is returned by a Write that timed out while flow
+// control was on, saying what was holding the output up when it did.
+// It unwraps to ErrTimeout; without flow control a timed out Write
+// returns plain ErrTimeout.
+type WriteTimeoutError struct {
+	Flow    FlowControl   // the flow control in force
+	Timeout time.Duration // the write timeout that expired
+
+	CTSLow   bool // CTS was not asserted
+	XOFFHeld bool // output was held by a received XOFF; Windows only
+	Queued   int  // bytes still in the driver's output queue, or -1
+
+	// Err, if not nil, is why the line state could not be read, in
+	// which case CTSLow and XOFFHeld are not known.
+	Err error
+}
+
+func (e *WriteTimeoutError) Error() string {
+	s := fmt.Sprintf("goserial: write timed out with %v flow control: ", e.Flow)
+	switch {
+	case e.Err != nil:
+		s += fmt.Sprintf("line state unknown (%v)", e.Err)
+	case e.CTSLow:
+		s += fmt.Sprintf("CTS low for %v", e.Timeout)
+	case e.XOFFHeld:
+		s += fmt.Sprintf("held by XOFF for %v", e.Timeout)
+	default:
+		s += "output not held"
+	}
+	if e.Queued >= 0 {
+		s += fmt.Sprintf(", %d bytes still queued", e.Queued)
+	}
+	return s
+}
+
+func (e *WriteTimeoutError) Unwrap() error { return ErrTimeout }
+
+// writeTimeoutSetter is implemented by drivers whose writes can time
+// out.
+type writeTimeoutSetter interface {
+	setWriteTimeout(d time.Duration) error
+}
+
+// outputHold is what may be holding a driver's output up.
+type outputHold struct {
+	ctsLow, xoffHeld bool
+	queued           int // -1 if not known
+}
+
+// outputHoldReporter is implemented by drivers that can say why their
+// output is not moving.
+type outputHoldReporter interface {
+	outputHold() (outputHold, error)
+}
+
+// SetWriteTimeout bounds each Write by d, after which it returns the
+// count written with ErrTimeout, or a *WriteTimeoutError if flow control
+// is on.  Zero, the default, lets a Write block until it is done.  POSIX
+// ports opened with PosixTimeouts, and RFC 2217 ports, return
+// ErrUnsupported.  See Config.WriteTimeout.
+func (p *Port) SetWriteTimeout(d time.Duration) error {
+	s, ok := p.d.(writeTimeoutSetter)
+	err := ErrUnsupported
+	if ok {
+		err = s.setWriteTimeout(d)
+	}
+	p.traceControl("write timeout", err, d)
+	if err != nil {
+		return err
+	}
+	p.tl.Lock()
+	p.writeTimeout = d
+	p.tl.Unlock()
+	return nil
+}
+
+// writeTimeoutError returns the error for a Write that timed out: plain
+// ErrTimeout, or with flow control on, a WriteTimeoutError describing
+// the line.
+func (p *Port) writeTimeoutError() error {
+	p.cl.Lock()
+	flow := p.flow
+	p.cl.Unlock()
+	if flow == FlowNone {
+		return ErrTimeout
+	}
+	p.tl.Lock()
+	e := &WriteTimeoutError{Flow: flow, Timeout: p.writeTimeout, Queued: -1}
+	p.tl.Unlock()
+	r, ok := p.d.(outputHoldReporter)
+	if !ok {
+		e.Err = ErrUnsupported
+		return e
+	}
+	h, err := r.outputHold()
+	e.CTSLow, e.XOFFHeld, e.Queued, e.Err = h.ctsLow, h.xoffHeld, h.queued, err
+	return e
+}
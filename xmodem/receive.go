@@ -0,0 +1,223 @@
+package xmodem
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+)
+
+// Receive receives data with XMODEM and writes it to w.  It asks for
+// CRC mode, unless the Checksum option is given, and falls back to
+// checksum mode if the sender does not answer.  XMODEM cannot tell
+// padding from data, so w gets the last block whole, 0x1A bytes and
+// all.
+func Receive(p Port, w io.Writer, opts ...Option) error {
+	c, done, err := begin(p, opts)
+	if err != nil {
+		return err
+	}
+	defer done()
+	return c.receiveData(w, -1, false)
+}
+
+// ReceiveYModem receives one file with YMODEM, writes it to w and
+// returns the name and size the sender gave.  If the sender has no
+// file to send, name is empty.
+func ReceiveYModem(p Port, w io.Writer, opts ...Option) (name string, size int64, err error) {
+	c, done, err := begin(p, opts)
+	if err != nil {
+		return "", 0, err
+	}
+	defer done()
+	c.checksum = false
+
+	hdr, err := c.receiveHeader()
+	if err != nil {
+		return "", 0, err
+	}
+	i := bytes.IndexByte(hdr, 0)
+	if i <= 0 {
+		return "", 0, nil
+	}
+	name = string(hdr[:i])
+	field := hdr[i+1:]
+	if j := bytes.IndexAny(field, " \x00"); j >= 0 {
+		field = field[:j]
+	}
+	size = -1
+	if n, err := strconv.ParseInt(string(field), 10, 64); err == nil {
+		size = n
+	}
+
+	if err := c.receiveData(w, size, true); err != nil {
+		return name, size, err
+	}
+	// The batch ends with an empty header.
+	_, err = c.receiveHeader()
+	return name, size, err
+}
+
+// receiveHeader receives a YMODEM block 0.
+func (c *conn) receiveHeader() ([]byte, error) {
+	for tries := 0; tries < c.retries; {
+		if err := c.write(crc); err != nil {
+			return nil, err
+		}
+		b, ok, err := c.readByte()
+		switch {
+		case err != nil:
+			return nil, err
+		case !ok:
+			tries++
+		case b == can:
+			if err := c.canceled(); err != nil {
+				return nil, err
+			}
+		case b == eot:
+			// The sender missed the ACK of its EOT.
+			if err := c.write(ack); err != nil {
+				return nil, err
+			}
+		case b == soh || b == stx:
+			num, data, good, err := c.readBlock(b, true)
+			switch {
+			case err != nil:
+				return nil, err
+			case !good:
+				tries++
+				if err := c.drain(); err != nil {
+					return nil, err
+				}
+			case num != 0:
+				c.cancel()
+				return nil, ErrSequence
+			default:
+				return data, c.write(ack)
+			}
+		}
+	}
+	c.cancel()
+	return nil, ErrRetries
+}
+
+// receiveData receives data blocks, numbered from 1, until the sender's
+// EOT, writing at most size bytes to w if size is not negative.
+func (c *conn) receiveData(w io.Writer, size int64, ymodem bool) error {
+	useCRC := !c.checksum
+	started, eots := false, 0
+	expected := byte(1)
+	var total int64
+
+	// ask asks for the first block, or for a block to be sent again.
+	ask := func() error {
+		if !started && useCRC {
+			return c.write(crc)
+		}
+		return c.write(nak)
+	}
+	if err := ask(); err != nil {
+		return err
+	}
+
+	for tries := 0; tries < c.retries; {
+		b, ok, err := c.readByte()
+		switch {
+		case err != nil:
+			return err
+		case !ok:
+			tries++
+			if !started && useCRC && !c.checksum && tries >= (c.retries+1)/2 {
+				useCRC = false
+			}
+			if err := ask(); err != nil {
+				return err
+			}
+		case b == can:
+			if err := c.canceled(); err != nil {
+				return err
+			}
+		case b == eot:
+			// A YMODEM receiver makes sure of the end by refusing the
+			// first EOT.
+			if ymodem && eots == 0 {
+				eots++
+				if err := c.write(nak); err != nil {
+					return err
+				}
+				continue
+			}
+			return c.write(ack)
+		case b == soh || b == stx:
+			num, data, good, err := c.readBlock(b, useCRC)
+			if err != nil {
+				return err
+			}
+			if !good {
+				tries++
+				if err := c.drain(); err != nil {
+					return err
+				}
+				if err := c.write(nak); err != nil {
+					return err
+				}
+				continue
+			}
+			started, eots = true, 0
+			switch num {
+			case expected:
+				if size >= 0 && int64(len(data)) > size-total {
+					data = data[:size-total]
+				}
+				if _, err := w.Write(data); err != nil {
+					c.cancel()
+					return err
+				}
+				total += int64(len(data))
+				expected++
+				tries = 0
+				if err := c.write(ack); err != nil {
+					return err
+				}
+				c.report(total)
+			case expected - 1:
+				// Our ACK was lost and the sender repeated the block.
+				if err := c.write(ack); err != nil {
+					return err
+				}
+			default:
+				c.cancel()
+				return ErrSequence
+			}
+		}
+	}
+	c.cancel()
+	return ErrRetries
+}
+
+// readBlock reads the rest of a block whose header byte was hdr.  good
+// is false if it timed out or arrived damaged.
+func (c *conn) readBlock(hdr byte, useCRC bool) (num byte, data []byte, good bool, err error) {
+	n := 128
+	if hdr == stx {
+		n = 1024
+	}
+	check := 1
+	if useCRC {
+		check = 2
+	}
+	buf := make([]byte, 2+n+check)
+	if ok, err := c.readFull(buf); !ok || err != nil {
+		return 0, nil, false, err
+	}
+	num, data = buf[0], buf[2:2+n]
+	if buf[1] != ^num {
+		return 0, nil, false, nil
+	}
+	if useCRC {
+		v := crc16(data)
+		good = buf[2+n] == byte(v>>8) && buf[3+n] == byte(v)
+	} else {
+		good = buf[2+n] == checksum(data)
+	}
+	return num, data, good, nil
+}
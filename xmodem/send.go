@@ -0,0 +1,209 @@
+package xmodem
+
+import (
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Send sends the data read from r with XMODEM once the receiver asks
+// for it.  The receiver's first request decides between CRC and
+// checksum mode.  The last block is padded with 0x1A bytes, so the
+// receiver gets the data rounded up to a whole block.
+func Send(p Port, r io.Reader, opts ...Option) error {
+	c, done, err := begin(p, opts)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	useCRC, err := c.waitStart()
+	if err != nil {
+		return err
+	}
+	size := 128
+	if useCRC && c.block1K {
+		size = 1024
+	}
+	if err := c.sendData(r, size, useCRC); err != nil {
+		return err
+	}
+	return c.sendEOT()
+}
+
+// SendYModem sends one file with YMODEM: a header block giving name
+// and size, the data in 1024 byte blocks, and the empty header that
+// ends the batch.  The receiver cuts the padding off using the size.
+func SendYModem(p Port, name string, size int64, r io.Reader, opts ...Option) error {
+	c, done, err := begin(p, opts)
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	hdr := append([]byte(name), 0)
+	hdr = append(hdr, strconv.FormatInt(size, 10)...)
+	hdr = append(hdr, 0)
+	if len(hdr) <= 128 {
+		hdr = append(hdr, make([]byte, 128-len(hdr))...)
+	} else if len(hdr) <= 1024 {
+		hdr = append(hdr, make([]byte, 1024-len(hdr))...)
+	} else {
+		return errors.New("xmodem: file name too long for a YMODEM header")
+	}
+
+	useCRC, err := c.waitStart()
+	if err != nil {
+		return err
+	}
+	if err := c.sendBlock(0, hdr, useCRC); err != nil {
+		return err
+	}
+	if useCRC, err = c.waitStart(); err != nil {
+		return err
+	}
+	if err := c.sendData(r, 1024, useCRC); err != nil {
+		return err
+	}
+	if err := c.sendEOT(); err != nil {
+		return err
+	}
+	if useCRC, err = c.waitStart(); err != nil {
+		return err
+	}
+	return c.sendBlock(0, make([]byte, 128), useCRC)
+}
+
+// waitStart waits for the receiver to ask for data, returning whether
+// it wants CRC mode.
+func (c *conn) waitStart() (useCRC bool, err error) {
+	for tries := 0; tries < c.retries; {
+		b, ok, err := c.readByte()
+		switch {
+		case err != nil:
+			return false, err
+		case !ok:
+			tries++
+		case b == crc:
+			return true, nil
+		case b == nak:
+			return false, nil
+		case b == can:
+			if err := c.canceled(); err != nil {
+				return false, err
+			}
+		}
+	}
+	return false, ErrRetries
+}
+
+// canceled checks whether the CAN just read is followed by another, as
+// a real cancel is.
+func (c *conn) canceled() error {
+	b, ok, err := c.readByte()
+	switch {
+	case err != nil:
+		return err
+	case ok && b == can:
+		return ErrCanceled
+	}
+	return nil
+}
+
+// sendData sends the data from r in blocks of size bytes, numbered from
+// 1.  A short last block of a 1K transfer goes as a 128 byte block if
+// it fits.
+func (c *conn) sendData(r io.Reader, size int, useCRC bool) error {
+	buf := make([]byte, size)
+	var total int64
+	for num := byte(1); ; num++ {
+		n, err := io.ReadFull(r, buf)
+		switch {
+		case err == io.EOF:
+			return nil
+		case err != nil && err != io.ErrUnexpectedEOF:
+			c.cancel()
+			return err
+		}
+		block := buf
+		if n < len(block) {
+			if n <= 128 {
+				block = buf[:128]
+			}
+			for i := n; i < len(block); i++ {
+				block[i] = sub
+			}
+		}
+		if err := c.sendBlock(num, block, useCRC); err != nil {
+			return err
+		}
+		total += int64(n)
+		c.report(total)
+		if n < size {
+			return nil
+		}
+	}
+}
+
+// sendBlock sends one block until the receiver acknowledges it.
+func (c *conn) sendBlock(num byte, data []byte, useCRC bool) error {
+	hdr := byte(soh)
+	if len(data) == 1024 {
+		hdr = stx
+	}
+	pkt := append([]byte{hdr, num, ^num}, data...)
+	if useCRC {
+		v := crc16(data)
+		pkt = append(pkt, byte(v>>8), byte(v))
+	} else {
+		pkt = append(pkt, checksum(data))
+	}
+
+	for tries := 0; tries < c.retries; tries++ {
+		if _, err := c.p.Write(pkt); err != nil {
+			return err
+		}
+		if acked, err := c.waitAck(); acked || err != nil {
+			return err
+		}
+	}
+	c.cancel()
+	return ErrRetries
+}
+
+// sendEOT ends the data until the receiver acknowledges it.  A YMODEM
+// receiver refuses the first EOT.
+func (c *conn) sendEOT() error {
+	for tries := 0; tries < c.retries; tries++ {
+		if err := c.write(eot); err != nil {
+			return err
+		}
+		if acked, err := c.waitAck(); acked || err != nil {
+			return err
+		}
+	}
+	return ErrRetries
+}
+
+// waitAck reads the receiver's answer to a block: acked is true for an
+// ACK and false for a NAK or timeout, after which the block is sent
+// again.
+func (c *conn) waitAck() (acked bool, err error) {
+	for {
+		b, ok, err := c.readByte()
+		switch {
+		case err != nil:
+			return false, err
+		case !ok:
+			return false, nil
+		case b == ack:
+			return true, nil
+		case b == nak:
+			return false, nil
+		case b == can:
+			if err := c.canceled(); err != nil {
+				return false, err
+			}
+		}
+	}
+}
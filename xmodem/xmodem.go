@@ -0,0 +1,202 @@
+// Package xmodem transfers files over a serial port with the XMODEM
+// protocol, in its checksum, CRC and 1K variants, and with YMODEM.
+//
+// Both ends work through the port's read timeout, so any port whose
+// Read returns an error with a Timeout method once the timeout set by
+// SetReadTimeout passes will do; *serial.Port, serial.Pipe and the
+// serialtest ports all qualify.
+package xmodem
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	soh = 0x01 // start of a 128 byte block
+	stx = 0x02 // start of a 1024 byte block
+	eot = 0x04
+	ack = 0x06
+	nak = 0x15
+	can = 0x18
+	crc = 'C' // asks the sender for CRC mode
+	sub = 0x1a
+)
+
+var (
+	// ErrCanceled is returned when the other end cancels the transfer.
+	ErrCanceled = errors.New("xmodem: transfer canceled by remote")
+	// ErrRetries is returned when a block could not be transferred
+	// within the allowed number of retries.
+	ErrRetries = errors.New("xmodem: too many retries")
+	// ErrSequence is returned by the receiver when a block arrives out
+	// of order; the transfer is canceled.
+	ErrSequence = errors.New("xmodem: block out of sequence")
+)
+
+// Port is what a transfer needs from a serial port.
+type Port interface {
+	io.ReadWriter
+	SetReadTimeout(d time.Duration) error
+}
+
+// An Option changes how a transfer is done.
+type Option func(*options)
+
+type options struct {
+	checksum bool
+	block1K  bool
+	retries  int
+	timeout  time.Duration
+	progress func(n int64)
+}
+
+// Checksum makes the receiver ask for the original 8-bit checksum mode
+// instead of CRC-16.  The sender always follows the receiver.
+func Checksum() Option {
+	return func(o *options) { o.checksum = true }
+}
+
+// Block1K makes the sender use 1024 byte blocks (XMODEM-1K) when the
+// receiver asked for CRC mode.  YMODEM always does.
+func Block1K() Option {
+	return func(o *options) { o.block1K = true }
+}
+
+// Retries sets how many times a block is tried before the transfer is
+// given up.  The default is 10.
+func Retries(n int) Option {
+	return func(o *options) { o.retries = n }
+}
+
+// Timeout sets how long to wait for each response or block.  The
+// default is 10 seconds.
+func Timeout(d time.Duration) Option {
+	return func(o *options) { o.timeout = d }
+}
+
+// Progress sets a function called with the number of bytes transferred
+// so far each time a block has been acknowledged.
+func Progress(f func(n int64)) Option {
+	return func(o *options) { o.progress = f }
+}
+
+func getOptions(opts []Option) *options {
+	o := &options{retries: 10, timeout: 10 * time.Second}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// conn is one end of a transfer.
+type conn struct {
+	p Port
+	*options
+	buf [1]byte
+}
+
+// begin sets up p for a transfer and returns a function that puts its
+// read timeout back, if the port can say what it was.
+func begin(p Port, opts []Option) (*conn, func(), error) {
+	c := &conn{p: p, options: getOptions(opts)}
+	done := func() {}
+	if t, ok := p.(interface{ ReadTimeout() time.Duration }); ok {
+		old := t.ReadTimeout()
+		done = func() { p.SetReadTimeout(old) }
+	}
+	if err := p.SetReadTimeout(c.timeout); err != nil {
+		return nil, nil, err
+	}
+	return c, done, nil
+}
+
+func isTimeout(err error) bool {
+	t, ok := err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
+
+// readByte reads one byte, returning ok false on a timeout.
+func (c *conn) readByte() (b byte, ok bool, err error) {
+	for {
+		n, err := c.p.Read(c.buf[:])
+		switch {
+		case n == 1:
+			return c.buf[0], true, nil
+		case isTimeout(err):
+			return 0, false, nil
+		case err != nil:
+			return 0, false, err
+		}
+	}
+}
+
+// readFull fills b, returning ok false on a timeout.
+func (c *conn) readFull(b []byte) (ok bool, err error) {
+	for len(b) > 0 {
+		n, err := c.p.Read(b)
+		b = b[n:]
+		switch {
+		case len(b) == 0:
+		case isTimeout(err):
+			return false, nil
+		case err != nil:
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (c *conn) write(b ...byte) error {
+	_, err := c.p.Write(b)
+	return err
+}
+
+// cancel tells the other end to give up.
+func (c *conn) cancel() {
+	c.write(can, can, can)
+}
+
+// drain discards input until the line has been quiet for a moment,
+// so that the rest of a bad block is not taken for a new one.
+func (c *conn) drain() error {
+	c.p.SetReadTimeout(100 * time.Millisecond)
+	defer c.p.SetReadTimeout(c.timeout)
+	for {
+		_, ok, err := c.readByte()
+		if !ok || err != nil {
+			return err
+		}
+	}
+}
+
+func (c *conn) report(n int64) {
+	if c.progress != nil {
+		c.progress(n)
+	}
+}
+
+// crc16 is the CRC-16/XMODEM of b.
+func crc16(b []byte) uint16 {
+	var v uint16
+	for _, c := range b {
+		v ^= uint16(c) << 8
+		for i := 0; i < 8; i++ {
+			if v&0x8000 != 0 {
+				v = v<<1 ^ 0x1021
+			} else {
+				v <<= 1
+			}
+		}
+	}
+	return v
+}
+
+func checksum(b []byte) byte {
+	var v byte
+	for _, c := range b {
+		v += c
+	}
+	return v
+}
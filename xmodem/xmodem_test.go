@@ -0,0 +1,211 @@
+package xmodem
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	serial "github.com/tarm/goserial"
+)
+
+func testData(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+func TestSendReceive(t *testing.T) {
+	data := testData(3000)
+	for _, tc := range []struct {
+		name       string
+		send, recv []Option
+		block      int
+	}{
+		{"crc", nil, nil, 128},
+		{"checksum", nil, []Option{Checksum()}, 128},
+		{"1k", []Option{Block1K()}, nil, 1024},
+	} {
+		a, b := serial.Pipe()
+		sent := make(chan error, 1)
+		go func() {
+			sent <- Send(a, bytes.NewReader(data), append(tc.send, Timeout(time.Second))...)
+		}()
+		var got bytes.Buffer
+		var progress int64
+		err := Receive(b, &got, append(tc.recv, Timeout(time.Second), Progress(func(n int64) { progress = n }))...)
+		if err != nil {
+			t.Errorf("%s: Receive: %v", tc.name, err)
+		}
+		if err := <-sent; err != nil {
+			t.Errorf("%s: Send: %v", tc.name, err)
+		}
+		a.Close()
+		b.Close()
+
+		// The last block is 3000 % block bytes of data, rounded up to
+		// 128 and padded with SUB.
+		want := append([]byte(nil), data...)
+		for len(want)%128 != 0 {
+			want = append(want, sub)
+		}
+		if !bytes.Equal(got.Bytes(), want) {
+			t.Errorf("%s: received %d bytes, want %d", tc.name, got.Len(), len(want))
+		}
+		if progress != int64(len(want)) {
+			t.Errorf("%s: progress reported %d bytes, want %d", tc.name, progress, len(want))
+		}
+	}
+}
+
+func TestYModem(t *testing.T) {
+	data := testData(2500)
+	a, b := serial.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- SendYModem(a, "fw.bin", int64(len(data)), bytes.NewReader(data), Timeout(time.Second))
+	}()
+	var got bytes.Buffer
+	name, size, err := ReceiveYModem(b, &got, Timeout(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if name != "fw.bin" || size != int64(len(data)) || !bytes.Equal(got.Bytes(), data) {
+		t.Errorf("got %q, %d bytes of %d", name, got.Len(), size)
+	}
+}
+
+// block builds a CRC mode 128 byte block.
+func block(num byte, fill byte) []byte {
+	data := bytes.Repeat([]byte{fill}, 128)
+	v := crc16(data)
+	return append(append([]byte{soh, num, ^num}, data...), byte(v>>8), byte(v))
+}
+
+// expect reads one byte from p and checks it.
+func expect(t *testing.T, p io.Reader, want byte) {
+	t.Helper()
+	b := make([]byte, 1)
+	if _, err := p.Read(b); err != nil || b[0] != want {
+		t.Fatalf("read %#x, %v; want %#x", b[0], err, want)
+	}
+}
+
+func TestReceiveRepeatedBlock(t *testing.T) {
+	a, b := serial.Pipe()
+	defer a.Close()
+	b.SetReadTimeout(time.Second)
+
+	var got bytes.Buffer
+	received := make(chan error, 1)
+	go func() { received <- Receive(a, &got, Timeout(time.Second)) }()
+
+	expect(t, b, crc)
+	b.Write(block(1, 'a'))
+	expect(t, b, ack)
+	b.Write(block(1, 'a')) // as if the ACK had been lost
+	expect(t, b, ack)
+	bad := block(2, 'b')
+	bad[10] ^= 0xff
+	b.Write(bad)
+	expect(t, b, nak)
+	b.Write(block(2, 'b'))
+	expect(t, b, ack)
+	b.Write([]byte{eot})
+	expect(t, b, ack)
+
+	if err := <-received; err != nil {
+		t.Fatal(err)
+	}
+	want := string(bytes.Repeat([]byte{'a'}, 128)) + string(bytes.Repeat([]byte{'b'}, 128))
+	if got.String() != want {
+		t.Errorf("received %q", got.String())
+	}
+}
+
+func TestReceiveOutOfSequence(t *testing.T) {
+	a, b := serial.Pipe()
+	defer a.Close()
+	b.SetReadTimeout(time.Second)
+
+	received := make(chan error, 1)
+	go func() { received <- Receive(a, io.Discard, Timeout(time.Second)) }()
+	expect(t, b, crc)
+	b.Write(block(3, 'a'))
+	expect(t, b, can)
+	if err := <-received; err != ErrSequence {
+		t.Errorf("got %v, want ErrSequence", err)
+	}
+}
+
+func TestSendCanceled(t *testing.T) {
+	a, b := serial.Pipe()
+	defer a.Close()
+	b.SetReadTimeout(time.Second)
+
+	sent := make(chan error, 1)
+	go func() { sent <- Send(a, bytes.NewReader(testData(1000)), Timeout(time.Second)) }()
+	b.Write([]byte{crc})
+	if _, err := io.ReadFull(b, make([]byte, 133)); err != nil {
+		t.Fatal(err)
+	}
+	b.Write([]byte{can, can})
+	if err := <-sent; err != ErrCanceled {
+		t.Errorf("got %v, want ErrCanceled", err)
+	}
+}
+
+func TestSendRetries(t *testing.T) {
+	a, b := serial.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	sent := make(chan error, 1)
+	go func() {
+		sent <- Send(a, bytes.NewReader(testData(100)), Timeout(20*time.Millisecond), Retries(3))
+	}()
+	b.Write([]byte{nak})
+	select {
+	case err := <-sent:
+		if err != ErrRetries {
+			t.Errorf("got %v, want ErrRetries", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Send did not give up")
+	}
+}
+
+func TestReceiveFallsBackToChecksum(t *testing.T) {
+	a, b := serial.Pipe()
+	defer a.Close()
+	b.SetReadTimeout(time.Second)
+
+	var got bytes.Buffer
+	received := make(chan error, 1)
+	go func() { received <- Receive(a, &got, Timeout(20*time.Millisecond), Retries(4)) }()
+
+	// A sender that only knows checksum mode ignores the 'C's until
+	// the receiver gives up on CRC, after half its retries, and sends NAK.
+	for _, want := range []byte{crc, crc, nak} {
+		expect(t, b, want)
+	}
+	data := bytes.Repeat([]byte{'z'}, 128)
+	b.Write(append(append([]byte{soh, 1, 0xfe}, data...), checksum(data)))
+	expect(t, b, ack)
+	b.Write([]byte{eot})
+	expect(t, b, ack)
+
+	if err := <-received; err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got.Bytes(), data) {
+		t.Errorf("received %q", got.Bytes())
+	}
+}